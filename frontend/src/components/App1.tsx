@@ -17,6 +17,8 @@ function App() {
     register,
     reset,
     sendMessage,
+    setReadReceipts,
+    setConversationTimer,
     connect,
     disconnect,
   } = useMessagingClient();
@@ -78,7 +80,20 @@ function App() {
     }
   };
 
+  const handleReadReceipts = (on: boolean) => {
+    void setReadReceipts(on).catch((err) =>
+      setError(err instanceof Error ? err.message : String(err))
+    );
+  };
+
+  const handleTimer = (seconds: number) => {
+    void setConversationTimer(sendForm.convId, seconds).catch((err) =>
+      setError(err instanceof Error ? err.message : String(err))
+    );
+  };
+
   const canSend = Boolean(state && ready && info);
+  const convTimer = info?.timers[sendForm.convId.trim()] ?? 0;
 
   return (
     <div className="app">
@@ -182,6 +197,15 @@ function App() {
                   <dd>{info.messagesUrl}</dd>
                 </div>
               </dl>
+              <label className="checkbox">
+                <input
+                  type="checkbox"
+                  checked={info.readReceipts}
+                  onChange={(evt) => handleReadReceipts(evt.target.checked)}
+                  disabled={!ready}
+                />
+                Send read receipts
+              </label>
             </div>
           )}
         </section>
@@ -215,6 +239,20 @@ function App() {
                 disabled={!canSend}
               />
             </label>
+            <label>
+              Disappearing messages
+              <select
+                value={convTimer}
+                onChange={(evt) => handleTimer(Number(evt.target.value))}
+                disabled={!canSend || !sendForm.convId.trim()}
+              >
+                {timerOptions.map((option) => (
+                  <option key={option.seconds} value={option.seconds}>
+                    {option.label}
+                  </option>
+                ))}
+              </select>
+            </label>
             <label>
               Recipient device ID
               <input
@@ -265,6 +303,7 @@ function App() {
                   <th>Conversation</th>
                   <th>From</th>
                   <th>Message</th>
+                  <th>Status</th>
                 </tr>
               </thead>
               <tbody>
@@ -285,13 +324,32 @@ function App() {
   );
 }
 
+const timerOptions = [
+  { seconds: 0, label: "Off" },
+  { seconds: 30, label: "30 seconds" },
+  { seconds: 5 * 60, label: "5 minutes" },
+  { seconds: 60 * 60, label: "1 hour" },
+  { seconds: 24 * 60 * 60, label: "1 day" },
+  { seconds: 7 * 24 * 60 * 60, label: "1 week" },
+];
+
 function MessageRow({ record }: { record: MessageRecord }) {
   return (
     <tr>
       <td>{new Date(record.sentAt).toLocaleString()}</td>
       <td>{record.convId}</td>
       <td>{record.fromDeviceId}</td>
-      <td className="message-text">{record.plaintext}</td>
+      <td className="message-text">
+        {record.replyTo?.body && <blockquote>{record.replyTo.body}</blockquote>}
+        {record.notice ? <em>{record.notice}</em> : record.plaintext}
+        {record.expiresAt && (
+          <small className="muted">
+            {" "}
+            (disappears {new Date(record.expiresAt).toLocaleTimeString()})
+          </small>
+        )}
+      </td>
+      <td className="muted">{record.outgoing ? record.status : ""}</td>
     </tr>
   );
 }
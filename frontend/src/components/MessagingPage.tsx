@@ -5,10 +5,12 @@ import {
   InboundMessage,
   MessagingClient,
   OutboundMessage,
+  type MessageStatus,
+  type Receipt,
 } from "../lib/messagingClient";
 import { getItem, setItem } from "../lib/storage";
 import { SecureStore } from "../lib/secureStore";
-import { migrateLegacyMessages } from "../lib/messageStorage";
+import { migrateLegacyMessages, statusAdvances } from "../lib/messageStorage";
 import { PinModal } from "./PinModal";
 import { getKeyManager } from "../lib/keyManagerInstance";
 import { ActivityTracker } from "../lib/activityTracker";
@@ -27,6 +29,25 @@ const CONTACTS_KEY = "secumsg-contacts";
 
 const defaultConvId = () => crypto.randomUUID();
 
+const statusLabels: Record<MessageStatus, string> = {
+  sent: "Sent",
+  delivered: "Delivered",
+  read: "Read",
+};
+
+// Disappearing-message timers offered per conversation, in seconds.
+const timerOptions: { seconds: number; label: string }[] = [
+  { seconds: 0, label: "Off" },
+  { seconds: 30, label: "30 seconds" },
+  { seconds: 5 * 60, label: "5 minutes" },
+  { seconds: 60 * 60, label: "1 hour" },
+  { seconds: 24 * 60 * 60, label: "1 day" },
+  { seconds: 7 * 24 * 60 * 60, label: "1 week" },
+];
+
+// Received messages not yet reported as read, per conversation and sender.
+type UnreadEntry = { convId: string; toDeviceId: string; ids: string[] };
+
 export const MessagingPage: React.FC = () => {
   const [client, setClient] = useState<MessagingClient | null>(null);
   const [lockState, setLockState] = useState<"checking" | "locked" | "unlocked">(
@@ -61,8 +82,39 @@ export const MessagingPage: React.FC = () => {
   const [serverConversationIds, setServerConversationIds] = useState<string[]>(
     []
   );
+  const [readReceipts, setReadReceipts] = useState(true);
+  const [timers, setTimers] = useState<Record<string, number>>({});
+  const unreadRef = useRef(new Map<string, UnreadEntry>());
+  const flushReadRef = useRef<() => Promise<void>>(async () => {});
   const navigate = useNavigate();
 
+  // queueRead remembers received messages so a read receipt can be sent once
+  // they are on screen.
+  const queueRead = useCallback((msg: InboundMessage) => {
+    if (!msg.id) return;
+    const key = `${msg.convId}/${msg.peerDeviceId}`;
+    const entry = unreadRef.current.get(key) ?? {
+      convId: msg.convId,
+      toDeviceId: msg.peerDeviceId,
+      ids: [],
+    };
+    entry.ids.push(msg.id);
+    unreadRef.current.set(key, entry);
+  }, []);
+
+  const applyReceipt = useCallback((receipt: Receipt) => {
+    setMessages((prev) =>
+      prev.map((m) =>
+        m.direction === "outbound" &&
+        ((m.id && receipt.messageIds.includes(m.id)) ||
+          (m.serverId && receipt.messageIds.includes(m.serverId))) &&
+        statusAdvances(m.status, receipt.status)
+          ? { ...m, status: receipt.status }
+          : m
+      )
+    );
+  }, []);
+
   const handleLock = useCallback(() => {
     setLockState("locked");
     setClient(null);
@@ -157,7 +209,7 @@ export const MessagingPage: React.FC = () => {
       return;
     }
     let cancelled = false;
-    let socket: WebSocket | null = null;
+    let listening: MessagingClient | null = null;
     (async () => {
       const userId = await getItem("userId");
       if (!userId) {
@@ -177,9 +229,12 @@ export const MessagingPage: React.FC = () => {
         return;
       }
       setClient(loaded);
+      setReadReceipts(loaded.readReceipts());
+      setTimers(loaded.timers());
 
       try {
-        socket = await loaded.connectWebSocket(
+        listening = loaded;
+        await loaded.connectWebSocket(
           (msg) => {
             setMessages((prev) => [...prev, msg]);
             setContacts((prev) => {
@@ -217,13 +272,17 @@ export const MessagingPage: React.FC = () => {
             });
             resolveUsernameForDevice(msg.peerDeviceId, msg.convId);
             setSelectedConvId((prev) => prev ?? msg.convId);
+            queueRead(msg);
+            void flushReadRef.current();
           },
           (state) => {
             if (state === "open") setWsStatus("Listening for incoming messages");
             if (state === "closed") setWsStatus("Connection closed");
+            if (state === "reconnecting") setWsStatus("Server restarting – reconnecting…");
             if (state === "error")
               setWsStatus("Connection error – retry or refresh");
-          }
+          },
+          applyReceipt
         );
       } catch (err) {
         console.error("Failed to open websocket", err);
@@ -233,9 +292,9 @@ export const MessagingPage: React.FC = () => {
 
     return () => {
       cancelled = true;
-      socket?.close();
+      listening?.disconnectWebSocket();
     };
-  }, [lockState, navigate, resolveUsernameForDevice]);
+  }, [applyReceipt, lockState, navigate, queueRead, resolveUsernameForDevice]);
 
   useEffect(() => {
     if (!unlockWaitSeconds || unlockWaitSeconds <= 0) {
@@ -392,11 +451,75 @@ export const MessagingPage: React.FC = () => {
       });
 
       setMessages((prev) => [...prev, ...fetched]);
+      for (const msg of fetched) {
+        if (msg.direction === "inbound") queueRead(msg);
+      }
+      void flushReadRef.current();
       return fetched;
     },
-    [client]
+    [client, queueRead]
   );
 
+  // Read receipts go out once the conversation is open in a visible tab.
+  const flushReadReceipts = useCallback(async () => {
+    if (!client || !selectedConvId || document.visibilityState !== "visible") {
+      return;
+    }
+    for (const [key, entry] of [...unreadRef.current]) {
+      if (entry.convId !== selectedConvId) continue;
+      unreadRef.current.delete(key);
+      try {
+        await client.sendReadReceipt(entry.convId, entry.toDeviceId, entry.ids);
+      } catch (err) {
+        console.error("Failed to send read receipt", err);
+      }
+    }
+  }, [client, selectedConvId]);
+
+  useEffect(() => {
+    flushReadRef.current = flushReadReceipts;
+    void flushReadReceipts();
+    const onVisible = () => void flushReadReceipts();
+    document.addEventListener("visibilitychange", onVisible);
+    return () => document.removeEventListener("visibilitychange", onVisible);
+  }, [flushReadReceipts]);
+
+  // Disappearing messages leave the list once they expire, matching the
+  // server, which deletes them at the same time.
+  useEffect(() => {
+    const timer = window.setInterval(() => {
+      const now = Date.now();
+      setMessages((prev) => {
+        const kept = prev.filter(
+          (m) => !m.expiresAt || m.expiresAt.getTime() > now
+        );
+        return kept.length === prev.length ? prev : kept;
+      });
+    }, 1000);
+    return () => window.clearInterval(timer);
+  }, []);
+
+  const handleTimer = async (convId: string, seconds: number) => {
+    if (!client) return;
+    try {
+      await client.setTimer(convId, seconds);
+      setTimers(client.timers());
+    } catch (err) {
+      console.error("Failed to set disappearing-message timer", err);
+    }
+  };
+
+  const handleReadReceipts = async (on: boolean) => {
+    if (!client) return;
+    setReadReceipts(on);
+    try {
+      await client.setReadReceipts(on);
+    } catch (err) {
+      console.error("Failed to save read receipt setting", err);
+      setReadReceipts(!on);
+    }
+  };
+
   useEffect(() => {
     if (!client || !activeContact) return;
     if (!localHistoryLoaded) return; // wait until local history is available to compute "last"
@@ -522,6 +645,24 @@ export const MessagingPage: React.FC = () => {
     );
   };
 
+  const handleResetSession = async () => {
+    if (!client || !activeContact) return;
+    const ok = window.confirm(
+      "Reset the secure session with this contact? Use this when their messages no longer decrypt."
+    );
+    if (!ok) return;
+    try {
+      const notice = await client.resetSession(
+        activeContact.convId,
+        activeContact.deviceId
+      );
+      setMessages((prev) => [...prev, notice]);
+    } catch (err) {
+      console.error("Failed to reset session", err);
+      setWsStatus("Session reset failed – please try again.");
+    }
+  };
+
   const handleSend = async (e: React.FormEvent) => {
     e.preventDefault();
     await sendMessage();
@@ -593,6 +734,16 @@ export const MessagingPage: React.FC = () => {
             {header || "Preparing device..."}
           </p>
           <p className="text-xs text-slate-500">{wsStatus}</p>
+          {client && (
+            <label className="flex items-center gap-2 text-xs text-slate-400">
+              <input
+                type="checkbox"
+                checked={readReceipts}
+                onChange={(e) => handleReadReceipts(e.target.checked)}
+              />
+              Send read receipts
+            </label>
+          )}
         </div>
 
         <div className="grid grid-cols-1 lg:grid-cols-4 gap-4">
@@ -643,7 +794,7 @@ export const MessagingPage: React.FC = () => {
                     {lastMsg && (
                       <p className="text-xs text-slate-500 mt-1 truncate">
                         {lastMsg.direction === "inbound" ? "Them: " : "You: "}
-                        {lastMsg.plaintext}
+                        {displayText(lastMsg)}
                       </p>
                     )}
                   </button>
@@ -670,13 +821,38 @@ export const MessagingPage: React.FC = () => {
                       </p>
                     )}
                   </div>
-                  <button
-                    type="button"
-                    onClick={handleRenameContact}
-                    className="text-xs px-3 py-1 rounded-full border border-slate-700 text-slate-200 hover:border-sky-500 hover:text-sky-300"
-                  >
-                    Rename
-                  </button>
+                  <div className="flex items-center gap-2">
+                    <label className="text-xs text-slate-400 flex items-center gap-1">
+                      Disappearing
+                      <select
+                        className="rounded-full bg-slate-900 border border-slate-700 px-2 py-1 text-xs text-slate-200"
+                        value={timers[activeContact.convId] ?? 0}
+                        onChange={(e) =>
+                          handleTimer(activeContact.convId, Number(e.target.value))
+                        }
+                      >
+                        {timerOptions.map((option) => (
+                          <option key={option.seconds} value={option.seconds}>
+                            {option.label}
+                          </option>
+                        ))}
+                      </select>
+                    </label>
+                    <button
+                      type="button"
+                      onClick={handleResetSession}
+                      className="text-xs px-3 py-1 rounded-full border border-slate-700 text-slate-200 hover:border-amber-500 hover:text-amber-300"
+                    >
+                      Reset session
+                    </button>
+                    <button
+                      type="button"
+                      onClick={handleRenameContact}
+                      className="text-xs px-3 py-1 rounded-full border border-slate-700 text-slate-200 hover:border-sky-500 hover:text-sky-300"
+                    >
+                      Rename
+                    </button>
+                  </div>
                 </div>
 
                 <div className="flex-1 overflow-y-auto px-6 py-4 space-y-3 custom-scroll">
@@ -698,10 +874,20 @@ export const MessagingPage: React.FC = () => {
                         <span>
                           {msg.direction === "inbound" ? "Incoming" : "You"}
                         </span>
-                        <span>{msg.sentAt.toLocaleTimeString()}</span>
+                        <span>
+                          {msg.sentAt.toLocaleTimeString()}
+                          {msg.direction === "outbound" &&
+                            ` · ${statusLabels[msg.status ?? "sent"]}`}
+                          {msg.expiresAt &&
+                            ` · disappears ${msg.expiresAt.toLocaleTimeString()}`}
+                        </span>
                       </div>
-                      <p className="whitespace-pre-wrap break-words text-slate-100">
-                        {msg.plaintext}
+                      <p
+                        className={`whitespace-pre-wrap break-words ${
+                          isNotice(msg) ? "italic text-slate-400" : "text-slate-100"
+                        }`}
+                      >
+                        {displayText(msg)}
                       </p>
                     </div>
                   ))}
@@ -825,6 +1011,16 @@ export const MessagingPage: React.FC = () => {
   );
 };
 
+// Notices, such as a session reset or a message from a newer client, stand
+// in for the text.
+function isNotice(msg: InboundMessage | OutboundMessage): boolean {
+  return msg.direction === "inbound" && !!msg.notice;
+}
+
+function displayText(msg: InboundMessage | OutboundMessage): string {
+  return msg.direction === "inbound" && msg.notice ? msg.notice : msg.plaintext;
+}
+
 async function ensureUnlocked(manager: KeyManager): Promise<void> {
   if (!(await manager.hasWrappedKey())) {
     const setupPin = window.prompt("Set a 4-digit PIN to secure this device.");
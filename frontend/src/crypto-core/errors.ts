@@ -3,3 +3,4 @@ export const ErrMissingOneTimeKey = new Error("cryptocore: missing one-time prek
 export const ErrInvalidRemoteKey = new Error("cryptocore: invalid remote ratchet key");
 export const ErrDuplicateMessage = new Error("cryptocore: duplicate message");
 export const ErrDecryptionFailed = new Error("cryptocore: message authentication failed");
+export const ErrInvalidPadding = new Error("cryptocore: invalid padding");
@@ -1,6 +1,7 @@
 export * from "./core";
 export * from "./errors";
 export * from "./keyManager";
+export * from "./padding";
 export * from "./session";
 export * from "./ratchet";
 export * from "./state";
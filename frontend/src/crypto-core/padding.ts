@@ -0,0 +1,72 @@
+import { ErrInvalidPadding } from "./errors";
+
+// PaddingScheme selects how Pad rounds up a plaintext before encryption, so
+// ciphertext lengths reveal less about message lengths. The names match the
+// Go crypto-core's.
+export type PaddingScheme = "none" | "buckets" | "padme";
+
+// paddingMarker ends the message inside a padded plaintext; only zero bytes
+// follow it (ISO/IEC 7816-4).
+const paddingMarker = 0x80;
+
+const paddingBuckets = [128, 256, 512, 1024, 2048, 4096];
+
+// Pad appends the end marker and zero bytes up to the length scheme picks.
+// Unpad reverses it without knowing the scheme.
+export function Pad(plaintext: Uint8Array, scheme: PaddingScheme): Uint8Array {
+  const n = plaintext.length + 1;
+  let size: number;
+  switch (scheme) {
+    case "none":
+      size = n;
+      break;
+    case "buckets":
+      size = bucketLength(n);
+      break;
+    case "padme":
+      size = padmeLength(n);
+      break;
+    default:
+      throw new Error(`cryptocore: unknown padding scheme ${scheme as string}`);
+  }
+  const out = new Uint8Array(size);
+  out.set(plaintext);
+  out[plaintext.length] = paddingMarker;
+  return out;
+}
+
+// Unpad strips the padding added by Pad.
+export function Unpad(padded: Uint8Array): Uint8Array {
+  for (let i = padded.length - 1; i >= 0; i--) {
+    if (padded[i] === 0) {
+      continue;
+    }
+    if (padded[i] === paddingMarker) {
+      return padded.subarray(0, i);
+    }
+    break;
+  }
+  throw ErrInvalidPadding;
+}
+
+function bucketLength(n: number): number {
+  for (const b of paddingBuckets) {
+    if (n <= b) {
+      return b;
+    }
+  }
+  const last = paddingBuckets[paddingBuckets.length - 1];
+  return Math.ceil(n / last) * last;
+}
+
+// padmeLength keeps the top bits of n that Padmé allows and rounds the rest
+// up: with e = floor(log2 n), the low e - floor(log2 e) - 1 bits are zeroed.
+function padmeLength(n: number): number {
+  if (n < 2) {
+    return n;
+  }
+  const e = 31 - Math.clz32(n);
+  const s = 32 - Math.clz32(e);
+  const mask = (1 << (e - s)) - 1;
+  return (n + mask) & ~mask;
+}
@@ -0,0 +1,17 @@
+/// <reference types="node" />
+import { readFileSync } from "node:fs";
+import { fileURLToPath } from "node:url";
+import { expect, it } from "vitest";
+import { runVectorHarness, type CryptoVectors } from "./vectors.harness";
+
+// The Go crypto-core writes these vectors; the TypeScript port must produce
+// the same keys and ciphertexts from the same randomness.
+const vectorsPath = fileURLToPath(
+  new URL("../../../services/crypto-core/testdata/vectors.json", import.meta.url)
+);
+
+it("matches the Go crypto-core vectors", () => {
+  const vectors = JSON.parse(readFileSync(vectorsPath, "utf8")) as CryptoVectors;
+  expect(vectors.ratchet.length).toBeGreaterThan(0);
+  runVectorHarness(vectors);
+});
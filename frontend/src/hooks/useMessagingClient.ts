@@ -1,7 +1,14 @@
 import { useCallback, useEffect, useMemo, useRef, useState } from 'react';
-import { loadWasmClient, WasmClient, WasmStateInfo } from '../lib/wasmClient';
+import {
+  loadWasmClient,
+  WasmClient,
+  WasmQuote,
+  WasmReceipt,
+  WasmStateInfo
+} from '../lib/wasmClient';
 import { getItem, removeItem, setItem } from '../lib/storage';
 import { requireAccessToken } from '../lib/authToken';
+import { reconnectDelay } from '../lib/messagingClient';
 
 export interface RegistrationForm {
   keysUrl: string;
@@ -23,6 +30,7 @@ export interface SendForm {
   convId: string;
   toDeviceId: string;
   message: string;
+  replyTo?: WasmQuote;
 }
 
 export interface MessageRecord {
@@ -32,15 +40,32 @@ export interface MessageRecord {
   toDeviceId: string;
   sentAt: string;
   plaintext: string;
+  // Set for status rows such as "session reset" instead of message text.
+  notice?: string;
+  replyTo?: WasmQuote;
+  // Set on messages this device sent. serverId is the messages service's id,
+  // which its delivery notices refer to.
+  outgoing?: boolean;
+  serverId?: string;
+  status?: MessageStatus;
+  // ISO time a disappearing message leaves the list.
+  expiresAt?: string;
 }
 
+export type MessageStatus = 'sent' | 'delivered' | 'read';
+
 export interface StateInfo {
   userId: string;
   deviceId: string;
   keysUrl: string;
   messagesUrl: string;
+  readReceipts: boolean;
+  // Disappearing-message timers in seconds by conversation id.
+  timers: Record<string, number>;
 }
 
+const statusRank: Record<MessageStatus, number> = { sent: 0, delivered: 1, read: 2 };
+
 const STORAGE_KEY = 'secumsg-state-v1';
 
 interface ListenerState {
@@ -58,6 +83,11 @@ export function useMessagingClient() {
   const [engineError, setEngineError] = useState<string | null>(null);
   const stateRef = useRef<string | null>(null);
   const clientRef = useRef<WasmClient | null>(null);
+  const connectRef = useRef<(() => Promise<void>) | null>(null);
+  const reconnectTimer = useRef<ReturnType<typeof setTimeout>>();
+  // Received messages not yet reported as read, keyed by conversation and
+  // sender, until the page is visible.
+  const unreadRef = useRef(new Map<string, { convId: string; toDeviceId: string; ids: string[] }>());
 
   useEffect(() => {
     let cancelled = false;
@@ -179,14 +209,99 @@ export function useMessagingClient() {
         state: stateRef.current,
         convId: form.convId.trim(),
         toDeviceId: form.toDeviceId.trim(),
-        plaintext: form.message
+        plaintext: form.message,
+        replyTo: form.replyTo
       });
-      await postEncryptedMessage(info.messagesUrl, result.request);
+      const sent = await postEncryptedMessage(info.messagesUrl, result.request);
       await persistState(result.state);
+      setMessages((prev) => [
+        {
+          id: result.messageId,
+          convId: form.convId.trim(),
+          fromDeviceId: info.deviceId,
+          toDeviceId: form.toDeviceId.trim(),
+          sentAt: sent.sent_at ?? new Date().toISOString(),
+          plaintext: form.message,
+          replyTo: form.replyTo,
+          outgoing: true,
+          serverId: sent.id,
+          status: 'sent',
+          expiresAt: sent.expires_at
+        },
+        ...prev
+      ]);
     },
     [info, persistState]
   );
 
+  const flushReadReceipts = useCallback(async () => {
+    const client = clientRef.current;
+    if (!client || !info || document.visibilityState !== 'visible') {
+      return;
+    }
+    const pending = [...unreadRef.current.values()];
+    unreadRef.current.clear();
+    for (const entry of pending) {
+      if (!stateRef.current) {
+        return;
+      }
+      try {
+        const result = await client.prepareReadReceipt({ state: stateRef.current, ...entry });
+        await persistState(result.state);
+        if (result.request) {
+          await postEncryptedMessage(info.messagesUrl, result.request);
+        }
+      } catch (err) {
+        console.error('Failed to send read receipt', err);
+      }
+    }
+  }, [info, persistState]);
+
+  useEffect(() => {
+    const onVisible = () => void flushReadReceipts();
+    document.addEventListener('visibilitychange', onVisible);
+    return () => document.removeEventListener('visibilitychange', onVisible);
+  }, [flushReadReceipts]);
+
+  const setReadReceipts = useCallback(
+    async (on: boolean) => {
+      if (!stateRef.current || !clientRef.current) {
+        throw new Error('Device is not initialized');
+      }
+      const result = await clientRef.current.configure({ state: stateRef.current, readReceipts: on });
+      await persistState(result.state);
+    },
+    [persistState]
+  );
+
+  const setConversationTimer = useCallback(
+    async (convId: string, seconds: number) => {
+      if (!stateRef.current || !clientRef.current) {
+        throw new Error('Device is not initialized');
+      }
+      const result = await clientRef.current.configure({
+        state: stateRef.current,
+        convId: convId.trim(),
+        timerSeconds: seconds
+      });
+      await persistState(result.state);
+    },
+    [persistState]
+  );
+
+  // Disappearing messages leave the list once they expire, matching the
+  // server, which deletes them at the same time.
+  useEffect(() => {
+    const timer = setInterval(() => {
+      const now = Date.now();
+      setMessages((prev) => {
+        const kept = prev.filter((m) => !m.expiresAt || Date.parse(m.expiresAt) > now);
+        return kept.length === prev.length ? prev : kept;
+      });
+    }, 1000);
+    return () => clearInterval(timer);
+  }, []);
+
   const connect = useCallback(async () => {
     if (!stateRef.current || !info) {
       throw new Error('Device is not initialized');
@@ -207,8 +322,14 @@ export function useMessagingClient() {
       setListener({ status: 'error', websocket: ws, error: 'WebSocket error' });
     };
 
-    ws.onclose = () => {
+    ws.onclose = (event) => {
       setListener({ status: 'idle' });
+      const delay = reconnectDelay(event);
+      if (delay !== null) {
+        reconnectTimer.current = setTimeout(() => {
+          void connectRef.current?.();
+        }, delay);
+      }
     };
 
     ws.onmessage = async (event) => {
@@ -220,28 +341,84 @@ export function useMessagingClient() {
         if (!text) {
           return;
         }
-        const envelope = JSON.parse(text) as InboundEnvelope;
+        const frame = JSON.parse(text) as InboundEnvelope | DeliveryNotice;
+        if ('type' in frame) {
+          if (frame.type === 'delivered') {
+            const notice = frame;
+            setMessages((prev) =>
+              advanceStatus(prev, (m) => m.serverId === notice.id, 'delivered')
+            );
+          }
+          return;
+        }
+        const envelope = frame;
         const response = await clientRef.current.handleEnvelope({
           state: stateRef.current,
           envelope
         });
         await persistState(response.state);
-        const record: MessageRecord = {
-          id: envelope.id,
+        ws.send(JSON.stringify({ type: 'ack', ids: [envelope.id] }));
+        for (const request of response.requests) {
+          await postEncryptedMessage(info.messagesUrl, request);
+        }
+        if (response.error) {
+          console.error('Failed to decrypt inbound message', response.error);
+        }
+        if (response.receipt) {
+          const receipt: WasmReceipt = response.receipt;
+          setMessages((prev) =>
+            advanceStatus(
+              prev,
+              (m) => !!m.outgoing && receipt.messageIds.includes(m.id),
+              receipt.status
+            )
+          );
+        }
+        const base = {
           convId: envelope.conv_id,
           fromDeviceId: envelope.from_device_id,
           toDeviceId: envelope.to_device_id,
-          sentAt: envelope.sent_at,
-          plaintext: response.plaintext
+          sentAt: envelope.sent_at
         };
-        setMessages((prev) => [record, ...prev]);
+        const records: MessageRecord[] = [];
+        if (response.notice) {
+          records.push({ ...base, id: `${envelope.id}:notice`, plaintext: '', notice: response.notice });
+        }
+        if (response.plaintext) {
+          const message = response.message;
+          records.push({
+            ...base,
+            id: message?.id || envelope.id,
+            sentAt: message?.ts || envelope.sent_at,
+            plaintext: response.plaintext,
+            replyTo: message?.replyTo,
+            expiresAt: response.expiresAt
+          });
+        }
+        if (records.length > 0) {
+          setMessages((prev) => [...records.reverse(), ...prev]);
+        }
+        if (response.message?.id) {
+          const key = `${envelope.conv_id}/${envelope.from_device_id}`;
+          const entry = unreadRef.current.get(key) ?? {
+            convId: envelope.conv_id,
+            toDeviceId: envelope.from_device_id,
+            ids: []
+          };
+          entry.ids.push(response.message.id);
+          unreadRef.current.set(key, entry);
+          await flushReadReceipts();
+        }
       } catch (err) {
         console.error('Failed to process inbound message', err);
       }
     };
-  }, [info, listener.status, listener.websocket, persistState]);
+  }, [info, listener.status, listener.websocket, persistState, flushReadReceipts]);
+
+  connectRef.current = connect;
 
   const disconnect = useCallback(() => {
+    clearTimeout(reconnectTimer.current);
     if (listener.websocket) {
       listener.websocket.close();
     }
@@ -260,11 +437,36 @@ export function useMessagingClient() {
     register,
     reset,
     sendMessage,
+    setReadReceipts,
+    setConversationTimer,
     connect,
     disconnect
   };
 }
 
+// Sent by the messages service once the recipient device acknowledged a
+// message; id is the service's message id.
+interface DeliveryNotice {
+  type: 'delivered';
+  id: string;
+  conv_id: string;
+  to_device_id: string;
+  at: string;
+}
+
+// Moves matching messages forward to status; receipts never move it back.
+function advanceStatus(
+  records: MessageRecord[],
+  match: (record: MessageRecord) => boolean,
+  status: MessageStatus
+): MessageRecord[] {
+  return records.map((record) =>
+    match(record) && statusRank[status] > statusRank[record.status ?? 'sent']
+      ? { ...record, status }
+      : record
+  );
+}
+
 interface InboundEnvelope {
   id: string;
   conv_id: string;
@@ -273,6 +475,7 @@ interface InboundEnvelope {
   ciphertext: string;
   header: unknown;
   sent_at: string;
+  expires_at?: string;
 }
 
 function buildWsUrl(baseUrl: string, deviceId: string, token?: string): string {
@@ -293,13 +496,17 @@ function extractStateInfo(stateJSON: string): StateInfo | null {
       device_id?: string;
       keys_base_url?: string;
       messages_base_url?: string;
+      disableReadReceipts?: boolean;
     };
+    const timers = raw.timers && typeof raw.timers === 'object' ? raw.timers : {};
     if ('userId' in raw && raw.userId && 'deviceId' in raw && raw.deviceId) {
       return {
         userId: raw.userId,
         deviceId: raw.deviceId,
         keysUrl: raw.keysUrl,
-        messagesUrl: raw.messagesUrl
+        messagesUrl: raw.messagesUrl,
+        readReceipts: raw.readReceipts !== false,
+        timers
       };
     }
     if (!raw || !raw.device_id || !raw.user_id || !raw.messages_base_url || !raw.keys_base_url) {
@@ -309,7 +516,9 @@ function extractStateInfo(stateJSON: string): StateInfo | null {
       userId: raw.user_id,
       deviceId: raw.device_id,
       keysUrl: raw.keys_base_url,
-      messagesUrl: raw.messages_base_url
+      messagesUrl: raw.messages_base_url,
+      readReceipts: !raw.disableReadReceipts,
+      timers
     };
   } catch (err) {
     console.error('Failed to parse state info', err);
@@ -317,21 +526,36 @@ function extractStateInfo(stateJSON: string): StateInfo | null {
   }
 }
 
-async function postEncryptedMessage(baseUrl: string, body: Record<string, unknown>): Promise<void> {
+interface SendResponse {
+  id?: string;
+  sent_at?: string;
+  expires_at?: string;
+}
+
+async function postEncryptedMessage(
+  baseUrl: string,
+  body: Record<string, unknown>
+): Promise<SendResponse> {
   const target = joinUrl(baseUrl, '/messages/send');
   const token = await requireAccessToken();
+  const headers: Record<string, string> = {
+    'Content-Type': 'application/json',
+    Authorization: `Bearer ${token}`
+  };
+  // Lets the gateway confirm the sending device so messages need not ask auth again.
+  if (typeof body.from_device_id === 'string') {
+    headers['X-Device-ID'] = body.from_device_id;
+  }
   const response = await fetch(target, {
     method: 'POST',
-    headers: {
-      'Content-Type': 'application/json',
-      Authorization: `Bearer ${token}`
-    },
+    headers,
     body: JSON.stringify(body)
   });
   if (!response.ok) {
     const text = await response.text();
     throw new Error(text || 'Failed to send message');
   }
+  return (await response.json().catch(() => ({}))) as SendResponse;
 }
 
 function joinUrl(base: string, path: string): string {
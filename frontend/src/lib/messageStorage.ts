@@ -1,13 +1,22 @@
 import { getItem, setItem, removeItem, listKeysInStore, STORE_NAMES } from "./storage";
 import { SecureStore } from "./secureStore";
-import type { InboundMessage, OutboundMessage } from "./messagingClient";
+import type {
+  InboundMessage,
+  MessageStatus,
+  OutboundMessage,
+} from "./messagingClient";
 
 export type PersistedMessage = {
   direction: "inbound" | "outbound";
+  id?: string;
+  serverId?: string;
+  status?: MessageStatus;
   convId: string;
   peerDeviceId: string;
   plaintext: string;
+  notice?: string;
   sentAt: string;
+  expiresAt?: string;
 };
 
 const keyForConv = (convId: string) => `conv:${convId}:messages`;
@@ -32,6 +41,63 @@ export async function appendMessages(
   await setItem(keyForConv(convId), JSON.stringify(merged));
 }
 
+const statusRank: Record<MessageStatus, number> = { sent: 0, delivered: 1, read: 2 };
+
+// statusAdvances reports whether status is further along than current;
+// receipts never move a message back.
+export function statusAdvances(
+  current: MessageStatus | undefined,
+  status: MessageStatus
+): boolean {
+  return statusRank[status] > statusRank[current ?? "sent"];
+}
+
+// advanceStoredStatus moves the stored outbound messages whose payload or
+// service id is in ids forward to status.
+export async function advanceStoredStatus(
+  convId: string,
+  ids: string[],
+  status: MessageStatus,
+  secureStore?: SecureStore
+): Promise<void> {
+  const existing = await loadMessages(convId, secureStore);
+  let changed = false;
+  const updated = existing.map((m) => {
+    const match =
+      m.direction === "outbound" &&
+      ((m.id && ids.includes(m.id)) || (m.serverId && ids.includes(m.serverId)));
+    if (!match || !statusAdvances(m.status, status)) {
+      return m;
+    }
+    changed = true;
+    return { ...m, status };
+  });
+  if (!changed) return;
+  if (secureStore) {
+    await secureStore.securePut(SECURE_STORE, convId, updated);
+    return;
+  }
+  await setItem(keyForConv(convId), JSON.stringify(updated));
+}
+
+// pruneExpired deletes the conversation's disappearing messages whose expiry
+// has passed and returns the rest.
+export async function pruneExpired(
+  convId: string,
+  secureStore?: SecureStore
+): Promise<PersistedMessage[]> {
+  const existing = await loadMessages(convId, secureStore);
+  const now = Date.now();
+  const kept = existing.filter((m) => !m.expiresAt || Date.parse(m.expiresAt) > now);
+  if (kept.length === existing.length) return existing;
+  if (secureStore) {
+    await secureStore.securePut(SECURE_STORE, convId, kept);
+  } else {
+    await setItem(keyForConv(convId), JSON.stringify(kept));
+  }
+  return kept;
+}
+
 export async function loadMessages(
   convId: string,
   secureStore?: SecureStore
@@ -67,13 +133,24 @@ export async function latestTimestamp(
 export function deserializeMessages(
   entries: PersistedMessage[]
 ): (InboundMessage | OutboundMessage)[] {
-  return entries.map((msg) => ({
-    direction: msg.direction,
-    convId: msg.convId,
-    peerDeviceId: msg.peerDeviceId,
-    plaintext: msg.plaintext,
-    sentAt: new Date(msg.sentAt),
-  }));
+  return entries.map((msg) => {
+    const base = {
+      id: msg.id,
+      convId: msg.convId,
+      peerDeviceId: msg.peerDeviceId,
+      plaintext: msg.plaintext,
+      sentAt: new Date(msg.sentAt),
+      expiresAt: msg.expiresAt ? new Date(msg.expiresAt) : undefined,
+    };
+    return msg.direction === "inbound"
+      ? { ...base, direction: "inbound" as const, notice: msg.notice }
+      : {
+          ...base,
+          direction: "outbound" as const,
+          serverId: msg.serverId,
+          status: msg.status,
+        };
+  });
 }
 
 export function serializeMessages(
@@ -81,10 +158,15 @@ export function serializeMessages(
 ): PersistedMessage[] {
   return entries.map((msg) => ({
     direction: msg.direction,
+    id: msg.id,
+    serverId: msg.direction === "outbound" ? msg.serverId : undefined,
+    status: msg.direction === "outbound" ? msg.status : undefined,
     convId: msg.convId,
     peerDeviceId: msg.peerDeviceId,
     plaintext: msg.plaintext,
+    notice: msg.direction === "inbound" ? msg.notice : undefined,
     sentAt: msg.sentAt.toISOString(),
+    expiresAt: msg.expiresAt?.toISOString(),
   }));
 }
 
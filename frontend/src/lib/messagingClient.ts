@@ -3,6 +3,9 @@ import {
   AcceptSession,
   Decrypt,
   Encrypt,
+  ErrDecryptionFailed,
+  ErrInvalidRemoteKey,
+  ErrMissingOneTimeKey,
   ExportDevice,
   ExportSession,
   GenerateIdentityKeypair,
@@ -12,22 +15,38 @@ import {
   type Device,
   type HandshakeMessage,
   MessageHeader,
+  type PaddingScheme,
   type PrekeyBundle,
   type SessionState,
 } from "../crypto-core";
-import { fromBase64, toBase64, utf8 } from "../crypto-core/utils";
+import { fromBase64, toBase64 } from "../crypto-core/utils";
 import {
+  advanceStoredStatus,
   appendMessages,
   deserializeMessages,
   latestTimestamp,
   loadMessages,
   migrateLegacyMessages,
+  pruneExpired,
   type PersistedMessage,
 } from "./messageStorage";
 import { getItem, removeItem, setItem } from "./storage";
 import { SecureStore } from "./secureStore";
 import { requireAccessToken } from "./authToken";
 import { getApiBaseUrl } from "../config/config";
+import {
+  ContentDeliveryReceipt,
+  ContentReadReceipt,
+  ContentResendRequest,
+  ContentSessionEnd,
+  ContentText,
+  decodePayload,
+  DefaultPadding,
+  encodePayload,
+  isControl,
+  NoticeNewerPayload,
+  type Payload,
+} from "./payload";
 
 export type InboundEnvelope = {
   id: string;
@@ -37,9 +56,14 @@ export type InboundEnvelope = {
   ciphertext: string;
   header: HeaderPayload;
   sent_at: string;
+  // Set for disappearing messages; the server deletes them at this time.
+  expires_at?: string;
 };
 
 export type HeaderPayload = {
+  // Readable without decrypting, so a recipient can ask for a message it
+  // could not open.
+  messageId?: string;
   handshake?: {
     identityKey: string;
     identitySignatureKey: string;
@@ -63,22 +87,75 @@ export type StoredMessagingState = {
   messagesBaseUrl: string;
   device: ReturnType<typeof ExportDevice>;
   sessions?: Record<string, ReturnType<typeof ExportSession>>;
+  // Padding scheme for outgoing plaintexts; DefaultPadding when unset.
+  padding?: PaddingScheme;
+  disableReadReceipts?: boolean;
+  // Undecryptable messages per conversation since the last good one.
+  failures?: Record<string, FailureState>;
+  // Disappearing-message timers in seconds by conversation id.
+  timers?: Record<string, number>;
+};
+
+type FailureState = {
+  count: number;
+  messageIds: string[];
+  lastReset?: string;
+};
+
+// resetAfterFailures is how many undecryptable messages in a row make a
+// conversation reset its session; resetCooldownMs stops two broken ends from
+// resetting each other in a loop.
+const resetAfterFailures = 3;
+const resetCooldownMs = 60_000;
+// maxResendIds bounds how many failed messages one reset asks for again.
+const maxResendIds = 100;
+
+// maxTimerSeconds is the longest disappearing-message timer the messages
+// service accepts.
+export const maxTimerSeconds = 365 * 24 * 60 * 60;
+
+// Shown on both ends when a conversation's session has been replaced.
+export const NoticeSessionReset = "session reset";
+
+const errNoSession = new Error("missing handshake for new session");
+
+export type MessageStatus = "sent" | "delivered" | "read";
+
+// Receipt reports that the peer received or read messages this device sent.
+// messageIds are payload ids for end-to-end receipts and the messages
+// service's id for its delivery notices; outbound messages carry both.
+export type Receipt = {
+  convId: string;
+  status: "delivered" | "read";
+  messageIds: string[];
 };
 
 export type OutboundMessage = {
   direction: "outbound";
+  // Payload id, which receipts and resend requests refer to.
+  id?: string;
+  // The messages service's id, which its delivery notices refer to.
+  serverId?: string;
+  status?: MessageStatus;
   convId: string;
   peerDeviceId: string;
   plaintext: string;
   sentAt: Date;
+  // When a disappearing message must be removed from view.
+  expiresAt?: Date;
 };
 
 export type InboundMessage = {
   direction: "inbound";
+  id?: string;
   convId: string;
   peerDeviceId: string;
   plaintext: string;
+  // Set for status rows, such as an unreadable newer payload, instead of
+  // message text.
+  notice?: string;
   sentAt: Date;
+  expiresAt?: Date;
 };
 
 export const STORAGE_KEY = "secumsg-state";
@@ -88,6 +165,9 @@ export class MessagingClient {
   private device: Device;
   private sessions: Map<string, SessionState>;
   private secureStore?: SecureStore;
+  private socket?: WebSocket;
+  private reconnectTimer?: ReturnType<typeof setTimeout>;
+  private onReceipt?: (receipt: Receipt) => void;
   private async authHeaders(): Promise<Record<string, string>> {
     const token = await requireAccessToken();
     return { Authorization: `Bearer ${token}` };
@@ -99,6 +179,10 @@ export class MessagingClient {
       deviceId: string;
       keysBaseUrl: string;
       messagesBaseUrl: string;
+      padding?: PaddingScheme;
+      disableReadReceipts?: boolean;
+      failures?: Record<string, FailureState>;
+      timers?: Record<string, number>;
     },
     device: Device,
     sessions: Map<string, SessionState> = new Map(),
@@ -209,6 +293,10 @@ export class MessagingClient {
           deviceId: resolved.deviceId,
           keysBaseUrl: baseUrl,
           messagesBaseUrl: baseUrl,
+          padding: resolved.padding,
+          disableReadReceipts: resolved.disableReadReceipts,
+          failures: resolved.failures,
+          timers: resolved.timers,
         },
         device,
         sessions,
@@ -227,6 +315,10 @@ export class MessagingClient {
       keysBaseUrl: this.state.keysBaseUrl,
       messagesBaseUrl: this.state.messagesBaseUrl,
       device: ExportDevice(this.device),
+      padding: this.state.padding,
+      disableReadReceipts: this.state.disableReadReceipts,
+      failures: this.state.failures,
+      timers: this.state.timers,
     };
 
     if (this.sessions.size > 0) {
@@ -251,6 +343,41 @@ export class MessagingClient {
     return this.state.userId;
   }
 
+  // readReceipts reports whether this device tells peers that their
+  // messages were read. Delivery receipts are always sent; they reveal
+  // nothing the messages service does not already see.
+  readReceipts(): boolean {
+    return !this.state.disableReadReceipts;
+  }
+
+  async setReadReceipts(on: boolean): Promise<void> {
+    this.state.disableReadReceipts = !on;
+    await this.save();
+  }
+
+  // timers lists the conversations that have a disappearing-message timer,
+  // in seconds by conversation id.
+  timers(): Record<string, number> {
+    return { ...this.state.timers };
+  }
+
+  // setTimer sets the disappearing-message timer for messages this device
+  // sends in a conversation. The messages service deletes each message that
+  // many seconds after it was sent. Zero turns the timer off.
+  async setTimer(convId: string, seconds: number): Promise<void> {
+    if (!Number.isInteger(seconds) || seconds < 0 || seconds > maxTimerSeconds) {
+      throw new Error(`timer must be whole seconds between 0 and ${maxTimerSeconds}`);
+    }
+    const timers = { ...this.state.timers };
+    if (seconds === 0) {
+      delete timers[convId];
+    } else {
+      timers[convId] = seconds;
+    }
+    this.state.timers = timers;
+    await this.save();
+  }
+
   async sendMessage(
     convId: string,
     toDeviceId: string,
@@ -258,25 +385,26 @@ export class MessagingClient {
   ): Promise<OutboundMessage> {
     const { session, handshake } = await this.ensureSession(convId, toDeviceId);
 
-    const { ciphertext, header } = Encrypt(session, utf8(plaintext));
-    const headerPayload = buildHeaderPayload(header, handshake);
-
-    await axios.post(`${this.state.messagesBaseUrl}/messages/send`, {
-      conv_id: convId,
-      from_device_id: this.state.deviceId,
-      to_device_id: toDeviceId,
-      ciphertext: toBase64(ciphertext),
-      header: headerPayload,
-    }, { headers: await this.authHeaders() });
-
-    await this.save();
+    const id = crypto.randomUUID();
+    const sentAt = new Date();
+    const sent = await this.post(
+      convId,
+      toDeviceId,
+      { type: ContentText, id, ts: sentAt.toISOString(), body: plaintext },
+      session,
+      handshake
+    );
 
     const outbound: OutboundMessage = {
       direction: "outbound",
+      id,
+      serverId: sent.id,
+      status: "sent",
       convId,
       peerDeviceId: toDeviceId,
       plaintext,
-      sentAt: new Date(),
+      sentAt,
+      expiresAt: sent.expires_at ? new Date(sent.expires_at) : undefined,
     };
 
     await appendMessages(convId, [serialize(outbound)], this.secureStore);
@@ -284,42 +412,284 @@ export class MessagingClient {
     return outbound;
   }
 
-  async handleEnvelope(env: InboundEnvelope): Promise<InboundMessage> {
-    const ciphertext = toBytes(env.ciphertext);
-    const header = payloadToMessageHeader(env.header.ratchet);
+  // sendReadReceipt tells toDeviceId that the messages with the given payload
+  // ids were displayed. It does nothing when read receipts are off.
+  async sendReadReceipt(
+    convId: string,
+    toDeviceId: string,
+    ids: string[]
+  ): Promise<void> {
+    if (!this.readReceipts() || ids.length === 0) {
+      return;
+    }
+    await this.sendControl(convId, toDeviceId, {
+      type: ContentReadReceipt,
+      receipts: ids,
+    });
+  }
 
-    let session = this.sessions.get(env.conv_id);
-    if (!session) {
-      if (!env.header.handshake) {
-        throw new Error("missing handshake for new session");
-      }
-      const hs = payloadToHandshake(env.header.handshake);
-      session = AcceptSession(this.device, hs);
-      this.sessions.set(env.conv_id, session);
+  // sendControl encrypts and posts a control payload, which the peer handles
+  // without showing it.
+  private async sendControl(
+    convId: string,
+    toDeviceId: string,
+    payload: Payload
+  ): Promise<void> {
+    const { session, handshake } = await this.ensureSession(convId, toDeviceId);
+    await this.post(convId, toDeviceId, payload, session, handshake);
+  }
+
+  // post encrypts payload on session and sends it. The conversation's timer
+  // applies unless expireAfterSeconds overrides it; session control
+  // messages must reach the peer however late, so they never expire.
+  private async post(
+    convId: string,
+    toDeviceId: string,
+    payload: Payload,
+    session: SessionState,
+    handshake?: HandshakeMessage,
+    expireAfterSeconds?: number
+  ): Promise<{ id?: string; expires_at?: string }> {
+    const { ciphertext, header } = Encrypt(
+      session,
+      encodePayload(payload, this.state.padding ?? DefaultPadding)
+    );
+    let expireAfter = expireAfterSeconds ?? this.state.timers?.[convId] ?? 0;
+    if (payload.type.startsWith("session.")) {
+      expireAfter = 0;
     }
+    const response = await axios.post(`${this.state.messagesBaseUrl}/messages/send`, {
+      conv_id: convId,
+      from_device_id: this.state.deviceId,
+      to_device_id: toDeviceId,
+      ciphertext: toBase64(ciphertext),
+      header: buildHeaderPayload(header, handshake, payload.id),
+      expire_after_seconds: expireAfter > 0 ? expireAfter : undefined,
+    }, { headers: { ...(await this.authHeaders()), "X-Device-ID": this.state.deviceId } });
 
-    const plaintextBytes = Decrypt(session, ciphertext, header);
-    const clear = new TextDecoder().decode(toBytes(plaintextBytes));
+    await this.save();
+    return (response.data ?? {}) as { id?: string; expires_at?: string };
+  }
 
+  // handleEnvelope decrypts an envelope and returns the message to show, or
+  // null for control messages, which are never shown. Receipts go to the
+  // onReceipt callback given to connectWebSocket.
+  // A message the session cannot open is counted instead of thrown, so the
+  // caller still acknowledges it; the reset that follows asks for it again.
+  async handleEnvelope(env: InboundEnvelope): Promise<InboundMessage | null> {
+    let plaintextBytes: Uint8Array;
+    try {
+      plaintextBytes = this.open(env);
+    } catch (err) {
+      if (!isSessionFailure(err)) {
+        throw err;
+      }
+      console.error("Failed to decrypt inbound message", err);
+      return this.recordFailure(env);
+    }
+    if (this.state.failures) {
+      delete this.state.failures[env.conv_id];
+    }
     await this.save();
+    const payload = decodePayload(toBytes(plaintextBytes));
+    if (payload?.type === ContentSessionEnd) {
+      return this.notice(env.conv_id, env.from_device_id, NoticeSessionReset);
+    }
+    if (payload?.type === ContentResendRequest) {
+      await this.resend(env.conv_id, env.from_device_id, payload.resend ?? []);
+      return null;
+    }
+    if (
+      payload?.type === ContentDeliveryReceipt ||
+      payload?.type === ContentReadReceipt
+    ) {
+      await this.receipt({
+        convId: env.conv_id,
+        status: payload.type === ContentReadReceipt ? "read" : "delivered",
+        messageIds: payload.receipts ?? [],
+      });
+      return null;
+    }
+    // Other control messages are dropped; other unknown types fall back to
+    // their body so newer clients stay readable.
+    if (payload && isControl(payload)) {
+      return null;
+    }
+    // A disappearing message read after its expiry is dropped.
+    const expiresAt = env.expires_at ? new Date(env.expires_at) : undefined;
+    if (expiresAt && expiresAt.getTime() <= Date.now()) {
+      return null;
+    }
 
     const inbound: InboundMessage = {
       direction: "inbound",
+      id: payload?.id,
       convId: env.conv_id,
       peerDeviceId: env.from_device_id,
-      plaintext: clear,
+      plaintext: payload?.body ?? "",
+      notice: payload ? undefined : NoticeNewerPayload,
       sentAt: new Date(env.sent_at),
+      expiresAt,
     };
 
     await appendMessages(env.conv_id, [serialize(inbound)], this.secureStore);
 
+    // Messages that predate payload ids cannot be confirmed.
+    if (payload?.id) {
+      try {
+        await this.sendControl(env.conv_id, env.from_device_id, {
+          type: ContentDeliveryReceipt,
+          receipts: [payload.id],
+        });
+      } catch (err) {
+        console.error("Failed to send delivery receipt", err);
+      }
+    }
+
     return inbound;
   }
 
+  // open decrypts env with the conversation's session. A handshake on a
+  // known conversation means the peer reset it, so when the current session
+  // cannot open the message the handshake's session takes over. Sessions
+  // only change once a message decrypts.
+  private open(env: InboundEnvelope): Uint8Array {
+    const ciphertext = toBytes(env.ciphertext);
+    const header = payloadToMessageHeader(env.header.ratchet);
+    const current = this.sessions.get(env.conv_id);
+    if (current) {
+      const trial = ImportSession(ExportSession(current));
+      try {
+        const plaintext = Decrypt(trial, ciphertext, header);
+        this.sessions.set(env.conv_id, trial);
+        return plaintext;
+      } catch (err) {
+        if (!env.header.handshake) {
+          throw err;
+        }
+      }
+    }
+    if (!env.header.handshake) {
+      throw errNoSession;
+    }
+    const session = AcceptSession(this.device, payloadToHandshake(env.header.handshake));
+    const plaintext = Decrypt(session, ciphertext, header);
+    this.sessions.set(env.conv_id, session);
+    return plaintext;
+  }
+
+  // recordFailure counts an undecryptable envelope and resets the session
+  // once resetAfterFailures is reached, returning the reset notice.
+  private async recordFailure(env: InboundEnvelope): Promise<InboundMessage | null> {
+    const failures = this.state.failures ?? {};
+    this.state.failures = failures;
+    const f = failures[env.conv_id] ?? { count: 0, messageIds: [] };
+    failures[env.conv_id] = f;
+    f.count++;
+    const messageId = env.header.messageId;
+    if (messageId && f.messageIds.length < maxResendIds) {
+      f.messageIds.push(messageId);
+    }
+    const cooling =
+      f.lastReset !== undefined && Date.now() - Date.parse(f.lastReset) < resetCooldownMs;
+    if (f.count < resetAfterFailures || cooling) {
+      await this.save();
+      return null;
+    }
+    try {
+      const notice = await this.resetSession(env.conv_id, env.from_device_id, f.messageIds);
+      failures[env.conv_id] = { count: 0, messageIds: [], lastReset: new Date().toISOString() };
+      return notice;
+    } finally {
+      await this.save();
+    }
+  }
+
+  // resetSession ends the conversation's session and starts a new one from a
+  // fresh prekey bundle. The peer gets an end-session message on the new
+  // session, followed by a request to resend resendIds.
+  async resetSession(
+    convId: string,
+    toDeviceId: string,
+    resendIds: string[] = []
+  ): Promise<InboundMessage> {
+    const bundle = await this.fetchBundle(toDeviceId);
+    const { session, message } = InitSession(this.device, bundle);
+    this.sessions.set(convId, session);
+    await this.post(convId, toDeviceId, { type: ContentSessionEnd }, session, message);
+    if (resendIds.length > 0) {
+      await this.post(
+        convId,
+        toDeviceId,
+        { type: ContentResendRequest, resend: resendIds },
+        session
+      );
+    }
+    return this.notice(convId, toDeviceId, NoticeSessionReset);
+  }
+
+  // resend re-encrypts the requested messages this device sent to toDeviceId
+  // in the conversation. Unknown and expired ids are skipped, and a
+  // disappearing message keeps its original expiry.
+  private async resend(convId: string, toDeviceId: string, ids: string[]): Promise<void> {
+    const stored = await loadMessages(convId, this.secureStore);
+    const now = Date.now();
+    for (const m of stored) {
+      if (
+        m.direction !== "outbound" ||
+        !m.id ||
+        !ids.includes(m.id) ||
+        m.peerDeviceId !== toDeviceId
+      ) {
+        continue;
+      }
+      const left = m.expiresAt ? Math.ceil((Date.parse(m.expiresAt) - now) / 1000) : 0;
+      if (m.expiresAt && left <= 0) {
+        continue;
+      }
+      const { session, handshake } = await this.ensureSession(convId, toDeviceId);
+      await this.post(
+        convId,
+        toDeviceId,
+        { type: ContentText, id: m.id, ts: m.sentAt, body: m.plaintext },
+        session,
+        handshake,
+        left
+      );
+    }
+  }
+
+  // notice stores and returns a status row for the conversation.
+  private async notice(
+    convId: string,
+    peerDeviceId: string,
+    notice: string
+  ): Promise<InboundMessage> {
+    const msg: InboundMessage = {
+      direction: "inbound",
+      convId,
+      peerDeviceId,
+      plaintext: "",
+      notice,
+      sentAt: new Date(),
+    };
+    await appendMessages(convId, [serialize(msg)], this.secureStore);
+    return msg;
+  }
+
+  // receipt moves the stored outbound messages forward and reports it.
+  private async receipt(r: Receipt): Promise<void> {
+    await advanceStoredStatus(r.convId, r.messageIds, r.status, this.secureStore);
+    this.onReceipt?.(r);
+  }
+
   async connectWebSocket(
     onMessage: (msg: InboundMessage) => void,
-    onStatus?: (state: "open" | "closed" | "error") => void
+    onStatus?: (state: "open" | "closed" | "error" | "reconnecting") => void,
+    onReceipt?: (receipt: Receipt) => void
   ): Promise<WebSocket> {
+    clearTimeout(this.reconnectTimer);
+    this.onReceipt = onReceipt;
     const token = await requireAccessToken();
     const url = buildWebSocketURL(
       this.state.messagesBaseUrl,
@@ -332,8 +702,22 @@ export class MessagingClient {
       onStatus?.("open");
     };
 
-    ws.onclose = () => {
-      onStatus?.("closed");
+    ws.onclose = (event) => {
+      if (this.socket !== ws) {
+        return;
+      }
+      const delay = reconnectDelay(event);
+      if (delay === null) {
+        onStatus?.("closed");
+        return;
+      }
+      // The gateway is restarting and asked us to come back after a delay.
+      onStatus?.("reconnecting");
+      this.reconnectTimer = setTimeout(() => {
+        this.connectWebSocket(onMessage, onStatus, onReceipt).catch(() => {
+          onStatus?.("error");
+        });
+      }, delay);
     };
 
     ws.onerror = () => {
@@ -342,17 +726,43 @@ export class MessagingClient {
 
     ws.onmessage = async (event) => {
       try {
-        const env = JSON.parse(event.data) as InboundEnvelope;
-        const msg = await this.handleEnvelope(env);
-        onMessage(msg);
+        const frame = JSON.parse(event.data) as
+          | InboundEnvelope
+          | DeliveryNotice
+          | { type: string };
+        // Frames other than envelopes, such as delivery notices, carry a type.
+        if ("type" in frame) {
+          if (frame.type === "delivered") {
+            const notice = frame as DeliveryNotice;
+            await this.receipt({
+              convId: notice.conv_id,
+              status: "delivered",
+              messageIds: [notice.id],
+            });
+          }
+          return;
+        }
+        const msg = await this.handleEnvelope(frame);
+        ws.send(JSON.stringify({ type: "ack", ids: [frame.id] }));
+        if (msg) {
+          onMessage(msg);
+        }
       } catch (err) {
         console.error("Failed to process inbound message", err);
       }
     };
 
+    this.socket = ws;
     return ws;
   }
 
+  disconnectWebSocket(): void {
+    clearTimeout(this.reconnectTimer);
+    const ws = this.socket;
+    this.socket = undefined;
+    ws?.close();
+  }
+
   private async ensureSession(
     convId: string,
     toDeviceId: string
@@ -374,7 +784,11 @@ export class MessagingClient {
     }/keys/bundle?device_id=${encodeURIComponent(deviceId)}`;
     const response = await axios.get(endpoint, {
       headers: await this.authHeaders(),
+      validateStatus: (status) => status < 400 || status === 410,
     });
+    if (response.status === 410 || response.data?.revoked) {
+      throw new Error(`Device ${deviceId} has been revoked`);
+    }
     const data = response.data as {
       deviceId: string;
       identityKey: string;
@@ -445,7 +859,9 @@ export class MessagingClient {
     const results: InboundMessage[] = [];
     for (const env of sorted) {
       const msg = await this.handleEnvelope(env);
-      results.push(msg);
+      if (msg) {
+        results.push(msg);
+      }
     }
 
     await this.save();
@@ -455,7 +871,7 @@ export class MessagingClient {
   async loadLocalHistory(
     convId: string
   ): Promise<(InboundMessage | OutboundMessage)[]> {
-    const stored = await loadMessages(convId, this.secureStore);
+    const stored = await pruneExpired(convId, this.secureStore);
     return deserializeMessages(stored);
   }
 
@@ -464,6 +880,17 @@ export class MessagingClient {
   }
 }
 
+// isSessionFailure reports whether err means the session with the peer is
+// out of step, as opposed to a malformed or replayed envelope.
+function isSessionFailure(err: unknown): boolean {
+  return (
+    err === ErrDecryptionFailed ||
+    err === ErrInvalidRemoteKey ||
+    err === ErrMissingOneTimeKey ||
+    err === errNoSession
+  );
+}
+
 async function loadPlaintextState(): Promise<StoredMessagingState | null> {
   const raw = await getItem(STORAGE_KEY);
   if (!raw) {
@@ -502,9 +929,11 @@ function toUint32Array(b64: ByteLike): Uint8Array {
 
 function buildHeaderPayload(
   header: MessageHeader,
-  handshake?: HandshakeMessage
+  handshake?: HandshakeMessage,
+  messageId?: string
 ): HeaderPayload {
   const payload: HeaderPayload = {
+    messageId,
     ratchet: {
       dhPublic: toBase64(header.DHPublic),
       pn: header.PN,
@@ -528,13 +957,28 @@ function buildHeaderPayload(
 function serialize(msg: InboundMessage | OutboundMessage): PersistedMessage {
   return {
     direction: msg.direction,
+    id: msg.id,
+    serverId: msg.direction === "outbound" ? msg.serverId : undefined,
+    status: msg.direction === "outbound" ? msg.status : undefined,
     convId: msg.convId,
     peerDeviceId: msg.peerDeviceId,
     plaintext: msg.plaintext,
+    notice: msg.direction === "inbound" ? msg.notice : undefined,
     sentAt: msg.sentAt.toISOString(),
+    expiresAt: msg.expiresAt?.toISOString(),
   };
 }
 
+// Sent by the messages service once the recipient device acknowledged a
+// message; id is the service's message id.
+type DeliveryNotice = {
+  type: "delivered";
+  id: string;
+  conv_id: string;
+  to_device_id: string;
+  at: string;
+};
+
 function payloadToHandshake(p: HeaderPayload["handshake"]): HandshakeMessage {
   if (!p) {
     throw new Error("nil handshake payload");
@@ -599,3 +1043,15 @@ function buildWebSocketURL(base: string, deviceId: string, token?: string): stri
   }
   return withPath;
 }
+
+const CLOSE_SERVICE_RESTART = 1012;
+
+// reconnectDelay returns how long to wait before reconnecting after the
+// gateway closed the socket for a restart, or null for any other close.
+export function reconnectDelay(event: CloseEvent): number | null {
+  if (event.code !== CLOSE_SERVICE_RESTART) {
+    return null;
+  }
+  const match = /reconnect_after_ms=(\d+)/.exec(event.reason);
+  return match ? Number(match[1]) : 0;
+}
@@ -0,0 +1,79 @@
+import { Pad, Unpad, type PaddingScheme } from "../crypto-core";
+import { utf8 } from "../crypto-core/utils";
+
+// Plaintexts start with a version byte followed by a JSON Payload, padded
+// with Pad over the whole plaintext. This mirrors msgclient's payload.go so
+// the web client and msgctl/WASM clients read each other's messages.
+// Version 1 carried unpadded JSON, and older clients encrypted the raw text,
+// which is still read as a text message.
+const payloadVersionJSON = 0x01;
+const payloadVersionPadded = 0x02;
+const payloadVersion = payloadVersionPadded;
+
+// maxPayloadVersion ends the byte range reserved for payload versions.
+// Typed text never starts with these control characters, so a plaintext
+// from an older client cannot be mistaken for a payload.
+const maxPayloadVersion = 0x08;
+
+// Content types carried inside the ciphertext. The session.* and receipt.*
+// types are control messages handled by the client and never shown.
+export const ContentText = "text";
+export const ContentSessionEnd = "session.end";
+export const ContentResendRequest = "session.resend";
+export const ContentDeliveryReceipt = "receipt.delivered";
+export const ContentReadReceipt = "receipt.read";
+
+const controlPrefixes = ["session.", "receipt."];
+
+// Shown for messages written in a payload version this client cannot read.
+export const NoticeNewerPayload = "message needs a newer client";
+
+export const DefaultPadding: PaddingScheme = "buckets";
+
+// Payload is the content encrypted inside every message. A client that does
+// not know type shows body as text, so new content types should carry a
+// readable fallback there.
+export type Payload = {
+  type: string;
+  id?: string;
+  ts?: string;
+  replyTo?: { id: string; body?: string };
+  body?: string;
+  // Message ids a resend request asks for again.
+  resend?: string[];
+  // Message ids a receipt confirms.
+  receipts?: string[];
+};
+
+export function isControl(p: Payload): boolean {
+  return controlPrefixes.some((prefix) => p.type.startsWith(prefix));
+}
+
+export function encodePayload(p: Payload, scheme: PaddingScheme): Uint8Array {
+  const data = utf8(JSON.stringify(p));
+  const plaintext = new Uint8Array(data.length + 1);
+  plaintext[0] = payloadVersion;
+  plaintext.set(data, 1);
+  return Pad(plaintext, scheme);
+}
+
+// decodePayload parses a decrypted plaintext. It returns null for a payload
+// version newer than this client understands and throws on a malformed one.
+export function decodePayload(plaintext: Uint8Array): Payload | null {
+  const version = plaintext.length > 0 ? plaintext[0] : -1;
+  let body: Uint8Array;
+  if (version === payloadVersionPadded) {
+    body = Unpad(plaintext).subarray(1);
+  } else if (version === payloadVersionJSON) {
+    body = plaintext.subarray(1);
+  } else if (version > payloadVersion && version <= maxPayloadVersion) {
+    return null;
+  } else {
+    return { type: ContentText, body: new TextDecoder().decode(plaintext) };
+  }
+  const p = JSON.parse(new TextDecoder().decode(body)) as Payload;
+  if (!p || typeof p.type !== "string" || p.type === "") {
+    throw new Error("payload without content type");
+  }
+  return p;
+}
@@ -1,20 +1,58 @@
+// Padding schemes of crypto-core; "buckets" is the default.
+export type WasmPadding = 'none' | 'buckets' | 'padme';
+
 export interface WasmRegistrationResult {
   state: string;
   userId: string;
   deviceId: string;
   keysUrl: string;
   messagesUrl: string;
+  padding: WasmPadding;
   oneTimePrekeys: number;
 }
 
 export interface WasmPrepareSendResult {
   state: string;
   request: Record<string, unknown>;
+  messageId: string;
+}
+
+// Mirrors msgclient.Payload, the structured content inside the ciphertext.
+export interface WasmPayload {
+  type: string;
+  id?: string;
+  ts?: string;
+  replyTo?: WasmQuote;
+  body?: string;
+}
+
+export interface WasmQuote {
+  id: string;
+  body?: string;
+}
+
+// The peer confirms messages this device sent; ids are payload ids.
+export interface WasmReceipt {
+  status: 'delivered' | 'read';
+  messageIds: string[];
 }
 
 export interface WasmHandleEnvelopeResult {
   state: string;
   plaintext: string;
+  // Status for the user, e.g. "session reset"; empty for ordinary messages.
+  notice: string;
+  // Structured message; absent for control messages and failures.
+  message?: WasmPayload;
+  receipt?: WasmReceipt;
+  // ISO time a disappearing message must be removed from view.
+  expiresAt?: string;
+  // Control and resent messages, including the delivery receipt for a
+  // received message, that must be posted to /messages/send.
+  requests: Record<string, unknown>[];
+  // Set when the envelope could not be decrypted. The state must still be
+  // stored: it counts failures towards an automatic session reset.
+  error?: string;
 }
 
 export interface WasmStateInfo {
@@ -22,6 +60,16 @@ export interface WasmStateInfo {
   deviceId: string;
   keysUrl: string;
   messagesUrl: string;
+  padding: WasmPadding;
+  readReceipts: boolean;
+  // Disappearing-message timers in seconds by conversation id.
+  timers: Record<string, number>;
+}
+
+export interface WasmReadReceiptResult {
+  state: string;
+  // Null when read receipts are turned off.
+  request: Record<string, unknown> | null;
 }
 
 export interface WasmClient {
@@ -31,17 +79,36 @@ export interface WasmClient {
     userId?: string;
     deviceId?: string;
     accessToken?: string;
+    padding?: WasmPadding;
   }): Promise<WasmRegistrationResult>;
   prepareSend(options: {
     state: string;
     convId: string;
     toDeviceId: string;
     plaintext: string;
+    type?: string;
+    replyTo?: WasmQuote;
+    // Changes the padding scheme stored in the state.
+    padding?: WasmPadding;
   }): Promise<WasmPrepareSendResult>;
   handleEnvelope(options: {
     state: string;
     envelope: unknown;
   }): Promise<WasmHandleEnvelopeResult>;
+  prepareReadReceipt(options: {
+    state: string;
+    convId: string;
+    toDeviceId: string;
+    ids: string[];
+  }): Promise<WasmReadReceiptResult>;
+  configure(options: {
+    state: string;
+    readReceipts?: boolean;
+    padding?: WasmPadding;
+    // Sets the disappearing-message timer of convId; 0 turns it off.
+    convId?: string;
+    timerSeconds?: number;
+  }): Promise<{ state: string }>;
   stateInfo(state: string): WasmStateInfo | null;
 }
 
@@ -57,6 +124,8 @@ type GlobalWithRuntime = typeof globalThis & {
   msgClientInit?: (options: Record<string, unknown>) => Promise<unknown>;
   msgClientPrepareSend?: (options: Record<string, unknown>) => Promise<unknown>;
   msgClientHandleEnvelope?: (options: Record<string, unknown>) => Promise<unknown>;
+  msgClientPrepareReadReceipt?: (options: Record<string, unknown>) => Promise<unknown>;
+  msgClientConfigure?: (options: Record<string, unknown>) => Promise<unknown>;
   msgClientStateInfo?: (state: string) => unknown;
 };
 
@@ -107,14 +176,18 @@ async function initialize(): Promise<WasmClient> {
     userId?: string;
     deviceId?: string;
     accessToken?: string;
+    padding?: WasmPadding;
   }): Promise<WasmRegistrationResult> => {
-    const payload = {
+    const payload: Record<string, unknown> = {
       keysURL: options.keysUrl,
       messagesURL: options.messagesUrl,
       userID: options.userId ?? '',
       deviceID: options.deviceId ?? '',
       accessToken: options.accessToken ?? ''
     };
+    if (options.padding) {
+      payload.padding = options.padding;
+    }
     const result = (await call<Promise<Record<string, unknown>>>(
       'msgClientInit',
       payload
@@ -127,13 +200,26 @@ async function initialize(): Promise<WasmClient> {
     convId: string;
     toDeviceId: string;
     plaintext: string;
+    type?: string;
+    replyTo?: WasmQuote;
+    // Changes the padding scheme stored in the state.
+    padding?: WasmPadding;
   }): Promise<WasmPrepareSendResult> => {
-    const payload = {
+    const payload: Record<string, unknown> = {
       state: options.state,
       convId: options.convId,
       toDeviceId: options.toDeviceId,
       plaintext: options.plaintext
     };
+    if (options.type) {
+      payload.type = options.type;
+    }
+    if (options.replyTo) {
+      payload.replyTo = options.replyTo;
+    }
+    if (options.padding) {
+      payload.padding = options.padding;
+    }
     const result = (await call<Promise<Record<string, unknown>>>(
       'msgClientPrepareSend',
       payload
@@ -156,6 +242,36 @@ async function initialize(): Promise<WasmClient> {
     return normalizeHandleEnvelope(result);
   };
 
+  const prepareReadReceipt = async (options: {
+    state: string;
+    convId: string;
+    toDeviceId: string;
+    ids: string[];
+  }): Promise<WasmReadReceiptResult> => {
+    const result = (await call<Promise<Record<string, unknown>>>(
+      'msgClientPrepareReadReceipt',
+      options
+    )) as Record<string, unknown>;
+    return {
+      state: String(result.state ?? ''),
+      request: (result.request as Record<string, unknown> | null) ?? null
+    };
+  };
+
+  const configure = async (options: {
+    state: string;
+    readReceipts?: boolean;
+    padding?: WasmPadding;
+    convId?: string;
+    timerSeconds?: number;
+  }): Promise<{ state: string }> => {
+    const result = (await call<Promise<Record<string, unknown>>>(
+      'msgClientConfigure',
+      options
+    )) as Record<string, unknown>;
+    return { state: String(result.state ?? '') };
+  };
+
   const stateInfo = (state: string): WasmStateInfo | null => {
     try {
       const raw = call<Record<string, unknown> | null>('msgClientStateInfo', state);
@@ -169,7 +285,7 @@ async function initialize(): Promise<WasmClient> {
     }
   };
 
-  return { init, prepareSend, handleEnvelope, stateInfo };
+  return { init, prepareSend, handleEnvelope, prepareReadReceipt, configure, stateInfo };
 }
 
 async function ensureGoRuntime(globalRuntime: GlobalWithRuntime): Promise<void> {
@@ -238,6 +354,7 @@ function normalizeRegistration(raw: Record<string, unknown>): WasmRegistrationRe
     deviceId: String(raw.deviceId ?? ''),
     keysUrl: String(raw.keysUrl ?? ''),
     messagesUrl: String(raw.messagesUrl ?? ''),
+    padding: normalizePadding(raw.padding),
     oneTimePrekeys: Number(raw.oneTimePrekeys ?? 0)
   };
 }
@@ -246,14 +363,21 @@ function normalizePrepareSend(raw: Record<string, unknown>): WasmPrepareSendResu
   const request = (raw.request as Record<string, unknown>) ?? {};
   return {
     state: String(raw.state ?? ''),
-    request
+    request,
+    messageId: String(raw.messageId ?? '')
   };
 }
 
 function normalizeHandleEnvelope(raw: Record<string, unknown>): WasmHandleEnvelopeResult {
   return {
     state: String(raw.state ?? ''),
-    plaintext: String(raw.plaintext ?? '')
+    plaintext: String(raw.plaintext ?? ''),
+    notice: String(raw.notice ?? ''),
+    message: raw.message ? (raw.message as WasmPayload) : undefined,
+    receipt: raw.receipt ? (raw.receipt as WasmReceipt) : undefined,
+    expiresAt: typeof raw.expiresAt === 'string' ? raw.expiresAt : undefined,
+    requests: Array.isArray(raw.requests) ? (raw.requests as Record<string, unknown>[]) : [],
+    error: typeof raw.error === 'string' ? raw.error : undefined
   };
 }
 
@@ -262,6 +386,25 @@ function normalizeStateInfo(raw: Record<string, unknown>): WasmStateInfo {
     userId: String(raw.userId ?? ''),
     deviceId: String(raw.deviceId ?? ''),
     keysUrl: String(raw.keysUrl ?? ''),
-    messagesUrl: String(raw.messagesUrl ?? '')
+    messagesUrl: String(raw.messagesUrl ?? ''),
+    padding: normalizePadding(raw.padding),
+    readReceipts: raw.readReceipts !== false,
+    timers: normalizeTimers(raw.timers)
   };
 }
+
+function normalizeTimers(raw: unknown): Record<string, number> {
+  const timers: Record<string, number> = {};
+  if (raw && typeof raw === 'object') {
+    for (const [convId, seconds] of Object.entries(raw as Record<string, unknown>)) {
+      if (typeof seconds === 'number' && seconds > 0) {
+        timers[convId] = seconds;
+      }
+    }
+  }
+  return timers;
+}
+
+function normalizePadding(raw: unknown): WasmPadding {
+  return raw === 'none' || raw === 'padme' ? raw : 'buckets';
+}
@@ -8,11 +8,49 @@ export type DeleteServicePayload = {
   timestamp: string;
 };
 
-export type DeleteProfilePayload = {
-  status: string;
-  deletedResources?: Record<string, Record<string, number>>;
-  errors?: Record<string, string>;
-  timestamp: string;
+export type DeletionStatus =
+  | "pending"
+  | "running"
+  | "retrying"
+  | "completed"
+  | "failed";
+
+export type DeletionStep = {
+  service: string;
+  status: DeletionStatus;
+  attempts: number;
+  startedAt?: string;
+  completedAt?: string;
+  deletedResources?: Record<string, number>;
+  lastError?: string;
+};
+
+export type DeletionReceipt = {
+  jobId: string;
+  userId: string;
+  requestedAt: string;
+  completedAt: string;
+  services: {
+    service: string;
+    completedAt: string;
+    deletedResources: Record<string, number>;
+  }[];
+  digest: string;
+};
+
+export type DeletionJob = {
+  id: string;
+  userId: string;
+  deviceId?: string;
+  status: DeletionStatus;
+  steps: DeletionStep[];
+  attempts: number;
+  nextAttemptAt: string;
+  lastError?: string;
+  receipt?: DeletionReceipt;
+  createdAt: string;
+  updatedAt: string;
+  completedAt?: string;
 };
 
 export async function deleteAuthData(): Promise<DeleteServicePayload> {
@@ -40,11 +78,28 @@ export async function deleteMessagesData(
 
 export async function deleteAllProfileData(
   deviceId?: string
-): Promise<DeleteProfilePayload> {
+): Promise<DeletionJob> {
   const headers = await authHeaders();
   const resp = await axios.delete(`${config.apiBaseUrl}/profile`, {
     headers,
     params: deviceId ? { device_id: deviceId } : undefined,
   });
-  return resp.data as DeleteProfilePayload;
+  return resp.data as DeletionJob;
+}
+
+export async function getDeletionJob(id: string): Promise<DeletionJob> {
+  const resp = await axios.get(
+    `${config.apiBaseUrl}/profile/deletion/${encodeURIComponent(id)}`
+  );
+  return resp.data as DeletionJob;
+}
+
+export async function resumeDeletionJob(id: string): Promise<DeletionJob> {
+  const headers = await authHeaders();
+  const resp = await axios.post(
+    `${config.apiBaseUrl}/profile/deletion/${encodeURIComponent(id)}/resume`,
+    undefined,
+    { headers }
+  );
+  return resp.data as DeletionJob;
 }
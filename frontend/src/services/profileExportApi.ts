@@ -0,0 +1,50 @@
+import axios from "axios";
+import config from "../config/config";
+import { authHeaders } from "../lib/authToken";
+
+export type ExportSignature = {
+  alg: "Ed25519";
+  keyId: string;
+  value: string;
+};
+
+export type ProfileExport = {
+  version: number;
+  userId: string;
+  deviceId?: string;
+  exportedAt: string;
+  services: Record<string, unknown>;
+  signature: ExportSignature;
+};
+
+export type ExportPublicKey = {
+  alg: "Ed25519";
+  keyId: string;
+  publicKey: string;
+};
+
+export async function exportProfileData(
+  deviceId?: string
+): Promise<ProfileExport> {
+  const headers = await authHeaders();
+  const resp = await axios.get(`${config.apiBaseUrl}/profile/export`, {
+    headers,
+    params: deviceId ? { device_id: deviceId } : undefined,
+  });
+  return resp.data as ProfileExport;
+}
+
+export async function exportProfileArchive(deviceId?: string): Promise<Blob> {
+  const headers = await authHeaders();
+  const resp = await axios.get(`${config.apiBaseUrl}/profile/export`, {
+    headers,
+    params: deviceId ? { device_id: deviceId, format: "zip" } : { format: "zip" },
+    responseType: "blob",
+  });
+  return resp.data as Blob;
+}
+
+export async function getExportPublicKey(): Promise<ExportPublicKey> {
+  const resp = await axios.get(`${config.apiBaseUrl}/profile/export/key`);
+  return resp.data as ExportPublicKey;
+}
@@ -29,6 +29,10 @@ create_db_if_missing() {
 create_db_if_missing "authdb"
 create_db_if_missing "keysdb"
 create_db_if_missing "messagesdb"
+# Gateway-owned state such as account deletion jobs.
+create_db_if_missing "gatewaydb"
+# Shared database used only as the LISTEN/NOTIFY channel for the event bus.
+create_db_if_missing "eventsdb"
 
 # Enable common extensions in all DBs
 for DB in authdb keysdb messagesdb; do
@@ -1,21 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"auth/internal/config"
-	"auth/internal/observability/logging"
+	"auth/internal/keys"
 	"auth/internal/observability/metrics"
-	"auth/internal/observability/middleware"
 	impl "auth/internal/service/impl"
 	"auth/internal/store"
 	httpx "auth/internal/transport/http"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"eventbus"
+	"identity"
+	"observability/health"
+	"observability/logging"
+	"observability/middleware"
+	"observability/tracing"
 )
 
 func main() {
@@ -31,7 +41,12 @@ func main() {
 	})
 
 	slog.SetDefault(logger)
-	metrics.MustRegister("auth")
+	metrics.MustRegister("auth", env)
+	shutdownTracing, err := tracing.Setup(context.Background(), "auth", env)
+	if err != nil {
+		logger.Error("tracing", "error", err)
+		os.Exit(1)
+	}
 
 	logger.Info("starting service")
 
@@ -44,9 +59,25 @@ func main() {
 		logger.Error("gorm open", "error", err)
 		os.Exit(1)
 	}
+	if err := tracing.InstrumentGORM(gdb); err != nil {
+		logger.Error("gorm tracing", "error", err)
+		os.Exit(1)
+	}
 
 	st := &store.Store{DB: gdb}
 
+	bus, err := eventbus.Open(context.Background(), cfg.EventBus)
+	if err != nil {
+		logger.Error("event bus", "error", err)
+		os.Exit(1)
+	}
+	// Background work outlives the signal until in-flight requests are done,
+	// so their outbox rows still get relayed.
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	relay := eventbus.NewRelay(gdb, bus, eventbus.RelayOptions{Interval: cfg.OutboxPollInterval})
+	go relay.Run(background)
+
 	// 2) Services
 	pw := impl.NewPasswordServiceArgon2id()
 
@@ -60,10 +91,29 @@ func main() {
 	}, st)
 
 	as := impl.NewAuthServiceImpl(st, pw, ts)
+	as.Limiter = impl.NewLoginLimiter(cfg.LoginMaxFailuresPerAccount, cfg.LoginMaxFailuresPerIP, cfg.LoginFailureWindow)
 	ds := impl.NewDeviceServiceImpl(st)
+	ss := impl.NewSessionServiceImpl(st)
+	ps := impl.NewPrekeyServiceImpl(st, keys.NewClient(cfg.KeysBaseURL))
 
 	// 3) HTTP router
-	mux := httpx.NewRouter(as, ds, ts, st) // if router needs cfg (CORS, trust proxy), pass it in here
+	mux := httpx.NewRouter(as, ds, ts, ss, ps, st) // if router needs cfg (CORS, trust proxy), pass it in here
+	if cfg.IdentityKey != "" {
+		signer, err := identity.NewSigner(cfg.IdentityKey)
+		if err != nil {
+			logger.Error("internal identity key", "error", err)
+			os.Exit(1)
+		}
+		httpx.RegisterInternal(mux, ds, signer)
+	} else {
+		slog.Warn("INTERNAL_IDENTITY_KEY not set; keys and messages cannot sync revoked devices")
+	}
+
+	// Keys is only needed for prekey allocation, so it is not a readiness
+	// dependency.
+	ready := health.New()
+	ready.Add("db", health.DB(gdb))
+	mux.Handle("/readyz", ready)
 
 	handler := middleware.WithRequestAndTrace(middleware.WithMetrics(mux))
 
@@ -73,9 +123,34 @@ func main() {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	slog.Info("auth service listening", "addr", srv.Addr, "issuer", cfg.Issuer)
-	if err := srv.ListenAndServe(); err != nil {
-		logger.Error("server error", "error", err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		slog.Info("auth service listening", "addr", srv.Addr, "issuer", cfg.Issuer)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+	<-ctx.Done()
+
+	slog.Info("auth service shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
+	ready.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("http shutdown", "error", err)
+	}
+	stopBackground()
+	_ = bus.Close()
+	if sqlDB, err := gdb.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("tracing shutdown", "error", err)
 	}
+	slog.Info("auth service stopped")
 }
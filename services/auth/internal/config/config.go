@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"eventbus"
 )
 
 type Config struct {
@@ -22,6 +24,27 @@ type Config struct {
 	// HTTP
 	Addr       string
 	TrustProxy bool
+
+	// Login brute-force protection
+	LoginMaxFailuresPerAccount int
+	LoginMaxFailuresPerIP      int
+	LoginFailureWindow         time.Duration
+
+	// Downstream services
+	KeysBaseURL string
+
+	// IdentityKey verifies the internal calls keys and messages make, such
+	// as listing revoked devices. The internal routes are off when empty.
+	IdentityKey string
+
+	// Events
+	EventBus           eventbus.Config
+	OutboxPollInterval time.Duration
+
+	// Shutdown: how long /readyz fails before the listener closes, then how
+	// long in-flight requests get to finish
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
 }
 
 func Load() Config {
@@ -36,6 +59,25 @@ func Load() Config {
 
 		Addr:       getenv("ADDR", ":8081"),
 		TrustProxy: getbool("TRUST_PROXY", true),
+
+		LoginMaxFailuresPerAccount: getint("LOGIN_MAX_FAILURES_PER_ACCOUNT", 5),
+		LoginMaxFailuresPerIP:      getint("LOGIN_MAX_FAILURES_PER_IP", 50),
+		LoginFailureWindow:         getdur("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+
+		KeysBaseURL: getenv("KEYS_BASE_URL", "http://keys:8082"),
+		IdentityKey: os.Getenv("INTERNAL_IDENTITY_KEY"),
+
+		EventBus: eventbus.Config{
+			Transport:   getenv("EVENTBUS_TRANSPORT", ""),
+			PostgresURL: getenv("EVENTBUS_POSTGRES_URL", ""),
+			Channel:     getenv("EVENTBUS_CHANNEL", eventbus.DefaultChannel),
+			NATSURL:     getenv("EVENTBUS_NATS_URL", ""),
+			Group:       "auth",
+		},
+		OutboxPollInterval: getdur("OUTBOX_POLL_INTERVAL", time.Second),
+
+		ShutdownDelay:   getdur("SHUTDOWN_DELAY", 5*time.Second),
+		ShutdownTimeout: getdur("SHUTDOWN_TIMEOUT", 20*time.Second),
 	}
 }
 
@@ -55,6 +97,16 @@ func getbool(k string, def bool) bool {
 	return def
 }
 
+func getint(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		slog.Warn("invalid integer, using default", "key", k, "value", v, "default", def)
+	}
+	return def
+}
+
 func getdur(k string, def time.Duration) time.Duration {
 	if v := os.Getenv(k); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
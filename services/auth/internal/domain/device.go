@@ -14,16 +14,3 @@ type Device struct {
 }
 
 func (Device) TableName() string { return "devices" }
-
-type DeviceKeyBundle struct {
-	DeviceID        DeviceID `gorm:"type:uuid;primaryKey" db:"device_id"`
-	IdentityKeyPub  []byte   `gorm:"type:bytea;not null" db:"identity_key_pub"`
-	SignedPreKeyPub []byte   `gorm:"column:signed_prekey_pub;type:bytea;not null" db:"signed_prekey_pub"`
-	SignedPreKeySig []byte   `gorm:"column:signed_prekey_sig;type:bytea;not null" db:"signed_prekey_sig"`
-	// OneTimePreKeys: store as JSONB array; for heavy usage, put in a separate table.
-	OneTimePreKeys []byte    `gorm:"column:one_time_prekeys;type:jsonb;not null" db:"one_time_prekeys"`
-	LastRotatedAt  time.Time `gorm:"not null" db:"last_rotated_at"`
-	CreatedAt      time.Time `gorm:"not null" db:"created_at"`
-}
-
-func (DeviceKeyBundle) TableName() string { return "device_key_bundles" }
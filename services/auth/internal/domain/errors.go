@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
@@ -13,10 +16,22 @@ var (
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrTokenExpired       = errors.New("token expired")
 	ErrTokenConsumed      = errors.New("token already consumed")
+	ErrTokenReused        = errors.New("refresh token reuse detected")
 	ErrMFARequired        = errors.New("multi-factor authentication required")
 	ErrMFAMethodNotFound  = errors.New("multi-factor authentication method not found")
 	ErrMFAMethodExists    = errors.New("multi-factor authentication method already exists")
 	ErrSessionNotFound    = errors.New("session not found")
 	ErrDeviceNotFound     = errors.New("device not found")
+	ErrDeviceNotOwned     = errors.New("device belongs to another user")
 	ErrRecordNotFound     = errors.New("record not found")
+	ErrKeysUnavailable    = errors.New("keys service unavailable")
 )
+
+// RateLimitError is ErrRateLimited with the time until the caller may retry.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string { return ErrRateLimited.Error() }
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
@@ -7,15 +7,25 @@ import (
 )
 
 type Session struct {
-	ID        SessionID  `gorm:"type:uuid;primaryKey" db:"id"`
-	UserID    UserID     `gorm:"type:uuid;index" db:"user_id"`
-	DeviceID  *DeviceID  `gorm:"type:uuid" db:"device_id"`
-	RefreshID uuid.UUID  `gorm:"type:uuid;uniqueIndex:ux_sessions_refreshid" db:"refresh_id"`
-	ExpiresAt time.Time  `gorm:"not null" db:"expires_at"`
-	RevokedAt *time.Time `db:"revoked_at"`
-	CreatedAt time.Time  `gorm:"not null" db:"created_at"`
-	IP        string     `gorm:"type:inet" db:"ip"`
-	UserAgent string     `gorm:"type:text" db:"user_agent"`
+	ID         SessionID  `gorm:"type:uuid;primaryKey" db:"id"`
+	UserID     UserID     `gorm:"type:uuid;index" db:"user_id"`
+	DeviceID   *DeviceID  `gorm:"type:uuid" db:"device_id"`
+	RefreshID  uuid.UUID  `gorm:"type:uuid;uniqueIndex:ux_sessions_refreshid" db:"refresh_id"`
+	ExpiresAt  time.Time  `gorm:"not null" db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `gorm:"not null" db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	IP         string     `gorm:"type:inet" db:"ip"`
+	UserAgent  string     `gorm:"type:text" db:"user_agent"`
 }
 
 func (Session) TableName() string { return "sessions" }
+
+// SupersededRefresh records a refresh ID that has been rotated away from its session.
+type SupersededRefresh struct {
+	RefreshID    uuid.UUID `gorm:"type:uuid;primaryKey" db:"refresh_id"`
+	SessionID    SessionID `gorm:"type:uuid;index;not null" db:"session_id"`
+	SupersededAt time.Time `gorm:"not null" db:"superseded_at"`
+}
+
+func (SupersededRefresh) TableName() string { return "session_refresh_history" }
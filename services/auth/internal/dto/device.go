@@ -1,7 +1,19 @@
 package dto
 
+import "time"
+
 type DeviceRegisterRequest struct {
 	UserID    string                 `json:"userId"`
 	Name      string                 `json:"name"`
 	Platform  string                 `json:"platform"`
 }
+
+type RevokedDevice struct {
+	DeviceID  string    `json:"deviceId"`
+	UserID    string    `json:"userId"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+type RevokedDevicesResponse struct {
+	Devices []RevokedDevice `json:"devices"`
+}
@@ -0,0 +1,77 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserExportResponse is auth's part of a GDPR data export. It describes
+// credentials and MFA factors but never carries hashes, seeds or tokens.
+type UserExportResponse struct {
+	Service     string                `json:"service"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Profile     ExportProfile         `json:"profile"`
+	Credentials ExportCredentials     `json:"credentials"`
+	MFA         ExportMFA             `json:"mfa"`
+	Devices     []ExportDevice        `json:"devices"`
+	Sessions    []ExportSession       `json:"sessions"`
+	AuditLog    []ExportAuditLogEntry `json:"auditLog"`
+}
+
+type ExportProfile struct {
+	ID                 string    `json:"id"`
+	Email              string    `json:"email"`
+	EmailVerified      bool      `json:"emailVerified"`
+	Username           string    `json:"username"`
+	Disabled           bool      `json:"disabled"`
+	EmailVerifications int64     `json:"emailVerifications"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+type ExportCredentials struct {
+	Password bool                       `json:"password"`
+	WebAuthn []ExportWebAuthnCredential `json:"webauthn"`
+}
+
+type ExportWebAuthnCredential struct {
+	ID        string    `json:"id"`
+	SignCount uint32    `json:"signCount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ExportMFA struct {
+	TOTPEnrolled           bool `json:"totpEnrolled"`
+	TOTPEnabled            bool `json:"totpEnabled"`
+	RecoveryCodesIssued    int  `json:"recoveryCodesIssued"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type ExportDevice struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Platform  string     `json:"platform"`
+	HasPush   bool       `json:"hasPushToken"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type ExportSession struct {
+	ID         string     `json:"id"`
+	DeviceID   string     `json:"deviceId,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"userAgent,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+type ExportAuditLogEntry struct {
+	ID        string          `json:"id"`
+	Action    string          `json:"action"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	UserAgent string          `json:"userAgent,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+type SignedPreKey struct {
+	PublicKey string    `json:"publicKey"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OneTimePreKey struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"publicKey"`
+}
+
+// KEMPreKey is a signed ML-KEM-768 prekey for PQXDH. Auth only passes it
+// through to keys.
+type KEMPreKey struct {
+	ID        uint32 `json:"id"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+type RotatePrekeysRequest struct {
+	DeviceID          string          `json:"deviceId"`
+	SignedPreKey      SignedPreKey    `json:"signedPreKey"`
+	OneTimePreKeys    []OneTimePreKey `json:"oneTimePreKeys"`
+	KEMPreKey         *KEMPreKey      `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKeys []KEMPreKey     `json:"oneTimeKemPreKeys,omitempty"`
+}
+
+type RotatePrekeysResponse struct {
+	DeviceID            string       `json:"deviceId"`
+	SignedPreKey        SignedPreKey `json:"signedPreKey"`
+	AddedOneTimeKeys    int          `json:"addedOneTimePreKeys"`
+	AddedOneTimeKEMKeys int          `json:"addedOneTimeKemPreKeys"`
+}
+
+type AllocatePrekeyRequest struct {
+	DeviceID string `json:"deviceId"`
+}
+
+type PrekeyBundleResponse struct {
+	DeviceID             string         `json:"deviceId"`
+	IdentityKey          string         `json:"identityKey"`
+	IdentitySignatureKey string         `json:"identitySignatureKey"`
+	SignedPreKey         SignedPreKey   `json:"signedPreKey"`
+	OneTimePreKey        *OneTimePreKey `json:"oneTimePreKey,omitempty"`
+	KEMPreKey            *KEMPreKey     `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKey     *KEMPreKey     `json:"oneTimeKemPreKey,omitempty"`
+}
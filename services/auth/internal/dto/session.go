@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	DeviceID   string     `json:"deviceId,omitempty"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	Platform   string     `json:"platform,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"userAgent,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
@@ -0,0 +1,15 @@
+// Package events holds the domain events auth emits through its outbox.
+// The EventType strings are the routing keys other services subscribe to.
+package events
+
+const (
+	TypeUserRegistered   = "auth.user.registered"
+	TypeDeviceRegistered = "auth.device.registered"
+	TypeDeviceRevoked    = "auth.device.revoked"
+	TypeSessionRevoked   = "auth.session.revoked"
+)
+
+func (UserRegistered) EventType() string   { return TypeUserRegistered }
+func (DeviceRegistered) EventType() string { return TypeDeviceRegistered }
+func (DeviceRevoked) EventType() string    { return TypeDeviceRevoked }
+func (SessionRevoked) EventType() string   { return TypeSessionRevoked }
@@ -5,5 +5,15 @@ import "time"
 type SessionRevoked struct {
 	SessionID string    `json:"sessionId"`
 	UserID    string    `json:"userId"`
+	Reason    string    `json:"reason,omitempty"`
 	At        time.Time `json:"at"`
 }
+
+// Reasons carried by SessionRevoked.
+const (
+	// SessionRevokedReasonRefreshReuse marks sessions killed because a
+	// superseded refresh token was presented again.
+	SessionRevokedReasonRefreshReuse = "refresh_token_reuse"
+	SessionRevokedReasonUser         = "user"
+	SessionRevokedReasonDevice       = "device_revoked"
+)
@@ -0,0 +1,88 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+)
+
+// Client calls the keys service on behalf of an authenticated caller.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	base := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = "http://localhost:8082"
+	}
+	return &Client{
+		baseURL: base,
+		http:    &http.Client{Timeout: 5 * time.Second, Transport: otelhttp.NewTransport(nil)},
+	}
+}
+
+// RotateSignedPreKey replaces the device's signed prekey and uploads fresh one-time prekeys.
+func (c *Client) RotateSignedPreKey(ctx context.Context, token string, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error) {
+	var res dto.RotatePrekeysResponse
+	data, err := json.Marshal(req)
+	if err != nil {
+		return res, err
+	}
+	err = c.do(ctx, http.MethodPost, "/keys/rotate-signed-prekey", token, bytes.NewReader(data), &res)
+	return res, err
+}
+
+// FetchBundle returns the device's prekey bundle. Keys hands out each
+// one-time prekey at most once.
+func (c *Client) FetchBundle(ctx context.Context, token string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error) {
+	var res dto.PrekeyBundleResponse
+	path := "/keys/bundle?device_id=" + url.QueryEscape(deviceID.String())
+	err := c.do(ctx, http.MethodGet, path, token, nil, &res)
+	return res, err
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(token))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrKeysUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return domain.ErrDeviceNotFound
+	case resp.StatusCode == http.StatusGone, resp.StatusCode == http.StatusConflict:
+		return domain.ErrDeviceRevoked
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", domain.ErrKeysUnavailable, resp.Status)
+	case resp.StatusCode >= 400:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(bytes.TrimSpace(msg)) == 0 {
+			msg = []byte(resp.Status)
+		}
+		return fmt.Errorf("keys: %s", strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,31 +1,18 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
 
-var (
-	HTTPRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests.",
-		},
-		[]string{"service", "method", "path", "status"},
-	)
-
-	HTTPRequestDurationSeconds = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests.",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"service", "method", "path"},
-	)
+	obsmetrics "observability/metrics"
+)
 
+var (
 	AuthRegistrationsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "auth_registrations_total",
 			Help: "Total number of registration attempts.",
 		},
-		[]string{"service", "result"},
+		[]string{"result"},
 	)
 
 	AuthLoginsTotal = prometheus.NewCounterVec(
@@ -33,7 +20,7 @@ var (
 			Name: "auth_logins_total",
 			Help: "Total number of login attempts.",
 		},
-		[]string{"service", "result"},
+		[]string{"result"},
 	)
 
 	TokensIssuedTotal = prometheus.NewCounterVec(
@@ -41,22 +28,24 @@ var (
 			Name: "auth_tokens_issued_total",
 			Help: "Total number of tokens issued or refreshed.",
 		},
-		[]string{"service", "flow", "result"},
+		[]string{"flow", "result"},
 	)
-)
 
-func MustRegister(serviceName string) {
-	HTTPRequestsTotal = HTTPRequestsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	HTTPRequestDurationSeconds = HTTPRequestDurationSeconds.MustCurryWith(prometheus.Labels{"service": serviceName}).(*prometheus.HistogramVec)
-	AuthRegistrationsTotal = AuthRegistrationsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	AuthLoginsTotal = AuthLoginsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	TokensIssuedTotal = TokensIssuedTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
+	RefreshTokenReuseTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "auth_refresh_token_reuse_total",
+			Help: "Total number of superseded refresh tokens presented again; each revokes its session.",
+		},
+	)
+)
 
-	prometheus.MustRegister(
-		HTTPRequestsTotal,
-		HTTPRequestDurationSeconds,
+// MustRegister registers the shared HTTP metrics and the auth metrics
+// under the given service and environment labels.
+func MustRegister(serviceName, environment string) {
+	obsmetrics.MustRegister(serviceName, environment,
 		AuthRegistrationsTotal,
 		AuthLoginsTotal,
 		TokensIssuedTotal,
+		RefreshTokenReuseTotal,
 	)
 }
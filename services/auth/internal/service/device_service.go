@@ -3,6 +3,7 @@ package service
 import (
 	"auth/internal/domain"
 	"context"
+	"time"
 )
 
 type DeviceService interface {
@@ -14,4 +15,5 @@ type DeviceService interface {
 	Revoke(ctx context.Context, deviceID domain.DeviceID) error
 	ResolveFirstActiveByUsername(ctx context.Context, username string) (*domain.User, *domain.Device, error)
 	ResolveActiveByDeviceID(ctx context.Context, deviceID domain.DeviceID) (*domain.User, *domain.Device, error)
+	ListRevoked(ctx context.Context, after time.Time, afterID domain.DeviceID, limit int) ([]*domain.Device, error)
 }
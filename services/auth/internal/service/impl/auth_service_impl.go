@@ -9,17 +9,22 @@ import (
 
 	"auth/internal/domain"
 	"auth/internal/dto"
-	"auth/internal/observability/middleware"
+	"auth/internal/events"
 	"auth/internal/service"
 	"auth/internal/store"
 
 	"github.com/google/uuid"
+
+	"eventbus"
+	"observability/middleware"
 )
 
 type AuthServiceImpl struct {
 	Store           dataStore
 	PasswordService service.PasswordService
 	TService        service.TokenService
+	// Limiter, when set, locks out accounts and IPs after repeated failures.
+	Limiter *LoginLimiter
 }
 
 func NewAuthServiceImpl(store *store.Store, passwordService service.PasswordService, tokenService service.TokenService) *AuthServiceImpl {
@@ -37,6 +42,7 @@ type dataStore interface {
 type storeTx interface {
 	Users() userStore
 	Credentials() credentialStore
+	Outbox() outboxStore
 }
 
 type userStore interface {
@@ -50,6 +56,10 @@ type credentialStore interface {
 	GetPasswordByUserID(ctx context.Context, userID uuid.UUID) (*domain.PasswordCredential, error)
 }
 
+type outboxStore interface {
+	Append(ctx context.Context, evt eventbus.Event) error
+}
+
 type gormStoreAdapter struct {
 	store *store.Store
 }
@@ -71,6 +81,8 @@ func (g gormTxAdapter) Users() userStore { return g.tx.Users() }
 
 func (g gormTxAdapter) Credentials() credentialStore { return g.tx.Credentials() }
 
+func (g gormTxAdapter) Outbox() outboxStore { return g.tx.Outbox() }
+
 func (a *AuthServiceImpl) Register(ctx context.Context, r dto.RegisterRequest, ip, ua string) (*dto.RegisterResponse, error) {
 	// 1) basic validation
 	if r.Email == "" || r.Username == "" {
@@ -128,6 +140,13 @@ func (a *AuthServiceImpl) Register(ctx context.Context, r dto.RegisterRequest, i
 		// (Optional) create email verification token + send email via a.Email
 		// You’ll implement email_verifications store later.
 
+		if err := tx.Outbox().Append(ctx, events.UserRegistered{
+			UserID: u.ID.String(),
+			At:     now,
+		}); err != nil {
+			return err
+		}
+
 		out = dto.RegisterResponse{
 			UserID:                    u.ID.String(),
 			RequiresEmailVerification: true,
@@ -162,6 +181,12 @@ func (a *AuthServiceImpl) Login(ctx context.Context, r dto.LoginRequest, ip, ua
 	if r.EmailOrUsername == "" || r.Password == "" {
 		return nil, ErrEmptyCredential
 	}
+	if a.Limiter != nil {
+		if err := a.Limiter.Check(r.EmailOrUsername, ip); err != nil {
+			slog.Warn("auth login rate limited", "ip", ip, "request_id", middleware.RequestIDFromContext(ctx), "trace_id", middleware.TraceIDFromContext(ctx))
+			return nil, err
+		}
+	}
 
 	var user *domain.User
 	// We might need a tx if we rehash the password (write). Keep it simple: always use WithTx.
@@ -222,6 +247,14 @@ func (a *AuthServiceImpl) Login(ctx context.Context, r dto.LoginRequest, ip, ua
 
 		return nil
 	})
+	if a.Limiter != nil {
+		switch {
+		case err == nil:
+			a.Limiter.Success(r.EmailOrUsername)
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			a.Limiter.Failure(r.EmailOrUsername, ip)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
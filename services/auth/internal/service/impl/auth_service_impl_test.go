@@ -9,8 +9,11 @@ import (
 
 	"auth/internal/domain"
 	"auth/internal/dto"
+	"auth/internal/events"
 
 	"github.com/google/uuid"
+
+	"eventbus"
 )
 
 type stubPasswordService struct {
@@ -101,6 +104,7 @@ type memoryStore struct {
 	emailIndex  map[string]uuid.UUID
 	usernameIdx map[string]uuid.UUID
 	credentials map[uuid.UUID]*domain.PasswordCredential
+	outbox      []eventbus.Event
 }
 
 type storeSnapshot struct {
@@ -108,6 +112,7 @@ type storeSnapshot struct {
 	emailIndex  map[string]uuid.UUID
 	usernameIdx map[string]uuid.UUID
 	credentials map[uuid.UUID]*domain.PasswordCredential
+	outbox      []eventbus.Event
 }
 
 func newMemoryStore() *memoryStore {
@@ -156,6 +161,7 @@ func (m *memoryStore) snapshot() storeSnapshot {
 		emailIndex:  emails,
 		usernameIdx: usernames,
 		credentials: creds,
+		outbox:      append([]eventbus.Event(nil), m.outbox...),
 	}
 }
 
@@ -164,6 +170,7 @@ func (m *memoryStore) restore(s storeSnapshot) {
 	m.emailIndex = s.emailIndex
 	m.usernameIdx = s.usernameIdx
 	m.credentials = s.credentials
+	m.outbox = s.outbox
 }
 
 func (m *memoryStore) userByEmail(email string) (*domain.User, bool) {
@@ -196,6 +203,17 @@ func (m *memoryTx) Users() userStore { return &memoryUserStore{store: m.store} }
 
 func (m *memoryTx) Credentials() credentialStore { return &memoryCredentialStore{store: m.store} }
 
+func (m *memoryTx) Outbox() outboxStore { return &memoryOutboxStore{store: m.store} }
+
+type memoryOutboxStore struct {
+	store *memoryStore
+}
+
+func (m *memoryOutboxStore) Append(_ context.Context, evt eventbus.Event) error {
+	m.store.outbox = append(m.store.outbox, evt)
+	return nil
+}
+
 type memoryUserStore struct {
 	store *memoryStore
 }
@@ -291,6 +309,13 @@ func TestAuthServiceRegisterCreatesUserAndPasswordCredential(t *testing.T) {
 	if cred.PasswordVer != 1 {
 		t.Fatalf("unexpected password version: %d", cred.PasswordVer)
 	}
+
+	if len(store.outbox) != 1 {
+		t.Fatalf("expected one outbox event, got %d", len(store.outbox))
+	}
+	if evt, ok := store.outbox[0].(events.UserRegistered); !ok || evt.UserID != resp.UserID {
+		t.Fatalf("expected UserRegistered for %s, got %+v", resp.UserID, store.outbox[0])
+	}
 }
 
 func TestAuthServiceRegisterValidations(t *testing.T) {
@@ -460,3 +485,62 @@ func TestAuthServiceLoginRehashesWhenNeeded(t *testing.T) {
 		t.Fatalf("expected password version 2, got %d", stored.PasswordVer)
 	}
 }
+
+func TestAuthServiceLoginLocksOutAfterRepeatedFailures(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	user := &domain.User{ID: uuid.New(), Email: "eve@example.com", Username: "eve", CreatedAt: now, UpdatedAt: now}
+	cred := &domain.PasswordCredential{ID: uuid.New(), UserID: user.ID, Algo: "argon2id", Hash: []byte("h"), Salt: []byte("s"), ParamsJSON: []byte("p"), PasswordVer: 1, CreatedAt: now, UpdatedAt: now}
+	if err := store.WithTx(ctx, func(tx storeTx) error {
+		if err := tx.Users().Create(ctx, user); err != nil {
+			return err
+		}
+		return tx.Credentials().UpsertPassword(ctx, cred)
+	}); err != nil {
+		t.Fatalf("failed to seed store: %v", err)
+	}
+
+	ps := &stubPasswordService{}
+	svc := &AuthServiceImpl{
+		Store:           store,
+		PasswordService: ps,
+		TService:        &stubTokenService{issueResponse: &dto.TokenResponse{AccessToken: "access"}},
+		Limiter:         NewLoginLimiter(3, 100, time.Minute),
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := svc.Login(ctx, dto.LoginRequest{EmailOrUsername: "eve", Password: "wrong"}, "10.0.0.2", "unit-test")
+		if !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected invalid credentials, got %v", i+1, err)
+		}
+	}
+
+	// The account is locked even for the right password and a different
+	// address, and the password is not checked at all.
+	ps.verifyFunc = func(string, interface {
+		GetAlgo() string
+		GetHash() []byte
+		GetSalt() []byte
+		GetParamsJSON() []byte
+		GetPasswordVer() int
+	},
+	) (bool, bool) {
+		return false, true
+	}
+	verifies := len(ps.verifyCalls)
+	_, err := svc.Login(ctx, dto.LoginRequest{EmailOrUsername: "EVE", Password: "right"}, "10.0.0.3", "unit-test")
+	var limited *domain.RateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, domain.ErrRateLimited) || limited.RetryAfter <= 0 {
+		t.Fatalf("expected a rate limit error with a retry delay, got %v", err)
+	}
+	if len(ps.verifyCalls) != verifies {
+		t.Fatalf("expected no password verification while locked out")
+	}
+
+	svc.Limiter.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := svc.Login(ctx, dto.LoginRequest{EmailOrUsername: "eve", Password: "right"}, "10.0.0.3", "unit-test"); err != nil {
+		t.Fatalf("expected login to succeed once the window passed, got %v", err)
+	}
+}
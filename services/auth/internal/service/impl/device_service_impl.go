@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"auth/internal/domain"
+	"auth/internal/events"
 	"auth/internal/service"
 	"auth/internal/store"
 
@@ -63,7 +64,11 @@ func (d *DeviceServiceImpl) Register(
 		if err := tx.Devices().Create(ctx, device); err != nil {
 			return err
 		}
-		return nil
+		return tx.Outbox().Append(ctx, events.DeviceRegistered{
+			DeviceID: device.ID.String(),
+			UserID:   device.UserID.String(),
+			At:       now,
+		})
 	}); err != nil {
 		return nil, err
 	}
@@ -90,7 +95,11 @@ func (d *DeviceServiceImpl) Revoke(ctx context.Context, deviceID domain.DeviceID
 		if err := tx.Devices().Revoke(ctx, uuid.UUID(deviceID)); err != nil {
 			return translateDeviceErr(err)
 		}
-		return translateDeviceErr(tx.Devices().Revoke(ctx, uuid.UUID(deviceID)))
+		return tx.Outbox().Append(ctx, events.DeviceRevoked{
+			DeviceID: dev.ID.String(),
+			UserID:   dev.UserID.String(),
+			At:       d.nowTime(),
+		})
 	})
 }
 
@@ -146,6 +155,21 @@ func (d *DeviceServiceImpl) ResolveActiveByDeviceID(ctx context.Context, deviceI
 	return user, device, nil
 }
 
+// maxRevokedPage caps how many revocations one ListRevoked call returns.
+const maxRevokedPage = 1000
+
+// ListRevoked pages through revoked devices in revocation order, so keys and
+// messages can repair revocations they missed on the event bus.
+func (d *DeviceServiceImpl) ListRevoked(ctx context.Context, after time.Time, afterID domain.DeviceID, limit int) ([]*domain.Device, error) {
+	if err := d.ensureStore(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxRevokedPage {
+		limit = maxRevokedPage
+	}
+	return d.store.Devices().ListRevokedAfter(ctx, after.UTC(), uuid.UUID(afterID), limit)
+}
+
 func (d *DeviceServiceImpl) ensureStore() error {
 	if d.store == nil {
 		return errors.New("device store not configured")
@@ -0,0 +1,120 @@
+package impl
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"auth/internal/domain"
+)
+
+// LoginLimiter counts failed logins per account and per client IP and locks
+// the key out once it reaches its limit within the window. Counts live in
+// process memory, so each auth replica enforces its own share.
+type LoginLimiter struct {
+	accountLimit int
+	ipLimit      int
+	window       time.Duration
+	now          func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+const maxTrackedLoginKeys = 10000
+
+type loginFailures struct {
+	count int
+	reset time.Time
+}
+
+// NewLoginLimiter allows accountLimit failures per account and ipLimit per IP
+// in each window. A limit of zero or less disables that key.
+func NewLoginLimiter(accountLimit, ipLimit int, window time.Duration) *LoginLimiter {
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	return &LoginLimiter{
+		accountLimit: accountLimit,
+		ipLimit:      ipLimit,
+		window:       window,
+		now:          time.Now,
+		failures:     make(map[string]*loginFailures),
+	}
+}
+
+// Check returns a *domain.RateLimitError if the account or IP is locked out.
+func (l *LoginLimiter) Check(account, ip string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var wait time.Duration
+	for key, limit := range l.keys(account, ip) {
+		f, ok := l.failures[key]
+		if !ok || limit <= 0 {
+			continue
+		}
+		if !now.Before(f.reset) {
+			delete(l.failures, key)
+			continue
+		}
+		if f.count >= limit && f.reset.Sub(now) > wait {
+			wait = f.reset.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return &domain.RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Failure records a failed attempt against the account and the IP.
+func (l *LoginLimiter) Failure(account, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.failures) >= maxTrackedLoginKeys {
+		l.sweep(now)
+	}
+	for key, limit := range l.keys(account, ip) {
+		if limit <= 0 {
+			continue
+		}
+		f, ok := l.failures[key]
+		if !ok || !now.Before(f.reset) {
+			f = &loginFailures{reset: now.Add(l.window)}
+			l.failures[key] = f
+		}
+		f.count++
+	}
+}
+
+// Success clears the account's failures. The IP keeps its count so one valid
+// login cannot reset a spray across many accounts.
+func (l *LoginLimiter) Success(account string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, accountKey(account))
+}
+
+// sweep drops expired entries so a spray over many accounts or addresses
+// does not grow the map without bound.
+func (l *LoginLimiter) sweep(now time.Time) {
+	for key, f := range l.failures {
+		if !now.Before(f.reset) {
+			delete(l.failures, key)
+		}
+	}
+}
+
+func (l *LoginLimiter) keys(account, ip string) map[string]int {
+	keys := map[string]int{accountKey(account): l.accountLimit}
+	if ip != "" {
+		keys["ip:"+ip] = l.ipLimit
+	}
+	return keys
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,96 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/service"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+)
+
+var _ service.PrekeyService = (*PrekeyServiceImpl)(nil)
+
+// KeysClient is the part of the keys service API the prekey facade relies on.
+type KeysClient interface {
+	RotateSignedPreKey(ctx context.Context, token string, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error)
+	FetchBundle(ctx context.Context, token string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error)
+}
+
+// PrekeyServiceImpl checks device ownership and revocation against auth's
+// records, then delegates to keys, which stores the prekeys.
+type PrekeyServiceImpl struct {
+	store *store.Store
+	keys  KeysClient
+}
+
+func NewPrekeyServiceImpl(st *store.Store, keys KeysClient) *PrekeyServiceImpl {
+	return &PrekeyServiceImpl{store: st, keys: keys}
+}
+
+// Rotate replaces the signed prekey of one of the user's own devices.
+func (s *PrekeyServiceImpl) Rotate(ctx context.Context, token string, userID domain.UserID, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error) {
+	if err := s.ensureDeps(); err != nil {
+		return dto.RotatePrekeysResponse{}, err
+	}
+	deviceID, err := uuid.Parse(strings.TrimSpace(req.DeviceID))
+	if err != nil {
+		return dto.RotatePrekeysResponse{}, ErrInvalidDeviceID
+	}
+	device, err := s.activeDevice(ctx, deviceID)
+	if err != nil {
+		return dto.RotatePrekeysResponse{}, err
+	}
+	if device.UserID != userID {
+		return dto.RotatePrekeysResponse{}, domain.ErrDeviceNotOwned
+	}
+	req.DeviceID = deviceID.String()
+	return s.keys.RotateSignedPreKey(ctx, token, req)
+}
+
+// Allocate hands out the device's bundle with exactly one one-time prekey.
+// It fails with domain.ErrNoOneTimePrekeys once the device has run out.
+func (s *PrekeyServiceImpl) Allocate(ctx context.Context, token string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error) {
+	if err := s.ensureDeps(); err != nil {
+		return dto.PrekeyBundleResponse{}, err
+	}
+	if deviceID == uuid.Nil {
+		return dto.PrekeyBundleResponse{}, ErrInvalidDeviceID
+	}
+	if _, err := s.activeDevice(ctx, deviceID); err != nil {
+		return dto.PrekeyBundleResponse{}, err
+	}
+	bundle, err := s.keys.FetchBundle(ctx, token, deviceID)
+	if err != nil {
+		return dto.PrekeyBundleResponse{}, err
+	}
+	if bundle.OneTimePreKey == nil {
+		return dto.PrekeyBundleResponse{}, domain.ErrNoOneTimePrekeys
+	}
+	return bundle, nil
+}
+
+func (s *PrekeyServiceImpl) activeDevice(ctx context.Context, deviceID domain.DeviceID) (*domain.Device, error) {
+	device, err := s.store.Devices().Get(ctx, deviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil, domain.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+	if device.RevokedAt != nil {
+		return nil, domain.ErrDeviceRevoked
+	}
+	return device, nil
+}
+
+func (s *PrekeyServiceImpl) ensureDeps() error {
+	if s == nil || s.store == nil || s.keys == nil {
+		return errors.New("prekey service not configured")
+	}
+	return nil
+}
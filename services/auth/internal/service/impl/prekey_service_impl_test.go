@@ -0,0 +1,121 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeKeysClient struct {
+	rotated []dto.RotatePrekeysRequest
+	bundles []dto.PrekeyBundleResponse
+}
+
+func (f *fakeKeysClient) RotateSignedPreKey(_ context.Context, _ string, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error) {
+	f.rotated = append(f.rotated, req)
+	return dto.RotatePrekeysResponse{DeviceID: req.DeviceID, SignedPreKey: req.SignedPreKey, AddedOneTimeKeys: len(req.OneTimePreKeys)}, nil
+}
+
+func (f *fakeKeysClient) FetchBundle(_ context.Context, _ string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error) {
+	if len(f.bundles) == 0 {
+		return dto.PrekeyBundleResponse{DeviceID: deviceID.String(), IdentityKey: "identity"}, nil
+	}
+	b := f.bundles[0]
+	f.bundles = f.bundles[1:]
+	return b, nil
+}
+
+func setupPrekeyService(t *testing.T) (*PrekeyServiceImpl, *fakeKeysClient, *store.Store) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&domain.User{}, &domain.Device{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	st := store.New(db)
+	keys := &fakeKeysClient{}
+	return NewPrekeyServiceImpl(st, keys), keys, st
+}
+
+func createDevice(t *testing.T, st *store.Store, userID domain.UserID, revoked bool) *domain.Device {
+	t.Helper()
+	now := time.Now().UTC()
+	device := &domain.Device{ID: uuid.New(), UserID: userID, Name: "phone", Platform: "ios", CreatedAt: now, UpdatedAt: now}
+	if revoked {
+		device.RevokedAt = &now
+	}
+	if err := st.DB.Create(device).Error; err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	return device
+}
+
+func TestPrekeyRotateChecksOwnership(t *testing.T) {
+	ps, keys, st := setupPrekeyService(t)
+	ctx := context.Background()
+	owner := uuid.New()
+	device := createDevice(t, st, owner, false)
+	req := dto.RotatePrekeysRequest{
+		DeviceID:     device.ID.String(),
+		SignedPreKey: dto.SignedPreKey{PublicKey: "spk", Signature: "sig"},
+	}
+
+	if _, err := ps.Rotate(ctx, "token", uuid.New(), req); !errors.Is(err, domain.ErrDeviceNotOwned) {
+		t.Fatalf("expected ErrDeviceNotOwned for another user's device, got %v", err)
+	}
+	if len(keys.rotated) != 0 {
+		t.Fatalf("expected keys not to be called, got %d calls", len(keys.rotated))
+	}
+
+	res, err := ps.Rotate(ctx, "token", owner, req)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if res.DeviceID != device.ID.String() || len(keys.rotated) != 1 {
+		t.Fatalf("expected rotation to be forwarded, got %+v (%d calls)", res, len(keys.rotated))
+	}
+
+	revoked := createDevice(t, st, owner, true)
+	req.DeviceID = revoked.ID.String()
+	if _, err := ps.Rotate(ctx, "token", owner, req); !errors.Is(err, domain.ErrDeviceRevoked) {
+		t.Fatalf("expected ErrDeviceRevoked, got %v", err)
+	}
+}
+
+func TestPrekeyAllocateRequiresOneTimePrekey(t *testing.T) {
+	ps, keys, st := setupPrekeyService(t)
+	ctx := context.Background()
+	device := createDevice(t, st, uuid.New(), false)
+
+	keys.bundles = []dto.PrekeyBundleResponse{{
+		DeviceID:      device.ID.String(),
+		IdentityKey:   "identity",
+		OneTimePreKey: &dto.OneTimePreKey{ID: uuid.NewString(), PublicKey: "otk"},
+	}}
+	bundle, err := ps.Allocate(ctx, "token", device.ID)
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if bundle.OneTimePreKey == nil || bundle.OneTimePreKey.PublicKey != "otk" {
+		t.Fatalf("expected the allocated one-time prekey, got %+v", bundle)
+	}
+
+	if _, err := ps.Allocate(ctx, "token", device.ID); !errors.Is(err, domain.ErrNoOneTimePrekeys) {
+		t.Fatalf("expected ErrNoOneTimePrekeys once exhausted, got %v", err)
+	}
+	if _, err := ps.Allocate(ctx, "token", uuid.New()); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound for unknown device, got %v", err)
+	}
+}
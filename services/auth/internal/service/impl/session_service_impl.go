@@ -0,0 +1,159 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/events"
+	"auth/internal/service"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+)
+
+var _ service.SessionService = (*SessionServiceImpl)(nil)
+
+type SessionServiceImpl struct {
+	store *store.Store
+	now   func() time.Time
+}
+
+func NewSessionServiceImpl(st *store.Store) *SessionServiceImpl {
+	return &SessionServiceImpl{
+		store: st,
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// List returns the user's active sessions, enriched with the device they were issued for.
+func (s *SessionServiceImpl) List(ctx context.Context, userID domain.UserID, current domain.SessionID) ([]dto.SessionResponse, error) {
+	if err := s.ensureStore(); err != nil {
+		return nil, err
+	}
+	if userID == uuid.Nil {
+		return nil, ErrInvalidSessionUserID
+	}
+	sessions, err := s.store.Sessions().ListActiveForUser(ctx, uuid.UUID(userID), s.nowTime())
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.store.Devices().GetByUserID(ctx, uuid.UUID(userID))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[domain.DeviceID]*domain.Device, len(devices))
+	for _, dev := range devices {
+		byID[dev.ID] = dev
+	}
+
+	out := make([]dto.SessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		item := dto.SessionResponse{
+			ID:         sess.ID.String(),
+			IP:         sess.IP,
+			UserAgent:  sess.UserAgent,
+			CreatedAt:  sess.CreatedAt,
+			LastUsedAt: sess.LastUsedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			Current:    sess.ID == current,
+		}
+		if sess.DeviceID != nil {
+			item.DeviceID = sess.DeviceID.String()
+			if dev, ok := byID[*sess.DeviceID]; ok {
+				item.DeviceName = dev.Name
+				item.Platform = dev.Platform
+			}
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (s *SessionServiceImpl) Revoke(ctx context.Context, userID domain.UserID, sessionID domain.SessionID) error {
+	if err := s.ensureStore(); err != nil {
+		return err
+	}
+	if userID == uuid.Nil {
+		return ErrInvalidSessionUserID
+	}
+	if sessionID == uuid.Nil {
+		return ErrInvalidSessionID
+	}
+	now := s.nowTime()
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		if err := tx.Sessions().RevokeForUser(ctx, uuid.UUID(userID), uuid.UUID(sessionID), now); err != nil {
+			return err
+		}
+		return tx.Outbox().Append(ctx, sessionRevokedEvent(userID, sessionID, events.SessionRevokedReasonUser, now))
+	})
+	if errors.Is(err, store.ErrRecordNotFound) {
+		return domain.ErrSessionNotFound
+	}
+	return err
+}
+
+// RevokeOthers signs the user out everywhere except the session making the request.
+func (s *SessionServiceImpl) RevokeOthers(ctx context.Context, userID domain.UserID, current domain.SessionID) (int64, error) {
+	if err := s.ensureStore(); err != nil {
+		return 0, err
+	}
+	if userID == uuid.Nil {
+		return 0, ErrInvalidSessionUserID
+	}
+	if current == uuid.Nil {
+		return 0, ErrInvalidSessionID
+	}
+	now := s.nowTime()
+	var revoked int64
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		active, err := tx.Sessions().ListActiveForUser(ctx, uuid.UUID(userID), now)
+		if err != nil {
+			return err
+		}
+		for _, sess := range active {
+			if sess.ID == current {
+				continue
+			}
+			if err := tx.Sessions().RevokeForUser(ctx, uuid.UUID(userID), sess.ID, now); err != nil {
+				return err
+			}
+			if err := tx.Outbox().Append(ctx, sessionRevokedEvent(userID, sess.ID, events.SessionRevokedReasonUser, now)); err != nil {
+				return err
+			}
+			revoked++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+func sessionRevokedEvent(userID domain.UserID, sessionID domain.SessionID, reason string, at time.Time) events.SessionRevoked {
+	return events.SessionRevoked{
+		SessionID: sessionID.String(),
+		UserID:    userID.String(),
+		Reason:    reason,
+		At:        at,
+	}
+}
+
+func (s *SessionServiceImpl) ensureStore() error {
+	if s.store == nil {
+		return errors.New("session store not configured")
+	}
+	return nil
+}
+
+func (s *SessionServiceImpl) nowTime() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,165 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// issueSession signs user in and returns the session the tokens belong to.
+func issueSession(t *testing.T, ts *TokenServiceImpl, user *domain.User) (domain.SessionID, string) {
+	t.Helper()
+	ctx := context.Background()
+	tok, err := ts.Issue(ctx, user, nil, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	res, err := ts.VerifyAccess(ctx, dto.VerifyRequest{Token: tok.AccessToken})
+	if err != nil || !res.Valid {
+		t.Fatalf("verify access: valid=%v err=%v", res.Valid, err)
+	}
+	sessID, err := uuid.Parse(res.SessionID)
+	if err != nil {
+		t.Fatalf("parse session id: %v", err)
+	}
+	return sessID, tok.AccessToken
+}
+
+func TestSessionListMarksCurrent(t *testing.T) {
+	ts, st := setupTokenService(t)
+	svc := NewSessionServiceImpl(st)
+	ctx := context.Background()
+	user := &domain.User{ID: uuid.New()}
+
+	current, _ := issueSession(t, ts, user)
+	other, _ := issueSession(t, ts, user)
+	issueSession(t, ts, &domain.User{ID: uuid.New()})
+
+	list, err := svc.List(ctx, user.ID, current)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(list))
+	}
+	seen := map[string]bool{}
+	for _, item := range list {
+		seen[item.ID] = item.Current
+	}
+	if cur, ok := seen[current.String()]; !ok || !cur {
+		t.Fatalf("expected current session %s marked current, got %+v", current, list)
+	}
+	if cur, ok := seen[other.String()]; !ok || cur {
+		t.Fatalf("expected other session %s listed and not current, got %+v", other, list)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   bool
+		current bool
+		wantErr error
+	}{
+		{name: "other session", owner: true},
+		{name: "current session", owner: true, current: true},
+		{name: "another user's session", wantErr: domain.ErrSessionNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, st := setupTokenService(t)
+			svc := NewSessionServiceImpl(st)
+			ctx := context.Background()
+			user := &domain.User{ID: uuid.New()}
+
+			current, currentToken := issueSession(t, ts, user)
+			target, targetToken := current, currentToken
+			if !tc.current {
+				owner := user
+				if !tc.owner {
+					owner = &domain.User{ID: uuid.New()}
+				}
+				target, targetToken = issueSession(t, ts, owner)
+			}
+
+			err := svc.Revoke(ctx, user.ID, target)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+
+			res, err := ts.VerifyAccess(ctx, dto.VerifyRequest{Token: targetToken})
+			if err != nil {
+				t.Fatalf("verify access: %v", err)
+			}
+			if res.Valid == (tc.wantErr == nil) {
+				t.Fatalf("expected target session valid=%v after revoke", tc.wantErr != nil)
+			}
+
+			rows := outboxEvents(t, st)
+			if tc.wantErr != nil {
+				if len(rows) != 0 {
+					t.Fatalf("expected no events, got %d", len(rows))
+				}
+				return
+			}
+			if len(rows) != 1 || rows[0].Type != events.TypeSessionRevoked {
+				t.Fatalf("expected one %s event, got %+v", events.TypeSessionRevoked, rows)
+			}
+			var evt events.SessionRevoked
+			if err := json.Unmarshal(rows[0].Payload, &evt); err != nil {
+				t.Fatalf("decode event: %v", err)
+			}
+			if evt.SessionID != target.String() || evt.Reason != events.SessionRevokedReasonUser {
+				t.Fatalf("unexpected event %+v", evt)
+			}
+		})
+	}
+}
+
+func TestSessionRevokeRejectsNilIDs(t *testing.T) {
+	_, st := setupTokenService(t)
+	svc := NewSessionServiceImpl(st)
+	ctx := context.Background()
+
+	if err := svc.Revoke(ctx, uuid.Nil, uuid.New()); !errors.Is(err, ErrInvalidSessionUserID) {
+		t.Fatalf("expected ErrInvalidSessionUserID, got %v", err)
+	}
+	if err := svc.Revoke(ctx, uuid.New(), uuid.Nil); !errors.Is(err, ErrInvalidSessionID) {
+		t.Fatalf("expected ErrInvalidSessionID, got %v", err)
+	}
+}
+
+func TestSessionRevokeOthersKeepsCurrent(t *testing.T) {
+	ts, st := setupTokenService(t)
+	svc := NewSessionServiceImpl(st)
+	ctx := context.Background()
+	user := &domain.User{ID: uuid.New()}
+
+	current, currentToken := issueSession(t, ts, user)
+	_, otherToken := issueSession(t, ts, user)
+	_, strangerToken := issueSession(t, ts, &domain.User{ID: uuid.New()})
+
+	n, err := svc.RevokeOthers(ctx, user.ID, current)
+	if err != nil {
+		t.Fatalf("revoke others: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 revoked session, got %d", n)
+	}
+	for token, want := range map[string]bool{currentToken: true, otherToken: false, strangerToken: true} {
+		res, err := ts.VerifyAccess(ctx, dto.VerifyRequest{Token: token})
+		if err != nil {
+			t.Fatalf("verify access: %v", err)
+		}
+		if res.Valid != want {
+			t.Fatalf("expected valid=%v for session %s", want, res.SessionID)
+		}
+	}
+}
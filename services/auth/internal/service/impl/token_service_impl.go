@@ -9,14 +9,16 @@ import (
 
 	"auth/internal/domain"
 	"auth/internal/dto"
+	"auth/internal/events"
 	"auth/internal/netutil"
 	"auth/internal/observability/metrics"
-	"auth/internal/observability/middleware"
 	"auth/internal/store"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"observability/middleware"
 )
 
 // ====== Config ======
@@ -43,6 +45,9 @@ type RefreshClaims struct {
 	jwt.RegisteredClaims        // jti == refresh_id
 }
 
+// sessionTouchInterval bounds how often VerifyAccess writes last_used_at.
+const sessionTouchInterval = time.Minute
+
 // ====== Service ======
 
 type TokenServiceImpl struct {
@@ -71,15 +76,16 @@ func (t *TokenServiceImpl) Issue(
 
 	// 1) create session
 	sess := &domain.Session{
-		ID:        uuid.New(),
-		UserID:    user.ID,
-		DeviceID:  (*uuid.UUID)(deviceID), // nil safe
-		RefreshID: uuid.New(),
-		ExpiresAt: now.Add(t.cfg.RefreshTTL),
-		RevokedAt: nil,
-		CreatedAt: now,
-		IP:        ip,
-		UserAgent: ua,
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		DeviceID:   (*uuid.UUID)(deviceID), // nil safe
+		RefreshID:  uuid.New(),
+		ExpiresAt:  now.Add(t.cfg.RefreshTTL),
+		RevokedAt:  nil,
+		CreatedAt:  now,
+		LastUsedAt: &now,
+		IP:         ip,
+		UserAgent:  ua,
 	}
 	if err := t.store.Sessions().Create(ctx, sess); err != nil {
 		result = "failure"
@@ -126,10 +132,21 @@ func (t *TokenServiceImpl) Refresh(ctx context.Context, refreshToken string, ip,
 		return nil, errors.New("invalid token")
 	}
 
+	rid, err := uuid.Parse(claims.ID)
+	if err != nil {
+		result = "failure"
+		return nil, errors.New("invalid token")
+	}
+
 	// 2) lookup session by refresh_id (claims.ID) and validate state
-	sess, err := t.store.Sessions().GetByRefreshID(ctx, uuid.MustParse(claims.ID))
+	sess, err := t.store.Sessions().GetByRefreshID(ctx, rid)
 	if err != nil {
 		result = "failure"
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if reuseErr := t.detectReuse(ctx, rid, now); reuseErr != nil {
+				return nil, reuseErr
+			}
+		}
 		return nil, errors.New("invalid token")
 	}
 	if sess.RevokedAt != nil || now.After(sess.ExpiresAt) {
@@ -139,11 +156,21 @@ func (t *TokenServiceImpl) Refresh(ctx context.Context, refreshToken string, ip,
 
 	// (Optional) you can verify the IP/UA drift here if you want to bind sessions tightly.
 
-	// 3) rotate refresh id + extend session expiry
+	// 3) rotate refresh id + extend session expiry; the old id is kept as superseded
 	newRID := uuid.New()
 	newExp := now.Add(t.cfg.RefreshTTL)
-	if err := t.store.Sessions().Rotate(ctx, sess.ID, newRID, newExp, ip, ua); err != nil {
+	err = t.store.WithTx(ctx, func(tx *store.Store) error {
+		return tx.Sessions().Rotate(ctx, sess.ID, rid, newRID, newExp, ip, ua)
+	})
+	if err != nil {
 		result = "failure"
+		if errors.Is(err, store.ErrRecordNotFound) {
+			// Another refresh with the same token won the race.
+			if reuseErr := t.detectReuse(ctx, rid, now); reuseErr != nil {
+				return nil, reuseErr
+			}
+			return nil, errors.New("session expired or revoked")
+		}
 		return nil, err
 	}
 	sess.RefreshID = newRID
@@ -174,6 +201,42 @@ func (t *TokenServiceImpl) Refresh(ctx context.Context, refreshToken string, ip,
 	}, nil
 }
 
+// detectReuse checks whether rid is a refresh ID that was already rotated away.
+// If so the token has been replayed: the whole session is revoked and
+// domain.ErrTokenReused returned. A nil result means rid is simply unknown.
+func (t *TokenServiceImpl) detectReuse(ctx context.Context, rid uuid.UUID, now time.Time) error {
+	sess, err := t.store.Sessions().GetBySupersededRefreshID(ctx, rid)
+	if err != nil {
+		if !errors.Is(err, store.ErrRecordNotFound) {
+			slog.Warn("refresh reuse lookup failed", "error", err)
+		}
+		return nil
+	}
+
+	metrics.RefreshTokenReuseTotal.Inc()
+	reqID := middleware.RequestIDFromContext(ctx)
+	traceID := middleware.TraceIDFromContext(ctx)
+	slog.Warn("refresh token reuse detected", "session_id", sess.ID, "user_id", sess.UserID, "request_id", reqID, "trace_id", traceID)
+
+	if sess.RevokedAt != nil {
+		return domain.ErrTokenReused
+	}
+	if err := t.store.WithTx(ctx, func(tx *store.Store) error {
+		if err := tx.Sessions().Revoke(ctx, sess.ID, now); err != nil {
+			return err
+		}
+		return tx.Outbox().Append(ctx, events.SessionRevoked{
+			SessionID: sess.ID.String(),
+			UserID:    sess.UserID.String(),
+			Reason:    events.SessionRevokedReasonRefreshReuse,
+			At:        now,
+		})
+	}); err != nil {
+		return err
+	}
+	return domain.ErrTokenReused
+}
+
 func (t *TokenServiceImpl) RevokeSession(ctx context.Context, sessionID domain.SessionID) error {
 	return t.store.Sessions().Revoke(ctx, uuid.UUID(sessionID), time.Now().UTC())
 }
@@ -212,6 +275,9 @@ func (t *TokenServiceImpl) VerifyAccess(ctx context.Context, req dto.VerifyReque
 	if sess.RevokedAt != nil || now.After(sess.ExpiresAt) {
 		return dto.VerifyResponse{Valid: false}, nil
 	}
+	if err := t.store.Sessions().Touch(ctx, sess.ID, now, sessionTouchInterval); err != nil {
+		slog.Warn("session touch failed", "session_id", sess.ID, "error", err)
+	}
 
 	var tokenDeviceID string
 	if claims.DID != nil {
@@ -0,0 +1,145 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"auth/internal/domain"
+	"auth/internal/events"
+	"auth/internal/observability/metrics"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"eventbus"
+)
+
+func TestMain(m *testing.M) {
+	metrics.MustRegister("auth-test", "test")
+	os.Exit(m.Run())
+}
+
+func setupTokenService(t *testing.T) (*TokenServiceImpl, *store.Store) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&domain.User{}, &domain.Device{}, &domain.Session{}, &domain.SupersededRefresh{}, &eventbus.OutboxEvent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+
+	st := store.New(db)
+	ts := NewTokenServiceHS256(TokenConfig{
+		Issuer:     "test-issuer",
+		Audience:   "test-clients",
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+		SigningKey: []byte("test-signing-key"),
+	}, st)
+	return ts, st
+}
+
+func outboxEvents(t *testing.T, st *store.Store) []eventbus.OutboxEvent {
+	t.Helper()
+	var rows []eventbus.OutboxEvent
+	if err := st.DB.Order("occurred_at").Find(&rows).Error; err != nil {
+		t.Fatalf("load outbox: %v", err)
+	}
+	return rows
+}
+
+func TestRefreshRotatesAndRecordsSupersededID(t *testing.T) {
+	ts, st := setupTokenService(t)
+	ctx := context.Background()
+	user := &domain.User{ID: uuid.New()}
+
+	first, err := ts.Issue(ctx, user, nil, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	second, err := ts.Refresh(ctx, first.RefreshToken, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a new refresh token")
+	}
+
+	var count int64
+	if err := st.DB.Model(&domain.SupersededRefresh{}).Count(&count).Error; err != nil {
+		t.Fatalf("count history: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected one superseded refresh id, got %d", count)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	ts, st := setupTokenService(t)
+	ctx := context.Background()
+	user := &domain.User{ID: uuid.New()}
+
+	first, err := ts.Issue(ctx, user, nil, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	second, err := ts.Refresh(ctx, first.RefreshToken, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// Replaying the superseded token kills the session...
+	if _, err := ts.Refresh(ctx, first.RefreshToken, "10.0.0.1", "attacker"); !errors.Is(err, domain.ErrTokenReused) {
+		t.Fatalf("expected ErrTokenReused, got %v", err)
+	}
+	// ...so the legitimate holder's current token stops working too.
+	if _, err := ts.Refresh(ctx, second.RefreshToken, "127.0.0.1", "test"); err == nil {
+		t.Fatalf("expected refresh on revoked session to fail")
+	}
+
+	var sessions []domain.Session
+	if err := st.DB.Find(&sessions).Error; err != nil {
+		t.Fatalf("load sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].RevokedAt == nil {
+		t.Fatalf("expected the session to be revoked, got %+v", sessions)
+	}
+
+	rows := outboxEvents(t, st)
+	if len(rows) != 1 || rows[0].Type != events.TypeSessionRevoked {
+		t.Fatalf("expected one SessionRevoked outbox event, got %+v", rows)
+	}
+	var evt events.SessionRevoked
+	if err := json.Unmarshal(rows[0].Payload, &evt); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if evt.SessionID != sessions[0].ID.String() || evt.Reason != events.SessionRevokedReasonRefreshReuse {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestRefreshUnknownTokenIsNotReuse(t *testing.T) {
+	ts, st := setupTokenService(t)
+	ctx := context.Background()
+
+	ghost := &domain.Session{ID: uuid.New(), RefreshID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)}
+	token, err := ts.signRefresh(uuid.New(), ghost, time.Now())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := ts.Refresh(ctx, token, "127.0.0.1", "test"); err == nil || errors.Is(err, domain.ErrTokenReused) {
+		t.Fatalf("expected plain invalid token error, got %v", err)
+	}
+	if rows := outboxEvents(t, st); len(rows) != 0 {
+		t.Fatalf("expected no events, got %d", len(rows))
+	}
+}
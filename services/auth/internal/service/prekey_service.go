@@ -0,0 +1,15 @@
+package service
+
+import (
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"context"
+)
+
+// PrekeyService fronts the keys service, which owns all prekey material.
+// token is the caller's access token; it is forwarded so keys can authorise
+// the call itself.
+type PrekeyService interface {
+	Rotate(ctx context.Context, token string, userID domain.UserID, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error)
+	Allocate(ctx context.Context, token string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error)
+}
@@ -0,0 +1,13 @@
+package service
+
+import (
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"context"
+)
+
+type SessionService interface {
+	List(ctx context.Context, userID domain.UserID, current domain.SessionID) ([]dto.SessionResponse, error)
+	Revoke(ctx context.Context, userID domain.UserID, sessionID domain.SessionID) error
+	RevokeOthers(ctx context.Context, userID domain.UserID, current domain.SessionID) (int64, error)
+}
@@ -40,9 +40,6 @@ func (s *Store) DeleteUserData(ctx context.Context, userID uuid.UUID) (map[strin
 		if err := count("devices", db.Model(&domain.Device{}).Where("user_id = ?", userID)); err != nil {
 			return err
 		}
-		if err := count("deviceKeyBundles", db.Table("device_key_bundles").Joins("JOIN devices ON devices.id = device_key_bundles.device_id").Where("devices.user_id = ?", userID)); err != nil {
-			return err
-		}
 		if err := count("sessions", db.Model(&domain.Session{}).Where("user_id = ?", userID)); err != nil {
 			return err
 		}
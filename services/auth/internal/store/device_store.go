@@ -89,3 +89,16 @@ func (d *DeviceStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID) (i
 		Update("revoked_at", time.Now())
 	return tx.RowsAffected, tx.Error
 }
+
+// ListRevokedAfter returns up to limit revoked devices that come after the
+// (after, afterID) cursor, ordered by revocation time and then ID.
+func (d *DeviceStore) ListRevokedAfter(ctx context.Context, after time.Time, afterID uuid.UUID, limit int) ([]*domain.Device, error) {
+	var devices []*domain.Device
+	err := d.db.WithContext(ctx).
+		Where("revoked_at IS NOT NULL").
+		Where("revoked_at > ? OR (revoked_at = ? AND id > ?)", after, after, afterID).
+		Order("revoked_at ASC, id ASC").
+		Limit(limit).
+		Find(&devices).Error
+	return devices, err
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"auth/internal/domain"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserData is everything auth holds about a user, loaded for a data export.
+// Secrets (password hashes, TOTP seeds, recovery code hashes) are included
+// only so callers can describe them; they must never be serialised.
+type UserData struct {
+	User               domain.User
+	HasPassword        bool
+	WebAuthn           []domain.WebAuthnCredential
+	Devices            []domain.Device
+	Sessions           []domain.Session
+	TOTP               *domain.TotpMFA
+	RecoveryCodes      []domain.RecoveryCode
+	AuditLogs          []domain.AuditLog
+	EmailVerifications int64
+}
+
+// ExportUserData loads the user's records in one consistent snapshot.
+func (s *Store) ExportUserData(ctx context.Context, userID uuid.UUID) (*UserData, error) {
+	var data UserData
+
+	err := s.WithTx(ctx, func(tx *Store) error {
+		db := tx.DB.WithContext(ctx)
+
+		if err := db.First(&data.User, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+
+		var passwords int64
+		if err := db.Model(&domain.PasswordCredential{}).Where("user_id = ?", userID).Count(&passwords).Error; err != nil {
+			return err
+		}
+		data.HasPassword = passwords > 0
+
+		if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&data.WebAuthn).Error; err != nil {
+			return err
+		}
+		if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&data.Devices).Error; err != nil {
+			return err
+		}
+		if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&data.Sessions).Error; err != nil {
+			return err
+		}
+
+		var totp domain.TotpMFA
+		err := db.Where("user_id = ?", userID).Take(&totp).Error
+		switch {
+		case err == nil:
+			data.TOTP = &totp
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if err := db.Where("user_id = ?", userID).Find(&data.RecoveryCodes).Error; err != nil {
+			return err
+		}
+		if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&data.AuditLogs).Error; err != nil {
+			return err
+		}
+		return db.Model(&domain.EmailVerification{}).Where("user_id = ?", userID).Count(&data.EmailVerifications).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+
+	"eventbus"
+
+	"gorm.io/gorm"
+)
+
+// eventSource names auth in every envelope it emits.
+const eventSource = "auth"
+
+type OutboxStore struct{ db *gorm.DB }
+
+func (s *Store) Outbox() *OutboxStore { return &OutboxStore{db: s.DB} }
+
+// Append records evt for the relay. Call it on the transaction that makes the
+// change the event announces, so both commit or neither does.
+func (o *OutboxStore) Append(ctx context.Context, evt eventbus.Event) error {
+	return eventbus.Append(ctx, o.db, eventSource, evt)
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"auth/internal/domain"
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -54,14 +55,89 @@ func (ss *SessionStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID,
 	return tx.RowsAffected, tx.Error
 }
 
-func (ss *SessionStore) Rotate(ctx context.Context, sessionID uuid.UUID, newRefreshID uuid.UUID, newExpiresAt time.Time, ip, ua string) error {
-	return ss.db.WithContext(ctx).
+// Rotate swaps the session's refresh ID from oldRefreshID to newRefreshID and
+// records the old one as superseded. It returns ErrRecordNotFound when the
+// session is revoked or oldRefreshID is no longer current, which happens when
+// two refreshes race with the same token. Call it inside WithTx.
+func (ss *SessionStore) Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID uuid.UUID, newExpiresAt time.Time, ip, ua string) error {
+	now := time.Now().UTC()
+	tx := ss.db.WithContext(ctx).
 		Model(&domain.Session{}).
-		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Where("id = ? AND refresh_id = ? AND revoked_at IS NULL", sessionID, oldRefreshID).
 		Updates(map[string]interface{}{
-			"refresh_id": newRefreshID,
-			"expires_at": newExpiresAt,
-			"ip":         ip,
-			"user_agent": ua,
-		}).Error
+			"refresh_id":   newRefreshID,
+			"expires_at":   newExpiresAt,
+			"last_used_at": now,
+			"ip":           ip,
+			"user_agent":   ua,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return ss.db.WithContext(ctx).Create(&domain.SupersededRefresh{
+		RefreshID:    oldRefreshID,
+		SessionID:    sessionID,
+		SupersededAt: now,
+	}).Error
+}
+
+// GetBySupersededRefreshID finds the session a rotated-away refresh ID used to belong to.
+func (ss *SessionStore) GetBySupersededRefreshID(ctx context.Context, rid uuid.UUID) (*domain.Session, error) {
+	var rec domain.SupersededRefresh
+	if err := ss.db.WithContext(ctx).First(&rec, "refresh_id = ?", rid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return ss.GetByID(ctx, rec.SessionID)
+}
+
+// ListActiveForUser returns the user's non-revoked, unexpired sessions, newest first.
+func (ss *SessionStore) ListActiveForUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]*domain.Session, error) {
+	var sessions []*domain.Session
+	if err := ss.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeForUser revokes a single session, scoped to its owner so a caller can
+// never revoke somebody else's session by guessing an id.
+func (ss *SessionStore) RevokeForUser(ctx context.Context, userID, id uuid.UUID, at time.Time) error {
+	tx := ss.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUserExcept revokes every active session of the user apart from keepID.
+func (ss *SessionStore) RevokeAllForUserExcept(ctx context.Context, userID, keepID uuid.UUID, at time.Time) (int64, error) {
+	tx := ss.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", at)
+	return tx.RowsAffected, tx.Error
+}
+
+// Touch records activity on a session. Writes are throttled to once per
+// interval so that verifying every request does not hammer the table.
+func (ss *SessionStore) Touch(ctx context.Context, id uuid.UUID, at time.Time, interval time.Duration) error {
+	return ss.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at.Add(-interval)).
+		Update("last_used_at", at).Error
 }
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"encoding/json"
+	"time"
+
+	"auth/internal/dto"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// userExport maps the stored rows to the export document, dropping every
+// secret on the way.
+func userExport(data *store.UserData, now time.Time) dto.UserExportResponse {
+	resp := dto.UserExportResponse{
+		Service:     "auth",
+		GeneratedAt: now,
+		Profile: dto.ExportProfile{
+			ID:                 data.User.ID.String(),
+			Email:              data.User.Email,
+			EmailVerified:      data.User.EmailVerified,
+			Username:           data.User.Username,
+			Disabled:           data.User.IsDisabled,
+			EmailVerifications: data.EmailVerifications,
+			CreatedAt:          data.User.CreatedAt,
+			UpdatedAt:          data.User.UpdatedAt,
+		},
+		Credentials: dto.ExportCredentials{
+			Password: data.HasPassword,
+			WebAuthn: make([]dto.ExportWebAuthnCredential, 0, len(data.WebAuthn)),
+		},
+		Devices:  make([]dto.ExportDevice, 0, len(data.Devices)),
+		Sessions: make([]dto.ExportSession, 0, len(data.Sessions)),
+		AuditLog: make([]dto.ExportAuditLogEntry, 0, len(data.AuditLogs)),
+	}
+
+	for _, c := range data.WebAuthn {
+		resp.Credentials.WebAuthn = append(resp.Credentials.WebAuthn, dto.ExportWebAuthnCredential{
+			ID:        c.ID.String(),
+			SignCount: c.SignCount,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+
+	if data.TOTP != nil {
+		resp.MFA.TOTPEnrolled = true
+		resp.MFA.TOTPEnabled = data.TOTP.IsEnabled
+	}
+	resp.MFA.RecoveryCodesIssued = len(data.RecoveryCodes)
+	for _, rc := range data.RecoveryCodes {
+		if rc.UsedAt == nil {
+			resp.MFA.RecoveryCodesRemaining++
+		}
+	}
+
+	for _, d := range data.Devices {
+		resp.Devices = append(resp.Devices, dto.ExportDevice{
+			ID:        d.ID.String(),
+			Name:      d.Name,
+			Platform:  d.Platform,
+			HasPush:   d.PushToken != nil && *d.PushToken != "",
+			CreatedAt: d.CreatedAt,
+			RevokedAt: d.RevokedAt,
+		})
+	}
+
+	for _, s := range data.Sessions {
+		entry := dto.ExportSession{
+			ID:         s.ID.String(),
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			RevokedAt:  s.RevokedAt,
+		}
+		if s.DeviceID != nil {
+			entry.DeviceID = s.DeviceID.String()
+		}
+		resp.Sessions = append(resp.Sessions, entry)
+	}
+
+	for _, a := range data.AuditLogs {
+		entry := dto.ExportAuditLogEntry{
+			ID:        uuid.UUID(a.ID).String(),
+			Action:    a.Action,
+			IP:        a.IP,
+			UserAgent: a.UserAgent,
+			CreatedAt: a.CreatedAt,
+		}
+		if len(a.Metadata) > 0 && json.Valid(a.Metadata) {
+			entry.Metadata = json.RawMessage(a.Metadata)
+		}
+		resp.AuditLog = append(resp.AuditLog, entry)
+	}
+
+	return resp
+}
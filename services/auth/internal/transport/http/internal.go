@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/service"
+
+	"github.com/google/uuid"
+
+	"identity"
+	"identity/revocations"
+)
+
+// RegisterInternal adds the routes keys and messages call on their own
+// behalf. The gateway does not proxy them, and every request must carry an
+// identity header signed with signer.SignService.
+func RegisterInternal(mux *http.ServeMux, devices service.DeviceService, signer *identity.Signer) {
+	mux.HandleFunc(revocations.Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		caller, err := signer.VerifyService(r.Header.Get(identity.Header), r.Method, r.URL.Path)
+		if err != nil {
+			slog.Warn("internal call rejected", "path", r.URL.Path, "error", err)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		var after time.Time
+		if v := strings.TrimSpace(q.Get("after")); v != "" {
+			if after, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				http.Error(w, "invalid after", http.StatusBadRequest)
+				return
+			}
+		}
+		var afterID uuid.UUID
+		if v := strings.TrimSpace(q.Get("afterId")); v != "" {
+			if afterID, err = uuid.Parse(v); err != nil {
+				http.Error(w, "invalid afterId", http.StatusBadRequest)
+				return
+			}
+		}
+		limit := 0
+		if v := strings.TrimSpace(q.Get("limit")); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		list, err := devices.ListRevoked(r.Context(), after, domain.DeviceID(afterID), limit)
+		if err != nil {
+			slog.Warn("list revoked devices failed", "caller", caller, "error", err)
+			http.Error(w, "list failed", http.StatusInternalServerError)
+			return
+		}
+		out := dto.RevokedDevicesResponse{Devices: make([]dto.RevokedDevice, 0, len(list))}
+		for _, dev := range list {
+			out.Devices = append(out.Devices, dto.RevokedDevice{
+				DeviceID:  dev.ID.String(),
+				UserID:    dev.UserID.String(),
+				RevokedAt: dev.RevokedAt.UTC(),
+			})
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,12 +13,13 @@ import (
 	"auth/internal/dto"
 	"auth/internal/netutil"
 	"auth/internal/observability/metrics"
-	"auth/internal/observability/middleware"
 	"auth/internal/service"
 	"auth/internal/store"
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"observability/middleware"
 )
 
 func clientIP(r *http.Request) string {
@@ -42,7 +44,7 @@ func clientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
-func NewRouter(auth service.AuthService, devices service.DeviceService, tokens service.TokenService, st *store.Store) *http.ServeMux {
+func NewRouter(auth service.AuthService, devices service.DeviceService, tokens service.TokenService, sessions service.SessionService, prekeys service.PrekeyService, st *store.Store) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -95,6 +97,14 @@ func NewRouter(auth service.AuthService, devices service.DeviceService, tokens s
 		}
 		ip := clientIP(r)
 		res, err := auth.Login(r.Context(), req, ip, r.UserAgent())
+		var limited *domain.RateLimitError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			metrics.AuthLoginsTotal.WithLabelValues("rate_limited").Inc()
+			slog.Warn("login rate limited", "retry_after", limited.RetryAfter, "request_id", reqID, "trace_id", traceID)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			metrics.AuthLoginsTotal.WithLabelValues("failure").Inc()
@@ -289,6 +299,123 @@ func NewRouter(auth service.AuthService, devices service.DeviceService, tokens s
 		w.WriteHeader(http.StatusNoContent)
 	})
 
+	mux.HandleFunc("/v1/devices/rotate-prekeys", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req dto.RotatePrekeysRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		deviceID, err := uuid.Parse(strings.TrimSpace(req.DeviceID))
+		if err != nil {
+			http.Error(w, "invalid deviceId", http.StatusBadRequest)
+			return
+		}
+		res, ok := requireToken(w, r, tokens, deviceID.String())
+		if !ok {
+			return
+		}
+		userID, err := uuid.Parse(res.UserID)
+		if err != nil {
+			http.Error(w, "invalid token subject", http.StatusUnauthorized)
+			return
+		}
+		rotated, err := prekeys.Rotate(r.Context(), bearerToken(r), domain.UserID(userID), req)
+		if err != nil {
+			writeDeviceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rotated)
+	})
+
+	mux.HandleFunc("/v1/devices/allocate-prekey", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body dto.AllocatePrekeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		deviceID, err := uuid.Parse(strings.TrimSpace(body.DeviceID))
+		if err != nil {
+			http.Error(w, "invalid deviceId", http.StatusBadRequest)
+			return
+		}
+		if _, ok := requireToken(w, r, tokens, ""); !ok {
+			return
+		}
+		bundle, err := prekeys.Allocate(r.Context(), bearerToken(r), domain.DeviceID(deviceID))
+		if err != nil {
+			writeDeviceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, bundle)
+	})
+
+	mux.HandleFunc("/v1/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, sessionID, ok := requireSession(w, r, tokens)
+		if !ok {
+			return
+		}
+		list, err := sessions.List(r.Context(), userID, sessionID)
+		if err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, dto.SessionListResponse{Sessions: list})
+	})
+
+	mux.HandleFunc("/v1/sessions/revoke-others", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, sessionID, ok := requireSession(w, r, tokens)
+		if !ok {
+			return
+		}
+		n, err := sessions.RevokeOthers(r.Context(), userID, sessionID)
+		if err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		slog.Info("revoked other sessions", "user_id", userID, "session_id", sessionID, "revoked", n,
+			"request_id", middleware.RequestIDFromContext(r.Context()), "trace_id", middleware.TraceIDFromContext(r.Context()))
+		writeJSON(w, http.StatusOK, dto.RevokeSessionsResponse{Revoked: n})
+	})
+
+	mux.HandleFunc("/v1/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := uuid.Parse(strings.TrimSpace(r.PathValue("id")))
+		if err != nil {
+			http.Error(w, "invalid session id", http.StatusBadRequest)
+			return
+		}
+		userID, _, ok := requireSession(w, r, tokens)
+		if !ok {
+			return
+		}
+		if err := sessions.Revoke(r.Context(), userID, domain.SessionID(target)); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		slog.Info("session revoked", "user_id", userID, "session_id", target,
+			"request_id", middleware.RequestIDFromContext(r.Context()), "trace_id", middleware.TraceIDFromContext(r.Context()))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
 	mux.HandleFunc("/v1/users/me", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -324,6 +451,40 @@ func NewRouter(auth service.AuthService, devices service.DeviceService, tokens s
 		writeJSON(w, http.StatusOK, resp)
 	})
 
+	mux.HandleFunc("/v1/users/me/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if st == nil {
+			http.Error(w, "store unavailable", http.StatusInternalServerError)
+			return
+		}
+		res, ok := requireToken(w, r, tokens, "")
+		if !ok {
+			return
+		}
+		userID, err := uuid.Parse(res.UserID)
+		if err != nil {
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+		data, err := st.ExportUserData(r.Context(), userID)
+		if errors.Is(err, store.ErrRecordNotFound) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("user export failed", "error", err, "user_id", userID,
+				"request_id", middleware.RequestIDFromContext(r.Context()), "trace_id", middleware.TraceIDFromContext(r.Context()))
+			http.Error(w, "export failed", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("user data exported", "user_id", userID,
+			"request_id", middleware.RequestIDFromContext(r.Context()), "trace_id", middleware.TraceIDFromContext(r.Context()))
+		writeJSON(w, http.StatusOK, userExport(data, time.Now().UTC()))
+	})
+
 	return mux
 }
 
@@ -344,14 +505,36 @@ func writeDeviceError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, domain.ErrDeviceNotFound):
 		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrDeviceNotOwned):
+		status = http.StatusForbidden
 	case errors.Is(err, domain.ErrDeviceRevoked):
 		status = http.StatusConflict
 	case errors.Is(err, domain.ErrNoOneTimePrekeys):
 		status = http.StatusConflict
+	case errors.Is(err, domain.ErrKeysUnavailable):
+		status = http.StatusBadGateway
 	}
 	http.Error(w, err.Error(), status)
 }
 
+func writeSessionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// retryAfterSeconds formats d for a Retry-After header, rounding up so
+// clients never retry early.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
 func bearerToken(r *http.Request) string {
 	authz := strings.TrimSpace(r.Header.Get("Authorization"))
 	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
@@ -386,3 +569,22 @@ func requireToken(w http.ResponseWriter, r *http.Request, tokens service.TokenSe
 	}
 	return &res, true
 }
+
+// requireSession verifies the bearer token and returns the caller's user and session ids.
+func requireSession(w http.ResponseWriter, r *http.Request, tokens service.TokenService) (domain.UserID, domain.SessionID, bool) {
+	res, ok := requireToken(w, r, tokens, "")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(res.UserID)
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	sessionID, err := uuid.Parse(res.SessionID)
+	if err != nil {
+		http.Error(w, "invalid session id", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, sessionID, true
+}
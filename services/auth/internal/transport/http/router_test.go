@@ -0,0 +1,319 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"auth/internal/domain"
+	"auth/internal/dto"
+	"auth/internal/observability/metrics"
+	"auth/internal/service/impl"
+	"auth/internal/store"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"eventbus"
+	"identity"
+	"identity/revocations"
+)
+
+func TestMain(m *testing.M) {
+	metrics.MustRegister("auth-test", "test")
+	os.Exit(m.Run())
+}
+
+type sessionFixture struct {
+	mux    *http.ServeMux
+	tokens *impl.TokenServiceImpl
+	st     *store.Store
+}
+
+func newSessionFixture(t *testing.T) *sessionFixture {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&domain.User{}, &domain.Device{}, &domain.Session{}, &domain.SupersededRefresh{}, &eventbus.OutboxEvent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	st := store.New(db)
+	tokens := impl.NewTokenServiceHS256(impl.TokenConfig{
+		Issuer:     "test-issuer",
+		Audience:   "test-clients",
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+		SigningKey: []byte("test-signing-key"),
+	}, st)
+	sessions := impl.NewSessionServiceImpl(st)
+	return &sessionFixture{
+		mux:    NewRouter(nil, nil, tokens, sessions, nil, st),
+		tokens: tokens,
+		st:     st,
+	}
+}
+
+// signIn issues tokens for user and returns the access token and its session id.
+func (f *sessionFixture) signIn(t *testing.T, user *domain.User) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	tok, err := f.tokens.Issue(ctx, user, nil, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	res, err := f.tokens.VerifyAccess(ctx, dto.VerifyRequest{Token: tok.AccessToken})
+	if err != nil || !res.Valid {
+		t.Fatalf("verify access: valid=%v err=%v", res.Valid, err)
+	}
+	return tok.AccessToken, res.SessionID
+}
+
+func (f *sessionFixture) do(method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	f.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListSessionsHandler(t *testing.T) {
+	f := newSessionFixture(t)
+	user := &domain.User{ID: uuid.New()}
+	token, current := f.signIn(t, user)
+	f.signIn(t, user)
+
+	if rec := f.do(http.MethodGet, "/v1/sessions", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	rec := f.do(http.MethodGet, "/v1/sessions", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body dto.SessionListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(body.Sessions))
+	}
+	for _, s := range body.Sessions {
+		if s.Current != (s.ID == current) {
+			t.Fatalf("session %s current=%v, want %v", s.ID, s.Current, s.ID == current)
+		}
+	}
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "other session", target: "other", wantStatus: http.StatusNoContent},
+		{name: "current session", target: "current", wantStatus: http.StatusNoContent},
+		{name: "another user's session", target: "foreign", wantStatus: http.StatusNotFound},
+		{name: "malformed id", target: "not-a-uuid", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newSessionFixture(t)
+			user := &domain.User{ID: uuid.New()}
+			token, current := f.signIn(t, user)
+			otherToken, other := f.signIn(t, user)
+			foreignToken, foreign := f.signIn(t, &domain.User{ID: uuid.New()})
+
+			target := tc.target
+			var targetToken string
+			switch tc.target {
+			case "current":
+				target, targetToken = current, token
+			case "other":
+				target, targetToken = other, otherToken
+			case "foreign":
+				target, targetToken = foreign, foreignToken
+			}
+
+			rec := f.do(http.MethodDelete, "/v1/sessions/"+target, token)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if targetToken == "" {
+				return
+			}
+			wantList := http.StatusOK
+			if tc.wantStatus == http.StatusNoContent {
+				wantList = http.StatusUnauthorized
+			}
+			if rec := f.do(http.MethodGet, "/v1/sessions", targetToken); rec.Code != wantList {
+				t.Fatalf("expected %d listing with target session, got %d", wantList, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRevokeOtherSessionsHandler(t *testing.T) {
+	f := newSessionFixture(t)
+	user := &domain.User{ID: uuid.New()}
+	token, _ := f.signIn(t, user)
+	otherToken, _ := f.signIn(t, user)
+
+	rec := f.do(http.MethodPost, "/v1/sessions/revoke-others", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body dto.RevokeSessionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Revoked != 1 {
+		t.Fatalf("expected 1 revoked, got %d", body.Revoked)
+	}
+	if rec := f.do(http.MethodGet, "/v1/sessions", otherToken); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked session to be rejected, got %d", rec.Code)
+	}
+	if rec := f.do(http.MethodGet, "/v1/sessions", token); rec.Code != http.StatusOK {
+		t.Fatalf("expected current session to survive, got %d", rec.Code)
+	}
+}
+
+func TestInternalRevokedDevices(t *testing.T) {
+	f := newSessionFixture(t)
+	ctx := context.Background()
+	signer, err := identity.NewSigner("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	devices := impl.NewDeviceServiceImpl(f.st)
+	RegisterInternal(f.mux, devices, signer)
+
+	userID := uuid.New()
+	var revoked []uuid.UUID
+	for i := 0; i < 3; i++ {
+		dev, err := devices.Register(ctx, userID, "phone", "ios")
+		if err != nil {
+			t.Fatalf("register device: %v", err)
+		}
+		if i == 1 {
+			continue // stays active
+		}
+		if err := devices.Revoke(ctx, dev.ID); err != nil {
+			t.Fatalf("revoke device: %v", err)
+		}
+		revoked = append(revoked, dev.ID)
+	}
+
+	list := func(header, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, revocations.Path+query, nil)
+		if header != "" {
+			req.Header.Set(identity.Header, header)
+		}
+		rec := httptest.NewRecorder()
+		f.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := list("", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without a service identity, got %d", rec.Code)
+	}
+	caller := signer.Sign(identity.Identity{UserID: userID.String(), SessionID: uuid.NewString()}, http.MethodGet, revocations.Path)
+	if rec := list(caller, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a caller identity, got %d", rec.Code)
+	}
+
+	rec := list(signer.SignService("keys", http.MethodGet, revocations.Path), "?limit=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var page dto.RevokedDevicesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Devices) != 1 {
+		t.Fatalf("expected a page of 1, got %d", len(page.Devices))
+	}
+
+	first := page.Devices[0]
+	query := "?afterId=" + first.DeviceID + "&after=" + first.RevokedAt.Format(time.RFC3339Nano)
+	rec = list(signer.SignService("keys", http.MethodGet, revocations.Path), query)
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := map[string]bool{first.DeviceID: true}
+	for _, d := range page.Devices {
+		got[d.DeviceID] = true
+	}
+	if len(got) != len(revoked) {
+		t.Fatalf("expected the revoked devices %v, got %v", revoked, got)
+	}
+	for _, id := range revoked {
+		if !got[id.String()] {
+			t.Fatalf("revoked device %s missing from %v", id, got)
+		}
+	}
+}
+
+type fakeKeys struct{ rotated int }
+
+func (f *fakeKeys) RotateSignedPreKey(_ context.Context, _ string, req dto.RotatePrekeysRequest) (dto.RotatePrekeysResponse, error) {
+	f.rotated++
+	return dto.RotatePrekeysResponse{DeviceID: req.DeviceID, SignedPreKey: req.SignedPreKey}, nil
+}
+
+func (f *fakeKeys) FetchBundle(_ context.Context, _ string, deviceID domain.DeviceID) (dto.PrekeyBundleResponse, error) {
+	return dto.PrekeyBundleResponse{DeviceID: deviceID.String()}, nil
+}
+
+func TestRotatePrekeysHandlerChecksOwnership(t *testing.T) {
+	f := newSessionFixture(t)
+	ctx := context.Background()
+	keys := &fakeKeys{}
+	devices := impl.NewDeviceServiceImpl(f.st)
+	mux := NewRouter(nil, devices, f.tokens, impl.NewSessionServiceImpl(f.st), impl.NewPrekeyServiceImpl(f.st, keys), f.st)
+
+	owner := &domain.User{ID: uuid.New()}
+	token, _ := f.signIn(t, owner)
+	own, err := devices.Register(ctx, owner.ID, "phone", "ios")
+	if err != nil {
+		t.Fatalf("register device: %v", err)
+	}
+	foreign, err := devices.Register(ctx, uuid.New(), "phone", "ios")
+	if err != nil {
+		t.Fatalf("register device: %v", err)
+	}
+
+	rotate := func(deviceID uuid.UUID) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(dto.RotatePrekeysRequest{
+			DeviceID:     deviceID.String(),
+			SignedPreKey: dto.SignedPreKey{PublicKey: "spk", Signature: "sig"},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/v1/devices/rotate-prekeys", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := rotate(foreign.ID); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's device, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if keys.rotated != 0 {
+		t.Fatalf("expected keys not to be called, got %d calls", keys.rotated)
+	}
+	if rec := rotate(own.ID); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the caller's device, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if keys.rotated != 1 {
+		t.Fatalf("expected one rotation forwarded, got %d", keys.rotated)
+	}
+}
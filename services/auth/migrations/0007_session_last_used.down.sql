@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ix_sessions_user_active;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,10 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS last_used_at timestamptz;
+
+UPDATE sessions
+SET last_used_at = created_at
+WHERE last_used_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS ix_sessions_user_active
+    ON sessions (user_id, created_at DESC)
+    WHERE revoked_at IS NULL;
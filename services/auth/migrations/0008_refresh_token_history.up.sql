@@ -0,0 +1,10 @@
+-- Refresh IDs that have been rotated away. Presenting one of these again means
+-- the refresh token was copied, so the whole session gets revoked.
+CREATE TABLE IF NOT EXISTS session_refresh_history (
+  refresh_id uuid PRIMARY KEY,
+  session_id uuid NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+  superseded_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_session_refresh_history_session
+    ON session_refresh_history (session_id);
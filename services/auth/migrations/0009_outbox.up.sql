@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+  id uuid PRIMARY KEY,
+  type text NOT NULL,
+  source text NOT NULL,
+  payload jsonb NOT NULL,
+  occurred_at timestamptz NOT NULL,
+  published_at timestamptz,
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text
+);
+
+-- The relay only ever scans unpublished rows in order.
+CREATE INDEX IF NOT EXISTS ix_outbox_events_pending
+    ON outbox_events (occurred_at)
+    WHERE published_at IS NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS device_key_bundles (
+  device_id uuid PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+  identity_key_pub bytea NOT NULL,
+  signed_prekey_pub bytea NOT NULL,
+  signed_prekey_sig bytea NOT NULL,
+  one_time_prekeys jsonb NOT NULL,
+  last_rotated_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL
+);
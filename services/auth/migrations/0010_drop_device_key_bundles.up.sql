@@ -0,0 +1,2 @@
+-- Prekeys live in the keys service; auth never wrote to this table.
+DROP TABLE IF EXISTS device_key_bundles;
@@ -0,0 +1,2 @@
+-- Keys and messages page through revoked devices to repair missed events.
+CREATE INDEX IF NOT EXISTS idx_devices_revoked_at ON devices (revoked_at, id) WHERE revoked_at IS NOT NULL;
@@ -3,9 +3,14 @@ package cryptocore
 import "errors"
 
 var (
-	ErrInvalidPrekeySignature = errors.New("cryptocore: invalid prekey signature")
-	ErrMissingOneTimeKey      = errors.New("cryptocore: missing one-time prekey")
-	ErrInvalidRemoteKey       = errors.New("cryptocore: invalid remote ratchet key")
-	ErrDuplicateMessage       = errors.New("cryptocore: duplicate message")
-	ErrDecryptionFailed       = errors.New("cryptocore: message authentication failed")
+	ErrInvalidPrekeySignature  = errors.New("cryptocore: invalid prekey signature")
+	ErrMissingOneTimeKey       = errors.New("cryptocore: missing one-time prekey")
+	ErrMissingKEMPrekey        = errors.New("cryptocore: missing KEM prekey")
+	ErrUnsupportedProtocol     = errors.New("cryptocore: unsupported protocol version")
+	ErrUnsupportedStateVersion = errors.New("cryptocore: unsupported state version")
+	ErrInvalidRemoteKey        = errors.New("cryptocore: invalid remote ratchet key")
+	ErrDuplicateMessage        = errors.New("cryptocore: duplicate message")
+	ErrDecryptionFailed        = errors.New("cryptocore: message authentication failed")
+	ErrNoSession               = errors.New("cryptocore: no session")
+	ErrInvalidPadding          = errors.New("cryptocore: invalid padding")
 )
@@ -0,0 +1,93 @@
+package cryptocore
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Current snapshot format versions. Version 0 is the format written before
+// snapshots carried a version; a missing "version" field decodes as 0.
+const (
+	DeviceStateVersion   uint32 = 1
+	SessionStateVersion  uint32 = 2
+	SessionRecordVersion uint32 = 1
+)
+
+// deviceMigrations[v] upgrades a device state from version v to v+1, and
+// sessionMigrations likewise for sessions. A format change bumps the
+// version constant and registers the step from the previous version.
+var (
+	deviceMigrations = map[uint32]func(*DeviceState) error{
+		// Version 1 only adds the version field.
+		0: func(*DeviceState) error { return nil },
+	}
+	sessionMigrations = map[uint32]func(*SessionStateSnapshot) error{
+		0: migrateSessionV0,
+		// Version 2 adds baseKey. Older sessions have none, so a repeated
+		// handshake cannot be matched to them and is accepted as new.
+		1: func(*SessionStateSnapshot) error { return nil },
+	}
+)
+
+// upgradeDevice returns state migrated to DeviceStateVersion. The caller's
+// value is left untouched.
+func upgradeDevice(state *DeviceState) (*DeviceState, error) {
+	out := *state
+	if out.Version > DeviceStateVersion {
+		return nil, fmt.Errorf("%w: device state version %d, newest known is %d", ErrUnsupportedStateVersion, out.Version, DeviceStateVersion)
+	}
+	for out.Version < DeviceStateVersion {
+		migrate, ok := deviceMigrations[out.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from device state version %d", ErrUnsupportedStateVersion, out.Version)
+		}
+		if err := migrate(&out); err != nil {
+			return nil, fmt.Errorf("cryptocore: migrate device state from version %d: %w", out.Version, err)
+		}
+		out.Version++
+	}
+	return &out, nil
+}
+
+// upgradeSession returns snapshot migrated to SessionStateVersion. The
+// caller's value is left untouched.
+func upgradeSession(snapshot *SessionStateSnapshot) (*SessionStateSnapshot, error) {
+	out := *snapshot
+	if out.Version > SessionStateVersion {
+		return nil, fmt.Errorf("%w: session state version %d, newest known is %d", ErrUnsupportedStateVersion, out.Version, SessionStateVersion)
+	}
+	for out.Version < SessionStateVersion {
+		migrate, ok := sessionMigrations[out.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from session state version %d", ErrUnsupportedStateVersion, out.Version)
+		}
+		if err := migrate(&out); err != nil {
+			return nil, fmt.Errorf("cryptocore: migrate session state from version %d: %w", out.Version, err)
+		}
+		out.Version++
+	}
+	return &out, nil
+}
+
+// migrateSessionV0 re-encodes skipped message keys. Version 0 used the raw
+// 36-byte key name as the JSON object key, and encoding/json replaces invalid
+// UTF-8 with U+FFFD, so most names were mangled when written. Names that
+// survived intact are kept; the rest are dropped, as their messages could not
+// be decrypted after a reload anyway.
+func migrateSessionV0(s *SessionStateSnapshot) error {
+	if len(s.Skipped) == 0 {
+		return nil
+	}
+	skipped := make(map[string]string, len(s.Skipped))
+	for name, key := range s.Skipped {
+		if len(name) != skippedKeySize {
+			continue
+		}
+		skipped[base64.StdEncoding.EncodeToString([]byte(name))] = key
+	}
+	if len(skipped) == 0 {
+		skipped = nil
+	}
+	s.Skipped = skipped
+	return nil
+}
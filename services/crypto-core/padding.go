@@ -0,0 +1,107 @@
+package cryptocore
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// PaddingScheme selects how Pad rounds up a plaintext before encryption, so
+// ciphertext lengths reveal less about message lengths.
+type PaddingScheme uint8
+
+const (
+	// PaddingNone only appends the end marker.
+	PaddingNone PaddingScheme = iota
+	// PaddingBuckets pads to the next of a fixed set of sizes, and to a
+	// multiple of the largest one beyond it.
+	PaddingBuckets
+	// PaddingPadme pads to the Padmé length of Nikitin et al. (PETS 2019),
+	// which leaks O(log log n) bits with at most 12% overhead.
+	PaddingPadme
+)
+
+// paddingMarker ends the message inside a padded plaintext; only zero bytes
+// follow it (ISO/IEC 7816-4).
+const paddingMarker = 0x80
+
+var paddingBuckets = []int{128, 256, 512, 1024, 2048, 4096}
+
+var paddingNames = map[PaddingScheme]string{
+	PaddingNone:    "none",
+	PaddingBuckets: "buckets",
+	PaddingPadme:   "padme",
+}
+
+func (s PaddingScheme) String() string {
+	if name, ok := paddingNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("PaddingScheme(%d)", uint8(s))
+}
+
+// ParsePaddingScheme returns the scheme named by String.
+func ParsePaddingScheme(name string) (PaddingScheme, error) {
+	for s, n := range paddingNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("cryptocore: unknown padding scheme %q", name)
+}
+
+// Pad appends the end marker and zero bytes up to the length scheme picks.
+// Unpad reverses it without knowing the scheme.
+func Pad(plaintext []byte, scheme PaddingScheme) ([]byte, error) {
+	n := len(plaintext) + 1
+	var size int
+	switch scheme {
+	case PaddingNone:
+		size = n
+	case PaddingBuckets:
+		size = bucketLength(n)
+	case PaddingPadme:
+		size = padmeLength(n)
+	default:
+		return nil, fmt.Errorf("cryptocore: unknown padding scheme %d", scheme)
+	}
+	out := make([]byte, size)
+	copy(out, plaintext)
+	out[len(plaintext)] = paddingMarker
+	return out, nil
+}
+
+// Unpad strips the padding added by Pad.
+func Unpad(padded []byte) ([]byte, error) {
+	for i := len(padded) - 1; i >= 0; i-- {
+		switch padded[i] {
+		case 0:
+			continue
+		case paddingMarker:
+			return padded[:i], nil
+		}
+		break
+	}
+	return nil, ErrInvalidPadding
+}
+
+func bucketLength(n int) int {
+	for _, b := range paddingBuckets {
+		if n <= b {
+			return b
+		}
+	}
+	last := paddingBuckets[len(paddingBuckets)-1]
+	return (n + last - 1) / last * last
+}
+
+// padmeLength keeps the top bits of n that Padmé allows and rounds the rest
+// up: with e = floor(log2 n), the low e - floor(log2 e) - 1 bits are zeroed.
+func padmeLength(n int) int {
+	if n < 2 {
+		return n
+	}
+	e := bits.Len(uint(n)) - 1
+	s := bits.Len(uint(e))
+	mask := 1<<(e-s) - 1
+	return (n + mask) &^ mask
+}
@@ -0,0 +1,90 @@
+package cryptocore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPadLengths(t *testing.T) {
+	cases := []struct {
+		scheme PaddingScheme
+		in     int
+		want   int
+	}{
+		{PaddingNone, 0, 1},
+		{PaddingNone, 41, 42},
+		{PaddingBuckets, 0, 128},
+		{PaddingBuckets, 127, 128},
+		{PaddingBuckets, 128, 256},
+		{PaddingBuckets, 4095, 4096},
+		{PaddingBuckets, 4096, 8192},
+		{PaddingBuckets, 10000, 12288},
+		{PaddingPadme, 0, 1},
+		{PaddingPadme, 8, 10},
+		{PaddingPadme, 99, 104},
+		{PaddingPadme, 999, 1024},
+		{PaddingPadme, 1024, 1088},
+	}
+	for _, tc := range cases {
+		padded, err := Pad(make([]byte, tc.in), tc.scheme)
+		if err != nil {
+			t.Fatalf("%v %d: %v", tc.scheme, tc.in, err)
+		}
+		if len(padded) != tc.want {
+			t.Errorf("%v %d: padded to %d, want %d", tc.scheme, tc.in, len(padded), tc.want)
+		}
+	}
+}
+
+func TestPadmeOverhead(t *testing.T) {
+	for n := 1; n < 1<<16; n++ {
+		size := padmeLength(n)
+		if size < n || float64(size-n) > 0.12*float64(n)+1 {
+			t.Fatalf("padme(%d) = %d", n, size)
+		}
+	}
+}
+
+func TestUnpadRejectsMalformedPadding(t *testing.T) {
+	for _, in := range [][]byte{nil, {}, {0, 0, 0}, []byte("no marker"), {0x80, 0x01}} {
+		if _, err := Unpad(in); !errors.Is(err, ErrInvalidPadding) {
+			t.Errorf("Unpad(%x): expected ErrInvalidPadding, got %v", in, err)
+		}
+	}
+	if _, err := Pad(nil, PaddingScheme(9)); err == nil {
+		t.Fatalf("expected an error for an unknown scheme")
+	}
+}
+
+func TestParsePaddingScheme(t *testing.T) {
+	for _, s := range []PaddingScheme{PaddingNone, PaddingBuckets, PaddingPadme} {
+		got, err := ParsePaddingScheme(s.String())
+		if err != nil || got != s {
+			t.Fatalf("ParsePaddingScheme(%q) = %v, %v", s.String(), got, err)
+		}
+	}
+	if _, err := ParsePaddingScheme("bogus"); err == nil {
+		t.Fatalf("expected an error for an unknown name")
+	}
+}
+
+func FuzzPadRoundTrip(f *testing.F) {
+	f.Add([]byte("ok"), uint8(PaddingBuckets))
+	f.Add([]byte{0x80, 0x00}, uint8(PaddingPadme))
+	f.Add([]byte{}, uint8(PaddingNone))
+	f.Fuzz(func(t *testing.T, msg []byte, scheme uint8) {
+		s := PaddingScheme(scheme % 3)
+		padded, err := Pad(msg, s)
+		if err != nil {
+			t.Fatalf("pad: %v", err)
+		}
+		got, err := Unpad(padded)
+		if err != nil {
+			t.Fatalf("unpad: %v", err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("round trip: got %x, want %x", got, msg)
+		}
+	})
+}
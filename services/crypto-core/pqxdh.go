@@ -0,0 +1,164 @@
+package cryptocore
+
+import (
+	"crypto/ed25519"
+	"crypto/mlkem"
+	"errors"
+	"fmt"
+)
+
+const hkdfInfoPQXDH = "SecuMSG-PQXDH"
+
+// PublishPQPrekeyBundle is PublishPrekeyBundle plus ML-KEM-768 prekeys: the
+// signed last-resort KEM key, created on first use and kept until rotated,
+// and kemOneTimeCount fresh one-time KEM keys. Initiators that understand
+// the KEM fields run PQXDH against the bundle; older ones ignore them and
+// fall back to X3DH.
+func (d *Device) PublishPQPrekeyBundle(oneTimeCount, kemOneTimeCount int) (*PrekeyBundle, error) {
+	bundle, err := d.PublishPrekeyBundle(oneTimeCount)
+	if err != nil {
+		return nil, err
+	}
+	if d.kemPrekey == nil {
+		if err := d.RotateKEMPrekey(); err != nil {
+			return nil, err
+		}
+	}
+	last, err := d.kemPrekey.public()
+	if err != nil {
+		return nil, err
+	}
+	bundle.KEMPrekey = &last
+	if kemOneTimeCount < 0 {
+		kemOneTimeCount = 0
+	}
+	if kemOneTimeCount > 0 {
+		bundle.OneTimeKEMPrekeys = make([]KEMPrekey, 0, kemOneTimeCount)
+	}
+	if d.oneTimeKEM == nil {
+		d.oneTimeKEM = make(map[uint32]kemEntry)
+	}
+	for i := 0; i < kemOneTimeCount; i++ {
+		entry, err := d.newKEMEntry()
+		if err != nil {
+			return nil, err
+		}
+		pub, err := entry.public()
+		if err != nil {
+			return nil, err
+		}
+		d.oneTimeKEM[entry.id] = entry
+		bundle.OneTimeKEMPrekeys = append(bundle.OneTimeKEMPrekeys, pub)
+	}
+	return bundle, nil
+}
+
+// RotateKEMPrekey replaces the last-resort KEM prekey. Handshakes already in
+// flight against the old key fail with ErrMissingKEMPrekey.
+func (d *Device) RotateKEMPrekey() error {
+	if d == nil {
+		return errors.New("cryptocore: nil device")
+	}
+	entry, err := d.newKEMEntry()
+	if err != nil {
+		return err
+	}
+	d.kemPrekey = &entry
+	return nil
+}
+
+func (d *Device) newKEMEntry() (kemEntry, error) {
+	seed := make([]byte, mlkem.SeedSize)
+	if err := readRandom(seed); err != nil {
+		return kemEntry{}, err
+	}
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return kemEntry{}, err
+	}
+	if d.nextKEMID == 0 {
+		d.nextKEMID = 1
+	}
+	id := d.nextKEMID
+	d.nextKEMID++
+	return kemEntry{
+		id:   id,
+		seed: seed,
+		sig:  ed25519.Sign(d.identity.signingPrivate, dk.EncapsulationKey().Bytes()),
+	}, nil
+}
+
+func (e kemEntry) decapsulationKey() (*mlkem.DecapsulationKey768, error) {
+	return mlkem.NewDecapsulationKey768(e.seed)
+}
+
+func (e kemEntry) public() (KEMPrekey, error) {
+	dk, err := e.decapsulationKey()
+	if err != nil {
+		return KEMPrekey{}, err
+	}
+	return KEMPrekey{
+		ID:        e.id,
+		Public:    dk.EncapsulationKey().Bytes(),
+		Signature: append([]byte(nil), e.sig...),
+	}, nil
+}
+
+// selectKEMPrekey picks the KEM key an initiator encapsulates to, preferring
+// a one-time key. It returns nil for classic-only bundles.
+func selectKEMPrekey(bundle *PrekeyBundle) (*KEMPrekey, error) {
+	var kem *KEMPrekey
+	switch {
+	case len(bundle.OneTimeKEMPrekeys) > 0:
+		kem = &bundle.OneTimeKEMPrekeys[0]
+	case bundle.KEMPrekey != nil:
+		kem = bundle.KEMPrekey
+	default:
+		return nil, nil
+	}
+	if len(kem.Public) != mlkem.EncapsulationKeySize768 {
+		return nil, fmt.Errorf("cryptocore: KEM prekey has length %d, want %d", len(kem.Public), mlkem.EncapsulationKeySize768)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(bundle.IdentitySignatureKey), kem.Public, kem.Signature) {
+		return nil, ErrInvalidPrekeySignature
+	}
+	return kem, nil
+}
+
+// encapsulate returns the KEM shared secret and the ciphertext to send.
+// crypto/mlkem always draws encapsulation randomness from crypto/rand, so
+// PQXDH handshakes are not reproducible under UseDeterministicRandom.
+func encapsulate(kem *KEMPrekey) (shared, ciphertext []byte, err error) {
+	ek, err := mlkem.NewEncapsulationKey768(kem.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, ciphertext = ek.Encapsulate()
+	return shared, ciphertext, nil
+}
+
+// decapsulate recovers the KEM shared secret for msg. A one-time key is
+// removed once used; the last-resort key stays.
+func (d *Device) decapsulate(msg *HandshakeMessage) ([]byte, error) {
+	var entry kemEntry
+	switch {
+	case d.kemPrekey != nil && d.kemPrekey.id == msg.KEMPrekeyID:
+		entry = *d.kemPrekey
+	default:
+		e, ok := d.oneTimeKEM[msg.KEMPrekeyID]
+		if !ok {
+			return nil, ErrMissingKEMPrekey
+		}
+		entry = e
+	}
+	dk, err := entry.decapsulationKey()
+	if err != nil {
+		return nil, err
+	}
+	shared, err := dk.Decapsulate(msg.KEMCiphertext)
+	if err != nil {
+		return nil, fmt.Errorf("cryptocore: decapsulate: %w", err)
+	}
+	delete(d.oneTimeKEM, msg.KEMPrekeyID)
+	return shared, nil
+}
@@ -0,0 +1,187 @@
+package cryptocore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func pqPair(t *testing.T) (*Device, *Device) {
+	t.Helper()
+	alice, err := GenerateIdentityKeypair()
+	if err != nil {
+		t.Fatalf("GenerateIdentityKeypair(alice): %v", err)
+	}
+	bob, err := GenerateIdentityKeypair()
+	if err != nil {
+		t.Fatalf("GenerateIdentityKeypair(bob): %v", err)
+	}
+	return alice, bob
+}
+
+func roundTrip(t *testing.T, aliceSess, bobSess *SessionState) {
+	t.Helper()
+	ct, header, err := Encrypt(aliceSess, []byte("hello bob"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	pt, err := Decrypt(bobSess, ct, header)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(pt, []byte("hello bob")) {
+		t.Fatalf("decrypt mismatch: got %q", pt)
+	}
+}
+
+func TestPQXDHUsesOneTimeKEMPrekey(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(1, 2)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	aliceSess, hs, err := alice.InitSession(bundle)
+	if err != nil {
+		t.Fatalf("InitSession: %v", err)
+	}
+	if hs.Protocol != ProtocolPQXDH || aliceSess.Protocol != ProtocolPQXDH {
+		t.Fatalf("expected PQXDH, got handshake %d session %d", hs.Protocol, aliceSess.Protocol)
+	}
+	if hs.KEMPrekeyID != bundle.OneTimeKEMPrekeys[0].ID {
+		t.Fatalf("expected one-time KEM prekey %d, got %d", bundle.OneTimeKEMPrekeys[0].ID, hs.KEMPrekeyID)
+	}
+	bobSess, err := bob.AcceptSession(hs)
+	if err != nil {
+		t.Fatalf("AcceptSession: %v", err)
+	}
+	if bobSess.Protocol != ProtocolPQXDH {
+		t.Fatalf("responder session protocol = %d", bobSess.Protocol)
+	}
+	if _, ok := bob.oneTimeKEM[hs.KEMPrekeyID]; ok {
+		t.Fatalf("one-time KEM prekey %d was not consumed", hs.KEMPrekeyID)
+	}
+	roundTrip(t, aliceSess, bobSess)
+
+	if _, err := bob.AcceptSession(hs); !errors.Is(err, ErrMissingOneTimeKey) && !errors.Is(err, ErrMissingKEMPrekey) {
+		t.Fatalf("replayed handshake: got %v", err)
+	}
+}
+
+func TestPQXDHFallsBackToLastResortKEMPrekey(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(0, 0)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		aliceSess, hs, err := alice.InitSession(bundle)
+		if err != nil {
+			t.Fatalf("InitSession: %v", err)
+		}
+		if hs.KEMPrekeyID != bundle.KEMPrekey.ID {
+			t.Fatalf("expected last-resort KEM prekey %d, got %d", bundle.KEMPrekey.ID, hs.KEMPrekeyID)
+		}
+		bobSess, err := bob.AcceptSession(hs)
+		if err != nil {
+			t.Fatalf("AcceptSession #%d: %v", i, err)
+		}
+		roundTrip(t, aliceSess, bobSess)
+	}
+}
+
+func TestPQXDHInteroperatesWithClassicPeers(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(1, 1)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	// A classic initiator only sees the X25519 part of the bundle.
+	classic := *bundle
+	classic.KEMPrekey = nil
+	classic.OneTimeKEMPrekeys = nil
+	aliceSess, hs, err := alice.InitSession(&classic)
+	if err != nil {
+		t.Fatalf("InitSession: %v", err)
+	}
+	if hs.Protocol != ProtocolX3DH || hs.KEMCiphertext != nil {
+		t.Fatalf("expected classic handshake, got protocol %d", hs.Protocol)
+	}
+	bobSess, err := bob.AcceptSession(hs)
+	if err != nil {
+		t.Fatalf("AcceptSession: %v", err)
+	}
+	if bobSess.Protocol != ProtocolX3DH {
+		t.Fatalf("responder session protocol = %d", bobSess.Protocol)
+	}
+	roundTrip(t, aliceSess, bobSess)
+}
+
+func TestPQXDHRejectsTamperedKEMPrekey(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(0, 1)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	bundle.OneTimeKEMPrekeys[0].Public[0] ^= 0xff
+	if _, _, err := alice.InitSession(bundle); !errors.Is(err, ErrInvalidPrekeySignature) {
+		t.Fatalf("expected ErrInvalidPrekeySignature, got %v", err)
+	}
+}
+
+func TestPQXDHRejectsStrippedCiphertext(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(1, 1)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	_, hs, err := alice.InitSession(bundle)
+	if err != nil {
+		t.Fatalf("InitSession: %v", err)
+	}
+	hs.KEMCiphertext = hs.KEMCiphertext[:10]
+	if _, err := bob.AcceptSession(hs); err == nil {
+		t.Fatalf("expected truncated KEM ciphertext to be rejected")
+	}
+	if _, ok := bob.oneTime[*hs.OneTimePrekeyID]; !ok {
+		t.Fatalf("failed handshake consumed the one-time prekey")
+	}
+}
+
+func TestDeviceExportImportKeepsKEMPrekeys(t *testing.T) {
+	alice, bob := pqPair(t)
+	bundle, err := bob.PublishPQPrekeyBundle(0, 1)
+	if err != nil {
+		t.Fatalf("PublishPQPrekeyBundle: %v", err)
+	}
+	state, err := bob.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	restored, err := ImportDevice(state)
+	if err != nil {
+		t.Fatalf("ImportDevice: %v", err)
+	}
+	if restored.nextKEMID != bob.nextKEMID {
+		t.Fatalf("nextKEMID mismatch: got %d want %d", restored.nextKEMID, bob.nextKEMID)
+	}
+	aliceSess, hs, err := alice.InitSession(bundle)
+	if err != nil {
+		t.Fatalf("InitSession: %v", err)
+	}
+	bobSess, err := restored.AcceptSession(hs)
+	if err != nil {
+		t.Fatalf("AcceptSession(restored): %v", err)
+	}
+	snap, err := ExportSession(bobSess)
+	if err != nil {
+		t.Fatalf("ExportSession: %v", err)
+	}
+	bobSess, err = ImportSession(snap)
+	if err != nil {
+		t.Fatalf("ImportSession: %v", err)
+	}
+	if bobSess.Protocol != ProtocolPQXDH {
+		t.Fatalf("session protocol lost on export: %d", bobSess.Protocol)
+	}
+	roundTrip(t, aliceSess, bobSess)
+}
@@ -15,6 +15,9 @@ import (
 const (
 	hkdfInfoRatchet       = "SecuMSG-DR"
 	maxSkippedMessageKeys = 64
+	// skippedKeySize is the length of a skipped-key name: the remote ratchet
+	// public key followed by the big-endian message index.
+	skippedKeySize = 32 + 4
 )
 
 // Encrypt derives the next sending message key, returns the ciphertext and the
@@ -239,7 +242,7 @@ func (s *SessionState) consumeSkipped(header *MessageHeader) ([32]byte, bool) {
 }
 
 func skippedKey(pub [32]byte, index uint32) string {
-	buf := make([]byte, 32+4)
+	buf := make([]byte, skippedKeySize)
 	copy(buf, pub[:])
 	binary.BigEndian.PutUint32(buf[32:], index)
 	return string(buf)
@@ -0,0 +1,206 @@
+package cryptocore
+
+import (
+	"bytes"
+	"errors"
+)
+
+// maxArchivedSessions bounds how many superseded sessions a record keeps for
+// messages that were still in flight when the session changed.
+const maxArchivedSessions = 8
+
+// SessionRecord holds every session with one peer device. New messages are
+// encrypted with the current session; inbound messages are tried against the
+// current session and then the archived ones, and the session that opens a
+// message becomes current. This keeps both ends talking when they briefly
+// disagree about which session is live, e.g. after one side resets or both
+// start a session at the same time.
+type SessionRecord struct {
+	current  *SessionState
+	archived []archivedSession
+}
+
+type archivedSession struct {
+	state *SessionState
+	// lostRace marks the losing side of a simultaneous initiation. Such a
+	// session still decrypts in-flight messages but is never promoted, so
+	// both ends settle on the same winner.
+	lostRace bool
+}
+
+// NewSessionRecord returns an empty record.
+func NewSessionRecord() *SessionRecord {
+	return &SessionRecord{}
+}
+
+// Current returns the session used for sending, or nil if there is none.
+func (r *SessionRecord) Current() *SessionState {
+	if r == nil {
+		return nil
+	}
+	return r.current
+}
+
+// ArchivedCount reports how many superseded sessions are kept.
+func (r *SessionRecord) ArchivedCount() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.archived)
+}
+
+// SetCurrent makes session the current one, archiving the previous current
+// session. It is used for sessions this device initiated.
+func (r *SessionRecord) SetCurrent(session *SessionState) {
+	if session == nil {
+		return
+	}
+	r.removeArchived(session)
+	if r.current != nil && r.current != session {
+		r.archive(archivedSession{state: r.current})
+	}
+	r.current = session
+}
+
+// Accept establishes the responder session for msg and files it in the
+// record. A handshake for a session the record already holds is ignored, so
+// redelivered handshakes do not fail on the consumed one-time prekey.
+//
+// If the current session is one this device initiated and the peer has not
+// answered yet, both ends started a session at the same time. The session
+// with the lower base key wins on both ends; the other is archived so
+// messages already sent on it still decrypt.
+func (r *SessionRecord) Accept(d *Device, msg *HandshakeMessage) error {
+	if msg == nil {
+		return errors.New("cryptocore: nil handshake message")
+	}
+	if r.find(msg.EphemeralKey) != nil {
+		return nil
+	}
+	session, err := d.AcceptSession(msg)
+	if err != nil {
+		return err
+	}
+	racing := r.current != nil && r.current.Role == RoleInitiator && !r.current.confirmed()
+	if racing && bytes.Compare(r.current.BaseKey[:], session.BaseKey[:]) < 0 {
+		r.archive(archivedSession{state: session, lostRace: true})
+		return nil
+	}
+	if r.current != nil {
+		r.archive(archivedSession{state: r.current, lostRace: racing})
+	}
+	r.current = session
+	return nil
+}
+
+// EndOtherSessions makes the session with baseKey current and forgets every
+// other one. It is used when the peer announces that it ended its earlier
+// sessions, which also overrides the outcome of a simultaneous initiation.
+func (r *SessionRecord) EndOtherSessions(baseKey [32]byte) error {
+	session := r.find(baseKey)
+	if session == nil {
+		return ErrNoSession
+	}
+	r.current = session
+	r.archived = nil
+	return nil
+}
+
+// Encrypt encrypts plaintext with the current session.
+func (r *SessionRecord) Encrypt(plaintext []byte) ([]byte, *MessageHeader, error) {
+	if r == nil || r.current == nil {
+		return nil, nil, ErrNoSession
+	}
+	return Encrypt(r.current, plaintext)
+}
+
+// Decrypt opens ciphertext with the first session that authenticates it,
+// current session first. Each attempt runs on a copy so a failed attempt
+// leaves the session untouched. An archived session that succeeds becomes
+// current unless it lost a simultaneous initiation.
+func (r *SessionRecord) Decrypt(ciphertext []byte, header *MessageHeader) ([]byte, error) {
+	if r == nil || (r.current == nil && len(r.archived) == 0) {
+		return nil, ErrNoSession
+	}
+	var firstErr error
+	if r.current != nil {
+		trial := r.current.clone()
+		plaintext, err := Decrypt(trial, ciphertext, header)
+		if err == nil {
+			*r.current = *trial
+			return plaintext, nil
+		}
+		firstErr = err
+	}
+	for _, entry := range r.archived {
+		trial := entry.state.clone()
+		plaintext, err := Decrypt(trial, ciphertext, header)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		*entry.state = *trial
+		if !entry.lostRace {
+			r.SetCurrent(entry.state)
+		}
+		return plaintext, nil
+	}
+	return nil, firstErr
+}
+
+// find returns the session with the given base key, if the record holds one.
+func (r *SessionRecord) find(baseKey [32]byte) *SessionState {
+	if isZeroKey(baseKey) {
+		return nil
+	}
+	if r.current != nil && r.current.BaseKey == baseKey {
+		return r.current
+	}
+	for _, entry := range r.archived {
+		if entry.state.BaseKey == baseKey {
+			return entry.state
+		}
+	}
+	return nil
+}
+
+// archive puts entry at the front of the archive, dropping the oldest
+// sessions beyond maxArchivedSessions.
+func (r *SessionRecord) archive(entry archivedSession) {
+	r.archived = append([]archivedSession{entry}, r.archived...)
+	if len(r.archived) > maxArchivedSessions {
+		r.archived = r.archived[:maxArchivedSessions]
+	}
+}
+
+func (r *SessionRecord) removeArchived(session *SessionState) {
+	for i, entry := range r.archived {
+		if entry.state == session {
+			r.archived = append(r.archived[:i], r.archived[i+1:]...)
+			return
+		}
+	}
+}
+
+// confirmed reports whether the peer has used the session. A responder
+// session is confirmed by the handshake itself; an initiator session once
+// the first reply has been received.
+func (s *SessionState) confirmed() bool {
+	return s.Role == RoleResponder || !isZeroKey(s.RecvChain.Key) || s.RecvChain.Index > 0
+}
+
+func (s *SessionState) clone() *SessionState {
+	out := *s
+	out.RemoteSignature = append([]byte(nil), s.RemoteSignature...)
+	if s.PendingPrekey != nil {
+		id := *s.PendingPrekey
+		out.PendingPrekey = &id
+	}
+	out.skipped = make(map[string][32]byte, len(s.skipped))
+	for k, v := range s.skipped {
+		out.skipped[k] = v
+	}
+	return &out
+}
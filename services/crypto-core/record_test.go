@@ -0,0 +1,227 @@
+package cryptocore
+
+import (
+	"errors"
+	"testing"
+)
+
+type wireMessage struct {
+	handshake  *HandshakeMessage
+	ciphertext []byte
+	header     *MessageHeader
+}
+
+func newRecordPeer(t *testing.T) *Device {
+	t.Helper()
+	dev, err := GenerateIdentityKeypair()
+	if err != nil {
+		t.Fatalf("identity: %v", err)
+	}
+	return dev
+}
+
+// startSession initiates a new session from d to peer and returns the first
+// message on it, which carries the handshake.
+func startSession(t *testing.T, d *Device, record *SessionRecord, peer *Device, text string) wireMessage {
+	t.Helper()
+	bundle, err := peer.PublishPrekeyBundle(1)
+	if err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	sess, hs, err := d.InitSession(bundle)
+	if err != nil {
+		t.Fatalf("init session: %v", err)
+	}
+	record.SetCurrent(sess)
+	msg := send(t, record, text)
+	msg.handshake = hs
+	return msg
+}
+
+func send(t *testing.T, record *SessionRecord, text string) wireMessage {
+	t.Helper()
+	ct, header, err := record.Encrypt([]byte(text))
+	if err != nil {
+		t.Fatalf("encrypt %q: %v", text, err)
+	}
+	return wireMessage{ciphertext: ct, header: header}
+}
+
+func deliver(t *testing.T, d *Device, record *SessionRecord, msg wireMessage, want string) {
+	t.Helper()
+	if msg.handshake != nil {
+		if err := record.Accept(d, msg.handshake); err != nil {
+			t.Fatalf("accept %q: %v", want, err)
+		}
+	}
+	got, err := record.Decrypt(msg.ciphertext, msg.header)
+	if err != nil {
+		t.Fatalf("decrypt %q: %v", want, err)
+	}
+	if string(got) != want {
+		t.Fatalf("decrypt: got %q, want %q", got, want)
+	}
+}
+
+func TestSessionRecordSettlesSimultaneousInitiation(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+
+	fromAlice := startSession(t, alice, aliceRec, bob, "hi bob")
+	fromBob := startSession(t, bob, bobRec, alice, "hi alice")
+	// Both keep typing before either handshake arrives.
+	fromAlice2 := send(t, aliceRec, "still there?")
+	fromBob2 := send(t, bobRec, "hello?")
+
+	deliver(t, alice, aliceRec, fromBob, "hi alice")
+	deliver(t, bob, bobRec, fromAlice, "hi bob")
+	deliver(t, alice, aliceRec, fromBob2, "hello?")
+	deliver(t, bob, bobRec, fromAlice2, "still there?")
+
+	if aliceRec.Current().BaseKey != bobRec.Current().BaseKey {
+		t.Fatalf("peers settled on different sessions")
+	}
+	if aliceRec.ArchivedCount() != 1 || bobRec.ArchivedCount() != 1 {
+		t.Fatalf("expected the losing session to be archived on both ends")
+	}
+	for i := 0; i < 3; i++ {
+		deliver(t, bob, bobRec, send(t, aliceRec, "ping"), "ping")
+		deliver(t, alice, aliceRec, send(t, bobRec, "pong"), "pong")
+	}
+	if aliceRec.Current().BaseKey != bobRec.Current().BaseKey {
+		t.Fatalf("peers drifted apart after the race was settled")
+	}
+}
+
+func TestSessionRecordFollowsPeerReset(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+
+	deliver(t, bob, bobRec, startSession(t, alice, aliceRec, bob, "hi"), "hi")
+	deliver(t, alice, aliceRec, send(t, bobRec, "hey"), "hey")
+	inFlight := send(t, bobRec, "sent before the reset")
+
+	// Bob loses his session and starts over.
+	bobRec = NewSessionRecord()
+	deliver(t, alice, aliceRec, startSession(t, bob, bobRec, alice, "new session"), "new session")
+	if aliceRec.Current().BaseKey != bobRec.Current().BaseKey {
+		t.Fatalf("alice did not switch to bob's new session")
+	}
+	deliver(t, bob, bobRec, send(t, aliceRec, "welcome back"), "welcome back")
+
+	// A late message on the old session still decrypts from the archive and
+	// makes it current again, as the peer evidently still uses it.
+	deliver(t, alice, aliceRec, inFlight, "sent before the reset")
+	if aliceRec.Current().BaseKey == bobRec.Current().BaseKey {
+		t.Fatalf("archived session was not promoted")
+	}
+	deliver(t, alice, aliceRec, send(t, bobRec, "again"), "again")
+	if aliceRec.Current().BaseKey != bobRec.Current().BaseKey {
+		t.Fatalf("alice did not return to bob's current session")
+	}
+
+	if err := aliceRec.EndOtherSessions([32]byte{1}); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession for an unknown session, got %v", err)
+	}
+	if err := aliceRec.EndOtherSessions(bobRec.Current().BaseKey); err != nil {
+		t.Fatalf("EndOtherSessions: %v", err)
+	}
+	if aliceRec.ArchivedCount() != 0 || aliceRec.Current().BaseKey != bobRec.Current().BaseKey {
+		t.Fatalf("EndOtherSessions must keep only the named session")
+	}
+}
+
+func TestSessionRecordEndOtherSessionsOverridesRace(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+	fromAlice := startSession(t, alice, aliceRec, bob, "hi bob")
+	fromBob := startSession(t, bob, bobRec, alice, "hi alice")
+	deliver(t, alice, aliceRec, fromBob, "hi alice")
+	deliver(t, bob, bobRec, fromAlice, "hi bob")
+
+	// Whichever session lost the race, the peer can insist on it.
+	loser := aliceRec.archived[0].state.BaseKey
+	if err := aliceRec.EndOtherSessions(loser); err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if err := bobRec.EndOtherSessions(loser); err != nil {
+		t.Fatalf("bob: %v", err)
+	}
+	deliver(t, bob, bobRec, send(t, aliceRec, "on the loser"), "on the loser")
+	deliver(t, alice, aliceRec, send(t, bobRec, "works"), "works")
+}
+
+func TestSessionRecordFailedTrialLeavesSessionsIntact(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+	deliver(t, bob, bobRec, startSession(t, alice, aliceRec, bob, "one"), "one")
+
+	msg := send(t, aliceRec, "two")
+	forged := *msg.header
+	forged.DHPublic[0] ^= 0xff
+	if _, err := bobRec.Decrypt(msg.ciphertext, &forged); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrDecryptionFailed, got %v", err)
+	}
+	deliver(t, bob, bobRec, msg, "two")
+	if _, err := bobRec.Decrypt(msg.ciphertext, msg.header); err == nil {
+		t.Fatalf("replayed message decrypted twice")
+	}
+	if _, err := NewSessionRecord().Decrypt(msg.ciphertext, msg.header); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession, got %v", err)
+	}
+}
+
+func TestSessionRecordIgnoresRedeliveredHandshake(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+	first := startSession(t, alice, aliceRec, bob, "one")
+	deliver(t, bob, bobRec, first, "one")
+
+	second := send(t, aliceRec, "two")
+	second.handshake = first.handshake
+	deliver(t, bob, bobRec, second, "two")
+	if bobRec.ArchivedCount() != 0 {
+		t.Fatalf("redelivered handshake created another session")
+	}
+}
+
+func TestSessionRecordBoundsArchive(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	bobRec := NewSessionRecord()
+	for i := 0; i < maxArchivedSessions+3; i++ {
+		deliver(t, bob, bobRec, startSession(t, alice, NewSessionRecord(), bob, "hi"), "hi")
+	}
+	if got := bobRec.ArchivedCount(); got != maxArchivedSessions {
+		t.Fatalf("archived %d sessions, want %d", got, maxArchivedSessions)
+	}
+}
+
+func TestSessionRecordExportImport(t *testing.T) {
+	alice, bob := newRecordPeer(t), newRecordPeer(t)
+	aliceRec, bobRec := NewSessionRecord(), NewSessionRecord()
+	fromAlice := startSession(t, alice, aliceRec, bob, "hi bob")
+	fromBob := startSession(t, bob, bobRec, alice, "hi alice")
+	deliver(t, alice, aliceRec, fromBob, "hi alice")
+	deliver(t, bob, bobRec, fromAlice, "hi bob")
+
+	snap, err := ExportRecord(aliceRec)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if snap.Version != SessionRecordVersion || len(snap.Archived) != 1 || !snap.Archived[0].LostRace {
+		t.Fatalf("unexpected snapshot: version %d, %d archived", snap.Version, len(snap.Archived))
+	}
+	restored, err := ImportRecord(snap)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if restored.Current().BaseKey != aliceRec.Current().BaseKey || !restored.archived[0].lostRace {
+		t.Fatalf("record did not round-trip")
+	}
+	deliver(t, alice, restored, send(t, bobRec, "after reload"), "after reload")
+
+	snap.Version = SessionRecordVersion + 1
+	if _, err := ImportRecord(snap); !errors.Is(err, ErrUnsupportedStateVersion) {
+		t.Fatalf("expected ErrUnsupportedStateVersion, got %v", err)
+	}
+}
@@ -13,7 +13,8 @@ import (
 const hkdfInfoX3DH = "SecuMSG-X3DH"
 
 // InitSession performs the X3DH handshake as the initiator using the remote
-// prekey bundle and prepares the initial Double Ratchet state.
+// prekey bundle and prepares the initial Double Ratchet state. When the bundle
+// carries a KEM prekey the handshake is upgraded to PQXDH.
 func (d *Device) InitSession(bundle *PrekeyBundle) (*SessionState, *HandshakeMessage, error) {
 	if d == nil {
 		return nil, nil, errors.New("cryptocore: nil device")
@@ -35,11 +36,28 @@ func (d *Device) InitSession(bundle *PrekeyBundle) (*SessionState, *HandshakeMes
 		otk = &bundle.OneTimePrekeys[0]
 	}
 
+	kem, err := selectKEMPrekey(bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	secret, err := deriveSharedSecretInitiator(d, bundle, ephemeral, otk)
 	if err != nil {
 		return nil, nil, err
 	}
-	root, chain := deriveInitialKeys(secret)
+	protocol, info := ProtocolX3DH, hkdfInfoX3DH
+	var kemID uint32
+	var kemCiphertext []byte
+	if kem != nil {
+		shared, ct, err := encapsulate(kem)
+		if err != nil {
+			return nil, nil, err
+		}
+		secret = append(secret, shared...)
+		protocol, info = ProtocolPQXDH, hkdfInfoPQXDH
+		kemID, kemCiphertext = kem.ID, ct
+	}
+	root, chain := deriveInitialKeys(secret, info)
 
 	var pending *uint32
 	if otk != nil {
@@ -58,6 +76,8 @@ func (d *Device) InitSession(bundle *PrekeyBundle) (*SessionState, *HandshakeMes
 		RemoteSignature: append([]byte(nil), bundle.IdentitySignatureKey...),
 		Role:            RoleInitiator,
 		PendingPrekey:   pending,
+		Protocol:        protocol,
+		BaseKey:         ephemeral.Public,
 		skipped:         make(map[string][32]byte),
 	}
 
@@ -66,12 +86,17 @@ func (d *Device) InitSession(bundle *PrekeyBundle) (*SessionState, *HandshakeMes
 		IdentitySignatureKey: append([]byte(nil), d.identity.signingPublic...),
 		EphemeralKey:         ephemeral.Public,
 		OneTimePrekeyID:      pending,
+		Protocol:             protocol,
+		KEMPrekeyID:          kemID,
+		KEMCiphertext:        kemCiphertext,
 	}
 	return sess, msg, nil
 }
 
 // AcceptSession finalizes the X3DH handshake on the responder side using the
 // initiator's handshake message and prepares the receiving Double Ratchet state.
+// Classic and PQXDH handshakes are both accepted, so initiators that predate
+// PQXDH keep working against devices that publish KEM prekeys.
 func (d *Device) AcceptSession(msg *HandshakeMessage) (*SessionState, error) {
 	if d == nil {
 		return nil, errors.New("cryptocore: nil device")
@@ -79,6 +104,12 @@ func (d *Device) AcceptSession(msg *HandshakeMessage) (*SessionState, error) {
 	if msg == nil {
 		return nil, errors.New("cryptocore: nil handshake message")
 	}
+	if msg.Protocol != ProtocolX3DH && msg.Protocol != ProtocolPQXDH {
+		return nil, ErrUnsupportedProtocol
+	}
+	if len(msg.IdentitySignatureKey) != ed25519.PublicKeySize {
+		return nil, errors.New("cryptocore: invalid handshake identity signature key")
+	}
 	var otk *keyPair
 	if msg.OneTimePrekeyID != nil {
 		entry, ok := d.oneTime[*msg.OneTimePrekeyID]
@@ -87,13 +118,27 @@ func (d *Device) AcceptSession(msg *HandshakeMessage) (*SessionState, error) {
 		}
 		k := entry.key
 		otk = &k
+	}
+	// Decapsulate before consuming the one-time prekey so a bad ciphertext
+	// does not burn it.
+	var kemShared []byte
+	info := hkdfInfoX3DH
+	if msg.Protocol == ProtocolPQXDH {
+		shared, err := d.decapsulate(msg)
+		if err != nil {
+			return nil, err
+		}
+		kemShared, info = shared, hkdfInfoPQXDH
+	}
+	if msg.OneTimePrekeyID != nil {
 		delete(d.oneTime, *msg.OneTimePrekeyID)
 	}
 	secret, err := deriveSharedSecretResponder(d, msg, otk)
 	if err != nil {
 		return nil, err
 	}
-	root, chain := deriveInitialKeys(secret)
+	secret = append(secret, kemShared...)
+	root, chain := deriveInitialKeys(secret, info)
 
 	sess := &SessionState{
 		RootKey:         root,
@@ -106,6 +151,8 @@ func (d *Device) AcceptSession(msg *HandshakeMessage) (*SessionState, error) {
 		RemoteSignature: append([]byte(nil), msg.IdentitySignatureKey...),
 		Role:            RoleResponder,
 		PendingPrekey:   msg.OneTimePrekeyID,
+		Protocol:        msg.Protocol,
+		BaseKey:         msg.EphemeralKey,
 		skipped:         make(map[string][32]byte),
 	}
 	return sess, nil
@@ -169,8 +216,8 @@ func deriveSharedSecretResponder(d *Device, msg *HandshakeMessage, otk *keyPair)
 	return secret, nil
 }
 
-func deriveInitialKeys(secret []byte) ([32]byte, [32]byte) {
-	kdf := hkdf.New(sha256.New, secret, nil, []byte(hkdfInfoX3DH))
+func deriveInitialKeys(secret []byte, info string) ([32]byte, [32]byte) {
+	kdf := hkdf.New(sha256.New, secret, nil, []byte(info))
 	var root, chain [32]byte
 	if _, err := io.ReadFull(kdf, root[:]); err != nil {
 		// return zero-value keys on failure
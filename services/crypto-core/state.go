@@ -1,12 +1,20 @@
 package cryptocore
 
 import (
+	"crypto/ed25519"
+	"crypto/mlkem"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+
+	"golang.org/x/crypto/curve25519"
 )
 
+// DeviceState is the serialized form of a Device. Version is the snapshot
+// format; ImportDevice upgrades older versions.
 type DeviceState struct {
+	Version         uint32                        `json:"version"`
 	SigningPrivate  string                        `json:"signingPrivate"`
 	SigningPublic   string                        `json:"signingPublic"`
 	DHPrivate       string                        `json:"dhPrivate"`
@@ -15,6 +23,17 @@ type DeviceState struct {
 	SignedPrekeySig string                        `json:"signedPrekeySig"`
 	OneTime         map[uint32]X25519KeyPairState `json:"oneTime,omitempty"`
 	NextOTKID       uint32                        `json:"nextOtkId"`
+	KEMPrekey       *KEMKeyState                  `json:"kemPrekey,omitempty"`
+	OneTimeKEM      map[uint32]KEMKeyState        `json:"oneTimeKem,omitempty"`
+	NextKEMID       uint32                        `json:"nextKemId,omitempty"`
+}
+
+// KEMKeyState holds an ML-KEM-768 prekey as its seed and signature; the
+// public key is derived again on import.
+type KEMKeyState struct {
+	ID        uint32 `json:"id"`
+	Seed      string `json:"seed"`
+	Signature string `json:"signature"`
 }
 
 type X25519KeyPairState struct {
@@ -22,7 +41,10 @@ type X25519KeyPairState struct {
 	Public  string `json:"public"`
 }
 
+// SessionStateSnapshot is the serialized form of a SessionState. Skipped
+// message keys are keyed by the base64 of their 36-byte name.
 type SessionStateSnapshot struct {
+	Version         uint32             `json:"version"`
 	RootKey         string             `json:"rootKey"`
 	SendChain       ChainStateSnapshot `json:"sendChain"`
 	RecvChain       ChainStateSnapshot `json:"recvChain"`
@@ -34,6 +56,8 @@ type SessionStateSnapshot struct {
 	PN              uint32             `json:"pn"`
 	Role            SessionRole        `json:"role"`
 	PendingPrekey   *uint32            `json:"pendingPrekey,omitempty"`
+	Protocol        ProtocolVersion    `json:"protocol,omitempty"`
+	BaseKey         string             `json:"baseKey,omitempty"`
 	Skipped         map[string]string  `json:"skipped,omitempty"`
 }
 
@@ -47,6 +71,7 @@ func (d *Device) Export() (*DeviceState, error) {
 		return nil, errors.New("cryptocore: nil device")
 	}
 	state := &DeviceState{
+		Version:        DeviceStateVersion,
 		SigningPrivate: base64.StdEncoding.EncodeToString(d.identity.signingPrivate),
 		SigningPublic:  base64.StdEncoding.EncodeToString(d.identity.signingPublic),
 		DHPrivate:      base64.StdEncoding.EncodeToString(d.identity.dhPrivate[:]),
@@ -68,21 +93,42 @@ func (d *Device) Export() (*DeviceState, error) {
 	if len(state.OneTime) == 0 {
 		state.OneTime = nil
 	}
+	if d.kemPrekey != nil {
+		k := exportKEM(*d.kemPrekey)
+		state.KEMPrekey = &k
+	}
+	if len(d.oneTimeKEM) > 0 {
+		state.OneTimeKEM = make(map[uint32]KEMKeyState, len(d.oneTimeKEM))
+		for id, entry := range d.oneTimeKEM {
+			state.OneTimeKEM[id] = exportKEM(entry)
+		}
+	}
+	state.NextKEMID = d.nextKEMID
 	return state, nil
 }
 
+// ImportDevice rebuilds a Device from state, migrating older snapshot
+// versions first. Every key must have its exact length and public keys must
+// match their private halves.
 func ImportDevice(state *DeviceState) (*Device, error) {
 	if state == nil {
 		return nil, errors.New("cryptocore: nil device state")
 	}
-	signingPriv, err := base64.StdEncoding.DecodeString(state.SigningPrivate)
+	state, err := upgradeDevice(state)
+	if err != nil {
+		return nil, err
+	}
+	signingPriv, err := decodeFixed(state.SigningPrivate, ed25519.PrivateKeySize)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode signing private: %w", err)
 	}
-	signingPub, err := base64.StdEncoding.DecodeString(state.SigningPublic)
+	signingPub, err := decodeFixed(state.SigningPublic, ed25519.PublicKeySize)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode signing public: %w", err)
 	}
+	if !ed25519.PublicKey(signingPub).Equal(ed25519.PrivateKey(signingPriv).Public()) {
+		return nil, errors.New("cryptocore: signing public key does not match private key")
+	}
 	dhPriv, err := decodeFixed(state.DHPrivate, 32)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode dh private: %w", err)
@@ -91,6 +137,9 @@ func ImportDevice(state *DeviceState) (*Device, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode dh public: %w", err)
 	}
+	if err := checkX25519Pair(dhPriv, dhPub); err != nil {
+		return nil, fmt.Errorf("cryptocore: dh key: %w", err)
+	}
 	signedPriv, err := decodeFixed(state.SignedPrekey.Private, 32)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode signed prekey private: %w", err)
@@ -99,7 +148,10 @@ func ImportDevice(state *DeviceState) (*Device, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode signed prekey public: %w", err)
 	}
-	sig, err := base64.StdEncoding.DecodeString(state.SignedPrekeySig)
+	if err := checkX25519Pair(signedPriv, signedPub); err != nil {
+		return nil, fmt.Errorf("cryptocore: signed prekey: %w", err)
+	}
+	sig, err := decodeFixed(state.SignedPrekeySig, ed25519.SignatureSize)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode signed prekey sig: %w", err)
 	}
@@ -128,19 +180,60 @@ func ImportDevice(state *DeviceState) (*Device, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cryptocore: decode one-time public: %w", err)
 		}
+		if err := checkX25519Pair(priv, pub); err != nil {
+			return nil, fmt.Errorf("cryptocore: one-time prekey %d: %w", id, err)
+		}
 		var entry keyPair
 		copy(entry.Private[:], priv)
 		copy(entry.Public[:], pub)
 		dev.oneTime[id] = oneTimeEntry{key: entry}
 	}
+	if state.KEMPrekey != nil {
+		entry, err := importKEM(*state.KEMPrekey)
+		if err != nil {
+			return nil, err
+		}
+		dev.kemPrekey = &entry
+	}
+	dev.oneTimeKEM = make(map[uint32]kemEntry, len(state.OneTimeKEM))
+	for id, k := range state.OneTimeKEM {
+		entry, err := importKEM(k)
+		if err != nil {
+			return nil, err
+		}
+		entry.id = id
+		dev.oneTimeKEM[id] = entry
+	}
+	dev.nextKEMID = state.NextKEMID
 	return dev, nil
 }
 
+func exportKEM(e kemEntry) KEMKeyState {
+	return KEMKeyState{
+		ID:        e.id,
+		Seed:      base64.StdEncoding.EncodeToString(e.seed),
+		Signature: base64.StdEncoding.EncodeToString(e.sig),
+	}
+}
+
+func importKEM(k KEMKeyState) (kemEntry, error) {
+	seed, err := decodeFixed(k.Seed, mlkem.SeedSize)
+	if err != nil {
+		return kemEntry{}, fmt.Errorf("cryptocore: decode KEM seed: %w", err)
+	}
+	sig, err := decodeFixed(k.Signature, ed25519.SignatureSize)
+	if err != nil {
+		return kemEntry{}, fmt.Errorf("cryptocore: decode KEM signature: %w", err)
+	}
+	return kemEntry{id: k.ID, seed: seed, sig: sig}, nil
+}
+
 func ExportSession(state *SessionState) (*SessionStateSnapshot, error) {
 	if state == nil {
 		return nil, errors.New("cryptocore: nil session")
 	}
 	snap := &SessionStateSnapshot{
+		Version:         SessionStateVersion,
 		RootKey:         base64.StdEncoding.EncodeToString(state.RootKey[:]),
 		SendChain:       exportChain(state.SendChain),
 		RecvChain:       exportChain(state.RecvChain),
@@ -152,10 +245,14 @@ func ExportSession(state *SessionState) (*SessionStateSnapshot, error) {
 		PN:              state.PN,
 		Role:            state.Role,
 		PendingPrekey:   state.PendingPrekey,
+		Protocol:        state.Protocol,
 		Skipped:         make(map[string]string, len(state.skipped)),
 	}
+	if !isZeroKey(state.BaseKey) {
+		snap.BaseKey = base64.StdEncoding.EncodeToString(state.BaseKey[:])
+	}
 	for k, v := range state.skipped {
-		snap.Skipped[k] = base64.StdEncoding.EncodeToString(v[:])
+		snap.Skipped[base64.StdEncoding.EncodeToString([]byte(k))] = base64.StdEncoding.EncodeToString(v[:])
 	}
 	if len(snap.Skipped) == 0 {
 		snap.Skipped = nil
@@ -163,10 +260,22 @@ func ExportSession(state *SessionState) (*SessionStateSnapshot, error) {
 	return snap, nil
 }
 
+// ImportSession rebuilds a SessionState from snapshot, migrating older
+// snapshot versions first. Every key must have its exact length.
 func ImportSession(snapshot *SessionStateSnapshot) (*SessionState, error) {
 	if snapshot == nil {
 		return nil, errors.New("cryptocore: nil session snapshot")
 	}
+	snapshot, err := upgradeSession(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Role != RoleInitiator && snapshot.Role != RoleResponder {
+		return nil, fmt.Errorf("cryptocore: unknown session role %d", snapshot.Role)
+	}
+	if snapshot.Protocol != ProtocolX3DH && snapshot.Protocol != ProtocolPQXDH {
+		return nil, ErrUnsupportedProtocol
+	}
 	rootBytes, err := decodeFixed(snapshot.RootKey, 32)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode root key: %w", err)
@@ -195,7 +304,7 @@ func ImportSession(snapshot *SessionStateSnapshot) (*SessionState, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode remote identity: %w", err)
 	}
-	remoteSig, err := base64.StdEncoding.DecodeString(snapshot.RemoteSignature)
+	remoteSig, err := decodeFixed(snapshot.RemoteSignature, ed25519.PublicKeySize)
 	if err != nil {
 		return nil, fmt.Errorf("cryptocore: decode remote signature: %w", err)
 	}
@@ -214,19 +323,99 @@ func ImportSession(snapshot *SessionStateSnapshot) (*SessionState, error) {
 	sess.PN = snapshot.PN
 	sess.Role = snapshot.Role
 	sess.PendingPrekey = snapshot.PendingPrekey
+	sess.Protocol = snapshot.Protocol
+	if snapshot.BaseKey != "" {
+		baseKey, err := decodeFixed(snapshot.BaseKey, 32)
+		if err != nil {
+			return nil, fmt.Errorf("cryptocore: decode base key: %w", err)
+		}
+		copy(sess.BaseKey[:], baseKey)
+	}
 	sess.skipped = make(map[string][32]byte, len(snapshot.Skipped))
 	for k, v := range snapshot.Skipped {
+		name, err := decodeFixed(k, skippedKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("cryptocore: decode skipped key name: %w", err)
+		}
 		keyBytes, err := decodeFixed(v, 32)
 		if err != nil {
 			return nil, fmt.Errorf("cryptocore: decode skipped key: %w", err)
 		}
 		var key [32]byte
 		copy(key[:], keyBytes)
-		sess.skipped[k] = key
+		sess.skipped[string(name)] = key
 	}
 	return sess, nil
 }
 
+// SessionRecordSnapshot is the serialized form of a SessionRecord. Archived
+// sessions are listed newest first.
+type SessionRecordSnapshot struct {
+	Version  uint32                    `json:"version"`
+	Current  *SessionStateSnapshot     `json:"current,omitempty"`
+	Archived []ArchivedSessionSnapshot `json:"archived,omitempty"`
+}
+
+type ArchivedSessionSnapshot struct {
+	Session  *SessionStateSnapshot `json:"session"`
+	LostRace bool                  `json:"lostRace,omitempty"`
+}
+
+func ExportRecord(record *SessionRecord) (*SessionRecordSnapshot, error) {
+	if record == nil {
+		return nil, errors.New("cryptocore: nil session record")
+	}
+	snap := &SessionRecordSnapshot{Version: SessionRecordVersion}
+	if record.current != nil {
+		current, err := ExportSession(record.current)
+		if err != nil {
+			return nil, err
+		}
+		snap.Current = current
+	}
+	for _, entry := range record.archived {
+		sess, err := ExportSession(entry.state)
+		if err != nil {
+			return nil, err
+		}
+		snap.Archived = append(snap.Archived, ArchivedSessionSnapshot{Session: sess, LostRace: entry.lostRace})
+	}
+	return snap, nil
+}
+
+// ImportRecord rebuilds a SessionRecord, importing each session with
+// ImportSession.
+func ImportRecord(snapshot *SessionRecordSnapshot) (*SessionRecord, error) {
+	if snapshot == nil {
+		return nil, errors.New("cryptocore: nil session record snapshot")
+	}
+	if snapshot.Version > SessionRecordVersion {
+		return nil, fmt.Errorf("%w: session record version %d, newest known is %d", ErrUnsupportedStateVersion, snapshot.Version, SessionRecordVersion)
+	}
+	if len(snapshot.Archived) > maxArchivedSessions {
+		return nil, fmt.Errorf("cryptocore: %d archived sessions, at most %d allowed", len(snapshot.Archived), maxArchivedSessions)
+	}
+	record := NewSessionRecord()
+	if snapshot.Current != nil {
+		current, err := ImportSession(snapshot.Current)
+		if err != nil {
+			return nil, err
+		}
+		record.current = current
+	}
+	for i, entry := range snapshot.Archived {
+		if entry.Session == nil {
+			return nil, fmt.Errorf("cryptocore: archived session %d is empty", i)
+		}
+		sess, err := ImportSession(entry.Session)
+		if err != nil {
+			return nil, fmt.Errorf("cryptocore: archived session %d: %w", i, err)
+		}
+		record.archived = append(record.archived, archivedSession{state: sess, lostRace: entry.LostRace})
+	}
+	return record, nil
+}
+
 func exportChain(cs chainState) ChainStateSnapshot {
 	return ChainStateSnapshot{
 		Key:   base64.StdEncoding.EncodeToString(cs.Key[:]),
@@ -244,6 +433,17 @@ func importChain(cs ChainStateSnapshot) (chainState, error) {
 	return chainState{Key: key, Index: cs.Index}, nil
 }
 
+func checkX25519Pair(priv, pub []byte) error {
+	derived, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(derived, pub) != 1 {
+		return errors.New("public key does not match private key")
+	}
+	return nil
+}
+
 func decodeFixed(in string, size int) ([]byte, error) {
 	data, err := base64.StdEncoding.DecodeString(in)
 	if err != nil {
@@ -0,0 +1,191 @@
+package cryptocore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Golden snapshots live in testdata/state as <kind>_v<version>[_variant].json.
+// Files for past versions are frozen; only the current version is rewritten
+// by -update.
+func readGolden(t *testing.T, name string, v any) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "state", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+	return data
+}
+
+func marshalGolden(t *testing.T, v any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// checkCurrentGolden compares v with the golden file for the current version.
+func checkCurrentGolden(t *testing.T, name string, v any) {
+	t.Helper()
+	path := filepath.Join("testdata", "state", name)
+	got := marshalGolden(t, v)
+	if *updateVectors {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s changed; bump the snapshot version and register a migration instead", name)
+	}
+}
+
+func TestDeviceStateGoldenVersions(t *testing.T) {
+	for _, name := range []string{"device_v0.json", "device_v0_pqxdh.json"} {
+		t.Run(name, func(t *testing.T) {
+			var state DeviceState
+			readGolden(t, name, &state)
+			// Bob published two one-time prekeys and Alice consumed one.
+			dev, err := ImportDevice(&state)
+			if err != nil {
+				t.Fatalf("ImportDevice: %v", err)
+			}
+			if len(dev.oneTime) != 1 || dev.nextOTKID != 3 {
+				t.Fatalf("one-time prekeys not restored: %d keys, next id %d", len(dev.oneTime), dev.nextOTKID)
+			}
+			if strings.Contains(name, "pqxdh") && (dev.kemPrekey == nil || len(dev.oneTimeKEM) != 1) {
+				t.Fatalf("KEM prekeys not restored")
+			}
+			out, err := dev.Export()
+			if err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+			if out.Version != DeviceStateVersion {
+				t.Fatalf("exported version %d, want %d", out.Version, DeviceStateVersion)
+			}
+			current := strings.Replace(name, "_v0", fmt.Sprintf("_v%d", DeviceStateVersion), 1)
+			checkCurrentGolden(t, current, out)
+		})
+	}
+}
+
+func TestSessionStateGoldenVersions(t *testing.T) {
+	// Of the three skipped keys written by version 0 only the one whose name
+	// was valid UTF-8 survived the old encoding.
+	var pub [32]byte
+	for i := range pub {
+		pub[i] = byte(0x21 + i)
+	}
+	var sess *SessionState
+	for v := uint32(0); v < SessionStateVersion; v++ {
+		name := fmt.Sprintf("session_v%d.json", v)
+		var old SessionStateSnapshot
+		readGolden(t, name, &old)
+		skipped := len(old.Skipped)
+		imported, err := ImportSession(&old)
+		if err != nil {
+			t.Fatalf("ImportSession(%s): %v", name, err)
+		}
+		if len(old.Skipped) != skipped {
+			t.Fatalf("%s: migration modified the caller's snapshot", name)
+		}
+		if len(imported.skipped) != 1 {
+			t.Fatalf("%s: expected 1 recoverable skipped key, got %d", name, len(imported.skipped))
+		}
+		if _, ok := imported.skipped[skippedKey(pub, 2)]; !ok {
+			t.Fatalf("%s: recoverable skipped key was dropped", name)
+		}
+		if sess != nil && imported.RootKey != sess.RootKey {
+			t.Fatalf("%s: imported a different session than version 0", name)
+		}
+		sess = imported
+	}
+
+	sess.BaseKey = pub
+	snap, err := ExportSession(sess)
+	if err != nil {
+		t.Fatalf("ExportSession: %v", err)
+	}
+	if snap.Version != SessionStateVersion {
+		t.Fatalf("exported version %d, want %d", snap.Version, SessionStateVersion)
+	}
+	checkCurrentGolden(t, fmt.Sprintf("session_v%d.json", SessionStateVersion), snap)
+
+	var current SessionStateSnapshot
+	readGolden(t, fmt.Sprintf("session_v%d.json", SessionStateVersion), &current)
+	again, err := ImportSession(&current)
+	if err != nil {
+		t.Fatalf("ImportSession(current): %v", err)
+	}
+	if len(again.skipped) != 1 || again.RootKey != sess.RootKey || again.BaseKey != pub {
+		t.Fatalf("current snapshot did not round-trip")
+	}
+}
+
+func TestImportRejectsNewerVersions(t *testing.T) {
+	var state DeviceState
+	readGolden(t, "device_v0.json", &state)
+	state.Version = DeviceStateVersion + 1
+	if _, err := ImportDevice(&state); !errors.Is(err, ErrUnsupportedStateVersion) {
+		t.Fatalf("ImportDevice: expected ErrUnsupportedStateVersion, got %v", err)
+	}
+	var snap SessionStateSnapshot
+	readGolden(t, "session_v0.json", &snap)
+	snap.Version = SessionStateVersion + 1
+	if _, err := ImportSession(&snap); !errors.Is(err, ErrUnsupportedStateVersion) {
+		t.Fatalf("ImportSession: expected ErrUnsupportedStateVersion, got %v", err)
+	}
+}
+
+func TestImportRejectsMalformedKeys(t *testing.T) {
+	short := base64.StdEncoding.EncodeToString(make([]byte, 31))
+	devices := map[string]func(*DeviceState){
+		"short signing private": func(s *DeviceState) { s.SigningPrivate = short },
+		"short signature":       func(s *DeviceState) { s.SignedPrekeySig = short },
+		"mismatched dh public":  func(s *DeviceState) { s.DHPublic = s.SignedPrekey.Public },
+		"mismatched signing public": func(s *DeviceState) {
+			s.SigningPublic = base64.StdEncoding.EncodeToString(make([]byte, 32))
+		},
+	}
+	for name, mutate := range devices {
+		var state DeviceState
+		readGolden(t, "device_v0.json", &state)
+		mutate(&state)
+		if _, err := ImportDevice(&state); err == nil {
+			t.Errorf("ImportDevice accepted %s", name)
+		}
+	}
+
+	sessions := map[string]func(*SessionStateSnapshot){
+		"short remote signature": func(s *SessionStateSnapshot) { s.RemoteSignature = short },
+		"unknown role":           func(s *SessionStateSnapshot) { s.Role = 7 },
+		"short skipped name": func(s *SessionStateSnapshot) {
+			s.Skipped = map[string]string{short: s.RootKey}
+		},
+	}
+	for name, mutate := range sessions {
+		var snap SessionStateSnapshot
+		readGolden(t, fmt.Sprintf("session_v%d.json", SessionStateVersion), &snap)
+		mutate(&snap)
+		if _, err := ImportSession(&snap); err == nil {
+			t.Errorf("ImportSession accepted %s", name)
+		}
+	}
+}
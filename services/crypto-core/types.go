@@ -11,12 +11,26 @@ const (
 	RoleResponder
 )
 
+// ProtocolVersion identifies the key agreement a session was established
+// with. The zero value is classic X3DH so handshakes and snapshots written
+// before PQXDH existed keep their meaning.
+type ProtocolVersion uint8
+
+const (
+	ProtocolX3DH ProtocolVersion = iota
+	// ProtocolPQXDH adds an ML-KEM-768 shared secret to the X3DH inputs.
+	ProtocolPQXDH
+)
+
 type Device struct {
 	identity     identityKeyPair
 	signedPrekey keyPair
 	signedSig    []byte
 	oneTime      map[uint32]oneTimeEntry
 	nextOTKID    uint32
+	kemPrekey    *kemEntry
+	oneTimeKEM   map[uint32]kemEntry
+	nextKEMID    uint32
 }
 
 type identityKeyPair struct {
@@ -35,12 +49,24 @@ type oneTimeEntry struct {
 	key keyPair
 }
 
+// kemEntry keeps the ML-KEM-768 decapsulation key as its 64-byte seed; the
+// public half is recomputed from it.
+type kemEntry struct {
+	id   uint32
+	seed []byte
+	sig  []byte
+}
+
 type PrekeyBundle struct {
 	IdentityKey          [32]byte
 	IdentitySignatureKey []byte
 	SignedPrekey         [32]byte
 	SignedPrekeySig      []byte
 	OneTimePrekeys       []OneTimePrekey
+	// KEMPrekey is the signed last-resort ML-KEM key; OneTimeKEMPrekeys are
+	// preferred while any are left. Both are empty for classic-only devices.
+	KEMPrekey         *KEMPrekey
+	OneTimeKEMPrekeys []KEMPrekey
 }
 
 type OneTimePrekey struct {
@@ -48,11 +74,22 @@ type OneTimePrekey struct {
 	Public [32]byte
 }
 
+// KEMPrekey is an ML-KEM-768 encapsulation key signed with the device's
+// Ed25519 identity key.
+type KEMPrekey struct {
+	ID        uint32
+	Public    []byte
+	Signature []byte
+}
+
 type HandshakeMessage struct {
 	IdentityKey          [32]byte
 	IdentitySignatureKey []byte
 	EphemeralKey         [32]byte
 	OneTimePrekeyID      *uint32
+	Protocol             ProtocolVersion
+	KEMPrekeyID          uint32
+	KEMCiphertext        []byte
 }
 
 type chainState struct {
@@ -72,7 +109,11 @@ type SessionState struct {
 	PN              uint32
 	Role            SessionRole
 	PendingPrekey   *uint32
-	skipped         map[string][32]byte
+	Protocol        ProtocolVersion
+	// BaseKey is the initiator's handshake ephemeral key. Both ends hold the
+	// same value, so it identifies the session to either of them.
+	BaseKey [32]byte
+	skipped map[string][32]byte
 }
 
 type MessageHeader struct {
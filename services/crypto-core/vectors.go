@@ -0,0 +1,411 @@
+package cryptocore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Vectors are known-answer tests shared with the TypeScript port in
+// frontend/src/crypto-core. Byte strings are hex. Each "random" field is the
+// exact randomness the operation draws, in order, so another implementation
+// can replay it through its own UseDeterministicRandom.
+//
+// PQXDH is not covered: crypto/mlkem draws encapsulation randomness from
+// crypto/rand, so its handshakes cannot be reproduced.
+type Vectors struct {
+	Identity  []IdentityVector `json:"identity"`
+	X3DH      []X3DHVector     `json:"x3dh"`
+	Ratchet   []RatchetVector  `json:"ratchet"`
+	Skipped   []SkippedVector  `json:"skipped"`
+	Snapshots []SnapshotVector `json:"snapshots"`
+}
+
+// IdentityVector covers GenerateIdentityKeypair: the Ed25519 seed, the X25519
+// key derived from it, and the first signed prekey.
+type IdentityVector struct {
+	Name                string `json:"name"`
+	Random              string `json:"random"`
+	SigningPublic       string `json:"signingPublic"`
+	DHPrivate           string `json:"dhPrivate"`
+	DHPublic            string `json:"dhPublic"`
+	SignedPrekeyPrivate string `json:"signedPrekeyPrivate"`
+	SignedPrekeyPublic  string `json:"signedPrekeyPublic"`
+	SignedPrekeySig     string `json:"signedPrekeySig"`
+}
+
+// X3DHVector covers the handshake between two identities. OneTimePrekeyRandom
+// is empty when the bundle had no one-time prekey. Secret is DH1..DH4
+// concatenated, before HKDF.
+type X3DHVector struct {
+	Name                string `json:"name"`
+	InitiatorRandom     string `json:"initiatorRandom"`
+	ResponderRandom     string `json:"responderRandom"`
+	OneTimePrekeyRandom string `json:"oneTimePrekeyRandom,omitempty"`
+	EphemeralRandom     string `json:"ephemeralRandom"`
+	EphemeralPublic     string `json:"ephemeralPublic"`
+	Secret              string `json:"secret"`
+	RootKey             string `json:"rootKey"`
+	ChainKey            string `json:"chainKey"`
+}
+
+// RatchetVector is a conversation on top of the named X3DH vector, in the
+// order the messages are sent and received.
+type RatchetVector struct {
+	Name  string        `json:"name"`
+	X3DH  string        `json:"x3dh"`
+	Steps []RatchetStep `json:"steps"`
+}
+
+// RatchetStep is one Encrypt call. Random is only set when the sender had to
+// turn its DH ratchet; RootKey is the sender's root key afterwards.
+type RatchetStep struct {
+	Sender     string `json:"sender"`
+	Random     string `json:"random,omitempty"`
+	Plaintext  string `json:"plaintext"`
+	DHPublic   string `json:"dhPublic"`
+	PN         uint32 `json:"pn"`
+	N          uint32 `json:"n"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+	RootKey    string `json:"rootKey"`
+}
+
+// SkippedVector sends Steps from the initiator and delivers them to the
+// responder in Order. Stored lists the message keys the responder keeps after
+// the first delivery.
+type SkippedVector struct {
+	Name   string             `json:"name"`
+	X3DH   string             `json:"x3dh"`
+	Steps  []RatchetStep      `json:"steps"`
+	Order  []int              `json:"order"`
+	Stored []SkippedKeyVector `json:"stored"`
+}
+
+type SkippedKeyVector struct {
+	DHPublic   string `json:"dhPublic"`
+	Index      uint32 `json:"index"`
+	MessageKey string `json:"messageKey"`
+}
+
+// SnapshotVector pins the JSON written by Export and ExportSession.
+type SnapshotVector struct {
+	Name    string          `json:"name"`
+	Device  json.RawMessage `json:"device,omitempty"`
+	Session json.RawMessage `json:"session,omitempty"`
+}
+
+// vectorStream is the randomness behind the vectors: SHA-256 in counter mode
+// over a label, recording what was read since the last take.
+type vectorStream struct {
+	label   string
+	counter uint64
+	buf     []byte
+	taken   bytes.Buffer
+}
+
+func (s *vectorStream) Read(p []byte) (int, error) {
+	for len(s.buf) < len(p) {
+		var block [8]byte
+		binary.BigEndian.PutUint64(block[:], s.counter)
+		s.counter++
+		sum := sha256.Sum256(append([]byte(s.label), block[:]...))
+		s.buf = append(s.buf, sum[:]...)
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	s.taken.Write(p[:n])
+	return n, nil
+}
+
+// take returns the randomness read since the previous call.
+func (s *vectorStream) take() string {
+	out := hex.EncodeToString(s.taken.Bytes())
+	s.taken.Reset()
+	return out
+}
+
+// GenerateVectors builds the vectors from a fixed randomness stream, so the
+// result only changes when the protocol does. It swaps the package randomness
+// source while running and must not be used concurrently with other calls.
+func GenerateVectors() (*Vectors, error) {
+	stream := &vectorStream{label: "SecuMSG-vectors"}
+	restore := UseDeterministicRandom(stream)
+	defer restore()
+
+	g := &vectorGen{stream: stream, out: &Vectors{}, sessions: map[string]*vectorSession{}}
+	for _, name := range []string{"alice", "bob"} {
+		if err := g.identity(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.x3dh("with-one-time-prekey", true); err != nil {
+		return nil, err
+	}
+	if err := g.x3dh("without-one-time-prekey", false); err != nil {
+		return nil, err
+	}
+	if err := g.ratchet(); err != nil {
+		return nil, err
+	}
+	if err := g.skipped(); err != nil {
+		return nil, err
+	}
+	if err := g.snapshots(); err != nil {
+		return nil, err
+	}
+	return g.out, nil
+}
+
+type vectorGen struct {
+	stream   *vectorStream
+	out      *Vectors
+	sessions map[string]*vectorSession
+}
+
+func (g *vectorGen) identity(name string) error {
+	g.stream.take()
+	dev, err := GenerateIdentityKeypair()
+	if err != nil {
+		return err
+	}
+	g.out.Identity = append(g.out.Identity, IdentityVector{
+		Name:                name,
+		Random:              g.stream.take(),
+		SigningPublic:       hex.EncodeToString(dev.identity.signingPublic),
+		DHPrivate:           hex.EncodeToString(dev.identity.dhPrivate[:]),
+		DHPublic:            hex.EncodeToString(dev.identity.dhPublic[:]),
+		SignedPrekeyPrivate: hex.EncodeToString(dev.signedPrekey.Private[:]),
+		SignedPrekeyPublic:  hex.EncodeToString(dev.signedPrekey.Public[:]),
+		SignedPrekeySig:     hex.EncodeToString(dev.signedSig),
+	})
+	return nil
+}
+
+// vectorSession is an established pair of sessions for the conversation
+// vectors.
+type vectorSession struct {
+	initiator, responder *SessionState
+	responderDevice      *Device
+}
+
+func (g *vectorGen) handshake(withOTK bool) (*vectorSession, X3DHVector, error) {
+	var v X3DHVector
+	g.stream.take()
+	alice, err := GenerateIdentityKeypair()
+	if err != nil {
+		return nil, v, err
+	}
+	v.InitiatorRandom = g.stream.take()
+	bob, err := GenerateIdentityKeypair()
+	if err != nil {
+		return nil, v, err
+	}
+	v.ResponderRandom = g.stream.take()
+	count := 0
+	if withOTK {
+		count = 1
+	}
+	bundle, err := bob.PublishPrekeyBundle(count)
+	if err != nil {
+		return nil, v, err
+	}
+	v.OneTimePrekeyRandom = g.stream.take()
+
+	initiator, msg, err := alice.InitSession(bundle)
+	if err != nil {
+		return nil, v, err
+	}
+	v.EphemeralRandom = g.stream.take()
+	responder, err := bob.AcceptSession(msg)
+	if err != nil {
+		return nil, v, err
+	}
+	if initiator.RootKey != responder.RootKey || initiator.SendChain.Key != responder.RecvChain.Key {
+		return nil, v, errors.New("cryptocore: vector handshake keys disagree")
+	}
+
+	var otk *OneTimePrekey
+	if withOTK {
+		otk = &bundle.OneTimePrekeys[0]
+	}
+	eph := keyPair{Private: initiator.RatchetPrivate, Public: initiator.RatchetPublic}
+	secret, err := deriveSharedSecretInitiator(alice, bundle, eph, otk)
+	if err != nil {
+		return nil, v, err
+	}
+	v.EphemeralPublic = hex.EncodeToString(msg.EphemeralKey[:])
+	v.Secret = hex.EncodeToString(secret)
+	v.RootKey = hex.EncodeToString(initiator.RootKey[:])
+	v.ChainKey = hex.EncodeToString(initiator.SendChain.Key[:])
+	return &vectorSession{initiator: initiator, responder: responder, responderDevice: bob}, v, nil
+}
+
+// x3dh records a handshake and keeps its sessions, so the conversation
+// vectors can continue from it.
+func (g *vectorGen) x3dh(name string, withOTK bool) error {
+	s, v, err := g.handshake(withOTK)
+	if err != nil {
+		return err
+	}
+	v.Name = name
+	g.out.X3DH = append(g.out.X3DH, v)
+	g.sessions[name] = s
+	return nil
+}
+
+// send encrypts plaintext and, when deliver is set, decrypts it on the other
+// side straight away.
+func (g *vectorGen) send(s *vectorSession, sender, plaintext string, deliver bool) (RatchetStep, *MessageHeader, []byte, error) {
+	from, to := s.initiator, s.responder
+	if sender == "responder" {
+		from, to = s.responder, s.initiator
+	}
+	g.stream.take()
+	ct, header, err := Encrypt(from, []byte(plaintext))
+	if err != nil {
+		return RatchetStep{}, nil, nil, err
+	}
+	step := RatchetStep{
+		Sender:     sender,
+		Random:     g.stream.take(),
+		Plaintext:  plaintext,
+		DHPublic:   hex.EncodeToString(header.DHPublic[:]),
+		PN:         header.PN,
+		N:          header.N,
+		Nonce:      hex.EncodeToString(header.Nonce[:]),
+		Ciphertext: hex.EncodeToString(ct),
+		RootKey:    hex.EncodeToString(from.RootKey[:]),
+	}
+	if deliver {
+		if err := g.receive(to, ct, header, plaintext); err != nil {
+			return RatchetStep{}, nil, nil, err
+		}
+	}
+	return step, header, ct, nil
+}
+
+func (g *vectorGen) receive(to *SessionState, ct []byte, header *MessageHeader, want string) error {
+	pt, err := Decrypt(to, ct, header)
+	if err != nil {
+		return fmt.Errorf("cryptocore: vector decrypt: %w", err)
+	}
+	if string(pt) != want {
+		return errors.New("cryptocore: vector decrypt mismatch")
+	}
+	return nil
+}
+
+func (g *vectorGen) ratchet() error {
+	v := RatchetVector{Name: "ping-pong", X3DH: "with-one-time-prekey"}
+	s := g.sessions[v.X3DH]
+	script := []struct{ sender, text string }{
+		{"initiator", "hello bob"},
+		{"initiator", "are you there?"},
+		{"responder", "hi alice"},
+		{"initiator", "new chain"},
+		{"responder", "and another"},
+		{"responder", "same chain"},
+	}
+	for _, m := range script {
+		step, _, _, err := g.send(s, m.sender, m.text, true)
+		if err != nil {
+			return err
+		}
+		v.Steps = append(v.Steps, step)
+	}
+	g.out.Ratchet = append(g.out.Ratchet, v)
+	return nil
+}
+
+func (g *vectorGen) skipped() error {
+	v := SkippedVector{Name: "out-of-order", X3DH: "without-one-time-prekey", Order: []int{2, 0, 1}}
+	s := g.sessions[v.X3DH]
+	type sent struct {
+		header *MessageHeader
+		ct     []byte
+	}
+	var msgs []sent
+	for _, text := range []string{"first", "second", "third"} {
+		step, header, ct, err := g.send(s, "initiator", text, false)
+		if err != nil {
+			return err
+		}
+		v.Steps = append(v.Steps, step)
+		msgs = append(msgs, sent{header: header, ct: ct})
+	}
+	for i, idx := range v.Order {
+		if err := g.receive(s.responder, msgs[idx].ct, msgs[idx].header, v.Steps[idx].Plaintext); err != nil {
+			return err
+		}
+		if i == 0 {
+			v.Stored = skippedVectors(s.responder)
+			if err := g.snapshotSession("session-with-skipped-keys", s.responder); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.responder.skipped) != 0 {
+		return errors.New("cryptocore: skipped keys left after delivery")
+	}
+	g.out.Skipped = append(g.out.Skipped, v)
+	return nil
+}
+
+func skippedVectors(s *SessionState) []SkippedKeyVector {
+	out := make([]SkippedKeyVector, 0, len(s.skipped))
+	for name, key := range s.skipped {
+		out = append(out, SkippedKeyVector{
+			DHPublic:   hex.EncodeToString([]byte(name[:32])),
+			Index:      binary.BigEndian.Uint32([]byte(name[32:])),
+			MessageKey: hex.EncodeToString(key[:]),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DHPublic != out[j].DHPublic {
+			return out[i].DHPublic < out[j].DHPublic
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out
+}
+
+// snapshots exports the state the ratchet vector ends in.
+func (g *vectorGen) snapshots() error {
+	s := g.sessions["with-one-time-prekey"]
+	if _, err := s.responderDevice.PublishPrekeyBundle(2); err != nil {
+		return err
+	}
+	device, err := s.responderDevice.Export()
+	if err != nil {
+		return err
+	}
+	deviceJSON, err := json.Marshal(device)
+	if err != nil {
+		return err
+	}
+	g.out.Snapshots = append(g.out.Snapshots, SnapshotVector{Name: "device", Device: deviceJSON})
+
+	if err := g.snapshotSession("initiator-session", s.initiator); err != nil {
+		return err
+	}
+	return g.snapshotSession("responder-session", s.responder)
+}
+
+func (g *vectorGen) snapshotSession(name string, state *SessionState) error {
+	snap, err := ExportSession(state)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	g.out.Snapshots = append(g.out.Snapshots, SnapshotVector{Name: name, Session: data})
+	return nil
+}
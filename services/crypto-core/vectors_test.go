@@ -0,0 +1,178 @@
+package cryptocore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+const vectorsPath = "testdata/vectors.json"
+
+var updateVectors = flag.Bool("update", false, "rewrite "+vectorsPath)
+
+// TestVectorsMatchGolden fails when a protocol change alters any vector. If the
+// change is intended, rerun with -update and update the TypeScript port so it
+// keeps passing the same file.
+func TestVectorsMatchGolden(t *testing.T) {
+	vectors, err := GenerateVectors()
+	if err != nil {
+		t.Fatalf("GenerateVectors: %v", err)
+	}
+	got, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	got = append(got, '\n')
+	if *updateVectors {
+		if err := os.WriteFile(vectorsPath, got, 0o644); err != nil {
+			t.Fatalf("write %s: %v", vectorsPath, err)
+		}
+	}
+	want, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatalf("read %s: %v", vectorsPath, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("vectors drifted from %s; rerun with -update if the change is intended", vectorsPath)
+	}
+}
+
+func loadVectors(t *testing.T) *Vectors {
+	t.Helper()
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatalf("read %s: %v", vectorsPath, err)
+	}
+	var v Vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("decode %s: %v", vectorsPath, err)
+	}
+	return &v
+}
+
+func replay(t *testing.T, random ...string) func() {
+	t.Helper()
+	var buf []byte
+	for _, r := range random {
+		b, err := hex.DecodeString(r)
+		if err != nil {
+			t.Fatalf("decode random: %v", err)
+		}
+		buf = append(buf, b...)
+	}
+	return UseDeterministicRandom(bytes.NewReader(buf))
+}
+
+func hexOf(b []byte) string { return hex.EncodeToString(b) }
+
+// The replay tests consume the file the way another implementation would:
+// only the recorded randomness goes in, and the outputs must match.
+func TestVectorsReplayHandshakeAndRatchet(t *testing.T) {
+	v := loadVectors(t)
+	for _, iv := range v.Identity {
+		restore := replay(t, iv.Random)
+		dev, err := GenerateIdentityKeypair()
+		restore()
+		if err != nil {
+			t.Fatalf("%s: GenerateIdentityKeypair: %v", iv.Name, err)
+		}
+		if hexOf(dev.identity.signingPublic) != iv.SigningPublic || hexOf(dev.identity.dhPublic[:]) != iv.DHPublic || hexOf(dev.signedSig) != iv.SignedPrekeySig {
+			t.Fatalf("%s: identity does not match vector", iv.Name)
+		}
+	}
+
+	sessions := map[string][2]*SessionState{}
+	for _, xv := range v.X3DH {
+		restore := replay(t, xv.InitiatorRandom, xv.ResponderRandom, xv.OneTimePrekeyRandom, xv.EphemeralRandom)
+		alice, err := GenerateIdentityKeypair()
+		if err != nil {
+			t.Fatalf("%s: alice: %v", xv.Name, err)
+		}
+		bob, err := GenerateIdentityKeypair()
+		if err != nil {
+			t.Fatalf("%s: bob: %v", xv.Name, err)
+		}
+		count := 0
+		if xv.OneTimePrekeyRandom != "" {
+			count = 1
+		}
+		bundle, err := bob.PublishPrekeyBundle(count)
+		if err != nil {
+			t.Fatalf("%s: bundle: %v", xv.Name, err)
+		}
+		initiator, msg, err := alice.InitSession(bundle)
+		restore()
+		if err != nil {
+			t.Fatalf("%s: InitSession: %v", xv.Name, err)
+		}
+		if hexOf(msg.EphemeralKey[:]) != xv.EphemeralPublic || hexOf(initiator.RootKey[:]) != xv.RootKey || hexOf(initiator.SendChain.Key[:]) != xv.ChainKey {
+			t.Fatalf("%s: handshake does not match vector", xv.Name)
+		}
+		responder, err := bob.AcceptSession(msg)
+		if err != nil {
+			t.Fatalf("%s: AcceptSession: %v", xv.Name, err)
+		}
+		sessions[xv.Name] = [2]*SessionState{initiator, responder}
+	}
+
+	for _, rv := range v.Ratchet {
+		pair, ok := sessions[rv.X3DH]
+		if !ok {
+			t.Fatalf("%s: unknown x3dh vector %q", rv.Name, rv.X3DH)
+		}
+		for i, step := range rv.Steps {
+			from, to := pair[0], pair[1]
+			if step.Sender == "responder" {
+				from, to = pair[1], pair[0]
+			}
+			restore := replay(t, step.Random)
+			ct, header, err := Encrypt(from, []byte(step.Plaintext))
+			restore()
+			if err != nil {
+				t.Fatalf("%s step %d: Encrypt: %v", rv.Name, i, err)
+			}
+			if hexOf(ct) != step.Ciphertext || hexOf(header.DHPublic[:]) != step.DHPublic || header.PN != step.PN || header.N != step.N || hexOf(header.Nonce[:]) != step.Nonce || hexOf(from.RootKey[:]) != step.RootKey {
+				t.Fatalf("%s step %d: output does not match vector", rv.Name, i)
+			}
+			if pt, err := Decrypt(to, ct, header); err != nil || string(pt) != step.Plaintext {
+				t.Fatalf("%s step %d: Decrypt: %q, %v", rv.Name, i, pt, err)
+			}
+		}
+	}
+
+	for _, sv := range v.Skipped {
+		pair, ok := sessions[sv.X3DH]
+		if !ok {
+			t.Fatalf("%s: unknown x3dh vector %q", sv.Name, sv.X3DH)
+		}
+		cts := make([][]byte, len(sv.Steps))
+		headers := make([]*MessageHeader, len(sv.Steps))
+		for i, step := range sv.Steps {
+			restore := replay(t, step.Random)
+			ct, header, err := Encrypt(pair[0], []byte(step.Plaintext))
+			restore()
+			if err != nil {
+				t.Fatalf("%s step %d: Encrypt: %v", sv.Name, i, err)
+			}
+			if hexOf(ct) != step.Ciphertext {
+				t.Fatalf("%s step %d: ciphertext does not match vector", sv.Name, i)
+			}
+			cts[i], headers[i] = ct, header
+		}
+		for i, idx := range sv.Order {
+			if pt, err := Decrypt(pair[1], cts[idx], headers[idx]); err != nil || string(pt) != sv.Steps[idx].Plaintext {
+				t.Fatalf("%s delivery %d: Decrypt: %q, %v", sv.Name, i, pt, err)
+			}
+			if i == 0 {
+				got, _ := json.Marshal(skippedVectors(pair[1]))
+				want, _ := json.Marshal(sv.Stored)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s: stored skipped keys %s, want %s", sv.Name, got, want)
+				}
+			}
+		}
+	}
+}
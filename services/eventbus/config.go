@@ -0,0 +1,40 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Config selects and configures a Transport.
+type Config struct {
+	Transport   string // "postgres" or "nats"
+	PostgresURL string
+	Channel     string // LISTEN/NOTIFY channel, DefaultChannel if empty
+	NATSURL     string
+	Group       string // NATS queue group, normally the service name
+}
+
+// Open builds the Transport described by cfg. Each service runs as its own
+// process, so Open refuses the in-process transport: events would never
+// reach the other services. Tests that need one use NewInProcess directly.
+func Open(ctx context.Context, cfg Config) (Transport, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Transport)) {
+	case "":
+		return nil, fmt.Errorf("eventbus: no transport configured, set EVENTBUS_TRANSPORT to postgres or nats")
+	case "inprocess", "memory":
+		return nil, fmt.Errorf("eventbus: %s transport cannot reach other services, use postgres or nats", cfg.Transport)
+	case "postgres", "pg":
+		if cfg.PostgresURL == "" {
+			return nil, fmt.Errorf("eventbus: postgres transport needs a database url")
+		}
+		return NewPostgres(ctx, cfg.PostgresURL, cfg.Channel)
+	case "nats":
+		if cfg.NATSURL == "" {
+			return nil, fmt.Errorf("eventbus: nats transport needs a server url")
+		}
+		return NewNATS(cfg.NATSURL, cfg.Group)
+	default:
+		return nil, fmt.Errorf("eventbus: unknown transport %q", cfg.Transport)
+	}
+}
@@ -0,0 +1,65 @@
+// Package eventbus carries domain events between SecuMSG services.
+//
+// Services never publish directly from request handlers. They append events
+// to their own outbox table in the same transaction as the state change that
+// caused them (see Append), and a Relay later forwards committed rows to a
+// Transport. The relay publishes every committed event, possibly twice, but
+// the transports are fire-and-forget: a consumer that is disconnected or
+// whose handler fails never sees the event again. Delivery to consumers is
+// therefore at-most-once, with occasional duplicates. Consumers must be
+// idempotent and must not rely on the bus alone for state they cannot miss.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is implemented by every domain event a service emits. The type string
+// is the routing key and must stay stable once consumers depend on it.
+type Event interface {
+	EventType() string
+}
+
+// Envelope is the wire format shared by every transport.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope wraps evt for publication by source (usually the service name).
+func NewEnvelope(source string, evt Event) (Envelope, error) {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:         uuid.NewString(),
+		Type:       evt.EventType(),
+		Source:     source,
+		OccurredAt: time.Now().UTC(),
+		Payload:    payload,
+	}, nil
+}
+
+// Decode unmarshals the payload into v.
+func (e Envelope) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// Handler consumes one event. Returning an error only logs it; transports do
+// not redeliver, so the event is lost for that consumer.
+type Handler func(ctx context.Context, env Envelope) error
+
+// Transport moves envelopes between processes.
+type Transport interface {
+	Publish(ctx context.Context, env Envelope) error
+	Subscribe(eventType string, h Handler) error
+	Close() error
+}
@@ -0,0 +1,219 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testEvent struct {
+	Name string `json:"name"`
+}
+
+func (testEvent) EventType() string { return "test.happened" }
+
+type recorder struct {
+	mu   sync.Mutex
+	seen []Envelope
+	ch   chan Envelope
+}
+
+func newRecorder() *recorder { return &recorder{ch: make(chan Envelope, 16)} }
+
+func (r *recorder) handle(_ context.Context, env Envelope) error {
+	r.mu.Lock()
+	r.seen = append(r.seen, env)
+	r.mu.Unlock()
+	r.ch <- env
+	return nil
+}
+
+func (r *recorder) wait(t *testing.T) Envelope {
+	t.Helper()
+	select {
+	case env := <-r.ch:
+		return env
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for event")
+		return Envelope{}
+	}
+}
+
+type failingTransport struct{ *InProcess }
+
+func (failingTransport) Publish(context.Context, Envelope) error { return errors.New("broker down") }
+
+func setupOutbox(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&OutboxEvent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+func TestInProcessDeliversByType(t *testing.T) {
+	bus := NewInProcess()
+	rec := newRecorder()
+	if err := bus.Subscribe("test.happened", rec.handle); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	env, err := NewEnvelope("test", testEvent{Name: "a"})
+	if err != nil {
+		t.Fatalf("envelope: %v", err)
+	}
+	if err := bus.Publish(context.Background(), env); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	other := env
+	other.Type = "test.ignored"
+	if err := bus.Publish(context.Background(), other); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	if len(rec.seen) != 1 {
+		t.Fatalf("expected one delivery, got %d", len(rec.seen))
+	}
+	var got testEvent
+	if err := rec.seen[0].Decode(&got); err != nil || got.Name != "a" {
+		t.Fatalf("unexpected payload %+v (%v)", got, err)
+	}
+}
+
+func TestRelayPublishesCommittedRowsInOrder(t *testing.T) {
+	db := setupOutbox(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"first", "second", "third"} {
+		if err := Append(ctx, db, "test", testEvent{Name: name}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	// A rolled back transaction must not leave anything to relay.
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		if err := Append(ctx, tx, "test", testEvent{Name: "rolled-back"}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		return errors.New("rollback")
+	})
+
+	bus := NewInProcess()
+	rec := newRecorder()
+	_ = bus.Subscribe("test.happened", rec.handle)
+
+	relay := NewRelay(db, bus, RelayOptions{})
+	sent, err := relay.Flush(ctx)
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if sent != 3 {
+		t.Fatalf("expected 3 events relayed, got %d", sent)
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		var got testEvent
+		_ = rec.seen[i].Decode(&got)
+		if got.Name != want {
+			t.Fatalf("event %d: expected %q, got %q", i, want, got.Name)
+		}
+	}
+
+	if sent, err := relay.Flush(ctx); err != nil || sent != 0 {
+		t.Fatalf("expected nothing left to relay, got %d (%v)", sent, err)
+	}
+}
+
+func TestRelayKeepsRowsWhenTransportFails(t *testing.T) {
+	db := setupOutbox(t)
+	ctx := context.Background()
+	if err := Append(ctx, db, "test", testEvent{Name: "retry-me"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	if _, err := NewRelay(db, failingTransport{NewInProcess()}, RelayOptions{}).Flush(ctx); err == nil {
+		t.Fatalf("expected flush to report the transport error")
+	}
+	var row OutboxEvent
+	if err := db.First(&row).Error; err != nil {
+		t.Fatalf("load row: %v", err)
+	}
+	if row.PublishedAt != nil || row.Attempts != 1 || row.LastError == "" {
+		t.Fatalf("expected row kept for retry, got %+v", row)
+	}
+
+	bus := NewInProcess()
+	rec := newRecorder()
+	_ = bus.Subscribe("test.happened", rec.handle)
+	if sent, err := NewRelay(db, bus, RelayOptions{}).Flush(ctx); err != nil || sent != 1 {
+		t.Fatalf("expected retry to succeed, got %d (%v)", sent, err)
+	}
+}
+
+func TestNATSTransport(t *testing.T) {
+	srv, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("nats server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("nats server not ready")
+	}
+
+	consumer, err := Open(context.Background(), Config{Transport: "nats", NATSURL: srv.ClientURL(), Group: "keys"})
+	if err != nil {
+		t.Fatalf("open consumer: %v", err)
+	}
+	defer consumer.Close()
+	producer, err := Open(context.Background(), Config{Transport: "nats", NATSURL: srv.ClientURL(), Group: "auth"})
+	if err != nil {
+		t.Fatalf("open producer: %v", err)
+	}
+	defer producer.Close()
+
+	rec := newRecorder()
+	if err := consumer.Subscribe("test.happened", rec.handle); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	env, _ := NewEnvelope("auth", testEvent{Name: "over-the-wire"})
+	if err := producer.Publish(context.Background(), env); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	got := rec.wait(t)
+	if got.ID != env.ID || got.Source != "auth" {
+		t.Fatalf("unexpected envelope %+v", got)
+	}
+}
+
+func TestOpenRefusesLocalTransports(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "unset", cfg: Config{}},
+		{name: "inprocess", cfg: Config{Transport: "inprocess"}},
+		{name: "memory", cfg: Config{Transport: "memory"}},
+		{name: "postgres without url", cfg: Config{Transport: "postgres"}},
+		{name: "nats without url", cfg: Config{Transport: "nats"}},
+		{name: "unknown", cfg: Config{Transport: "kafka"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bus, err := Open(context.Background(), tc.cfg)
+			if err == nil {
+				_ = bus.Close()
+				t.Fatalf("expected Open to fail")
+			}
+		})
+	}
+}
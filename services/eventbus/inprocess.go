@@ -0,0 +1,41 @@
+package eventbus
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// InProcess delivers events to handlers registered in the same process. It is
+// meant for tests that do not need a broker; Open never returns it.
+type InProcess struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{handlers: make(map[string][]Handler)}
+}
+
+// Publish runs matching handlers synchronously, in subscription order.
+func (b *InProcess) Publish(ctx context.Context, env Envelope) error {
+	b.mu.RLock()
+	handlers := append([]Handler(nil), b.handlers[env.Type]...)
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, env); err != nil {
+			slog.Warn("event handler failed", "event_type", env.Type, "event_id", env.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (b *InProcess) Subscribe(eventType string, h Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+	return nil
+}
+
+func (b *InProcess) Close() error { return nil }
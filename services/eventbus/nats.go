@@ -0,0 +1,96 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubjectPrefix namespaces event subjects on a shared NATS server.
+const DefaultSubjectPrefix = "secumsg.events."
+
+// flushTimeout bounds Publish when the caller's context has no deadline.
+const flushTimeout = 5 * time.Second
+
+// NATS is a Transport over core NATS subjects. Subscriptions join a queue
+// group, so each event is handled by one replica of each consuming service.
+type NATS struct {
+	conn   *nats.Conn
+	prefix string
+	group  string
+
+	mu   sync.Mutex
+	subs []*nats.Subscription
+}
+
+func NewNATS(url, group string, opts ...nats.Option) (*NATS, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("eventbus: nats connect: %w", err)
+	}
+	return &NATS{conn: conn, prefix: DefaultSubjectPrefix, group: group}, nil
+}
+
+// Publish sends env and waits for the server to acknowledge the flush, so a
+// nil error means the event left this process. Core NATS does not store it:
+// subscribers that are not connected right now never receive it.
+func (n *NATS) Publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if err := n.conn.Publish(n.prefix+env.Type, data); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flushTimeout)
+		defer cancel()
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+func (n *NATS) Subscribe(eventType string, h Handler) error {
+	cb := func(msg *nats.Msg) {
+		var env Envelope
+		if err := json.Unmarshal(msg.Data, &env); err != nil {
+			slog.Warn("eventbus dropped malformed message", "subject", msg.Subject, "error", err)
+			return
+		}
+		if err := h(context.Background(), env); err != nil {
+			slog.Warn("event handler failed", "event_type", env.Type, "event_id", env.ID, "error", err)
+		}
+	}
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if n.group != "" {
+		sub, err = n.conn.QueueSubscribe(n.prefix+eventType, n.group, cb)
+	} else {
+		sub, err = n.conn.Subscribe(n.prefix+eventType, cb)
+	}
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.subs = append(n.subs, sub)
+	n.mu.Unlock()
+	return n.conn.Flush()
+}
+
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, sub := range n.subs {
+		_ = sub.Unsubscribe()
+	}
+	n.subs = nil
+	n.conn.Close()
+	return nil
+}
@@ -0,0 +1,159 @@
+package eventbus
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxEvent is a row in a service's outbox_events table.
+type OutboxEvent struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" db:"id"`
+	Type        string     `gorm:"type:text;not null" db:"type"`
+	Source      string     `gorm:"type:text;not null" db:"source"`
+	Payload     []byte     `gorm:"type:jsonb;not null" db:"payload"`
+	OccurredAt  time.Time  `gorm:"not null;index" db:"occurred_at"`
+	PublishedAt *time.Time `gorm:"index" db:"published_at"`
+	Attempts    int        `gorm:"not null;default:0" db:"attempts"`
+	LastError   string     `gorm:"type:text" db:"last_error"`
+}
+
+func (OutboxEvent) TableName() string { return "outbox_events" }
+
+// Append stores evt in the outbox using db, which should be the transaction
+// that carries the state change the event describes.
+func Append(ctx context.Context, db *gorm.DB, source string, evt Event) error {
+	env, err := NewEnvelope(source, evt)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(env.ID)
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Create(&OutboxEvent{
+		ID:         id,
+		Type:       env.Type,
+		Source:     env.Source,
+		Payload:    env.Payload,
+		OccurredAt: env.OccurredAt,
+	}).Error
+}
+
+func (o OutboxEvent) envelope() Envelope {
+	return Envelope{
+		ID:         o.ID.String(),
+		Type:       o.Type,
+		Source:     o.Source,
+		OccurredAt: o.OccurredAt,
+		Payload:    o.Payload,
+	}
+}
+
+type RelayOptions struct {
+	Interval  time.Duration // poll interval, default 1s
+	BatchSize int           // rows per pass, default 100
+	Retention time.Duration // how long published rows are kept, default 7 days
+}
+
+// Relay forwards committed outbox rows to a Transport in occurrence order.
+type Relay struct {
+	db        *gorm.DB
+	transport Transport
+	opts      RelayOptions
+}
+
+func NewRelay(db *gorm.DB, transport Transport, opts RelayOptions) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	return &Relay{db: db, transport: transport, opts: opts}
+}
+
+// Run flushes the outbox every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("outbox flush failed", "error", err)
+		}
+		if time.Since(lastPrune) > time.Hour {
+			if err := r.prune(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("outbox prune failed", "error", err)
+			}
+			lastPrune = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes up to one batch of pending rows and returns how many were
+// sent. It stops at the first failure so later events never overtake it.
+// Rows are locked with SKIP LOCKED, so several replicas can relay safely.
+// A row counts as published once the transport accepts it, which says
+// nothing about whether any consumer received it.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	sent := 0
+	var publishErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending []OutboxEvent
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Order("occurred_at ASC").
+			Limit(r.opts.BatchSize).
+			Find(&pending).Error; err != nil {
+			return err
+		}
+		for _, row := range pending {
+			if err := r.transport.Publish(ctx, row.envelope()); err != nil {
+				publishErr = err
+				return tx.Model(&OutboxEvent{}).
+					Where("id = ?", row.ID).
+					Updates(map[string]any{
+						"attempts":   gorm.Expr("attempts + 1"),
+						"last_error": err.Error(),
+					}).Error
+			}
+			now := time.Now().UTC()
+			if err := tx.Model(&OutboxEvent{}).
+				Where("id = ?", row.ID).
+				Updates(map[string]any{
+					"published_at": now,
+					"attempts":     gorm.Expr("attempts + 1"),
+					"last_error":   "",
+				}).Error; err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	if err != nil {
+		return sent, err
+	}
+	return sent, publishErr
+}
+
+func (r *Relay) prune(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-r.opts.Retention)
+	return r.db.WithContext(ctx).
+		Where("published_at IS NOT NULL AND published_at < ?", cutoff).
+		Delete(&OutboxEvent{}).Error
+}
@@ -0,0 +1,145 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultChannel is the LISTEN/NOTIFY channel used when none is configured.
+const DefaultChannel = "secumsg_events"
+
+// maxNotifyPayload is Postgres' hard limit on a NOTIFY payload.
+const maxNotifyPayload = 8000
+
+// Postgres is a Transport over LISTEN/NOTIFY. Notifications are scoped to a
+// single database, so every service must point at the same one. Every
+// listening replica receives every event.
+type Postgres struct {
+	pool    *pgxpool.Pool
+	channel string
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+
+	listenOnce sync.Once
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewPostgres(ctx context.Context, url, channel string) (*Postgres, error) {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("eventbus: postgres connect: %w", err)
+	}
+	return &Postgres{
+		pool:     pool,
+		channel:  channel,
+		handlers: make(map[string][]Handler),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (p *Postgres) Publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxNotifyPayload {
+		return fmt.Errorf("eventbus: %s payload is %d bytes, NOTIFY allows %d", env.Type, len(data), maxNotifyPayload)
+	}
+	_, err = p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", p.channel, string(data))
+	return err
+}
+
+func (p *Postgres) Subscribe(eventType string, h Handler) error {
+	p.mu.Lock()
+	p.handlers[eventType] = append(p.handlers[eventType], h)
+	p.mu.Unlock()
+
+	p.listenOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		go p.listen(ctx)
+	})
+	return nil
+}
+
+func (p *Postgres) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+	}
+	p.pool.Close()
+	return nil
+}
+
+// listen holds one connection out of the pool for LISTEN and reconnects with
+// a fixed delay when it drops. NOTIFY does not queue for absent listeners, so
+// events sent while disconnected are lost to this process; the sender's
+// outbox has already marked them published.
+func (p *Postgres) listen(ctx context.Context) {
+	defer close(p.done)
+	for {
+		err := p.listenConn(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("eventbus listen connection lost", "channel", p.channel, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (p *Postgres) listenConn(ctx context.Context) error {
+	pooled, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pooled.Hijack()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{p.channel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var env Envelope
+		if err := json.Unmarshal([]byte(n.Payload), &env); err != nil {
+			slog.Warn("eventbus dropped malformed notification", "channel", p.channel, "error", err)
+			continue
+		}
+		p.dispatch(ctx, env)
+	}
+}
+
+func (p *Postgres) dispatch(ctx context.Context, env Envelope) {
+	p.mu.RLock()
+	handlers := append([]Handler(nil), p.handlers[env.Type]...)
+	p.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h(ctx, env); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Warn("event handler failed", "event_type", env.Type, "event_id", env.ID, "error", err)
+		}
+	}
+}
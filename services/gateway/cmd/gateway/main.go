@@ -2,29 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"log/slog"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/go-chi/httprate"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 
 	"gateway/internal/authz"
+	"gateway/internal/deletion"
+	"gateway/internal/export"
 	gwmw "gateway/internal/middleware"
-	"gateway/internal/observability/logging"
 	"gateway/internal/observability/metrics"
-	obsmw "gateway/internal/observability/middleware"
 	"gateway/internal/proxy"
+	"gateway/internal/ratelimit"
+	"gateway/internal/wsproxy"
+
+	"eventbus"
+	"identity"
+	"observability/health"
+	"observability/logging"
+	obsmw "observability/middleware"
+	"observability/tracing"
 )
 
 func main() {
@@ -40,7 +50,12 @@ func main() {
 	})
 
 	slog.SetDefault(logger)
-	metrics.MustRegister("gateway")
+	metrics.MustRegister("gateway", env)
+	shutdownTracing, err := tracing.Setup(context.Background(), "gateway", env)
+	if err != nil {
+		logger.Error("tracing", "error", err)
+		os.Exit(1)
+	}
 
 	logger.Info("starting service")
 
@@ -56,28 +71,116 @@ func main() {
 	keysProxy := proxy.New(keysBase, 10*time.Second)
 	messagesProxy := proxy.New(messagesBase, 10*time.Second)
 
+	deletionStore, db, err := openDeletionStore(os.Getenv("GATEWAY_DATABASE_URL"))
+	if err != nil {
+		logger.Error("deletion store", "error", err)
+		os.Exit(1)
+	}
+	deletionRunner := deletion.NewRunner(deletionStore, []deletion.Service{
+		{
+			Name:    "messages",
+			BaseURL: messagesBase,
+			Path: func(job *deletion.Job) string {
+				if job.DeviceID == "" {
+					return "/messages/me"
+				}
+				return "/messages/me?device_id=" + url.QueryEscape(job.DeviceID)
+			},
+		},
+		{Name: "keys", BaseURL: keysBase, Path: func(*deletion.Job) string { return "/keys/me" }},
+		// Auth goes last: deleting the user revokes the token the saga runs with.
+		{Name: "auth", BaseURL: authBase, Path: func(*deletion.Job) string { return "/v1/users/me" }, RevokesToken: true},
+	}, deletion.RunnerOptions{})
+	// The saga runner keeps going until in-flight requests are done, since
+	// they may have just queued a deletion.
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go deletionRunner.Run(background)
+	deletions := deletion.NewHandler(deletionStore, deletionRunner)
+
+	signer, err := export.NewSigner(os.Getenv("GATEWAY_EXPORT_SIGNING_KEY"))
+	if err != nil {
+		logger.Error("GATEWAY_EXPORT_SIGNING_KEY", "error", err)
+		os.Exit(1)
+	}
+	exports := export.NewHandler(export.NewExporter([]export.Source{
+		{Name: "auth", BaseURL: authBase, Path: func(string) string { return "/v1/users/me/export" }},
+		{Name: "keys", BaseURL: keysBase, Path: func(string) string { return "/keys/me/export" }},
+		{
+			Name:      "messages",
+			BaseURL:   messagesBase,
+			PerDevice: true,
+			Path: func(deviceID string) string {
+				return "/messages/me/export?device_id=" + url.QueryEscape(deviceID)
+			},
+		},
+	}, nil), signer)
+
 	msgWSURL, err := url.Parse(messagesBase)
 	if err != nil {
 		logger.Error("invalid MESSAGES_BASE_URL", "error", err)
 		os.Exit(1)
 	}
-	msgWSProxy := httputil.NewSingleHostReverseProxy(msgWSURL)
-	msgWSProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		reqID := obsmw.RequestIDFromContext(r.Context())
-		traceID := obsmw.TraceIDFromContext(r.Context())
-		slog.Error("gateway websocket proxy error", "error", err, "request_id", reqID, "trace_id", traceID)
-		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	wsProxy := wsproxy.New(msgWSURL, wsproxy.Options{
+		MaxPerUser: envInt("GATEWAY_WS_MAX_PER_USER", 10),
+	})
+
+	// choose validator: HS256 shared secret (if provided) else JWKS
+	var authMW func(http.Handler) http.Handler
+	var identify ratelimit.IdentifyFunc
+	if sharedHS != "" {
+		slog.Info("gateway using HS256 shared-secret token validation")
+		hv := authz.NewHMACValidator(sharedHS, issuer)
+		authMW = hv.Middleware
+		identify = hv.Identify
+	} else {
+		slog.Info("gateway using JWKS", "jwks_url", jwksURL)
+		jv, err := authz.NewJWTValidator(context.Background(), jwksURL, issuer)
+		if err != nil {
+			slog.Error("failed to init JWT validator", "error", err)
+			os.Exit(1)
+		}
+		authMW = jv.Middleware
+		identify = jv.Identify
+	}
+
+	perimeter, err := newPerimeter(authBase, os.Getenv("INTERNAL_IDENTITY_KEY"))
+	if err != nil {
+		logger.Error("internal identity key", "error", err)
+		os.Exit(1)
+	}
+	bus, err := eventbus.Open(context.Background(), eventbus.Config{
+		Transport:   os.Getenv("EVENTBUS_TRANSPORT"),
+		PostgresURL: os.Getenv("EVENTBUS_POSTGRES_URL"),
+		Channel:     envOr("EVENTBUS_CHANNEL", eventbus.DefaultChannel),
+		NATSURL:     os.Getenv("EVENTBUS_NATS_URL"),
+		Group:       "gateway",
+	})
+	if err != nil {
+		logger.Error("event bus", "error", err)
+		os.Exit(1)
+	}
+	if err := perimeter.Subscribe(bus); err != nil {
+		logger.Error("event subscribe", "error", err)
+		os.Exit(1)
+	}
+
+	limiter, err := newLimiter(os.Getenv("GATEWAY_RATE_LIMITS"), os.Getenv("GATEWAY_RATE_LIMIT_REDIS_URL"), identify)
+	if err != nil {
+		logger.Error("rate limiter", "error", err)
+		os.Exit(1)
 	}
 
 	r := chi.NewRouter()
 
 	// --- Middlewares ---
+	r.Use(gwmw.RecordRoute)
 	r.Use(chimw.RealIP)
 	r.Use(chimw.Recoverer)
 	r.Use(TimeoutExceptWS(30 * time.Second))
 
-	// rate limit (e.g., 100 req / minute by IP)
-	r.Use(httprate.LimitByIP(100, 1*time.Minute))
+	// rate limit per IP, subject and device; tighter classes are added per route
+	r.Use(limiter.Middleware(ratelimit.ClassDefault))
 
 	// CORS
 	origins := strings.Split(envOr("CORS_ORIGINS", ""), ",")
@@ -87,7 +190,8 @@ func main() {
 		// when you want to lock it down via CORS_ORIGINS.
 		AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID", "X-Trace-ID"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID", "X-Device-ID", "traceparent", "tracestate"},
+		ExposedHeaders:   []string{"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID", "X-Trace-ID"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}
@@ -102,65 +206,61 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	ready := health.New()
+	ready.Add("db", health.DB(db))
+	ready.Add("auth", health.HTTP(authBase+"/healthz"))
+	r.Handle("/readyz", ready)
 
 	r.Handle("/metrics", promhttp.Handler())
 
 	// -------- Public auth endpoints (pass-through to Auth) --------
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/register", p.ForwardJSON("/v1/auth/register"))
-		r.Post("/login", p.ForwardJSON("/v1/auth/login"))
+		r.With(limiter.Middleware(ratelimit.ClassLogin)).Post("/login", p.ForwardJSON("/v1/auth/login"))
 		r.Post("/refresh", p.ForwardJSON("/v1/auth/refresh"))
 		r.Post("/verify", p.ForwardJSON("/v1/auth/verify"))
 		r.Delete("/me", p.ForwardJSON("/v1/users/me"))
 		r.Post("/resolve", p.ForwardJSON("/v1/users/resolve"))
 		r.Post("/resolve-device", p.ForwardJSON("/v1/users/resolve-device"))
+		r.Route("/sessions", func(r chi.Router) {
+			r.Get("/", p.ForwardJSON("/v1/sessions"))
+			r.Post("/revoke-others", p.ForwardJSON("/v1/sessions/revoke-others"))
+			r.Delete("/{id}", p.ForwardJSONFunc(func(r *http.Request) string {
+				return "/v1/sessions/" + url.PathEscape(chi.URLParam(r, "id"))
+			}))
+		})
 		r.Route("/devices", func(r chi.Router) {
 			r.Post("/register", p.ForwardJSON("/v1/devices/register"))
 			r.Post("/rotate-prekeys", p.ForwardJSON("/v1/devices/rotate-prekeys"))
 			r.Post("/revoke", p.ForwardJSON("/v1/devices/revoke"))
-			r.Post("/allocate-prekey", p.ForwardJSON("/v1/devices/allocate-prekey"))
+			r.With(limiter.Middleware(ratelimit.ClassBundle)).Post("/allocate-prekey", p.ForwardJSON("/v1/devices/allocate-prekey"))
 		})
 	})
 
 	// -------- Key service proxy --------
 	r.Route("/keys", func(r chi.Router) {
+		r.Use(perimeter.Middleware)
 		r.Post("/device/register", keysProxy.ForwardJSON("/keys/device/register"))
-		r.Get("/bundle", keysProxy.ForwardJSON("/keys/bundle"))
+		r.With(limiter.Middleware(ratelimit.ClassBundle)).Get("/bundle", keysProxy.ForwardJSON("/keys/bundle"))
 		r.Post("/rotate-signed-prekey", keysProxy.ForwardJSON("/keys/rotate-signed-prekey"))
 		r.Delete("/me", keysProxy.ForwardJSON("/keys/me"))
 	})
 
 	// -------- Message service proxy --------
-	r.Post("/messages/send", messagesProxy.ForwardJSON("/messages/send"))
-	r.Get("/messages/history", messagesProxy.ForwardJSON("/messages/history"))
-	r.Get("/messages/conversations", messagesProxy.ForwardJSON("/messages/conversations"))
-	r.Delete("/messages/me", messagesProxy.ForwardJSON("/messages/me"))
-	wsHandler := func(w http.ResponseWriter, req *http.Request) {
-		if req.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		msgWSProxy.ServeHTTP(w, req)
-	}
-	r.HandleFunc("/ws", wsHandler)
-	r.HandleFunc("/messages/ws", wsHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(perimeter.Middleware)
+		r.With(limiter.Middleware(ratelimit.ClassSend)).Post("/messages/send", messagesProxy.ForwardJSON("/messages/send"))
+		r.Get("/messages/history", messagesProxy.ForwardJSON("/messages/history"))
+		r.Get("/messages/conversations", messagesProxy.ForwardJSON("/messages/conversations"))
+		r.Delete("/messages/me", messagesProxy.ForwardJSON("/messages/me"))
+		r.Handle("/ws", wsProxy)
+		r.Handle("/messages/ws", wsProxy)
+	})
 
-	// -------- Protected example route --------
-	// choose validator: HS256 shared secret (if provided) else JWKS
-	var authMW func(http.Handler) http.Handler
-	if sharedHS != "" {
-		slog.Info("gateway using HS256 shared-secret token validation")
-		hv := authz.NewHMACValidator(sharedHS, issuer)
-		authMW = hv.Middleware
-	} else {
-		slog.Info("gateway using JWKS", "jwks_url", jwksURL)
-		jv, err := authz.NewJWTValidator(context.Background(), jwksURL, issuer)
-		if err != nil {
-			slog.Error("failed to init JWT validator", "error", err)
-			os.Exit(1)
-		}
-		authMW = jv.Middleware
-	}
+	// Deletion status is keyed by an unguessable job id rather than a token,
+	// since the token dies with the account.
+	r.Get("/profile/deletion/{id}", deletions.Status)
+	r.Get("/profile/export/key", exports.PublicKey)
 
 	r.Group(func(pr chi.Router) {
 		pr.Use(authMW)
@@ -176,116 +276,110 @@ func main() {
 			_, _ = w.Write([]byte(`{"sub":"` + sub + `"}`))
 		})
 
-		pr.Delete("/profile", func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if strings.TrimSpace(authHeader) == "" {
-				http.Error(w, "missing bearer token", http.StatusUnauthorized)
-				return
-			}
-
-			type deletePayload struct {
-				Status           string           `json:"status"`
-				DeletedResources map[string]int64 `json:"deletedResources"`
-				Timestamp        string           `json:"timestamp"`
-			}
-			type aggregateResponse struct {
-				Status           string                      `json:"status"`
-				DeletedResources map[string]map[string]int64 `json:"deletedResources,omitempty"`
-				Errors           map[string]string           `json:"errors,omitempty"`
-				Timestamp        string                      `json:"timestamp"`
-			}
-
-			client := &http.Client{Timeout: 10 * time.Second}
-
-			callDelete := func(baseURL, path, label string) (*deletePayload, int, error) {
-				req, err := http.NewRequestWithContext(r.Context(), http.MethodDelete, baseURL+path, nil)
-				if err != nil {
-					return nil, http.StatusBadGateway, err
-				}
-				req.Header.Set("Authorization", authHeader)
-				req.Header.Set("Content-Type", "application/json")
-				if reqID := obsmw.RequestIDFromContext(r.Context()); reqID != "" {
-					req.Header.Set("X-Request-ID", reqID)
-				}
-				if traceID := obsmw.TraceIDFromContext(r.Context()); traceID != "" {
-					req.Header.Set("X-Trace-ID", traceID)
-				}
-
-				resp, err := client.Do(req)
-				if err != nil {
-					return nil, http.StatusBadGateway, err
-				}
-				defer func() { _ = resp.Body.Close() }()
-
-				if resp.StatusCode >= 400 {
-					body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-					return nil, resp.StatusCode, fmt.Errorf("%s delete failed: %s", label, strings.TrimSpace(string(body)))
-				}
-				var payload deletePayload
-				if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-					return nil, http.StatusBadGateway, err
-				}
-				return &payload, resp.StatusCode, nil
-			}
-
-			deleted := map[string]map[string]int64{}
-			errors := map[string]string{}
-
-			msgPath := "/messages/me"
-			if deviceParam := strings.TrimSpace(r.URL.Query().Get("device_id")); deviceParam != "" {
-				msgPath = msgPath + "?device_id=" + url.QueryEscape(deviceParam)
-			}
-			msgPayload, _, err := callDelete(messagesBase, msgPath, "messages")
-			if err != nil {
-				errors["messages"] = err.Error()
-			} else if msgPayload != nil {
-				deleted["messages"] = msgPayload.DeletedResources
-			}
-
-			keysPayload, _, err := callDelete(keysBase, "/keys/me", "keys")
-			if err != nil {
-				errors["keys"] = err.Error()
-			} else if keysPayload != nil {
-				deleted["keys"] = keysPayload.DeletedResources
-			}
+		pr.Get("/profile/export", exports.Export)
+		pr.Delete("/profile", deletions.Start)
+		pr.Post("/profile/deletion/{id}/resume", deletions.Resume)
+	})
 
-			if len(errors) == 0 {
-				authPayload, _, err := callDelete(authBase, "/v1/users/me", "auth")
-				if err != nil {
-					errors["auth"] = err.Error()
-				} else if authPayload != nil {
-					deleted["auth"] = authPayload.DeletedResources
-				}
-			}
+	handler := obsmw.WithRequestAndTrace(obsmw.WithMetrics(r))
 
-			resp := aggregateResponse{
-				Status:    "deleted",
-				Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
-			}
-			if len(errors) > 0 {
-				resp.Status = "failed"
-				resp.Errors = errors
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadGateway)
-				_ = json.NewEncoder(w).Encode(resp)
-				return
-			}
+	srv := &http.Server{Addr: ":8080", Handler: handler}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		slog.Info("gateway listening", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+	<-ctx.Done()
+
+	// Fail readiness first so the load balancer stops sending new clients
+	// before the listener closes.
+	delay := envDuration("GATEWAY_SHUTDOWN_DELAY", 5*time.Second)
+	timeout := envDuration("GATEWAY_SHUTDOWN_TIMEOUT", 20*time.Second)
+	slog.Info("gateway shutting down", "delay", delay, "timeout", timeout, "websockets", wsProxy.Active())
+	ready.Drain()
+	time.Sleep(delay)
+
+	// Shutdown does not wait for hijacked connections, so sockets are drained
+	// separately and at the same time.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- wsProxy.Drain(shutdownCtx) }()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("http shutdown", "error", err)
+	}
+	if err := <-drained; err != nil {
+		slog.Warn("websocket drain incomplete", "error", err, "remaining", wsProxy.Active())
+	}
+	stopBackground()
+	_ = bus.Close()
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("tracing shutdown", "error", err)
+	}
+	slog.Info("gateway stopped")
+}
 
-			resp.DeletedResources = deleted
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(resp)
-		})
-	})
+// openDeletionStore opens the Postgres deletion store and also returns the
+// connection. A deletion job must survive a restart, so there is no fallback
+// when the URL is missing.
+func openDeletionStore(dsn string) (deletion.Store, *gorm.DB, error) {
+	if strings.TrimSpace(dsn) == "" {
+		return nil, nil, errors.New("GATEWAY_DATABASE_URL is required to persist deletion jobs")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tracing.InstrumentGORM(db); err != nil {
+		return nil, nil, err
+	}
+	st := deletion.NewGormStore(db)
+	if err := st.AutoMigrate(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	return st, db, nil
+}
 
-	handler := obsmw.WithRequestAndTrace(obsmw.WithMetrics(r))
+// newPerimeter signs identity headers for the backends when key is set.
+// Without it the backends keep verifying tokens with auth themselves.
+func newPerimeter(authBase, key string) (*authz.Perimeter, error) {
+	if strings.TrimSpace(key) == "" {
+		slog.Warn("INTERNAL_IDENTITY_KEY not set; backends will re-verify every token with auth")
+		return authz.NewPerimeter(authBase, nil), nil
+	}
+	signer, err := identity.NewSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	return authz.NewPerimeter(authBase, signer), nil
+}
 
-	addr := ":8080"
-	slog.Info("gateway listening", "addr", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		logger.Error("server error", "error", err)
-		os.Exit(1)
+// newLimiter applies the policy overrides in spec. Buckets are shared through
+// redisURL when set, otherwise each replica counts on its own.
+func newLimiter(spec, redisURL string, identify ratelimit.IdentifyFunc) (*ratelimit.Limiter, error) {
+	policy, err := ratelimit.ParsePolicy(spec)
+	if err != nil {
+		return nil, err
 	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if strings.TrimSpace(redisURL) != "" {
+		rs, err := ratelimit.NewRedisStore(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		store = rs
+		slog.Info("gateway rate limits shared through redis")
+	}
+	return ratelimit.New(policy, store, identify), nil
 }
 
 func envOr(k, def string) string {
@@ -295,6 +389,26 @@ func envOr(k, def string) string {
 	return def
 }
 
+func envInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		slog.Warn("invalid integer, using default", "key", k, "value", v, "default", def)
+	}
+	return def
+}
+
+func envDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		slog.Warn("invalid duration, using default", "key", k, "value", v, "default", def)
+	}
+	return def
+}
+
 func originsIfSet(in []string) []string {
 	out := []string{}
 	for _, o := range in {
@@ -7,10 +7,12 @@ import (
 	"net/http"
 	"strings"
 
+	"gateway/internal/middleware"
 	"gateway/internal/observability/metrics"
-	obsmw "gateway/internal/observability/middleware"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	obsmw "observability/middleware"
 )
 
 type HMACValidator struct {
@@ -42,13 +44,7 @@ func (h *HMACValidator) Middleware(next http.Handler) http.Handler {
 		}
 		tokStr := strings.TrimSpace(raw[len("Bearer "):])
 
-		token, err := jwt.Parse(tokStr, func(token *jwt.Token) (interface{}, error) {
-			// Ensure HS* (HMAC) only
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %T", token.Method)
-			}
-			return h.secret, nil
-		})
+		token, err := jwt.Parse(tokStr, h.keyfunc)
 		if err != nil || !token.Valid {
 			result = "failure"
 			http.Error(w, "invalid token", http.StatusUnauthorized)
@@ -85,6 +81,38 @@ func (h *HMACValidator) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// Identify returns the subject of a valid bearer token and the device it was
+// issued to, if any, without rejecting the request when there is none, e.g.
+// to key rate limits on public routes.
+func (h *HMACValidator) Identify(r *http.Request) (sub, device string, ok bool) {
+	raw := r.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(raw), "bearer ") {
+		return "", "", false
+	}
+	token, err := jwt.Parse(strings.TrimSpace(raw[len("Bearer "):]), h.keyfunc)
+	if err != nil || !token.Valid {
+		return "", "", false
+	}
+	claims, isMap := token.Claims.(jwt.MapClaims)
+	if !isMap {
+		return "", "", false
+	}
+	if iss, _ := claims["iss"].(string); iss != "" && iss != h.issuer {
+		return "", "", false
+	}
+	sub, _ = claims["sub"].(string)
+	device, _ = claims["did"].(string)
+	return sub, device, sub != ""
+}
+
+func (h *HMACValidator) keyfunc(token *jwt.Token) (interface{}, error) {
+	// Ensure HS* (HMAC) only
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %T", token.Method)
+	}
+	return h.secret, nil
+}
+
 // Small local helpers so we don't import another package
 type subjectKey struct{}
 
@@ -92,7 +120,19 @@ func contextWithSubject(ctx context.Context, sub string) context.Context {
 	return context.WithValue(ctx, subjectKey{}, sub)
 }
 
+// SubjectFrom returns the subject set by any of the gateway's validators.
 func SubjectFrom(ctx context.Context) (string, bool) {
-	v, ok := ctx.Value(subjectKey{}).(string)
+	if v, ok := ctx.Value(subjectKey{}).(string); ok {
+		return v, true
+	}
+	v, ok := ctx.Value(middleware.CtxSubKey{}).(string)
 	return v, ok
 }
+
+// DeviceFrom returns the device the perimeter confirmed the caller acts for:
+// the one the request named once auth vouched for it, or else the device the
+// token was issued to.
+func DeviceFrom(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(middleware.CtxDeviceKey{}).(string)
+	return v, ok && v != ""
+}
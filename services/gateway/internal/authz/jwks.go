@@ -9,10 +9,11 @@ import (
 
 	"gateway/internal/middleware"
 	"gateway/internal/observability/metrics"
-	obsmw "gateway/internal/observability/middleware"
 
 	"github.com/MicahParks/keyfunc"
 	"github.com/golang-jwt/jwt/v4"
+
+	obsmw "observability/middleware"
 )
 
 type JWTValidator struct {
@@ -84,5 +85,29 @@ func (j *JWTValidator) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// Identify returns the subject of a valid bearer token and the device it was
+// issued to, if any, without rejecting the request when there is none, e.g.
+// to key rate limits on public routes.
+func (j *JWTValidator) Identify(r *http.Request) (sub, device string, ok bool) {
+	raw := r.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(raw), "bearer ") {
+		return "", "", false
+	}
+	token, err := jwt.Parse(strings.TrimSpace(raw[len("Bearer "):]), j.jwks.Keyfunc)
+	if err != nil || !token.Valid {
+		return "", "", false
+	}
+	claims, isMap := token.Claims.(jwt.MapClaims)
+	if !isMap {
+		return "", "", false
+	}
+	if iss, _ := claims["iss"].(string); iss != "" && iss != j.issuer {
+		return "", "", false
+	}
+	sub, _ = claims["sub"].(string)
+	device, _ = claims["did"].(string)
+	return sub, device, sub != ""
+}
+
 // Alias for easier import in main.go
 func (j *JWTValidator) Handler() func(http.Handler) http.Handler { return j.Middleware }
@@ -0,0 +1,194 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gateway/internal/middleware"
+	"gateway/internal/observability/metrics"
+
+	"github.com/google/uuid"
+
+	"eventbus"
+	"identity"
+	"identity/verifier"
+	obsmw "observability/middleware"
+)
+
+// Perimeter authenticates requests bound for the backend services. It checks
+// the token with auth once, including revocation and device ownership, and
+// forwards the result as a signed identity header so the services do not have
+// to ask auth again.
+type Perimeter struct {
+	verifier *verifier.Client
+	signer   *identity.Signer
+}
+
+// NewPerimeter verifies tokens against the auth service at authBase, caching
+// results as keys and messages do. Without a signer requests are still
+// checked, but no identity header is attached.
+func NewPerimeter(authBase string, signer *identity.Signer) *Perimeter {
+	return &Perimeter{verifier: verifier.New(authBase, verifier.Options{}), signer: signer}
+}
+
+// Auth events that make cached verifications stale.
+const (
+	eventSessionRevoked   = "auth.session.revoked"
+	eventDeviceRevoked    = "auth.device.revoked"
+	eventDeviceRegistered = "auth.device.registered"
+)
+
+// Subscribe drops cached verifications when auth revokes a session or a
+// device changes hands. The services trust whatever the gateway forwards, so
+// without it a revoked token keeps working until the cache TTL runs out.
+func (p *Perimeter) Subscribe(bus eventbus.Transport) error {
+	if err := bus.Subscribe(eventSessionRevoked, func(_ context.Context, env eventbus.Envelope) error {
+		var evt struct {
+			SessionID string `json:"sessionId"`
+		}
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("decode %s: %w", env.Type, err)
+		}
+		if id, err := uuid.Parse(evt.SessionID); err == nil {
+			p.verifier.InvalidateSession(id)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// auth's DeviceRegistered payload has the same shape as DeviceRevoked.
+	device := func(_ context.Context, env eventbus.Envelope) error {
+		var evt struct {
+			DeviceID string `json:"deviceId"`
+		}
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("decode %s: %w", env.Type, err)
+		}
+		if id, err := uuid.Parse(evt.DeviceID); err == nil {
+			p.verifier.InvalidateDevice(id)
+		}
+		return nil
+	}
+	if err := bus.Subscribe(eventDeviceRevoked, device); err != nil {
+		return err
+	}
+	return bus.Subscribe(eventDeviceRegistered, device)
+}
+
+func (p *Perimeter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := "success"
+		defer func() {
+			metrics.AuthenticationAttemptsTotal.WithLabelValues("perimeter", result).Inc()
+		}()
+		reqID := obsmw.RequestIDFromContext(r.Context())
+		traceID := obsmw.TraceIDFromContext(r.Context())
+
+		// Only the gateway may speak for a caller.
+		r.Header.Del(identity.Header)
+
+		token := bearerToken(r)
+		if token == "" {
+			result = "failure"
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			slog.Warn("gateway perimeter missing bearer", "request_id", reqID, "trace_id", traceID)
+			return
+		}
+		device := RequestDeviceID(r)
+		deviceID := uuid.Nil
+		if device != "" {
+			parsed, err := uuid.Parse(device)
+			if err != nil {
+				result = "failure"
+				http.Error(w, "device not authorized for user", http.StatusForbidden)
+				return
+			}
+			deviceID = parsed
+		}
+		claims, err := p.verifier.Verify(r.Context(), token, deviceID)
+		if err != nil {
+			result = "error"
+			status := http.StatusBadGateway
+			if errors.Is(err, verifier.ErrUnavailable) {
+				status = http.StatusServiceUnavailable
+				w.Header().Set("Retry-After", "10")
+			}
+			http.Error(w, "authorization unavailable", status)
+			slog.Error("gateway perimeter verify failed", "error", err, "request_id", reqID, "trace_id", traceID)
+			return
+		}
+		if !claims.Valid {
+			result = "failure"
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			slog.Warn("gateway perimeter invalid token", "request_id", reqID, "trace_id", traceID)
+			return
+		}
+		if deviceID != uuid.Nil && !claims.DeviceAuthorized {
+			result = "failure"
+			http.Error(w, "device not authorized for user", http.StatusForbidden)
+			slog.Warn("gateway perimeter device not authorized", "subject", claims.UserID, "device_id", deviceID, "request_id", reqID, "trace_id", traceID)
+			return
+		}
+
+		if p.signer != nil {
+			id := identity.Identity{UserID: claims.UserID.String(), SessionID: claims.SessionID.String()}
+			if deviceID != uuid.Nil {
+				id.DeviceID = deviceID.String()
+			}
+			if claims.TokenDeviceID != nil {
+				id.TokenDeviceID = claims.TokenDeviceID.String()
+			}
+			r.Header.Set(identity.Header, p.signer.Sign(id, r.Method, r.URL.Path))
+		}
+		ctx := contextWithSubject(r.Context(), claims.UserID.String())
+		if deviceID != uuid.Nil {
+			ctx = middleware.WithDevice(ctx, deviceID.String())
+		} else if claims.TokenDeviceID != nil {
+			ctx = middleware.WithDevice(ctx, claims.TokenDeviceID.String())
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// bearerToken reads the Authorization header, or the access_token query
+// parameter browsers use for WebSocket upgrades.
+func bearerToken(r *http.Request) string {
+	raw := strings.TrimSpace(r.Header.Get("Authorization"))
+	if strings.HasPrefix(strings.ToLower(raw), "bearer ") {
+		return strings.TrimSpace(raw[len("bearer "):])
+	}
+	return strings.TrimSpace(r.URL.Query().Get("access_token"))
+}
+
+// actingDeviceRoutes are the gateway routes whose device_id query parameter
+// names the caller's own device. Elsewhere it may name somebody else's, as on
+// /keys/bundle where it is the peer whose bundle is fetched.
+var actingDeviceRoutes = map[string]bool{
+	"/messages/history":       true,
+	"/messages/conversations": true,
+	"/messages/me":            true,
+	"/ws":                     true,
+	"/messages/ws":            true,
+}
+
+// RequestDeviceID finds the device a request acts for, from the X-Device-ID
+// header or, on routes that use it that way, the device_id query parameter.
+func RequestDeviceID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get("X-Device-ID")); id != "" {
+		return id
+	}
+	if !actingDeviceRoutes[r.URL.Path] {
+		return ""
+	}
+	q := r.URL.Query()
+	for _, name := range []string{"device_id", "deviceId"} {
+		if id := strings.TrimSpace(q.Get(name)); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"gateway/internal/observability/metrics"
+
+	"github.com/google/uuid"
+
+	"eventbus"
+	"identity"
+)
+
+var (
+	testUser    = uuid.NewString()
+	testSession = uuid.NewString()
+	testDevice  = uuid.NewString()
+)
+
+func TestMain(m *testing.M) {
+	metrics.MustRegister("gateway-test", "test")
+	os.Exit(m.Run())
+}
+
+// fakeAuth accepts "good" as a token and owns testDevice.
+func fakeAuth(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Token    string `json:"token"`
+			DeviceID string `json:"deviceId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		res := map[string]any{"valid": false}
+		if body.Token == "good" {
+			res = map[string]any{"valid": true, "userId": testUser, "sessionId": testSession, "deviceAuthorized": body.DeviceID == testDevice}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPerimeterSignsVerifiedIdentity(t *testing.T) {
+	signer, err := identity.NewSigner("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	var forwarded identity.Identity
+	h := NewPerimeter(fakeAuth(t).URL, signer).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := signer.Verify(r.Header.Get(identity.Header), r.Method, r.URL.Path)
+		if err != nil {
+			t.Fatalf("expected a valid identity header: %v", err)
+		}
+		forwarded = id
+		if sub, _ := SubjectFrom(r.Context()); sub != testUser {
+			t.Fatalf("expected the subject in the context, got %q", sub)
+		}
+		if device, _ := DeviceFrom(r.Context()); device != testDevice {
+			t.Fatalf("expected the confirmed device in the context, got %q", device)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/messages/history?device_id="+testDevice, nil)
+	req.Header.Set("Authorization", "Bearer good")
+	req.Header.Set(identity.Header, "forged")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the request to pass, got %d", rec.Code)
+	}
+	if forwarded != (identity.Identity{UserID: testUser, SessionID: testSession, DeviceID: testDevice}) {
+		t.Fatalf("unexpected identity %+v", forwarded)
+	}
+}
+
+func TestPerimeterRejectsBadTokensAndForeignDevices(t *testing.T) {
+	h := NewPerimeter(fakeAuth(t).URL, nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(identity.Header) != "" {
+			t.Fatalf("expected no identity header without a signer")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name, target, token, header string
+		want                        int
+	}{
+		{"missing token", "/keys/bundle", "", "", http.StatusUnauthorized},
+		{"invalid token", "/keys/bundle", "bad", "", http.StatusUnauthorized},
+		{"foreign device", "/messages/history?device_id=" + uuid.NewString(), "good", "", http.StatusForbidden},
+		{"malformed device", "/messages/history?device_id=dev-1", "good", "", http.StatusForbidden},
+		{"websocket query token", "/ws?device_id=" + testDevice + "&access_token=good", "", "", http.StatusNoContent},
+		{"peer bundle", "/keys/bundle?device_id=" + uuid.NewString(), "good", "", http.StatusNoContent},
+		{"peer bundle from a foreign device", "/keys/bundle?device_id=" + testDevice, "good", uuid.NewString(), http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		if tc.header != "" {
+			req.Header.Set("X-Device-ID", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestPerimeterDoesNotTakeBundleTargetAsCaller(t *testing.T) {
+	signer, err := identity.NewSigner("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	var forwarded identity.Identity
+	h := NewPerimeter(fakeAuth(t).URL, signer).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = signer.Verify(r.Header.Get(identity.Header), r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/keys/bundle?device_id="+uuid.NewString(), nil)
+	req.Header.Set("Authorization", "Bearer good")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a peer bundle fetch to pass, got %d", rec.Code)
+	}
+	if forwarded != (identity.Identity{UserID: testUser, SessionID: testSession}) {
+		t.Fatalf("expected no device in the identity, got %+v", forwarded)
+	}
+}
+
+type sessionRevoked struct {
+	SessionID string `json:"sessionId"`
+}
+
+func (sessionRevoked) EventType() string { return eventSessionRevoked }
+
+func TestPerimeterCachesUntilSessionRevoked(t *testing.T) {
+	var calls, revoked atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		res := map[string]any{"valid": true, "userId": testUser, "sessionId": testSession}
+		if revoked.Load() == 1 {
+			res = map[string]any{"valid": false}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := NewPerimeter(srv.URL, nil)
+	bus := eventbus.NewInProcess()
+	if err := p.Subscribe(bus); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/messages/conversations", nil)
+		req.Header.Set("Authorization", "Bearer good")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := serve(); code != http.StatusNoContent {
+			t.Fatalf("request %d: expected 204, got %d", i+1, code)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected one call to auth, got %d", n)
+	}
+
+	revoked.Store(1)
+	env, err := eventbus.NewEnvelope("auth", sessionRevoked{SessionID: testSession})
+	if err != nil {
+		t.Fatalf("envelope: %v", err)
+	}
+	if err := bus.Publish(context.Background(), env); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if code := serve(); code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked session to be rejected, got %d", code)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected auth to be asked again after the revocation, got %d calls", n)
+	}
+}
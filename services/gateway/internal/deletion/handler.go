@@ -0,0 +1,164 @@
+package deletion
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gateway/internal/authz"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	obsmw "observability/middleware"
+)
+
+// Handler exposes the saga over HTTP. Start and Resume must run behind the
+// gateway's auth middleware.
+type Handler struct {
+	store  Store
+	runner *Runner
+	now    func() time.Time
+}
+
+func NewHandler(store Store, runner *Runner) *Handler {
+	return &Handler{store: store, runner: runner, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// Start handles DELETE /profile. It records a job and returns 202 with its
+// status URL; a user with a job still in flight gets that job back.
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	sub, token, ok := caller(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	reqID := obsmw.RequestIDFromContext(ctx)
+	traceID := obsmw.TraceIDFromContext(ctx)
+
+	job, err := h.store.ActiveForUser(ctx, sub)
+	switch {
+	case err == nil:
+		slog.Info("deletion already in progress", "job_id", job.ID, "user_id", sub, "request_id", reqID, "trace_id", traceID)
+	case errors.Is(err, ErrNotFound):
+		deviceID := strings.TrimSpace(r.URL.Query().Get("device_id"))
+		if deviceID != "" {
+			if _, err := uuid.Parse(deviceID); err != nil {
+				http.Error(w, "invalid device_id", http.StatusBadRequest)
+				return
+			}
+		}
+		job = NewJob(sub, deviceID, token, h.runner.ServiceNames(), h.now())
+		if err := h.store.Create(ctx, job); err != nil {
+			slog.Error("deletion job create failed", "error", err, "request_id", reqID, "trace_id", traceID)
+			http.Error(w, "could not start deletion", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("deletion requested", "job_id", job.ID, "user_id", sub, "request_id", reqID, "trace_id", traceID)
+	default:
+		slog.Error("deletion job lookup failed", "error", err, "request_id", reqID, "trace_id", traceID)
+		http.Error(w, "could not start deletion", http.StatusInternalServerError)
+		return
+	}
+
+	h.runner.Trigger()
+	writeAccepted(w, job)
+}
+
+// Status handles GET /profile/deletion/{id}. The random job id is the only
+// credential: the user's token stops working once auth has deleted them, and
+// the receipt must stay retrievable after that.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// Resume handles POST /profile/deletion/{id}/resume. It re-arms a failed or
+// retrying job with the caller's fresh token and runs it immediately.
+func (h *Handler) Resume(w http.ResponseWriter, r *http.Request) {
+	sub, token, ok := caller(w, r)
+	if !ok {
+		return
+	}
+	job, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if job.UserID != sub {
+		http.Error(w, "deletion job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != StatusFailed && job.Status != StatusRetrying {
+		writeJSON(w, http.StatusConflict, job)
+		return
+	}
+
+	now := h.now()
+	job.Token = token
+	job.TokenExpiresAt = nil
+	if exp, ok := tokenExpiry(token); ok {
+		job.TokenExpiresAt = &exp
+	}
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.NextAttemptAt = now
+	job.LastError = ""
+	job.UpdatedAt = now
+	if err := h.store.Save(r.Context(), job); err != nil {
+		slog.Error("deletion job resume failed", "error", err, "job_id", job.ID)
+		http.Error(w, "could not resume deletion", http.StatusInternalServerError)
+		return
+	}
+	h.runner.Trigger()
+	writeAccepted(w, job)
+}
+
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid deletion id", http.StatusBadRequest)
+		return nil, false
+	}
+	job, err := h.store.Get(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "deletion job not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("deletion job load failed", "error", err, "job_id", id)
+		http.Error(w, "could not load deletion job", http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
+
+func caller(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	sub, ok := authz.SubjectFrom(r.Context())
+	if !ok || sub == "" {
+		http.Error(w, "no subject", http.StatusUnauthorized)
+		return "", "", false
+	}
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return "", "", false
+	}
+	return sub, strings.TrimSpace(header[len("bearer "):]), true
+}
+
+func writeAccepted(w http.ResponseWriter, job *Job) {
+	w.Header().Set("Location", "/profile/deletion/"+job.ID.String())
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,191 @@
+// Package deletion runs account deletion as a saga: one persisted job per
+// request, one idempotent step per downstream service, retried with backoff
+// until every service has confirmed or the job needs the user to resume it.
+package deletion
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusRetrying  Status = "retrying"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Step tracks one service's part of the deletion.
+type Step struct {
+	Service          string           `json:"service"`
+	Status           Status           `json:"status"`
+	Attempts         int              `json:"attempts"`
+	StartedAt        *time.Time       `json:"startedAt,omitempty"`
+	CompletedAt      *time.Time       `json:"completedAt,omitempty"`
+	DeletedResources map[string]int64 `json:"deletedResources,omitempty"`
+	LastError        string           `json:"lastError,omitempty"`
+}
+
+type Steps []Step
+
+// Job is a persisted deletion request. Token is the caller's access token,
+// kept only while the job still has steps to run.
+type Job struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         string     `gorm:"type:text;not null;index" json:"userId"`
+	DeviceID       string     `gorm:"type:text" json:"deviceId,omitempty"`
+	Token          string     `gorm:"type:text" json:"-"`
+	TokenExpiresAt *time.Time `json:"-"`
+	Status         Status     `gorm:"type:text;not null;index" json:"status"`
+	Steps          Steps      `gorm:"type:jsonb;not null" json:"steps"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"not null" json:"nextAttemptAt"`
+	LockedUntil    *time.Time `json:"-"`
+	LastError      string     `gorm:"type:text" json:"lastError,omitempty"`
+	Receipt        *Receipt   `gorm:"type:jsonb" json:"receipt,omitempty"`
+	CreatedAt      time.Time  `gorm:"not null" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"not null" json:"updatedAt"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+}
+
+func (Job) TableName() string { return "deletion_jobs" }
+
+// Finished reports whether the job will not run again without a resume.
+func (j *Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// NewJob returns a pending job with one step per service, in order.
+func NewJob(userID, deviceID, token string, services []string, now time.Time) *Job {
+	steps := make(Steps, 0, len(services))
+	for _, name := range services {
+		steps = append(steps, Step{Service: name, Status: StatusPending})
+	}
+	job := &Job{
+		ID:            uuid.New(),
+		UserID:        userID,
+		DeviceID:      deviceID,
+		Token:         token,
+		Status:        StatusPending,
+		Steps:         steps,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if exp, ok := tokenExpiry(token); ok {
+		job.TokenExpiresAt = &exp
+	}
+	return job
+}
+
+// Receipt is the compliance record handed out once every service confirmed.
+// Digest is the SHA-256 of the receipt encoded with an empty digest, so a
+// stored copy can be checked for tampering.
+type Receipt struct {
+	JobID       string         `json:"jobId"`
+	UserID      string         `json:"userId"`
+	RequestedAt time.Time      `json:"requestedAt"`
+	CompletedAt time.Time      `json:"completedAt"`
+	Services    []ReceiptEntry `json:"services"`
+	Digest      string         `json:"digest"`
+}
+
+type ReceiptEntry struct {
+	Service          string           `json:"service"`
+	CompletedAt      time.Time        `json:"completedAt"`
+	DeletedResources map[string]int64 `json:"deletedResources"`
+}
+
+func newReceipt(job *Job, completedAt time.Time) (*Receipt, error) {
+	rc := &Receipt{
+		JobID:       job.ID.String(),
+		UserID:      job.UserID,
+		RequestedAt: job.CreatedAt.UTC(),
+		CompletedAt: completedAt.UTC(),
+		Services:    make([]ReceiptEntry, 0, len(job.Steps)),
+	}
+	for _, st := range job.Steps {
+		entry := ReceiptEntry{Service: st.Service, DeletedResources: st.DeletedResources}
+		if st.CompletedAt != nil {
+			entry.CompletedAt = st.CompletedAt.UTC()
+		}
+		if entry.DeletedResources == nil {
+			entry.DeletedResources = map[string]int64{}
+		}
+		rc.Services = append(rc.Services, entry)
+	}
+	digest, err := rc.computeDigest()
+	if err != nil {
+		return nil, err
+	}
+	rc.Digest = digest
+	return rc, nil
+}
+
+func (rc Receipt) computeDigest() (string, error) {
+	rc.Digest = ""
+	data, err := json.Marshal(rc)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify reports whether the digest matches the receipt's contents.
+func (rc *Receipt) Verify() bool {
+	digest, err := rc.computeDigest()
+	return err == nil && digest == rc.Digest
+}
+
+func (s Steps) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (s *Steps) Scan(src any) error {
+	return scanJSON(src, s)
+}
+
+func (rc *Receipt) Value() (driver.Value, error) {
+	if rc == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(rc)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (rc *Receipt) Scan(src any) error {
+	return scanJSON(src, rc)
+}
+
+func scanJSON(src, dst any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("deletion: cannot scan %T into %T", src, dst)
+	}
+}
+
+var ErrNotFound = errors.New("deletion job not found")
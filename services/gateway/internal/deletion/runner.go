@@ -0,0 +1,307 @@
+package deletion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Service is one downstream step of the saga. Its DELETE endpoint must be
+// idempotent: calling it again after a success deletes nothing and succeeds.
+type Service struct {
+	Name    string
+	BaseURL string
+	// Path builds the request path for the job, e.g. to add a device id.
+	Path func(job *Job) string
+	// RevokesToken marks the step that deletes the credentials the saga calls
+	// with. A 401 on a retry of it, while the token has not expired, means an
+	// earlier attempt already went through.
+	RevokesToken bool
+}
+
+type RunnerOptions struct {
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	HTTPClient   *http.Client
+}
+
+func (o *RunnerOptions) setDefaults() {
+	if o.PollInterval <= 0 {
+		o.PollInterval = 2 * time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = time.Minute
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 2 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(nil)}
+	}
+}
+
+// Runner advances deletion jobs one step at a time.
+type Runner struct {
+	store    Store
+	services []Service
+	opts     RunnerOptions
+	wake     chan struct{}
+	now      func() time.Time
+}
+
+func NewRunner(store Store, services []Service, opts RunnerOptions) *Runner {
+	opts.setDefaults()
+	return &Runner{
+		store:    store,
+		services: services,
+		opts:     opts,
+		wake:     make(chan struct{}, 1),
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// ServiceNames lists the steps in the order they run.
+func (r *Runner) ServiceNames() []string {
+	names := make([]string, 0, len(r.services))
+	for _, svc := range r.services {
+		names = append(names, svc.Name)
+	}
+	return names
+}
+
+// Trigger wakes Run so a new job does not wait for the next poll.
+func (r *Runner) Trigger() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes due jobs until ctx is cancelled.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			processed, err := r.ProcessNext(ctx)
+			if err != nil {
+				slog.Error("deletion runner", "error", err)
+			}
+			if !processed {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// ProcessNext claims one due job and runs its remaining steps. It reports
+// whether a job was found.
+func (r *Runner) ProcessNext(ctx context.Context) (bool, error) {
+	job, err := r.store.ClaimDue(ctx, r.now(), r.opts.Lease)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, r.advance(ctx, job)
+}
+
+func (r *Runner) advance(ctx context.Context, job *Job) error {
+	for i := range job.Steps {
+		step := &job.Steps[i]
+		if step.Status == StatusCompleted {
+			continue
+		}
+		svc, ok := r.service(step.Service)
+		if !ok {
+			return r.fail(ctx, job, step, fmt.Errorf("unknown service %q", step.Service), false)
+		}
+
+		now := r.now()
+		if step.StartedAt == nil {
+			step.StartedAt = &now
+		}
+		retried := step.Attempts > 0
+		step.Attempts++
+		step.Status = StatusRunning
+		job.UpdatedAt = now
+		// Persist the attempt first so a crash mid-call still counts as tried.
+		if err := r.store.Save(ctx, job); err != nil {
+			return err
+		}
+
+		deleted, err := r.call(ctx, svc, job)
+		if err != nil && svc.RevokesToken && retried && isUnauthorized(err) && r.tokenStillValid(job) {
+			slog.Info("deletion step already applied", "job_id", job.ID, "service", svc.Name)
+			deleted, err = map[string]int64{}, nil
+		}
+		if err != nil {
+			return r.fail(ctx, job, step, err, isRetryable(err))
+		}
+
+		done := r.now()
+		step.Status = StatusCompleted
+		step.CompletedAt = &done
+		step.DeletedResources = deleted
+		step.LastError = ""
+		job.UpdatedAt = done
+		if err := r.store.Save(ctx, job); err != nil {
+			return err
+		}
+		slog.Info("deletion step completed", "job_id", job.ID, "service", svc.Name)
+	}
+	return r.complete(ctx, job)
+}
+
+func (r *Runner) complete(ctx context.Context, job *Job) error {
+	now := r.now()
+	receipt, err := newReceipt(job, now)
+	if err != nil {
+		return err
+	}
+	job.Status = StatusCompleted
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	job.Receipt = receipt
+	job.LastError = ""
+	job.Token = ""
+	job.TokenExpiresAt = nil
+	job.LockedUntil = nil
+	slog.Info("deletion completed", "job_id", job.ID, "user_id", job.UserID, "digest", receipt.Digest)
+	return r.store.Save(ctx, job)
+}
+
+// fail records the step error and either schedules a retry with exponential
+// backoff or parks the job as failed until the user resumes it.
+func (r *Runner) fail(ctx context.Context, job *Job, step *Step, cause error, retryable bool) error {
+	now := r.now()
+	step.Status = StatusFailed
+	step.LastError = cause.Error()
+	job.Attempts++
+	job.LastError = fmt.Sprintf("%s: %s", step.Service, cause)
+	job.LockedUntil = nil
+	job.UpdatedAt = now
+	if retryable && job.Attempts < r.opts.MaxAttempts {
+		job.Status = StatusRetrying
+		job.NextAttemptAt = now.Add(r.backoff(job.Attempts))
+	} else {
+		// A parked job only runs again after a resume, which brings a fresh
+		// token, so the old one is not kept around.
+		job.Status = StatusFailed
+		job.Token = ""
+		job.TokenExpiresAt = nil
+	}
+	slog.Warn("deletion step failed", "job_id", job.ID, "service", step.Service, "attempts", job.Attempts, "status", job.Status, "error", cause)
+	return r.store.Save(ctx, job)
+}
+
+func (r *Runner) backoff(attempts int) time.Duration {
+	d := r.opts.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.opts.MaxBackoff {
+			return r.opts.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (r *Runner) tokenStillValid(job *Job) bool {
+	return job.TokenExpiresAt != nil && r.now().Before(*job.TokenExpiresAt)
+}
+
+func (r *Runner) service(name string) (Service, bool) {
+	for _, svc := range r.services {
+		if svc.Name == name {
+			return svc, true
+		}
+	}
+	return Service{}, false
+}
+
+// statusError is a non-2xx answer from a downstream service.
+type statusError struct {
+	service string
+	code    int
+	body    string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("%s delete failed: %s", e.service, http.StatusText(e.code))
+	}
+	return fmt.Sprintf("%s delete failed: %s", e.service, e.body)
+}
+
+func isUnauthorized(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == http.StatusUnauthorized
+}
+
+// isRetryable treats transport errors, timeouts, throttling and 5xx as
+// transient; any other 4xx needs a new request from the user.
+func isRetryable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.code >= 500 || se.code == http.StatusRequestTimeout || se.code == http.StatusTooManyRequests
+}
+
+func (r *Runner) call(ctx context.Context, svc Service, job *Job) (map[string]int64, error) {
+	path := "/"
+	if svc.Path != nil {
+		path = svc.Path(job)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, strings.TrimRight(svc.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+job.Token)
+	req.Header.Set("X-Request-ID", job.ID.String())
+
+	resp, err := r.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, &statusError{service: svc.Name, code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	var payload struct {
+		DeletedResources map[string]int64 `json:"deletedResources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s delete: decode response: %w", svc.Name, err)
+	}
+	if payload.DeletedResources == nil {
+		payload.DeletedResources = map[string]int64{}
+	}
+	return payload.DeletedResources, nil
+}
@@ -0,0 +1,165 @@
+package deletion
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupStore(t *testing.T) *GormStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	st := NewGormStore(db)
+	if err := st.AutoMigrate(context.Background()); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return st
+}
+
+// fakeToken is shaped like a JWT so the runner can read its expiry.
+func fakeToken(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"user-1","exp":%d}`, exp.Unix())))
+	return "header." + payload + ".sig"
+}
+
+// deleteServer answers with the given status codes in turn, then 200.
+func deleteServer(t *testing.T, codes ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if r.Method != http.MethodDelete || r.Header.Get("Authorization") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if n <= len(codes) {
+			http.Error(w, "boom", codes[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"deleted","deletedResources":{"rows":2}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func runUntilIdle(t *testing.T, r *Runner) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		processed, err := r.ProcessNext(context.Background())
+		if err != nil {
+			t.Fatalf("process: %v", err)
+		}
+		if !processed {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestRunnerRetriesFailedStepAndIssuesReceipt(t *testing.T) {
+	st := setupStore(t)
+	messages, messagesCalls := deleteServer(t)
+	keys, keysCalls := deleteServer(t, http.StatusServiceUnavailable)
+	auth, _ := deleteServer(t)
+
+	r := NewRunner(st, []Service{
+		{Name: "messages", BaseURL: messages.URL},
+		{Name: "keys", BaseURL: keys.URL},
+		{Name: "auth", BaseURL: auth.URL, RevokesToken: true},
+	}, RunnerOptions{BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+
+	job := NewJob("user-1", "", fakeToken(time.Now().Add(time.Hour)), r.ServiceNames(), time.Now().UTC())
+	if err := st.Create(context.Background(), job); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	runUntilIdle(t, r)
+
+	got, err := st.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != StatusCompleted {
+		t.Fatalf("expected completed job, got %s (%s)", got.Status, got.LastError)
+	}
+	if messagesCalls.Load() != 1 || keysCalls.Load() != 2 {
+		t.Fatalf("expected messages once and keys twice, got %d and %d", messagesCalls.Load(), keysCalls.Load())
+	}
+	if got.Token != "" {
+		t.Fatalf("expected token to be cleared after completion")
+	}
+	if got.Receipt == nil || len(got.Receipt.Services) != 3 || !got.Receipt.Verify() {
+		t.Fatalf("expected a verifiable receipt covering all services, got %+v", got.Receipt)
+	}
+	if got.Receipt.Services[0].DeletedResources["rows"] != 2 {
+		t.Fatalf("expected deleted counts in receipt, got %+v", got.Receipt.Services[0])
+	}
+}
+
+func TestRunnerTreatsUnauthorizedRetryOfAuthAsDone(t *testing.T) {
+	st := setupStore(t)
+	messages, _ := deleteServer(t)
+	// The first call deletes the user but the response is lost; the retry
+	// then fails authentication because the account no longer exists.
+	auth, authCalls := deleteServer(t, http.StatusBadGateway, http.StatusUnauthorized)
+
+	r := NewRunner(st, []Service{
+		{Name: "messages", BaseURL: messages.URL},
+		{Name: "auth", BaseURL: auth.URL, RevokesToken: true},
+	}, RunnerOptions{BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+
+	job := NewJob("user-1", "", fakeToken(time.Now().Add(time.Hour)), r.ServiceNames(), time.Now().UTC())
+	if err := st.Create(context.Background(), job); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	runUntilIdle(t, r)
+
+	got, err := st.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != StatusCompleted || authCalls.Load() != 2 {
+		t.Fatalf("expected completion after two auth calls, got %s after %d", got.Status, authCalls.Load())
+	}
+}
+
+func TestRunnerParksJobOnExpiredToken(t *testing.T) {
+	st := setupStore(t)
+	messages, _ := deleteServer(t, http.StatusUnauthorized)
+	auth, authCalls := deleteServer(t)
+
+	r := NewRunner(st, []Service{
+		{Name: "messages", BaseURL: messages.URL},
+		{Name: "auth", BaseURL: auth.URL, RevokesToken: true},
+	}, RunnerOptions{BaseBackoff: time.Millisecond})
+
+	job := NewJob("user-1", "", fakeToken(time.Now().Add(-time.Minute)), r.ServiceNames(), time.Now().UTC())
+	if err := st.Create(context.Background(), job); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	runUntilIdle(t, r)
+
+	got, err := st.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != StatusFailed || got.Steps[0].Status != StatusFailed {
+		t.Fatalf("expected the job to wait for a resume, got %s / %s", got.Status, got.Steps[0].Status)
+	}
+	if got.Token != "" || got.TokenExpiresAt != nil {
+		t.Fatalf("expected a parked job to drop its token")
+	}
+	if authCalls.Load() != 0 {
+		t.Fatalf("auth must not run before earlier steps succeed")
+	}
+}
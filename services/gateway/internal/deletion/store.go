@@ -0,0 +1,199 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists deletion jobs.
+type Store interface {
+	Create(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	// ActiveForUser returns the user's unfinished job, or ErrNotFound.
+	ActiveForUser(ctx context.Context, userID string) (*Job, error)
+	Save(ctx context.Context, job *Job) error
+	// ClaimDue leases the oldest job that is due to run, or returns ErrNotFound.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+}
+
+var activeStatuses = []Status{StatusPending, StatusRunning, StatusRetrying}
+
+type GormStore struct{ db *gorm.DB }
+
+func NewGormStore(db *gorm.DB) *GormStore { return &GormStore{db: db} }
+
+func (s *GormStore) AutoMigrate(ctx context.Context) error {
+	return s.db.WithContext(ctx).AutoMigrate(&Job{})
+}
+
+func (s *GormStore) Create(ctx context.Context, job *Job) error {
+	return s.db.WithContext(ctx).Create(job).Error
+}
+
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	var job Job
+	if err := s.db.WithContext(ctx).First(&job, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *GormStore) ActiveForUser(ctx context.Context, userID string) (*Job, error) {
+	var job Job
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, activeStatuses).
+		Order("created_at DESC").
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *GormStore) Save(ctx context.Context, job *Job) error {
+	return s.db.WithContext(ctx).Save(job).Error
+}
+
+// ClaimDue locks the row with SKIP LOCKED, so several gateway replicas can
+// share the job table. A crashed runner's lease simply expires.
+func (s *GormStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	var job Job
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", activeStatuses, now).
+			Where("locked_until IS NULL OR locked_until < ?", now).
+			Order("next_attempt_at ASC").
+			First(&job).Error; err != nil {
+			return err
+		}
+		until := now.Add(lease)
+		job.LockedUntil = &until
+		job.Status = StatusRunning
+		job.UpdatedAt = now
+		return tx.Model(&Job{}).Where("id = ?", job.ID).Updates(map[string]any{
+			"locked_until": until,
+			"status":       StatusRunning,
+			"updated_at":   now,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// MemoryStore keeps jobs in process memory. Jobs do not survive a restart, so
+// it is only meant for tests and deployments without a gateway database.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[uuid.UUID]Job)}
+}
+
+func (s *MemoryStore) Create(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = cloneJob(*job)
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id uuid.UUID) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := cloneJob(job)
+	return &out, nil
+}
+
+func (s *MemoryStore) ActiveForUser(_ context.Context, userID string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found *Job
+	for _, job := range s.jobs {
+		if job.UserID != userID || job.Finished() {
+			continue
+		}
+		if found == nil || job.CreatedAt.After(found.CreatedAt) {
+			j := cloneJob(job)
+			found = &j
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = cloneJob(*job)
+	return nil
+}
+
+func (s *MemoryStore) ClaimDue(_ context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due *Job
+	for _, job := range s.jobs {
+		if job.Finished() || job.NextAttemptAt.After(now) {
+			continue
+		}
+		if job.LockedUntil != nil && !job.LockedUntil.Before(now) {
+			continue
+		}
+		if due == nil || job.NextAttemptAt.Before(due.NextAttemptAt) {
+			j := job
+			due = &j
+		}
+	}
+	if due == nil {
+		return nil, ErrNotFound
+	}
+	until := now.Add(lease)
+	due.LockedUntil = &until
+	due.Status = StatusRunning
+	due.UpdatedAt = now
+	s.jobs[due.ID] = cloneJob(*due)
+	out := cloneJob(*due)
+	return &out, nil
+}
+
+// cloneJob copies the slices and maps a caller could otherwise mutate in place.
+func cloneJob(job Job) Job {
+	steps := make(Steps, len(job.Steps))
+	for i, st := range job.Steps {
+		if st.DeletedResources != nil {
+			m := make(map[string]int64, len(st.DeletedResources))
+			for k, v := range st.DeletedResources {
+				m[k] = v
+			}
+			st.DeletedResources = m
+		}
+		steps[i] = st
+	}
+	job.Steps = steps
+	return job
+}
@@ -0,0 +1,248 @@
+// Package export assembles a user's data from every service into one signed
+// document, so a GDPR access request can be answered with a single download
+// whose integrity the user can check later.
+package export
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Source is one service contributing to the export. Its endpoint must accept
+// the user's bearer token and answer with a JSON document.
+type Source struct {
+	Name    string
+	BaseURL string
+	// Path builds the request path, e.g. to add the caller's device id.
+	Path func(deviceID string) string
+	// PerDevice fetches the source once for every device in the auth export,
+	// revoked ones included, instead of once for the caller's device. The
+	// answers are embedded as a JSON array.
+	PerDevice bool
+}
+
+// deviceListSource is the source whose export lists the user's devices.
+const deviceListSource = "auth"
+
+// Document is the signed export. Services holds each source's answer verbatim.
+type Document struct {
+	Version    int                        `json:"version"`
+	UserID     string                     `json:"userId"`
+	DeviceID   string                     `json:"deviceId,omitempty"`
+	ExportedAt time.Time                  `json:"exportedAt"`
+	Services   map[string]json.RawMessage `json:"services"`
+	Signature  *Signature                 `json:"signature,omitempty"`
+}
+
+// Signature covers the document encoded without its signature field.
+type Signature struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"keyId"`
+	Value     string `json:"value"`
+}
+
+// Signer holds the gateway's export signing key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner loads a base64 Ed25519 seed. The seed is required: a throwaway
+// key would leave exports made before a restart unverifiable.
+func NewSigner(seedB64 string) (*Signer, error) {
+	seedB64 = strings.TrimSpace(seedB64)
+	if seedB64 == "" {
+		return nil, errors.New("export: signing key is required")
+	}
+	seed, err := base64.StdEncoding.DecodeString(seedB64)
+	if err != nil {
+		return nil, fmt.Errorf("export: decode signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("export: signing key must be a %d-byte seed", ed25519.SeedSize)
+	}
+	return newSigner(ed25519.NewKeyFromSeed(seed)), nil
+}
+
+func newSigner(key ed25519.PrivateKey) *Signer {
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &Signer{key: key, keyID: hex.EncodeToString(sum[:8])}
+}
+
+func (s *Signer) KeyID() string { return s.keyID }
+
+func (s *Signer) PublicKey() ed25519.PublicKey { return s.key.Public().(ed25519.PublicKey) }
+
+// Sign sets the document's signature.
+func (s *Signer) Sign(doc *Document) error {
+	payload, err := doc.signedPayload()
+	if err != nil {
+		return err
+	}
+	doc.Signature = &Signature{
+		Algorithm: "Ed25519",
+		KeyID:     s.keyID,
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+	}
+	return nil
+}
+
+// Verify reports whether the document carries a valid signature by pub.
+func (d *Document) Verify(pub ed25519.PublicKey) bool {
+	if d.Signature == nil || d.Signature.Algorithm != "Ed25519" {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(d.Signature.Value)
+	if err != nil {
+		return false
+	}
+	payload, err := d.signedPayload()
+	return err == nil && ed25519.Verify(pub, payload, sig)
+}
+
+func (d Document) signedPayload() ([]byte, error) {
+	d.Signature = nil
+	return json.Marshal(d)
+}
+
+// Exporter fetches every source with the caller's token.
+type Exporter struct {
+	sources []Source
+	client  *http.Client
+	now     func() time.Time
+}
+
+func NewExporter(sources []Source, client *http.Client) *Exporter {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second, Transport: otelhttp.NewTransport(nil)}
+	}
+	return &Exporter{sources: sources, client: client, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// SourceError is a source that could not be exported.
+type SourceError struct {
+	Source string
+	Status int
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("%s export failed: %s", e.Source, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("%s export failed: %v", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// Collect builds an unsigned document. A missing source makes the whole export
+// fail: handing out a partial copy would misstate what is held about the user.
+func (e *Exporter) Collect(ctx context.Context, userID, deviceID, token string) (*Document, error) {
+	doc := &Document{
+		Version:    1,
+		UserID:     userID,
+		DeviceID:   deviceID,
+		ExportedAt: e.now(),
+		Services:   make(map[string]json.RawMessage, len(e.sources)),
+	}
+	for _, src := range e.sources {
+		if src.PerDevice {
+			continue
+		}
+		body, err := e.fetch(ctx, src, deviceID, token)
+		if err != nil {
+			return nil, err
+		}
+		doc.Services[src.Name] = body
+	}
+	var devices []string
+	for _, src := range e.sources {
+		if !src.PerDevice {
+			continue
+		}
+		if devices == nil {
+			var err error
+			if devices, err = userDevices(doc.Services[deviceListSource]); err != nil {
+				return nil, err
+			}
+		}
+		parts := make([]json.RawMessage, 0, len(devices))
+		for _, id := range devices {
+			body, err := e.fetch(ctx, src, id, token)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, body)
+		}
+		body, err := json.Marshal(parts)
+		if err != nil {
+			return nil, &SourceError{Source: src.Name, Err: err}
+		}
+		doc.Services[src.Name] = body
+	}
+	return doc, nil
+}
+
+// userDevices reads the device ids out of the auth export.
+func userDevices(authExport json.RawMessage) ([]string, error) {
+	if authExport == nil {
+		return nil, &SourceError{Source: deviceListSource, Err: errors.New("no device list to export per device")}
+	}
+	var body struct {
+		Devices []struct {
+			ID string `json:"id"`
+		} `json:"devices"`
+	}
+	if err := json.Unmarshal(authExport, &body); err != nil {
+		return nil, &SourceError{Source: deviceListSource, Err: err}
+	}
+	ids := make([]string, 0, len(body.Devices))
+	for _, d := range body.Devices {
+		if d.ID != "" {
+			ids = append(ids, d.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (e *Exporter) fetch(ctx context.Context, src Source, deviceID, token string) (json.RawMessage, error) {
+	path := "/"
+	if src.Path != nil {
+		path = src.Path(deviceID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(src.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, &SourceError{Source: src.Name, Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, &SourceError{Source: src.Name, Err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &SourceError{Source: src.Name, Status: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &SourceError{Source: src.Name, Err: err}
+	}
+	if !json.Valid(body) {
+		return nil, &SourceError{Source: src.Name, Err: errors.New("invalid JSON")}
+	}
+	return json.RawMessage(body), nil
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func sourceServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCollectSignsAndVerifiesExport(t *testing.T) {
+	auth := sourceServer(t, http.StatusOK, `{"service":"auth","profile":{"id":"user-1"}}`)
+	messages := sourceServer(t, http.StatusOK, `{"service":"messages","messages":[]}`)
+
+	var gotDevice string
+	e := NewExporter([]Source{
+		{Name: "auth", BaseURL: auth.URL},
+		{Name: "messages", BaseURL: messages.URL, Path: func(deviceID string) string {
+			gotDevice = deviceID
+			return "/messages/me/export"
+		}},
+	}, nil)
+	doc, err := e.Collect(context.Background(), "user-1", "device-1", "token-1")
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if gotDevice != "device-1" || len(doc.Services) != 2 {
+		t.Fatalf("expected both services with the device id, got %d services and %q", len(doc.Services), gotDevice)
+	}
+
+	seed := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if _, err := NewSigner(""); err == nil {
+		t.Fatalf("expected an empty signing key to be rejected")
+	}
+	signer, err := NewSigner(seed)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	if err := signer.Sign(doc); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// A downloaded copy must verify after a JSON round trip.
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var downloaded Document
+	if err := json.Unmarshal(data, &downloaded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !downloaded.Verify(signer.PublicKey()) {
+		t.Fatalf("expected downloaded export to verify")
+	}
+
+	downloaded.Services["auth"] = json.RawMessage(`{"service":"auth","profile":{"id":"someone-else"}}`)
+	if downloaded.Verify(signer.PublicKey()) {
+		t.Fatalf("expected tampered export to fail verification")
+	}
+}
+
+func TestCollectFailsWhenASourceFails(t *testing.T) {
+	auth := sourceServer(t, http.StatusOK, `{"service":"auth"}`)
+	keys := sourceServer(t, http.StatusServiceUnavailable, `unavailable`)
+
+	e := NewExporter([]Source{
+		{Name: "auth", BaseURL: auth.URL},
+		{Name: "keys", BaseURL: keys.URL},
+	}, nil)
+	_, err := e.Collect(context.Background(), "user-1", "", "token-1")
+	var se *SourceError
+	if !errors.As(err, &se) || se.Source != "keys" || se.Status != http.StatusServiceUnavailable {
+		t.Fatalf("expected a keys source error, got %v", err)
+	}
+}
+
+func TestCollectExportsEveryDevice(t *testing.T) {
+	auth := sourceServer(t, http.StatusOK, `{"service":"auth","devices":[{"id":"device-1"},{"id":"device-2","revokedAt":"2026-01-01T00:00:00Z"}]}`)
+	var requested []string
+	messages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		device := r.URL.Query().Get("device_id")
+		requested = append(requested, device)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"service":"messages","device_id":"` + device + `"}`))
+	}))
+	t.Cleanup(messages.Close)
+
+	e := NewExporter([]Source{
+		{Name: "messages", BaseURL: messages.URL, PerDevice: true, Path: func(deviceID string) string {
+			return "/messages/me/export?device_id=" + deviceID
+		}},
+		{Name: "auth", BaseURL: auth.URL},
+	}, nil)
+	doc, err := e.Collect(context.Background(), "user-1", "device-1", "token-1")
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(requested) != 2 || requested[0] != "device-1" || requested[1] != "device-2" {
+		t.Fatalf("expected messages to be fetched for both devices, got %v", requested)
+	}
+	var parts []struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := json.Unmarshal(doc.Services["messages"], &parts); err != nil {
+		t.Fatalf("decode messages part: %v", err)
+	}
+	if len(parts) != 2 || parts[0].DeviceID != "device-1" || parts[1].DeviceID != "device-2" {
+		t.Fatalf("expected one messages export per device, got %s", doc.Services["messages"])
+	}
+}
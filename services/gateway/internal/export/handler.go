@@ -0,0 +1,139 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gateway/internal/authz"
+
+	"github.com/google/uuid"
+
+	obsmw "observability/middleware"
+)
+
+// Handler serves exports. Export must run behind the gateway's auth middleware.
+type Handler struct {
+	exporter *Exporter
+	signer   *Signer
+}
+
+func NewHandler(exporter *Exporter, signer *Signer) *Handler {
+	return &Handler{exporter: exporter, signer: signer}
+}
+
+// Export handles GET /profile/export. It answers with the signed JSON
+// document, or with a ZIP holding it and one file per service when
+// format=zip is given.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	sub, ok := authz.SubjectFrom(r.Context())
+	if !ok || sub == "" {
+		http.Error(w, "no subject", http.StatusUnauthorized)
+		return
+	}
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	token := strings.TrimSpace(header[len("bearer "):])
+
+	query := r.URL.Query()
+	deviceID := strings.TrimSpace(query.Get("device_id"))
+	if deviceID != "" {
+		if _, err := uuid.Parse(deviceID); err != nil {
+			http.Error(w, "invalid device_id", http.StatusBadRequest)
+			return
+		}
+	}
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	if format != "" && format != "json" && format != "zip" {
+		http.Error(w, "format must be json or zip", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	reqID := obsmw.RequestIDFromContext(ctx)
+	traceID := obsmw.TraceIDFromContext(ctx)
+
+	doc, err := h.exporter.Collect(ctx, sub, deviceID, token)
+	if err != nil {
+		var se *SourceError
+		status := http.StatusBadGateway
+		if errors.As(err, &se) && (se.Status == http.StatusUnauthorized || se.Status == http.StatusForbidden || se.Status == http.StatusBadRequest) {
+			status = se.Status
+		}
+		slog.Warn("data export failed", "error", err, "user_id", sub, "request_id", reqID, "trace_id", traceID)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := h.signer.Sign(doc); err != nil {
+		slog.Error("data export signing failed", "error", err, "request_id", reqID, "trace_id", traceID)
+		http.Error(w, "could not sign export", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("data exported", "user_id", sub, "format", format, "key_id", h.signer.KeyID(), "request_id", reqID, "trace_id", traceID)
+
+	name := fmt.Sprintf("secumsg-export-%s", doc.ExportedAt.Format("20060102T150405Z"))
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+		if err := writeZip(w, doc); err != nil {
+			slog.Error("data export zip failed", "error", err, "request_id", reqID, "trace_id", traceID)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(doc)
+}
+
+// PublicKey handles GET /profile/export/key so exports can be verified offline.
+func (h *Handler) PublicKey(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"alg":       "Ed25519",
+		"keyId":     h.signer.KeyID(),
+		"publicKey": base64.StdEncoding.EncodeToString(h.signer.PublicKey()),
+	})
+}
+
+// writeZip stores the signed document as export.json, which is what the
+// signature covers, plus each service's part on its own for convenience.
+func writeZip(w http.ResponseWriter, doc *Document) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("export.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(doc.Services))
+	for name := range doc.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := zw.Create("services/" + name + ".json")
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(doc.Services[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -4,13 +4,15 @@ import (
 	"context"
 	"net/http"
 
-	obsmw "gateway/internal/observability/middleware"
-
 	"github.com/google/uuid"
+
+	obsmw "observability/middleware"
 )
 
 type CtxSubKey struct{}
 
+type CtxDeviceKey struct{}
+
 func PropagateRequestID() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
@@ -37,3 +39,8 @@ func PropagateRequestID() func(http.Handler) http.Handler {
 func WithSubject(ctx context.Context, sub string) context.Context {
 	return context.WithValue(ctx, CtxSubKey{}, sub)
 }
+
+// WithDevice records the device the perimeter confirmed the caller acts for.
+func WithDevice(ctx context.Context, device string) context.Context {
+	return context.WithValue(ctx, CtxDeviceKey{}, device)
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	obsmw "observability/middleware"
+)
+
+// RecordRoute hands chi's matched route template to the shared observability
+// middleware, which labels metrics and names spans with it. chi only knows
+// the full pattern once every sub-router has run, so it is read afterwards.
+func RecordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			obsmw.SetRoute(r, rctx.RoutePattern())
+		}
+	})
+}
@@ -1,42 +1,61 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	obsmetrics "observability/metrics"
+)
 
 var (
-	HTTPRequestsTotal = prometheus.NewCounterVec(
+	AuthenticationAttemptsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests.",
+			Name: "gateway_auth_attempts_total",
+			Help: "Total authentication checks at the gateway.",
 		},
-		[]string{"service", "method", "path", "status"},
+		[]string{"method", "result"},
 	)
 
-	HTTPRequestDurationSeconds = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests.",
-			Buckets: prometheus.DefBuckets,
+	RateLimitedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_rate_limited_total",
+			Help: "Total requests rejected by the gateway rate limiter.",
 		},
-		[]string{"service", "method", "path"},
+		[]string{"class", "scope"},
 	)
 
-	AuthenticationAttemptsTotal = prometheus.NewCounterVec(
+	WebSocketConnectionsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_websocket_connections_active",
+			Help: "WebSocket connections currently proxied by the gateway.",
+		},
+	)
+
+	WebSocketConnectionsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "gateway_auth_attempts_total",
-			Help: "Total authentication checks at the gateway.",
+			Name: "gateway_websocket_connections_total",
+			Help: "Total WebSocket upgrade attempts at the gateway by outcome.",
 		},
-		[]string{"service", "method", "result"},
+		[]string{"result"},
 	)
-)
 
-func MustRegister(serviceName string) {
-	HTTPRequestsTotal = HTTPRequestsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	HTTPRequestDurationSeconds = HTTPRequestDurationSeconds.MustCurryWith(prometheus.Labels{"service": serviceName}).(*prometheus.HistogramVec)
-	AuthenticationAttemptsTotal = AuthenticationAttemptsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
+	WebSocketConnectionDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_websocket_connection_duration_seconds",
+			Help:    "Lifetime of proxied WebSocket connections by which side ended them.",
+			Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 4 * 3600},
+		},
+		[]string{"closed_by"},
+	)
+)
 
-	prometheus.MustRegister(
-		HTTPRequestsTotal,
-		HTTPRequestDurationSeconds,
+// MustRegister registers the shared HTTP metrics and the gateway metrics
+// under the given service and environment labels.
+func MustRegister(serviceName, environment string) {
+	obsmetrics.MustRegister(serviceName, environment,
 		AuthenticationAttemptsTotal,
+		RateLimitedTotal,
+		WebSocketConnectionsActive,
+		WebSocketConnectionsTotal,
+		WebSocketConnectionDurationSeconds,
 	)
 }
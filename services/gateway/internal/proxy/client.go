@@ -11,7 +11,9 @@ import (
 	"strings"
 	"time"
 
-	obsmw "gateway/internal/observability/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	obsmw "observability/middleware"
 )
 
 type Client struct {
@@ -25,12 +27,13 @@ func New(baseURL string, timeout time.Duration) *Client {
 		baseURL: baseURL,
 		hc: &http.Client{
 			Timeout: timeout,
-			Transport: &http.Transport{
+			// Each upstream call gets a client span and a traceparent header.
+			Transport: otelhttp.NewTransport(&http.Transport{
 				Proxy:               http.ProxyFromEnvironment,
 				MaxIdleConns:        100,
 				IdleConnTimeout:     90 * time.Second,
 				TLSHandshakeTimeout: 10 * time.Second,
-			},
+			}),
 		},
 		debug: strings.EqualFold(os.Getenv("GATEWAY_DEBUG"), "true"),
 	}
@@ -39,7 +42,14 @@ func New(baseURL string, timeout time.Duration) *Client {
 // ForwardJSON forwards method/body/headers to auth path, sets real IP headers safely,
 // and logs upstream status/duration. It does NOT log request bodies (to avoid password leaks).
 func (c *Client) ForwardJSON(path string) http.HandlerFunc {
+	return c.ForwardJSONFunc(func(*http.Request) string { return path })
+}
+
+// ForwardJSONFunc is ForwardJSON for routes whose upstream path depends on the
+// request, e.g. ones carrying a URL parameter.
+func (c *Client) ForwardJSONFunc(pathFor func(*http.Request) string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		path := pathFor(r)
 		reqID := obsmw.RequestIDFromContext(r.Context())
 		traceID := obsmw.TraceIDFromContext(r.Context())
 
@@ -73,13 +83,10 @@ func (c *Client) ForwardJSON(path string) http.HandlerFunc {
 			req.Header.Set("Content-Type", "application/json")
 		}
 
-		// Propagate request id / trace id if present
+		// Propagate the request id; the transport adds traceparent.
 		if reqID != "" {
 			req.Header.Set("X-Request-ID", reqID)
 		}
-		if traceID != "" {
-			req.Header.Set("X-Trace-ID", traceID)
-		}
 
 		// Real client IP (append to X-Forwarded-For)
 		host, _, _ := net.SplitHostPort(r.RemoteAddr)
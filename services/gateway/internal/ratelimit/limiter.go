@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gateway/internal/authz"
+	"gateway/internal/observability/metrics"
+
+	obsmw "observability/middleware"
+)
+
+// IdentifyFunc returns the verified subject of a request and the device its
+// token was issued to, if it has them. It must not reject requests;
+// unauthenticated traffic is keyed by IP only.
+type IdentifyFunc func(r *http.Request) (sub, device string, ok bool)
+
+// Limiter applies a Policy using a Store.
+type Limiter struct {
+	policy   Policy
+	store    Store
+	identify IdentifyFunc
+}
+
+func New(policy Policy, store Store, identify IdentifyFunc) *Limiter {
+	if identify == nil {
+		identify = func(*http.Request) (string, string, bool) { return "", "", false }
+	}
+	return &Limiter{policy: policy, store: store, identify: identify}
+}
+
+// Middleware limits requests in the given route class. Every scope the class
+// has a limit for is checked: the client IP always, the subject when the
+// request carries a valid token, and the device when one is verified. The
+// device is the one the perimeter confirmed or else the token's, never an id
+// the client merely quotes, and its bucket belongs to the subject.
+func (l *Limiter) Middleware(class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limits := l.policy[class]
+			if len(limits) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			keys := map[string]string{ScopeIP: "ip:" + clientIP(r)}
+			if sub, tokenDevice, ok := l.identify(r); ok && sub != "" {
+				keys[ScopeUser] = "user:" + sub
+				device, confirmed := authz.DeviceFrom(r.Context())
+				if !confirmed {
+					device = tokenDevice
+				}
+				if device != "" {
+					keys[ScopeDevice] = "device:" + sub + ":" + device
+				}
+			}
+
+			var tightest *Decision
+			var tightestLimit Limit
+			for _, scope := range []string{ScopeIP, ScopeUser, ScopeDevice} {
+				limit, ok := limits[scope]
+				key, known := keys[scope]
+				if !ok || !known {
+					continue
+				}
+				d, err := l.store.Allow(r.Context(), class+":"+key, limit)
+				if err != nil {
+					// Fail open: an unreachable limiter backend must not take
+					// the whole gateway down with it.
+					slog.Warn("rate limit check failed", "error", err, "class", class, "scope", scope,
+						"request_id", obsmw.RequestIDFromContext(r.Context()), "trace_id", obsmw.TraceIDFromContext(r.Context()))
+					continue
+				}
+				if !d.Allowed {
+					metrics.RateLimitedTotal.WithLabelValues(class, scope).Inc()
+					slog.Warn("rate limited", "class", class, "scope", scope, "limit", limit.String(),
+						"request_id", obsmw.RequestIDFromContext(r.Context()), "trace_id", obsmw.TraceIDFromContext(r.Context()))
+					setHeaders(w, limit, d)
+					w.Header().Set("Retry-After", retryAfterSeconds(d.Reset))
+					http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+				if tightest == nil || d.Remaining < tightest.Remaining {
+					dd := d
+					tightest, tightestLimit = &dd, limit
+				}
+			}
+			if tightest != nil {
+				setHeaders(w, tightestLimit, *tightest)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setHeaders(w http.ResponseWriter, limit Limit, d Decision) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	w.Header().Set("X-RateLimit-Reset", retryAfterSeconds(d.Reset))
+}
+
+// retryAfterSeconds rounds up so clients never retry early.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
+// clientIP relies on chi's RealIP middleware having rewritten RemoteAddr.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gateway/internal/middleware"
+	"gateway/internal/observability/metrics"
+)
+
+func TestMain(m *testing.M) {
+	metrics.MustRegister("gateway-test", "test")
+	os.Exit(m.Run())
+}
+
+// serve sends a request whose token belongs to subject and was issued to
+// device, if one is given.
+func serve(t *testing.T, h http.Handler, remote, subject, device string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/messages/send", nil)
+	req.RemoteAddr = remote + ":40000"
+	if subject != "" {
+		token := subject
+		if device != "" {
+			token += "/" + device
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// identifyStub trusts the bearer value as "subject" or "subject/device".
+func identifyStub(r *http.Request) (string, string, bool) {
+	raw := r.Header.Get("Authorization")
+	if len(raw) <= len("Bearer ") {
+		return "", "", false
+	}
+	sub, device, _ := strings.Cut(raw[len("Bearer "):], "/")
+	return sub, device, true
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+func TestParsePolicyOverridesDefaults(t *testing.T) {
+	policy, err := ParsePolicy("send.device=5/30s, login.ip=0/1m, custom.user=7/1h")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := policy[ClassSend][ScopeDevice]; got != (Limit{Requests: 5, Window: 30 * time.Second}) {
+		t.Fatalf("expected send.device override, got %v", got)
+	}
+	if _, ok := policy[ClassLogin][ScopeIP]; ok {
+		t.Fatalf("expected login.ip to be disabled")
+	}
+	if policy[ClassSend][ScopeUser] != DefaultPolicy()[ClassSend][ScopeUser] {
+		t.Fatalf("expected untouched limits to keep their defaults")
+	}
+	if policy["custom"][ScopeUser].Requests != 7 {
+		t.Fatalf("expected new classes to be accepted")
+	}
+	for _, bad := range []string{"send=5/1m", "send.tenant=5/1m", "send.user=five/1m", "send.user=5/soon"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMiddlewareKeysOnSubjectAndDevice(t *testing.T) {
+	policy := Policy{ClassSend: {
+		ScopeUser:   {Requests: 4, Window: time.Minute},
+		ScopeDevice: {Requests: 2, Window: time.Minute},
+	}}
+	h := New(policy, NewMemoryStore(), identifyStub).Middleware(ClassSend)(ok)
+
+	// Changing address does not help a user who exhausted their device bucket.
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if rec := serve(t, h, ip, "alice", "dev-1"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected success, got %d", i+1, rec.Code)
+		}
+	}
+	rec := serve(t, h, "10.0.0.3", "alice", "dev-1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the device bucket to be exhausted, got %d", rec.Code)
+	}
+	if secs, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || secs < 1 || secs > 60 {
+		t.Fatalf("expected a Retry-After within the window, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Rejected requests still count, so the user bucket holds one more.
+	if rec := serve(t, h, "10.0.0.1", "alice", "dev-2"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a second device to be allowed, got %d", rec.Code)
+	}
+	if rec := serve(t, h, "10.0.0.1", "alice", "dev-3"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the user bucket to be exhausted, got %d", rec.Code)
+	}
+
+	// Quoting alice's device id does not drain it for another user.
+	if rec := serve(t, h, "10.0.0.1", "mallory", "dev-1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected another user's bucket to be separate, got %d", rec.Code)
+	}
+}
+
+func TestMiddlewareIgnoresClientNamedDevices(t *testing.T) {
+	policy := Policy{ClassSend: {ScopeDevice: {Requests: 1, Window: time.Minute}}}
+	limiter := New(policy, NewMemoryStore(), identifyStub)
+	h := limiter.Middleware(ClassSend)(ok)
+
+	// A device id the client merely quotes opens no fresh bucket.
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/messages/send?device_id=dev-"+strconv.Itoa(i), nil)
+		req.Header.Set("Authorization", "Bearer alice/dev-1")
+		req.Header.Set("X-Device-ID", "dev-"+strconv.Itoa(i))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		want := http.StatusTooManyRequests
+		if i == 0 {
+			want = http.StatusNoContent
+		}
+		if rec.Code != want {
+			t.Fatalf("request %d: expected the token's device bucket to give %d, got %d", i+1, want, rec.Code)
+		}
+	}
+
+	// The device the perimeter confirmed takes precedence over the token's.
+	confirmed := limiter.Middleware(ClassSend)(ok)
+	for i, want := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/messages/send", nil)
+		req.Header.Set("Authorization", "Bearer alice")
+		req = req.WithContext(middleware.WithDevice(req.Context(), "dev-2"))
+		rec := httptest.NewRecorder()
+		confirmed.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("confirmed request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+}
+
+func TestMiddlewareLimitsAnonymousTrafficByIP(t *testing.T) {
+	policy := Policy{ClassLogin: {ScopeIP: {Requests: 1, Window: time.Minute}}}
+	h := New(policy, NewMemoryStore(), nil).Middleware(ClassLogin)(ok)
+
+	if rec := serve(t, h, "192.0.2.1", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected first request to pass, got %d", rec.Code)
+	}
+	if rec := serve(t, h, "192.0.2.1", "", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request to be limited, got %d", rec.Code)
+	}
+	if rec := serve(t, h, "192.0.2.2", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a different address to pass, got %d", rec.Code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, Limit) (Decision, error) {
+	return Decision{}, errors.New("connection refused")
+}
+
+func TestMiddlewareFailsOpenWhenStoreIsDown(t *testing.T) {
+	policy := Policy{ClassDefault: {ScopeIP: {Requests: 1, Window: time.Minute}}}
+	h := New(policy, failingStore{}, nil).Middleware(ClassDefault)(ok)
+	for i := 0; i < 3; i++ {
+		if rec := serve(t, h, "192.0.2.1", "", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected requests to pass while the store is down, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package ratelimit limits gateway traffic per route class and per caller:
+// the client IP, the verified JWT subject and the device id each get their
+// own fixed-window bucket, stored in memory or in a Redis-compatible server.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route classes used by the gateway. Routes without a class use ClassDefault.
+const (
+	ClassDefault = "default"
+	ClassLogin   = "login"
+	ClassSend    = "send"
+	ClassBundle  = "bundle"
+)
+
+// Scopes a limit can be keyed on.
+const (
+	ScopeIP     = "ip"
+	ScopeUser   = "user"
+	ScopeDevice = "device"
+)
+
+// Limit allows Requests per Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// Policy maps a route class to its limit per scope.
+type Policy map[string]map[string]Limit
+
+// DefaultPolicy is used for every class and scope the configuration leaves out.
+func DefaultPolicy() Policy {
+	return Policy{
+		ClassDefault: {
+			ScopeIP:   {Requests: 300, Window: time.Minute},
+			ScopeUser: {Requests: 600, Window: time.Minute},
+		},
+		ClassLogin: {
+			ScopeIP: {Requests: 20, Window: time.Minute},
+		},
+		ClassSend: {
+			ScopeUser:   {Requests: 120, Window: time.Minute},
+			ScopeDevice: {Requests: 60, Window: time.Minute},
+		},
+		ClassBundle: {
+			ScopeUser:   {Requests: 60, Window: time.Minute},
+			ScopeDevice: {Requests: 30, Window: time.Minute},
+		},
+	}
+}
+
+// ParsePolicy reads overrides on top of DefaultPolicy. The format is a comma
+// separated list of class.scope=requests/window, e.g.
+// "send.device=30/1m,login.ip=10/30s". A zero request count disables that
+// limit.
+func ParsePolicy(spec string) (Policy, error) {
+	policy := DefaultPolicy()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: %q: expected class.scope=requests/window", entry)
+		}
+		class, scope, ok := strings.Cut(strings.TrimSpace(name), ".")
+		if !ok || class == "" {
+			return nil, fmt.Errorf("ratelimit: %q: expected class.scope", name)
+		}
+		switch scope {
+		case ScopeIP, ScopeUser, ScopeDevice:
+		default:
+			return nil, fmt.Errorf("ratelimit: %q: unknown scope %q", name, scope)
+		}
+		reqs, window, ok := strings.Cut(strings.TrimSpace(value), "/")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: %q: expected requests/window", value)
+		}
+		n, err := strconv.Atoi(reqs)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("ratelimit: %q: invalid request count", value)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("ratelimit: %q: invalid window", value)
+		}
+		if policy[class] == nil {
+			policy[class] = map[string]Limit{}
+		}
+		if n == 0 {
+			delete(policy[class], scope)
+			continue
+		}
+		policy[class][scope] = Limit{Requests: n, Window: d}
+	}
+	return policy, nil
+}
@@ -0,0 +1,231 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisStore keeps buckets in a Redis-compatible server (Redis, Valkey,
+// KeyDB, ...) so every gateway replica shares them. It speaks just enough
+// RESP to run one script per check.
+type RedisStore struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+// allowScript increments the bucket and starts its window on first use. The
+// PTTL fallback repairs a key that lost its expiry.
+const allowScript = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`
+
+// NewRedisStore parses a redis:// or rediss:// URL, e.g.
+// redis://:password@redis:6379/0. Connections are opened lazily.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("ratelimit: unsupported redis scheme %q", u.Scheme)
+	}
+	s := &RedisStore{
+		addr:    u.Host,
+		useTLS:  u.Scheme == "rediss",
+		prefix:  "gateway:ratelimit:",
+		timeout: 500 * time.Millisecond,
+		pool:    make(chan *redisConn, 16),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid redis db %q", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	window := strconv.FormatInt(limit.Window.Milliseconds(), 10)
+	reply, err := conn.do(ctx, s.timeout, "EVAL", allowScript, "1", s.prefix+key, window)
+	if err != nil {
+		conn.close()
+		return Decision{}, err
+	}
+	s.put(conn)
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return Decision{}, fmt.Errorf("ratelimit: unexpected redis reply %v", reply)
+	}
+	count, ok1 := values[0].(int64)
+	ttl, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return Decision{}, fmt.Errorf("ratelimit: unexpected redis reply %v", reply)
+	}
+	return decide(int(count), limit, time.Duration(ttl)*time.Millisecond), nil
+}
+
+// Close drops the idle connections.
+func (s *RedisStore) Close() {
+	for {
+		select {
+		case c := <-s.pool:
+			c.close()
+		default:
+			return
+		}
+	}
+}
+
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.pool:
+		return c, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var nc net.Conn
+	var err error
+	if s.useTLS {
+		nc, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := c.do(ctx, s.timeout, args...); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.do(ctx, s.timeout, "SELECT", strconv.Itoa(s.db)); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisStore) put(c *redisConn) {
+	select {
+	case s.pool <- c:
+	default:
+		c.close()
+	}
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) close() { _ = c.conn.Close() }
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of one bucket check.
+type Decision struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket's window ends.
+	Reset time.Duration
+}
+
+// Store counts requests per key in fixed windows. Allow must count the
+// request and decide atomically so replicas sharing a store agree.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// MemoryStore keeps buckets in process memory. Each gateway replica then
+// enforces its own copy of the limit.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	sweepAt time.Time
+}
+
+type bucket struct {
+	count int
+	reset time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.After(s.sweepAt) {
+		s.sweep(now)
+		s.sweepAt = now.Add(time.Minute)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || !now.Before(b.reset) {
+		b = &bucket{reset: now.Add(limit.Window)}
+		s.buckets[key] = b
+	}
+	b.count++
+	return decide(b.count, limit, b.reset.Sub(now)), nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.reset) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func decide(count int, limit Limit, reset time.Duration) Decision {
+	remaining := limit.Requests - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Decision{Allowed: count <= limit.Requests, Remaining: remaining, Reset: reset}
+}
@@ -0,0 +1,170 @@
+package wsproxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	opClose = 0x8
+
+	// maxFrame bounds how much of one backend frame is buffered.
+	maxFrame = 16 << 20
+)
+
+// conn is one proxied connection. Client-to-backend bytes are copied as they
+// come; backend-to-client traffic is forwarded frame by frame so a close frame
+// can be slipped in between two frames.
+type conn struct {
+	user    string
+	started time.Time
+	grace   time.Duration
+	drain   chan time.Duration
+
+	client  net.Conn
+	backend net.Conn
+
+	writeMu sync.Mutex // serialises writes to client and guards the fields below
+	closed  bool       // no frame may follow a close frame
+	dead    bool       // closeNow ran
+}
+
+// attach hands c its sockets. It fails when c was force-closed while the
+// backend was being dialled.
+func (c *conn) attach(client, backend net.Conn) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.dead {
+		return false
+	}
+	c.client, c.backend = client, backend
+	return true
+}
+
+// pump relays traffic until either side goes away and reports which one did:
+// "client", "upstream" or "drain".
+func (c *conn) pump(clientR, backendR *bufio.Reader) string {
+	ended := make(chan string, 3)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		_, _ = io.Copy(c.backend, clientR)
+		ended <- "client"
+	}()
+	go func() {
+		for {
+			frame, err := readFrame(backendR)
+			if err != nil {
+				ended <- "upstream"
+				return
+			}
+			if err := c.writeClient(frame); err != nil {
+				ended <- "client"
+				return
+			}
+		}
+	}()
+	go func() {
+		select {
+		case after := <-c.drain:
+			_ = c.writeClose(CloseServiceRestart, fmt.Sprintf("reconnect_after_ms=%d", after.Milliseconds()))
+			ended <- "drain"
+		case <-stop:
+		}
+	}()
+
+	closedBy := <-ended
+	if closedBy == "drain" {
+		// Give the client a moment to answer the close frame.
+		select {
+		case <-ended:
+		case <-time.After(c.grace):
+		}
+	}
+	c.closeNow()
+	return closedBy
+}
+
+func (c *conn) writeClient(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	if frame[0]&0x0f == opClose {
+		c.closed = true
+	}
+	if err := c.client.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	_, err := c.client.Write(frame)
+	return err
+}
+
+func (c *conn) writeClose(code uint16, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	frame := make([]byte, 4, 4+len(reason))
+	frame[0] = 0x80 | opClose
+	frame[1] = byte(2 + len(reason))
+	binary.BigEndian.PutUint16(frame[2:], code)
+	return c.writeClient(append(frame, reason...))
+}
+
+// closeNow drops both sides. Safe to call more than once.
+func (c *conn) closeNow() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.dead = true
+	if c.client != nil {
+		_ = c.client.Close()
+	}
+	if c.backend != nil {
+		_ = c.backend.Close()
+	}
+}
+
+// readFrame reads one complete frame, header included, as sent on the wire.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	masked := head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		head = append(head, ext...)
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		head = append(head, ext...)
+		n = binary.BigEndian.Uint64(ext)
+	}
+	if masked {
+		n += 4
+	}
+	if n > maxFrame {
+		return nil, errors.New("wsproxy: frame too large")
+	}
+	frame := make([]byte, len(head)+int(n))
+	copy(frame, head)
+	if _, err := io.ReadFull(r, frame[len(head):]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
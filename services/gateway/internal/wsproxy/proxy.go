@@ -0,0 +1,344 @@
+// Package wsproxy proxies WebSocket upgrades to the messages service. Unlike
+// httputil.ReverseProxy it keeps track of every connection, so the gateway
+// can cap connections per user, report them as metrics and, on shutdown,
+// close them with a reconnect hint instead of dropping them.
+package wsproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"gateway/internal/authz"
+	"gateway/internal/observability/metrics"
+
+	obsmw "observability/middleware"
+)
+
+// CloseServiceRestart is the close code sent while draining (RFC 6455 1012).
+const CloseServiceRestart = 1012
+
+type Options struct {
+	// MaxPerUser caps concurrent connections per subject; 0 means no cap.
+	MaxPerUser int
+	// DialTimeout bounds connecting to and upgrading with the backend.
+	// Default 10s.
+	DialTimeout time.Duration
+	// CloseGrace is how long a drained connection stays open after its close
+	// frame so the client can answer. Default 2s.
+	CloseGrace time.Duration
+	// ReconnectSpread is the window reconnect hints are spread over, so
+	// clients of a restarting gateway do not all come back at once.
+	// Default 5s.
+	ReconnectSpread time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 10 * time.Second
+	}
+	if o.CloseGrace <= 0 {
+		o.CloseGrace = 2 * time.Second
+	}
+	if o.ReconnectSpread <= 0 {
+		o.ReconnectSpread = 5 * time.Second
+	}
+	return o
+}
+
+type Proxy struct {
+	target *url.URL
+	opts   Options
+
+	mu       sync.Mutex
+	draining bool
+	perUser  map[string]int
+	conns    map[*conn]struct{}
+	done     chan struct{} // closed when draining and the last connection ends
+}
+
+func New(target *url.URL, opts Options) *Proxy {
+	return &Proxy{
+		target:  target,
+		opts:    opts.withDefaults(),
+		perUser: make(map[string]int),
+		conns:   make(map[*conn]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Active returns the number of open connections.
+func (p *Proxy) Active() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqID := obsmw.RequestIDFromContext(r.Context())
+	traceID := obsmw.TraceIDFromContext(r.Context())
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	user, _ := authz.SubjectFrom(r.Context())
+
+	c, status := p.reserve(user)
+	if c == nil {
+		switch status {
+		case http.StatusServiceUnavailable:
+			metrics.WebSocketConnectionsTotal.WithLabelValues("rejected_draining").Inc()
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "gateway is restarting", status)
+		default:
+			metrics.WebSocketConnectionsTotal.WithLabelValues("rejected_cap").Inc()
+			slog.Warn("websocket connection cap reached", "subject", user, "max", p.opts.MaxPerUser, "request_id", reqID, "trace_id", traceID)
+			http.Error(w, "too many open connections", status)
+		}
+		return
+	}
+
+	backend, br, resp, err := p.dial(r)
+	if err != nil {
+		p.release(c, "")
+		metrics.WebSocketConnectionsTotal.WithLabelValues("upstream_error").Inc()
+		slog.Error("gateway websocket proxy error", "error", err, "request_id", reqID, "trace_id", traceID)
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// The backend refused the upgrade, e.g. for an unknown device; relay
+		// its answer as a plain response.
+		defer func() { _ = backend.Close() }()
+		defer func() { _ = resp.Body.Close() }()
+		p.release(c, "")
+		metrics.WebSocketConnectionsTotal.WithLabelValues("upstream_refused").Inc()
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = bufio.NewReader(resp.Body).WriteTo(w)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		_ = backend.Close()
+		p.release(c, "")
+		http.Error(w, "upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	client, cbuf, err := hj.Hijack()
+	if err != nil {
+		_ = backend.Close()
+		p.release(c, "")
+		slog.Error("gateway websocket hijack", "error", err, "request_id", reqID, "trace_id", traceID)
+		return
+	}
+	if err := writeSwitching(client, resp); err != nil {
+		_ = client.Close()
+		_ = backend.Close()
+		p.release(c, "")
+		return
+	}
+
+	if !c.attach(client, backend) {
+		_ = client.Close()
+		_ = backend.Close()
+		p.release(c, "")
+		return
+	}
+	metrics.WebSocketConnectionsTotal.WithLabelValues("accepted").Inc()
+	closedBy := c.pump(cbuf.Reader, br)
+	p.release(c, closedBy)
+}
+
+// reserve counts a new connection for user, or returns the status to reject
+// it with.
+func (p *Proxy) reserve(user string) (*conn, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining {
+		return nil, http.StatusServiceUnavailable
+	}
+	if p.opts.MaxPerUser > 0 && p.perUser[user] >= p.opts.MaxPerUser {
+		return nil, http.StatusTooManyRequests
+	}
+	c := &conn{user: user, started: time.Now(), grace: p.opts.CloseGrace, drain: make(chan time.Duration, 1)}
+	p.perUser[user]++
+	p.conns[c] = struct{}{}
+	metrics.WebSocketConnectionsActive.Inc()
+	return c, 0
+}
+
+// release forgets c. An empty closedBy means it never carried traffic.
+func (p *Proxy) release(c *conn, closedBy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.conns[c]; !ok {
+		return
+	}
+	delete(p.conns, c)
+	if p.perUser[c.user]--; p.perUser[c.user] <= 0 {
+		delete(p.perUser, c.user)
+	}
+	metrics.WebSocketConnectionsActive.Dec()
+	if closedBy != "" {
+		metrics.WebSocketConnectionDurationSeconds.WithLabelValues(closedBy).Observe(time.Since(c.started).Seconds())
+	}
+	if p.draining && len(p.conns) == 0 {
+		close(p.done)
+	}
+}
+
+// Drain refuses new upgrades and asks every open connection to reconnect
+// elsewhere, each after its own delay within ReconnectSpread. It returns once
+// all connections are gone, or force-closes the rest when ctx ends.
+func (p *Proxy) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.draining {
+		p.draining = true
+		if len(p.conns) == 0 {
+			close(p.done)
+		}
+	}
+	conns := make([]*conn, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+
+	slog.Info("draining websocket connections", "active", len(conns))
+	for _, c := range conns {
+		select {
+		case c.drain <- time.Duration(rand.Int64N(int64(p.opts.ReconnectSpread))):
+		default:
+		}
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		for c := range p.conns {
+			c.closeNow()
+		}
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (p *Proxy) dial(r *http.Request) (net.Conn, *bufio.Reader, *http.Response, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.opts.DialTimeout)
+	defer cancel()
+
+	host := p.target.Host
+	useTLS := p.target.Scheme == "https" || p.target.Scheme == "wss"
+	if p.target.Port() == "" {
+		port := "80"
+		if useTLS {
+			port = "443"
+		}
+		host = net.JoinHostPort(p.target.Hostname(), port)
+	}
+	dialer := &net.Dialer{}
+	var backend net.Conn
+	var err error
+	if useTLS {
+		backend, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: p.target.Hostname()}}).DialContext(ctx, "tcp", host)
+	} else {
+		backend, err = dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = backend.SetDeadline(deadline)
+	}
+
+	out := r.Clone(ctx)
+	out.URL = &url.URL{
+		Scheme:   p.target.Scheme,
+		Host:     p.target.Host,
+		Path:     strings.TrimRight(p.target.Path, "/") + r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	}
+	out.Host = p.target.Host
+	out.RequestURI = ""
+	out.Header = forwardHeaders(r)
+	if err := out.Write(backend); err != nil {
+		_ = backend.Close()
+		return nil, nil, nil, err
+	}
+	br := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(br, out)
+	if err != nil {
+		_ = backend.Close()
+		return nil, nil, nil, err
+	}
+	_ = backend.SetDeadline(time.Time{})
+	return backend, br, resp, nil
+}
+
+// forwardHeaders copies the client's headers, keeping the upgrade handshake
+// and adding the forwarding headers the HTTP proxy sets.
+func forwardHeaders(r *http.Request) http.Header {
+	h := make(http.Header, len(r.Header)+3)
+	for k, vs := range r.Header {
+		switch strings.ToLower(k) {
+		case "keep-alive", "proxy-connection", "transfer-encoding", "te", "trailer", "content-length", "host":
+			continue
+		}
+		h[k] = append([]string(nil), vs...)
+	}
+	h.Set("Connection", "Upgrade")
+	h.Set("Upgrade", "websocket")
+	if reqID := obsmw.RequestIDFromContext(r.Context()); reqID != "" {
+		h.Set("X-Request-ID", reqID)
+	}
+	otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(h))
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+		clientIP = prior + ", " + clientIP
+	}
+	h.Set("X-Forwarded-For", clientIP)
+	return h
+}
+
+func writeSwitching(client net.Conn, resp *http.Response) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", resp.Status)
+	if err := resp.Header.Write(&b); err != nil {
+		return err
+	}
+	b.WriteString("\r\n")
+	_, err := client.Write([]byte(b.String()))
+	return err
+}
+
+func isUpgrade(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
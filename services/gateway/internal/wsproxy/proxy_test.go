@@ -0,0 +1,147 @@
+package wsproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gwmw "gateway/internal/middleware"
+	"gateway/internal/observability/metrics"
+)
+
+func TestMain(m *testing.M) {
+	metrics.MustRegister("gateway-test", "test")
+	os.Exit(m.Run())
+}
+
+// backend upgrades every request and sends one text frame every 10ms.
+func backend(t *testing.T) *url.URL {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: x\r\n\r\n")
+		_ = rw.Flush()
+		for {
+			if _, err := conn.Write([]byte{0x81, 2, 'h', 'i'}); err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u
+}
+
+// gateway serves p as if the perimeter had authenticated the user named in
+// the X-Test-User header.
+func gateway(t *testing.T, p *Proxy) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := gwmw.WithSubject(r.Context(), r.Header.Get("X-Test-User"))
+		p.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func upgrade(t *testing.T, addr, user string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: x\r\nSec-WebSocket-Version: 13\r\nX-Test-User: %s\r\n\r\n", addr, user)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	return conn, br, resp.StatusCode
+}
+
+func TestDrainSendsReconnectHintAndRefusesUpgrades(t *testing.T) {
+	p := New(backend(t), Options{CloseGrace: 50 * time.Millisecond, ReconnectSpread: time.Second})
+	addr := gateway(t, p)
+
+	conn, br, status := upgrade(t, addr, "alice")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the upgrade to succeed, got %d", status)
+	}
+	if frame, err := readFrame(br); err != nil || string(frame[2:]) != "hi" {
+		t.Fatalf("expected a relayed text frame, got %q, %v", frame, err)
+	}
+	if p.Active() != 1 {
+		t.Fatalf("expected one active connection, got %d", p.Active())
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- p.Drain(context.Background()) }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		frame, err := readFrame(br)
+		if err != nil {
+			t.Fatalf("expected a close frame, got %v", err)
+		}
+		if frame[0]&0x0f != opClose {
+			continue
+		}
+		if code := binary.BigEndian.Uint16(frame[2:4]); code != CloseServiceRestart {
+			t.Fatalf("expected close code %d, got %d", CloseServiceRestart, code)
+		}
+		if reason := string(frame[4:]); !strings.HasPrefix(reason, "reconnect_after_ms=") {
+			t.Fatalf("expected a reconnect hint, got %q", reason)
+		}
+		break
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if p.Active() != 0 {
+		t.Fatalf("expected no connections after draining, got %d", p.Active())
+	}
+	if _, _, status := upgrade(t, addr, "alice"); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected new upgrades to be refused while draining, got %d", status)
+	}
+}
+
+func TestPerUserCap(t *testing.T) {
+	p := New(backend(t), Options{MaxPerUser: 1})
+	addr := gateway(t, p)
+
+	first, _, status := upgrade(t, addr, "alice")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the first connection to succeed, got %d", status)
+	}
+	if _, _, status := upgrade(t, addr, "alice"); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the second connection to be capped, got %d", status)
+	}
+	if _, _, status := upgrade(t, addr, "bob"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected another user to connect, got %d", status)
+	}
+
+	// Closing frees the slot.
+	_ = first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Active() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, _, status := upgrade(t, addr, "alice"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected a freed slot to be reusable, got %d", status)
+	}
+}
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS deletion_jobs (
+  id uuid PRIMARY KEY,
+  user_id text NOT NULL,
+  device_id text,
+  token text,
+  token_expires_at timestamptz,
+  status text NOT NULL,
+  steps jsonb NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL,
+  locked_until timestamptz,
+  last_error text,
+  receipt jsonb,
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL,
+  completed_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_deletion_jobs_user_id ON deletion_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_deletion_jobs_status ON deletion_jobs (status);
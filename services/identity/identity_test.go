@@ -0,0 +1,86 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	s, err := NewSigner(testKey)
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	return s
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	s := newTestSigner(t)
+	want := Identity{UserID: "u-1", SessionID: "s-1", DeviceID: "d-1"}
+	got, err := s.Verify(s.Sign(want, "POST", "/messages/send"), "POST", "/messages/send")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestVerifyRejectsTamperingReuseAndExpiry(t *testing.T) {
+	s := newTestSigner(t)
+	value := s.Sign(Identity{UserID: "u-1", SessionID: "s-1"}, "GET", "/keys/bundle")
+
+	body, sig, _ := strings.Cut(value, ".")
+	forged := body[:len(body)-2] + "xx." + sig
+	if _, err := s.Verify(forged, "GET", "/keys/bundle"); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expected a tampered header to fail, got %v", err)
+	}
+
+	other, _ := NewSigner(strings.Repeat("k", MinKeyLength))
+	if _, err := other.Verify(value, "GET", "/keys/bundle"); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expected another key to reject the header, got %v", err)
+	}
+
+	if _, err := s.Verify(value, "DELETE", "/keys/me"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected the header to be bound to its route, got %v", err)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(DefaultTTL + time.Second) }
+	if _, err := s.Verify(value, "GET", "/keys/bundle"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected an old header to expire, got %v", err)
+	}
+}
+
+func TestNewSignerRejectsShortKeys(t *testing.T) {
+	if _, err := NewSigner("short"); err == nil {
+		t.Fatalf("expected a short key to be rejected")
+	}
+}
+
+func TestServiceIdentityIsSeparateFromCallers(t *testing.T) {
+	s := newTestSigner(t)
+	value := s.SignService("keys", "GET", "/v1/internal/devices/revoked")
+
+	service, err := s.VerifyService(value, "GET", "/v1/internal/devices/revoked")
+	if err != nil {
+		t.Fatalf("verify service: %v", err)
+	}
+	if service != "keys" {
+		t.Fatalf("expected service keys, got %q", service)
+	}
+	if _, err := s.Verify(value, "GET", "/v1/internal/devices/revoked"); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected a service header to be refused as a caller identity, got %v", err)
+	}
+
+	caller := s.Sign(Identity{UserID: "u-1", SessionID: "s-1"}, "GET", "/v1/internal/devices/revoked")
+	if _, err := s.VerifyService(caller, "GET", "/v1/internal/devices/revoked"); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected a caller identity to be refused as a service, got %v", err)
+	}
+	if _, err := s.VerifyService(value, "GET", "/v1/devices/revoke"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected the service header to be bound to its route, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package revocations lets keys and messages catch up on device revocations
+// they missed on the event bus.
+//
+// The bus delivers auth.device.revoked at most once, so a consumer that was
+// restarting when the event went out never tombstones the device. Auth keeps
+// the authoritative list; Run pages through it periodically and hands every
+// revocation to the service, which skips the ones it already knows.
+package revocations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"identity"
+)
+
+// Path is auth's internal route listing revoked devices. Requests must carry
+// an identity.Header signed with Signer.SignService.
+const Path = "/v1/internal/devices/revoked"
+
+// PageSize is how many revocations one request asks for.
+const PageSize = 500
+
+// overlap is how far before the newest revocation seen each pass starts
+// again. Auth stamps revoked_at before its transaction commits, so a slow
+// commit can surface an older revocation after a newer one was listed.
+const overlap = time.Minute
+
+// Device is one revoked device.
+type Device struct {
+	DeviceID  uuid.UUID `json:"deviceId"`
+	UserID    uuid.UUID `json:"userId"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// Cursor marks a position in auth's list, which is ordered by revocation
+// time and then device ID.
+type Cursor struct {
+	RevokedAt time.Time
+	DeviceID  uuid.UUID
+}
+
+// Client reads auth's revoked-device list on behalf of service.
+type Client struct {
+	listURL string
+	http    *http.Client
+	signer  *identity.Signer
+	service string
+}
+
+// New reads from the auth service at baseURL, which defaults to
+// http://localhost:8081.
+func New(baseURL string, signer *identity.Signer, service string) *Client {
+	base := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = "http://localhost:8081"
+	}
+	return &Client{
+		listURL: base + Path,
+		http:    &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(nil)},
+		signer:  signer,
+		service: service,
+	}
+}
+
+// List returns up to limit revocations after the cursor, oldest first.
+func (c *Client) List(ctx context.Context, after Cursor, limit int) ([]Device, error) {
+	q := url.Values{}
+	if !after.RevokedAt.IsZero() {
+		q.Set("after", after.RevokedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if after.DeviceID != uuid.Nil {
+		q.Set("afterId", after.DeviceID.String())
+	}
+	q.Set("limit", strconv.Itoa(limit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.listURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(identity.Header, c.signer.SignService(c.service, http.MethodGet, Path))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list revoked devices: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var body struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Devices, nil
+}
+
+// Sync hands every revocation after from to apply, in order, and returns the
+// cursor of the last one applied. It stops at the first error so a failed
+// device is retried on the next pass.
+func (c *Client) Sync(ctx context.Context, from Cursor, apply func(context.Context, Device) error) (Cursor, error) {
+	cursor := from
+	for {
+		page, err := c.List(ctx, cursor, PageSize)
+		if err != nil {
+			return cursor, err
+		}
+		for _, d := range page {
+			if err := apply(ctx, d); err != nil {
+				return cursor, fmt.Errorf("device %s: %w", d.DeviceID, err)
+			}
+			cursor = Cursor{RevokedAt: d.RevokedAt, DeviceID: d.DeviceID}
+		}
+		if len(page) < PageSize {
+			return cursor, nil
+		}
+	}
+}
+
+// Run syncs every interval until ctx is cancelled. The first pass walks the
+// whole list, so a revocation missed while the service was down is repaired
+// on start.
+func (c *Client) Run(ctx context.Context, interval time.Duration, apply func(context.Context, Device) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var from Cursor
+	for {
+		last, err := c.Sync(ctx, from, apply)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("revocation sync failed", "error", err)
+		}
+		if last.RevokedAt.Add(-overlap).After(from.RevokedAt) {
+			from = Cursor{RevokedAt: last.RevokedAt.Add(-overlap)}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
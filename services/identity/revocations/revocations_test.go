@@ -0,0 +1,150 @@
+package revocations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"identity"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// fakeAuth serves a fixed revoked-device list the way auth does.
+type fakeAuth struct {
+	t       *testing.T
+	signer  *identity.Signer
+	devices []Device
+	calls   int
+}
+
+func (f *fakeAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls++
+	if service, err := f.signer.VerifyService(r.Header.Get(identity.Header), r.Method, r.URL.Path); err != nil || service != "keys" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var after Cursor
+	if v := r.URL.Query().Get("after"); v != "" {
+		ts, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			f.t.Errorf("bad after %q", v)
+		}
+		after.RevokedAt = ts
+	}
+	if v := r.URL.Query().Get("afterId"); v != "" {
+		after.DeviceID = uuid.MustParse(v)
+	}
+	out := []Device{}
+	for _, d := range f.devices {
+		if d.RevokedAt.After(after.RevokedAt) ||
+			(d.RevokedAt.Equal(after.RevokedAt) && d.DeviceID.String() > after.DeviceID.String()) {
+			out = append(out, d)
+		}
+		if len(out) == PageSize {
+			break
+		}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"devices": out})
+}
+
+func newFakeAuth(t *testing.T, n int) (*fakeAuth, *Client) {
+	t.Helper()
+	signer, err := identity.NewSigner(testKey)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	f := &fakeAuth{t: t, signer: signer}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		f.devices = append(f.devices, Device{
+			DeviceID:  uuid.New(),
+			UserID:    uuid.New(),
+			RevokedAt: base.Add(time.Duration(i/3) * time.Second),
+		})
+	}
+	sort.Slice(f.devices, func(i, j int) bool {
+		a, b := f.devices[i], f.devices[j]
+		if !a.RevokedAt.Equal(b.RevokedAt) {
+			return a.RevokedAt.Before(b.RevokedAt)
+		}
+		return a.DeviceID.String() < b.DeviceID.String()
+	})
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, New(srv.URL, signer, "keys")
+}
+
+func TestSyncPagesThroughEveryRevocation(t *testing.T) {
+	f, c := newFakeAuth(t, PageSize+7)
+
+	seen := map[uuid.UUID]bool{}
+	last, err := c.Sync(context.Background(), Cursor{}, func(_ context.Context, d Device) error {
+		seen[d.DeviceID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(seen) != len(f.devices) {
+		t.Fatalf("expected %d devices, applied %d", len(f.devices), len(seen))
+	}
+	if f.calls != 2 {
+		t.Fatalf("expected 2 pages, got %d requests", f.calls)
+	}
+	want := f.devices[len(f.devices)-1]
+	if last.DeviceID != want.DeviceID || !last.RevokedAt.Equal(want.RevokedAt) {
+		t.Fatalf("expected cursor at the last device, got %+v", last)
+	}
+}
+
+func TestSyncStopsAtFirstFailure(t *testing.T) {
+	f, c := newFakeAuth(t, 5)
+	failing := f.devices[2].DeviceID
+
+	var applied []uuid.UUID
+	last, err := c.Sync(context.Background(), Cursor{}, func(_ context.Context, d Device) error {
+		if d.DeviceID == failing {
+			return errors.New("db down")
+		}
+		applied = append(applied, d.DeviceID)
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected the failure to be returned")
+	}
+	if len(applied) != 2 {
+		t.Fatalf("expected 2 devices before the failure, got %d", len(applied))
+	}
+	if last.DeviceID != f.devices[1].DeviceID {
+		t.Fatalf("expected the cursor to stop before the failed device")
+	}
+
+	// The next pass resumes at the failed device.
+	applied = nil
+	if _, err := c.Sync(context.Background(), last, func(_ context.Context, d Device) error {
+		applied = append(applied, d.DeviceID)
+		return nil
+	}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(applied) != 3 || applied[0] != failing {
+		t.Fatalf("expected to resume at the failed device, got %v", applied)
+	}
+}
+
+func TestListRequiresServiceSignature(t *testing.T) {
+	_, c := newFakeAuth(t, 1)
+	other, _ := identity.NewSigner("another-key-another-key-another-k")
+	c.signer = other
+	if _, err := c.List(context.Background(), Cursor{}, PageSize); err == nil {
+		t.Fatalf("expected a request signed with another key to be refused")
+	}
+}
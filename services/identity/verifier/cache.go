@@ -0,0 +1,81 @@
+package verifier
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cacheKey never keeps the token itself in memory longer than the request.
+func cacheKey(token string, deviceID uuid.UUID) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]) + ":" + deviceID.String()
+}
+
+type cache struct {
+	mu      sync.Mutex
+	max     int
+	now     func() time.Time
+	entries map[string]*list.Element
+	order   *list.List // oldest first
+}
+
+type cacheEntry struct {
+	key     string
+	claims  Claims
+	expires time.Time
+}
+
+func newCache(max int, now func() time.Time) *cache {
+	return &cache{max: max, now: now, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *cache) get(key string) (Claims, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Claims{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return Claims{}, false
+	}
+	return e.claims, true
+}
+
+func (c *cache) put(key string, claims Claims, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front())
+	}
+	c.entries[key] = c.order.PushBack(&cacheEntry{key: key, claims: claims, expires: c.now().Add(ttl)})
+}
+
+// drop removes every entry match selects.
+func (c *cache) drop(match func(key string, claims Claims) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*cacheEntry)
+		if match(e.key, e.claims) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+func (c *cache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,317 @@
+// Package verifier checks access tokens against the auth service for the
+// services behind the gateway.
+//
+// Results are cached per token hash and device. Invalid tokens are cached
+// briefly too, concurrent checks of the same token share one call to auth,
+// and a circuit breaker stops calling auth while it is failing. Services
+// shorten staleness further by calling InvalidateSession and
+// InvalidateDevice from auth's revocation events; those are best effort, the
+// TTL is what bounds how long a revoked token can keep working.
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"identity"
+)
+
+var (
+	// ErrMissingToken is returned by Authenticate for a request that carries
+	// neither a gateway identity nor a bearer token.
+	ErrMissingToken = errors.New("verifier: missing bearer token")
+	// ErrUnavailable is returned without calling auth while the breaker is
+	// open.
+	ErrUnavailable = errors.New("verifier: auth unavailable")
+)
+
+type Claims struct {
+	Valid            bool
+	UserID           uuid.UUID
+	SessionID        uuid.UUID
+	TokenDeviceID    *uuid.UUID
+	DeviceAuthorized bool
+}
+
+// Options tune a Client. Zero values pick the defaults; a negative TTL or
+// NegativeTTL turns that part of the cache off.
+type Options struct {
+	// Timeout bounds one call to auth. Default 5s.
+	Timeout time.Duration
+	// TTL is how long a valid result is reused. Default 30s.
+	TTL time.Duration
+	// NegativeTTL is how long an invalid result is reused. Default 5s.
+	NegativeTTL time.Duration
+	// MaxEntries caps the cache; the oldest entries go first. Default 10000.
+	MaxEntries int
+	// FailureThreshold is the number of consecutive failed calls that opens
+	// the breaker. Default 5.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before one call is let
+	// through to probe auth. Default 10s.
+	Cooldown time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.TTL == 0 {
+		o.TTL = 30 * time.Second
+	}
+	if o.NegativeTTL == 0 {
+		o.NegativeTTL = 5 * time.Second
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 5
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = 10 * time.Second
+	}
+	return o
+}
+
+type Client struct {
+	verifyURL string
+	http      *http.Client
+	opts      Options
+	identity  *identity.Signer
+
+	cache   *cache
+	breaker *breaker
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+type call struct {
+	done   chan struct{}
+	claims Claims
+	err    error
+}
+
+// New verifies tokens against the auth service at baseURL, which defaults to
+// http://localhost:8081.
+func New(baseURL string, opts Options) *Client {
+	base := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = "http://localhost:8081"
+	}
+	opts = opts.withDefaults()
+	return &Client{
+		verifyURL: base + "/v1/auth/verify",
+		http:      &http.Client{Timeout: opts.Timeout, Transport: otelhttp.NewTransport(nil)},
+		opts:      opts,
+		cache:     newCache(opts.MaxEntries, time.Now),
+		breaker:   newBreaker(opts.FailureThreshold, opts.Cooldown, time.Now),
+		inflight:  make(map[string]*call),
+	}
+}
+
+// TrustGateway makes Authenticate accept identity headers signed with s.
+func (c *Client) TrustGateway(s *identity.Signer) {
+	c.identity = s
+}
+
+// Authenticate resolves the caller of r. A valid identity header from the
+// gateway is trusted without asking auth. The token is still verified when
+// there is no header, or when r acts for a device the gateway did not
+// confirm, e.g. one named only in the request body.
+func (c *Client) Authenticate(r *http.Request, token string, deviceID uuid.UUID) (Claims, error) {
+	if value := r.Header.Get(identity.Header); value != "" && c.identity != nil {
+		id, err := c.identity.Verify(value, r.Method, r.URL.Path)
+		if err != nil {
+			return Claims{}, err
+		}
+		claims, confirmed, err := claimsFromIdentity(id)
+		if err != nil {
+			return Claims{}, err
+		}
+		if deviceID == uuid.Nil || deviceID == confirmed {
+			claims.DeviceAuthorized = deviceID != uuid.Nil
+			return claims, nil
+		}
+	}
+	if token == "" {
+		return Claims{}, ErrMissingToken
+	}
+	return c.Verify(r.Context(), token, deviceID)
+}
+
+// claimsFromIdentity also returns the device the gateway confirmed, or
+// uuid.Nil.
+func claimsFromIdentity(id identity.Identity) (Claims, uuid.UUID, error) {
+	userID, err := uuid.Parse(id.UserID)
+	if err != nil {
+		return Claims{}, uuid.Nil, fmt.Errorf("invalid user id in identity header")
+	}
+	sessionID, err := uuid.Parse(id.SessionID)
+	if err != nil {
+		return Claims{}, uuid.Nil, fmt.Errorf("invalid session id in identity header")
+	}
+	claims := Claims{Valid: true, UserID: userID, SessionID: sessionID}
+	if did, err := uuid.Parse(id.TokenDeviceID); err == nil {
+		claims.TokenDeviceID = &did
+	}
+	confirmed, _ := uuid.Parse(id.DeviceID)
+	return claims, confirmed, nil
+}
+
+// Verify checks token with auth. If deviceID is not uuid.Nil, auth also
+// asserts the device is an active device of the token's user.
+func (c *Client) Verify(ctx context.Context, token string, deviceID uuid.UUID) (Claims, error) {
+	token = strings.TrimSpace(token)
+	key := cacheKey(token, deviceID)
+	if claims, ok := c.cache.get(key); ok {
+		return claims, nil
+	}
+
+	c.mu.Lock()
+	if inflight, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-inflight.done:
+			return inflight.claims, inflight.err
+		case <-ctx.Done():
+			return Claims{}, ctx.Err()
+		}
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	// The shared call must not die with whichever caller happened to start it.
+	cl.claims, cl.err = c.fetch(context.WithoutCancel(ctx), token, deviceID)
+	if cl.err == nil {
+		c.store(key, cl.claims, deviceID)
+	}
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.claims, cl.err
+}
+
+// store caches a refusal, an invalid token or a device that is not (yet)
+// authorized, only for NegativeTTL.
+func (c *Client) store(key string, claims Claims, deviceID uuid.UUID) {
+	ttl := c.opts.TTL
+	if !claims.Valid || (deviceID != uuid.Nil && !claims.DeviceAuthorized) {
+		ttl = c.opts.NegativeTTL
+	}
+	if ttl > 0 {
+		c.cache.put(key, claims, ttl)
+	}
+}
+
+// InvalidateSession drops cached results for tokens of the session.
+func (c *Client) InvalidateSession(sessionID uuid.UUID) {
+	c.cache.drop(func(_ string, cl Claims) bool { return cl.Valid && cl.SessionID == sessionID })
+}
+
+// InvalidateDevice drops cached results that involve the device, e.g. after
+// it was revoked or registered.
+func (c *Client) InvalidateDevice(deviceID uuid.UUID) {
+	c.cache.drop(func(key string, cl Claims) bool {
+		return strings.HasSuffix(key, ":"+deviceID.String()) ||
+			(cl.TokenDeviceID != nil && *cl.TokenDeviceID == deviceID)
+	})
+}
+
+func (c *Client) fetch(ctx context.Context, token string, deviceID uuid.UUID) (Claims, error) {
+	if !c.breaker.allow() {
+		return Claims{}, ErrUnavailable
+	}
+	claims, err := c.post(ctx, token, deviceID)
+	var status statusError
+	// A rejected request says nothing about auth's health; only transport
+	// errors and server errors count against the breaker.
+	if err != nil && (!errors.As(err, &status) || status >= 500) {
+		c.breaker.failure()
+	} else {
+		c.breaker.success()
+	}
+	return claims, err
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("auth verify failed: %d %s", int(e), http.StatusText(int(e)))
+}
+
+func (c *Client) post(ctx context.Context, token string, deviceID uuid.UUID) (Claims, error) {
+	payload := map[string]string{"token": token}
+	if deviceID != uuid.Nil {
+		payload["deviceId"] = deviceID.String()
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Claims{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, bytes.NewReader(data))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, statusError(resp.StatusCode)
+	}
+
+	var body struct {
+		Valid            bool   `json:"valid"`
+		UserID           string `json:"userId"`
+		SessionID        string `json:"sessionId"`
+		TokenDeviceID    string `json:"tokenDeviceId"`
+		DeviceAuthorized bool   `json:"deviceAuthorized"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Claims{}, err
+	}
+	if !body.Valid {
+		return Claims{Valid: false, DeviceAuthorized: body.DeviceAuthorized}, nil
+	}
+
+	userID, err := uuid.Parse(body.UserID)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid user id from verify response")
+	}
+	sessionID, err := uuid.Parse(body.SessionID)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid session id from verify response")
+	}
+	var tokenDeviceID *uuid.UUID
+	if strings.TrimSpace(body.TokenDeviceID) != "" {
+		if did, err := uuid.Parse(body.TokenDeviceID); err == nil {
+			tokenDeviceID = &did
+		}
+	}
+
+	return Claims{
+		Valid:            true,
+		UserID:           userID,
+		SessionID:        sessionID,
+		TokenDeviceID:    tokenDeviceID,
+		DeviceAuthorized: body.DeviceAuthorized,
+	}, nil
+}
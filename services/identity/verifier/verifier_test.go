@@ -0,0 +1,218 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"identity"
+)
+
+var (
+	userID    = uuid.New()
+	sessionID = uuid.New()
+	deviceID  = uuid.New()
+)
+
+// fakeAuth accepts "good" and owns deviceID. Every call is counted, and calls
+// block on gate when one is set.
+type fakeAuth struct {
+	calls  atomic.Int32
+	status atomic.Int32
+	gate   chan struct{}
+}
+
+func (f *fakeAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	if s := f.status.Load(); s != 0 {
+		w.WriteHeader(int(s))
+		return
+	}
+	var body struct {
+		Token    string `json:"token"`
+		DeviceID string `json:"deviceId"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	if body.Token != "good" {
+		_ = json.NewEncoder(w).Encode(map[string]any{"valid": false})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"valid":            true,
+		"userId":           userID.String(),
+		"sessionId":        sessionID.String(),
+		"deviceAuthorized": body.DeviceID == deviceID.String(),
+	})
+}
+
+func newTestClient(t *testing.T, f *fakeAuth, opts Options) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return New(srv.URL, opts)
+}
+
+func TestVerifyCachesPositiveAndNegativeResults(t *testing.T) {
+	f := &fakeAuth{}
+	c := newTestClient(t, f, Options{})
+	now := time.Now()
+	c.cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		claims, err := c.Verify(ctx, "good", deviceID)
+		if err != nil || !claims.Valid || !claims.DeviceAuthorized || claims.SessionID != sessionID {
+			t.Fatalf("unexpected result %+v, %v", claims, err)
+		}
+		if claims, err := c.Verify(ctx, "bad", uuid.Nil); err != nil || claims.Valid {
+			t.Fatalf("expected an invalid token, got %+v, %v", claims, err)
+		}
+	}
+	if got := f.calls.Load(); got != 2 {
+		t.Fatalf("expected one call per token, got %d", got)
+	}
+
+	// The device is part of the key.
+	if claims, _ := c.Verify(ctx, "good", uuid.New()); claims.DeviceAuthorized {
+		t.Fatalf("expected another device not to be authorized")
+	}
+	if got := f.calls.Load(); got != 3 {
+		t.Fatalf("expected a new device to miss the cache, got %d calls", got)
+	}
+
+	// Refusals expire first.
+	now = now.Add(10 * time.Second)
+	_, _ = c.Verify(ctx, "good", deviceID)
+	_, _ = c.Verify(ctx, "bad", uuid.Nil)
+	if got := f.calls.Load(); got != 4 {
+		t.Fatalf("expected only the negative entry to expire, got %d calls", got)
+	}
+}
+
+func TestVerifyInvalidatesOnRevocation(t *testing.T) {
+	f := &fakeAuth{}
+	c := newTestClient(t, f, Options{})
+	ctx := context.Background()
+
+	_, _ = c.Verify(ctx, "good", uuid.Nil)
+	_, _ = c.Verify(ctx, "good", deviceID)
+	c.InvalidateDevice(deviceID)
+	_, _ = c.Verify(ctx, "good", uuid.Nil)
+	_, _ = c.Verify(ctx, "good", deviceID)
+	if got := f.calls.Load(); got != 3 {
+		t.Fatalf("expected only the device entry to be dropped, got %d calls", got)
+	}
+
+	c.InvalidateSession(sessionID)
+	_, _ = c.Verify(ctx, "good", uuid.Nil)
+	_, _ = c.Verify(ctx, "good", deviceID)
+	if got := f.calls.Load(); got != 5 {
+		t.Fatalf("expected every entry of the session to be dropped, got %d calls", got)
+	}
+}
+
+func TestVerifyCoalescesConcurrentCalls(t *testing.T) {
+	f := &fakeAuth{gate: make(chan struct{})}
+	c := newTestClient(t, f, Options{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if claims, err := c.Verify(context.Background(), "good", uuid.Nil); err != nil || !claims.Valid {
+				t.Errorf("unexpected result %+v, %v", claims, err)
+			}
+		}()
+	}
+	// Let the callers pile up behind the first request before releasing it.
+	for f.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(f.gate)
+	wg.Wait()
+	if got := f.calls.Load(); got != 1 {
+		t.Fatalf("expected a single call to auth, got %d", got)
+	}
+}
+
+func TestVerifyBreakerOpensAndProbes(t *testing.T) {
+	f := &fakeAuth{}
+	f.status.Store(http.StatusServiceUnavailable)
+	c := newTestClient(t, f, Options{FailureThreshold: 2, Cooldown: time.Minute})
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Verify(ctx, "good", uuid.Nil); err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("expected auth's error, got %v", err)
+		}
+	}
+	if _, err := c.Verify(ctx, "good", uuid.Nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected the breaker to be open, got %v", err)
+	}
+	if got := f.calls.Load(); got != 2 {
+		t.Fatalf("expected no call while open, got %d", got)
+	}
+
+	f.status.Store(0)
+	now = now.Add(time.Minute)
+	if claims, err := c.Verify(ctx, "good", uuid.Nil); err != nil || !claims.Valid {
+		t.Fatalf("expected the probe to succeed, got %+v, %v", claims, err)
+	}
+	if claims, err := c.Verify(ctx, "bad", uuid.Nil); err != nil || claims.Valid {
+		t.Fatalf("expected the breaker to be closed again, got %+v, %v", claims, err)
+	}
+}
+
+func TestAuthenticateTrustsGatewayIdentity(t *testing.T) {
+	f := &fakeAuth{}
+	c := newTestClient(t, f, Options{})
+	signer, err := identity.NewSigner("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	c.TrustGateway(signer)
+
+	req := httptest.NewRequest(http.MethodGet, "/messages/history", nil)
+	req.Header.Set(identity.Header, signer.Sign(identity.Identity{
+		UserID: userID.String(), SessionID: sessionID.String(), DeviceID: deviceID.String(),
+	}, http.MethodGet, "/messages/history"))
+
+	claims, err := c.Authenticate(req, "good", deviceID)
+	if err != nil || !claims.DeviceAuthorized || claims.UserID != userID {
+		t.Fatalf("unexpected result %+v, %v", claims, err)
+	}
+	if got := f.calls.Load(); got != 0 {
+		t.Fatalf("expected no call to auth, got %d", got)
+	}
+
+	// A device the gateway did not confirm goes to auth.
+	if claims, _ := c.Authenticate(req, "good", uuid.New()); claims.DeviceAuthorized {
+		t.Fatalf("expected an unconfirmed device to be checked with auth")
+	}
+	if got := f.calls.Load(); got != 1 {
+		t.Fatalf("expected one call to auth, got %d", got)
+	}
+
+	req.Header.Set(identity.Header, "forged.header")
+	if _, err := c.Authenticate(req, "good", uuid.Nil); err == nil {
+		t.Fatalf("expected a forged header to be rejected")
+	}
+	if _, err := c.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil), "", uuid.Nil); !errors.Is(err, ErrMissingToken) {
+		t.Fatalf("expected ErrMissingToken, got %v", err)
+	}
+}
@@ -1,22 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"keys/internal/auth"
 	"keys/internal/config"
-	"keys/internal/observability/logging"
+	"keys/internal/events"
 	"keys/internal/observability/metrics"
-	"keys/internal/observability/middleware"
 	"keys/internal/service"
 	"keys/internal/store"
 	httptransport "keys/internal/transport/http"
 
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"eventbus"
+	"identity"
+	"identity/revocations"
+	"identity/verifier"
+	"observability/health"
+	"observability/logging"
+	"observability/middleware"
+	"observability/tracing"
 )
 
 func main() {
@@ -32,7 +45,12 @@ func main() {
 	})
 
 	slog.SetDefault(logger)
-	metrics.MustRegister("keys")
+	metrics.MustRegister("keys", env)
+	shutdownTracing, err := tracing.Setup(context.Background(), "keys", env)
+	if err != nil {
+		logger.Error("tracing", "error", err)
+		os.Exit(1)
+	}
 
 	logger.Info("starting service")
 
@@ -43,11 +61,61 @@ func main() {
 		logger.Error("gorm open", "error", err)
 		os.Exit(1)
 	}
+	if err := tracing.InstrumentGORM(db); err != nil {
+		logger.Error("gorm tracing", "error", err)
+		os.Exit(1)
+	}
 
 	st := store.New(db)
 	svc := service.New(st)
-	authClient := auth.NewClient(cfg.AuthBaseURL)
+
+	bus, err := eventbus.Open(context.Background(), cfg.EventBus)
+	if err != nil {
+		logger.Error("event bus", "error", err)
+		os.Exit(1)
+	}
+	if err := svc.Subscribe(bus); err != nil {
+		logger.Error("event subscribe", "error", err)
+		os.Exit(1)
+	}
+	// Background work outlives the signal until in-flight requests are done,
+	// so their outbox rows still get relayed.
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	relay := eventbus.NewRelay(db, bus, eventbus.RelayOptions{Interval: cfg.OutboxPollInterval})
+	go relay.Run(background)
+	authClient := verifier.New(cfg.AuthBaseURL, verifier.Options{})
+	if cfg.IdentityKey != "" {
+		signer, err := identity.NewSigner(cfg.IdentityKey)
+		if err != nil {
+			logger.Error("internal identity key", "error", err)
+			os.Exit(1)
+		}
+		authClient.TrustGateway(signer)
+		// The bus may drop auth.device.revoked; auth's list is the fallback.
+		revoked := revocations.New(cfg.AuthBaseURL, signer, "keys")
+		go revoked.Run(background, cfg.RevocationSyncInterval, func(ctx context.Context, d revocations.Device) error {
+			repaired, err := svc.ReconcileRevocation(ctx, d.DeviceID, d.UserID, d.RevokedAt)
+			if repaired {
+				authClient.InvalidateDevice(d.DeviceID)
+			}
+			return err
+		})
+	} else {
+		slog.Warn("INTERNAL_IDENTITY_KEY not set; missed device revocations are not repaired")
+	}
+	if err := subscribeVerifier(bus, authClient); err != nil {
+		logger.Error("event subscribe", "error", err)
+		os.Exit(1)
+	}
+	ready := health.New()
+	ready.Add("db", health.DB(db))
+	// auth's /healthz, not /readyz, so one unready service does not take
+	// every other one out of rotation with it.
+	ready.Add("auth", health.HTTP(cfg.AuthBaseURL+"/healthz"))
+
 	mux := httptransport.NewRouter(svc, authClient)
+	mux.Handle("/readyz", ready)
 
 	handler := middleware.WithRequestAndTrace(middleware.WithMetrics(mux))
 
@@ -57,9 +125,67 @@ func main() {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	slog.Info("keys service listening", "addr", cfg.Addr)
-	if err := srv.ListenAndServe(); err != nil {
-		logger.Error("server error", "error", err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		slog.Info("keys service listening", "addr", cfg.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+	<-ctx.Done()
+
+	slog.Info("keys service shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
+	ready.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("http shutdown", "error", err)
+	}
+	stopBackground()
+	_ = bus.Close()
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("tracing shutdown", "error", err)
+	}
+	slog.Info("keys service stopped")
+}
+
+// subscribeVerifier drops cached verification results when auth revokes a
+// session or a device changes hands. With the NATS transport only one replica
+// sees each event, so the cache TTL still bounds staleness on the others.
+func subscribeVerifier(bus eventbus.Transport, v *verifier.Client) error {
+	if err := bus.Subscribe(events.TypeAuthSessionRevoked, func(_ context.Context, env eventbus.Envelope) error {
+		var evt events.AuthSessionRevoked
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("decode %s: %w", env.Type, err)
+		}
+		if id, err := uuid.Parse(evt.SessionID); err == nil {
+			v.InvalidateSession(id)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// auth's DeviceRegistered payload has the same shape as DeviceRevoked.
+	device := func(_ context.Context, env eventbus.Envelope) error {
+		var evt events.AuthDeviceRevoked
+		if err := env.Decode(&evt); err != nil {
+			return fmt.Errorf("decode %s: %w", env.Type, err)
+		}
+		if id, err := uuid.Parse(evt.DeviceID); err == nil {
+			v.InvalidateDevice(id)
+		}
+		return nil
+	}
+	if err := bus.Subscribe(events.TypeAuthDeviceRevoked, device); err != nil {
+		return err
 	}
+	return bus.Subscribe(events.TypeAuthDeviceRegistered, device)
 }
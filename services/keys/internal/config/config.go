@@ -1,11 +1,32 @@
 package config
 
-import "os"
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"eventbus"
+)
 
 type Config struct {
 	DatabaseURL string
 	Addr        string
 	AuthBaseURL string
+	// IdentityKey verifies identity headers signed by the gateway. When
+	// empty every request is verified with auth.
+	IdentityKey string
+	// RevocationSyncInterval is how often auth's revoked-device list is
+	// checked for revocations the event bus did not deliver. It needs
+	// IdentityKey.
+	RevocationSyncInterval time.Duration
+
+	EventBus           eventbus.Config
+	OutboxPollInterval time.Duration
+
+	// ShutdownDelay is how long /readyz fails before the listener closes;
+	// ShutdownTimeout bounds the wait for in-flight requests after that.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
 }
 
 func Load() Config {
@@ -15,6 +36,21 @@ func Load() Config {
 		// Default to service DNS name for containerized deploys; override to
 		// http://localhost:8081 when running everything on localhost without Docker.
 		AuthBaseURL: getenv("AUTH_BASE_URL", "http://auth:8081"),
+		IdentityKey: os.Getenv("INTERNAL_IDENTITY_KEY"),
+
+		RevocationSyncInterval: getdur("REVOCATION_SYNC_INTERVAL", time.Minute),
+
+		EventBus: eventbus.Config{
+			Transport:   getenv("EVENTBUS_TRANSPORT", ""),
+			PostgresURL: getenv("EVENTBUS_POSTGRES_URL", ""),
+			Channel:     getenv("EVENTBUS_CHANNEL", eventbus.DefaultChannel),
+			NATSURL:     getenv("EVENTBUS_NATS_URL", ""),
+			Group:       "keys",
+		},
+		OutboxPollInterval: getdur("OUTBOX_POLL_INTERVAL", time.Second),
+
+		ShutdownDelay:   getdur("SHUTDOWN_DELAY", 5*time.Second),
+		ShutdownTimeout: getdur("SHUTDOWN_TIMEOUT", 20*time.Second),
 	}
 }
 
@@ -24,3 +60,13 @@ func getenv(key, def string) string {
 	}
 	return def
 }
+
+func getdur(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		slog.Warn("invalid duration, using default", "key", key, "value", v, "default", def)
+	}
+	return def
+}
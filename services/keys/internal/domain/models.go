@@ -15,6 +15,7 @@ type Device struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
 	CreatedAt time.Time `gorm:"not null;autoCreateTime"`
+	RevokedAt *time.Time
 }
 
 type IdentityKey struct {
@@ -39,3 +40,23 @@ type OneTimePrekey struct {
 	ConsumedAt *time.Time `gorm:"type:timestamptz"`
 	CreatedAt  time.Time  `gorm:"not null;autoCreateTime"`
 }
+
+// KEMPreKey is the device's signed last-resort ML-KEM-768 prekey, handed out
+// once the one-time KEM prekeys run out. KeyID is the client's own key id.
+type KEMPreKey struct {
+	DeviceID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	KeyID     int64     `gorm:"not null"`
+	PublicKey string    `gorm:"type:text;not null"`
+	Signature string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type OneTimeKEMPrekey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	DeviceID   uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_one_time_kem_prekeys_device_key"`
+	KeyID      int64      `gorm:"not null;uniqueIndex:idx_one_time_kem_prekeys_device_key"`
+	PublicKey  string     `gorm:"type:text;not null"`
+	Signature  string     `gorm:"type:text;not null"`
+	ConsumedAt *time.Time `gorm:"type:timestamptz"`
+	CreatedAt  time.Time  `gorm:"not null;autoCreateTime"`
+}
@@ -1,9 +1,19 @@
 package dto
 
+import "time"
+
+// PreKeyBundleResponse carries the device's public keys. When Revoked is set
+// the key material is left empty and senders must stop encrypting to it.
+// The KEM prekeys are only present for devices that registered them; senders
+// that find one run PQXDH, everyone else falls back to X3DH.
 type PreKeyBundleResponse struct {
 	DeviceID             string         `json:"deviceId"`
-	IdentityKey          string         `json:"identityKey"`
-	IdentitySignatureKey string         `json:"identitySignatureKey"`
-	SignedPreKey         SignedPreKey   `json:"signedPreKey"`
+	IdentityKey          string         `json:"identityKey,omitempty"`
+	IdentitySignatureKey string         `json:"identitySignatureKey,omitempty"`
+	SignedPreKey         *SignedPreKey  `json:"signedPreKey,omitempty"`
 	OneTimePreKey        *OneTimePreKey `json:"oneTimePreKey,omitempty"`
+	KEMPreKey            *KEMPreKey     `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKey     *KEMPreKey     `json:"oneTimeKemPreKey,omitempty"`
+	Revoked              bool           `json:"revoked"`
+	RevokedAt            *time.Time     `json:"revokedAt,omitempty"`
 }
@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+// UserExportResponse is the keys service's part of a GDPR data export: the
+// public key material held for each device and how many prekeys remain.
+type UserExportResponse struct {
+	Service     string         `json:"service"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	UserID      string         `json:"userId"`
+	Devices     []ExportDevice `json:"devices"`
+}
+
+type ExportDevice struct {
+	DeviceID             string        `json:"deviceId"`
+	CreatedAt            time.Time     `json:"createdAt"`
+	RevokedAt            *time.Time    `json:"revokedAt,omitempty"`
+	IdentityKey          string        `json:"identityKey,omitempty"`
+	IdentitySignatureKey string        `json:"identitySignatureKey,omitempty"`
+	SignedPreKey         *SignedPreKey `json:"signedPreKey,omitempty"`
+	OneTimePreKeys       PrekeyCounts  `json:"oneTimePreKeys"`
+	KEMPreKey            *KEMPreKey    `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKeys    PrekeyCounts  `json:"oneTimeKemPreKeys"`
+}
+
+type PrekeyCounts struct {
+	Available int64 `json:"available"`
+	Consumed  int64 `json:"consumed"`
+}
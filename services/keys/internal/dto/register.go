@@ -13,6 +13,15 @@ type OneTimePreKey struct {
 	PublicKey string `json:"publicKey"`
 }
 
+// KEMPreKey is an ML-KEM-768 encapsulation key signed with the device's
+// identity signature key. ID is the client's key id and is echoed back in
+// PQXDH handshakes, so it is a number rather than a UUID.
+type KEMPreKey struct {
+	ID        uint32 `json:"id"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
 type RegisterDeviceRequest struct {
 	UserID               string          `json:"userId"`
 	DeviceID             string          `json:"deviceId"`
@@ -20,10 +29,14 @@ type RegisterDeviceRequest struct {
 	IdentitySignatureKey string          `json:"identitySignatureKey"`
 	SignedPreKey         SignedPreKey    `json:"signedPreKey"`
 	OneTimePreKeys       []OneTimePreKey `json:"oneTimePreKeys"`
+	// KEMPreKey and OneTimeKEMPreKeys are only sent by PQXDH-capable clients.
+	KEMPreKey         *KEMPreKey  `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKeys []KEMPreKey `json:"oneTimeKemPreKeys,omitempty"`
 }
 
 type RegisterDeviceResponse struct {
-	UserID         string `json:"userId"`
-	DeviceID       string `json:"deviceId"`
-	OneTimePreKeys int    `json:"oneTimePreKeys"`
+	UserID            string `json:"userId"`
+	DeviceID          string `json:"deviceId"`
+	OneTimePreKeys    int    `json:"oneTimePreKeys"`
+	OneTimeKEMPreKeys int    `json:"oneTimeKemPreKeys"`
 }
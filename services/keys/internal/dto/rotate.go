@@ -4,10 +4,15 @@ type RotateSignedPreKeyRequest struct {
 	DeviceID       string          `json:"deviceId"`
 	SignedPreKey   SignedPreKey    `json:"signedPreKey"`
 	OneTimePreKeys []OneTimePreKey `json:"oneTimePreKeys"`
+	// KEMPreKey replaces the last-resort KEM prekey when set; otherwise the
+	// stored one is kept.
+	KEMPreKey         *KEMPreKey  `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKeys []KEMPreKey `json:"oneTimeKemPreKeys,omitempty"`
 }
 
 type RotateSignedPreKeyResponse struct {
-	DeviceID         string       `json:"deviceId"`
-	SignedPreKey     SignedPreKey `json:"signedPreKey"`
-	AddedOneTimeKeys int          `json:"addedOneTimePreKeys"`
+	DeviceID            string       `json:"deviceId"`
+	SignedPreKey        SignedPreKey `json:"signedPreKey"`
+	AddedOneTimeKeys    int          `json:"addedOneTimePreKeys"`
+	AddedOneTimeKEMKeys int          `json:"addedOneTimeKemPreKeys"`
 }
@@ -0,0 +1,60 @@
+// Package events holds the domain events keys emits through its outbox and
+// the shapes of the events it consumes from other services.
+package events
+
+import "time"
+
+const (
+	TypeDeviceKeysRegistered = "keys.device.registered"
+	TypeSignedPreKeyRotated  = "keys.signed_prekey.rotated"
+	TypePreKeysDropped       = "keys.prekeys.dropped"
+
+	// Published by auth.
+	TypeAuthDeviceRevoked    = "auth.device.revoked"
+	TypeAuthDeviceRegistered = "auth.device.registered"
+	TypeAuthSessionRevoked   = "auth.session.revoked"
+)
+
+type DeviceKeysRegistered struct {
+	DeviceID          string    `json:"deviceId"`
+	UserID            string    `json:"userId"`
+	OneTimePreKeys    int       `json:"oneTimePreKeys"`
+	OneTimeKEMPreKeys int       `json:"oneTimeKemPreKeys,omitempty"`
+	At                time.Time `json:"at"`
+}
+
+type SignedPreKeyRotated struct {
+	DeviceID            string    `json:"deviceId"`
+	AddedOneTimeKeys    int       `json:"addedOneTimeKeys"`
+	AddedOneTimeKEMKeys int       `json:"addedOneTimeKemKeys,omitempty"`
+	At                  time.Time `json:"at"`
+}
+
+// PreKeysDropped counts the one-time prekeys discarded with a device;
+// DroppedKEM covers the ML-KEM ones.
+type PreKeysDropped struct {
+	DeviceID   string    `json:"deviceId"`
+	Dropped    int64     `json:"dropped"`
+	DroppedKEM int64     `json:"droppedKem,omitempty"`
+	Reason     string    `json:"reason"`
+	At         time.Time `json:"at"`
+}
+
+// AuthDeviceRevoked mirrors auth's DeviceRevoked payload.
+type AuthDeviceRevoked struct {
+	DeviceID string    `json:"deviceId"`
+	UserID   string    `json:"userId"`
+	At       time.Time `json:"at"`
+}
+
+// AuthSessionRevoked mirrors auth's SessionRevoked payload.
+type AuthSessionRevoked struct {
+	SessionID string    `json:"sessionId"`
+	UserID    string    `json:"userId"`
+	Reason    string    `json:"reason,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func (DeviceKeysRegistered) EventType() string { return TypeDeviceKeysRegistered }
+func (SignedPreKeyRotated) EventType() string  { return TypeSignedPreKeyRotated }
+func (PreKeysDropped) EventType() string       { return TypePreKeysDropped }
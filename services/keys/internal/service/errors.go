@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrInvalidRequest = errors.New("invalid request")
 	ErrDeviceNotFound = errors.New("device not found")
+	ErrDeviceRevoked  = errors.New("device revoked")
 )
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"keys/internal/domain"
+	"keys/internal/events"
+	"keys/internal/store"
+
+	"github.com/google/uuid"
+
+	"eventbus"
+)
+
+// Subscribe registers the service's handlers for events published by other services.
+func (s *Service) Subscribe(bus eventbus.Transport) error {
+	return bus.Subscribe(events.TypeAuthDeviceRevoked, s.handleDeviceRevoked)
+}
+
+func (s *Service) handleDeviceRevoked(ctx context.Context, env eventbus.Envelope) error {
+	var evt events.AuthDeviceRevoked
+	if err := env.Decode(&evt); err != nil {
+		return fmt.Errorf("decode %s: %w", env.Type, err)
+	}
+	deviceID, err := uuid.Parse(evt.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid deviceId in %s", ErrInvalidRequest, env.Type)
+	}
+	userID, err := uuid.Parse(evt.UserID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid userId in %s", ErrInvalidRequest, env.Type)
+	}
+	at := evt.At
+	if at.IsZero() {
+		at = env.OccurredAt
+	}
+	dropped, err := s.RevokeDevice(ctx, deviceID, userID, at, "device_revoked")
+	if err != nil {
+		return err
+	}
+	slog.Info("revoked device keys", "device_id", deviceID, "dropped", dropped, "event_id", env.ID)
+	return nil
+}
+
+// ReconcileRevocation applies a revocation listed by auth that the event bus
+// may not have delivered. It reports whether the device still needed
+// revoking here; devices that already carry a tombstone are left alone.
+func (s *Service) ReconcileRevocation(ctx context.Context, deviceID, userID uuid.UUID, at time.Time) (bool, error) {
+	dev, err := s.store.Devices().Get(ctx, deviceID)
+	if err != nil && !errors.Is(err, store.ErrRecordNotFound) {
+		return false, err
+	}
+	if err == nil && dev.RevokedAt != nil {
+		return false, nil
+	}
+	dropped, err := s.RevokeDevice(ctx, deviceID, userID, at, "device_revoked")
+	if err != nil {
+		return false, err
+	}
+	slog.Warn("repaired missed device revocation", "device_id", deviceID, "dropped", dropped)
+	return true, nil
+}
+
+// RevokeDevice tombstones the device so its bundle is no longer served and
+// deletes its unconsumed one-time prekeys, classic and KEM alike. A device
+// keys has never seen is tombstoned too, so a late registration cannot
+// resurrect it. Running it twice is harmless.
+func (s *Service) RevokeDevice(ctx context.Context, deviceID, userID uuid.UUID, at time.Time, reason string) (int64, error) {
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	var dropped, droppedKEM int64
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		if _, err := tx.Devices().Get(ctx, deviceID); err != nil {
+			if !errors.Is(err, store.ErrRecordNotFound) {
+				return err
+			}
+			if err := tx.Users().Ensure(ctx, userID); err != nil {
+				return err
+			}
+			if err := tx.Devices().Upsert(ctx, domain.Device{ID: deviceID, UserID: userID}); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Devices().Revoke(ctx, deviceID, at.UTC()); err != nil {
+			return err
+		}
+		var err error
+		dropped, err = tx.OneTimePreKeys().DeleteUnconsumed(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+		droppedKEM, err = tx.OneTimeKEMPreKeys().DeleteUnconsumed(ctx, deviceID)
+		if err != nil || dropped+droppedKEM == 0 {
+			return err
+		}
+		return tx.Outbox().Append(ctx, events.PreKeysDropped{
+			DeviceID:   deviceID.String(),
+			Dropped:    dropped,
+			DroppedKEM: droppedKEM,
+			Reason:     reason,
+			At:         time.Now().UTC(),
+		})
+	})
+	return dropped + droppedKEM, err
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"keys/internal/domain"
+	"keys/internal/dto"
+	"keys/internal/store"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExportUserData lists the public key material stored for the user's
+// devices. Keys only ever holds public halves, so everything is returned as is.
+func (s *Service) ExportUserData(ctx context.Context, userID uuid.UUID) (dto.UserExportResponse, error) {
+	resp := dto.UserExportResponse{
+		Service:     "keys",
+		GeneratedAt: time.Now().UTC(),
+		UserID:      userID.String(),
+		Devices:     []dto.ExportDevice{},
+	}
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		db := tx.DB.WithContext(ctx)
+
+		var devices []domain.Device
+		if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&devices).Error; err != nil {
+			return err
+		}
+		for _, device := range devices {
+			entry := dto.ExportDevice{
+				DeviceID:  device.ID.String(),
+				CreatedAt: device.CreatedAt,
+				RevokedAt: device.RevokedAt,
+			}
+
+			var identity domain.IdentityKey
+			err := db.Where("device_id = ?", device.ID).Take(&identity).Error
+			switch {
+			case err == nil:
+				entry.IdentityKey = identity.PublicKey
+				entry.IdentitySignatureKey = identity.SignatureKey
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+
+			var spk domain.SignedPreKey
+			err = db.Where("device_id = ?", device.ID).Take(&spk).Error
+			switch {
+			case err == nil:
+				entry.SignedPreKey = &dto.SignedPreKey{PublicKey: spk.PublicKey, Signature: spk.Signature, CreatedAt: spk.CreatedAt}
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+
+			if err := db.Model(&domain.OneTimePrekey{}).Where("device_id = ? AND consumed_at IS NULL", device.ID).Count(&entry.OneTimePreKeys.Available).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&domain.OneTimePrekey{}).Where("device_id = ? AND consumed_at IS NOT NULL", device.ID).Count(&entry.OneTimePreKeys.Consumed).Error; err != nil {
+				return err
+			}
+
+			var kem domain.KEMPreKey
+			err = db.Where("device_id = ?", device.ID).Take(&kem).Error
+			switch {
+			case err == nil:
+				entry.KEMPreKey = kemPreKeyDTO(kem.KeyID, kem.PublicKey, kem.Signature)
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+			if err := db.Model(&domain.OneTimeKEMPrekey{}).Where("device_id = ? AND consumed_at IS NULL", device.ID).Count(&entry.OneTimeKEMPreKeys.Available).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&domain.OneTimeKEMPrekey{}).Where("device_id = ? AND consumed_at IS NOT NULL", device.ID).Count(&entry.OneTimeKEMPreKeys.Consumed).Error; err != nil {
+				return err
+			}
+			resp.Devices = append(resp.Devices, entry)
+		}
+		return nil
+	})
+	return resp, err
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"keys/internal/domain"
+	"keys/internal/dto"
+
+	"github.com/google/uuid"
+)
+
+// kemPreKeys validates the optional ML-KEM prekeys of a register or rotate
+// request. Keys stores them as given; clients check the signatures.
+func kemPreKeys(deviceID uuid.UUID, last *dto.KEMPreKey, oneTime []dto.KEMPreKey, now time.Time) (*domain.KEMPreKey, []domain.OneTimeKEMPrekey, error) {
+	var lastResort *domain.KEMPreKey
+	if last != nil {
+		if last.PublicKey == "" || last.Signature == "" {
+			return nil, nil, fmt.Errorf("%w: KEM prekey missing publicKey or signature", ErrInvalidRequest)
+		}
+		lastResort = &domain.KEMPreKey{
+			DeviceID:  deviceID,
+			KeyID:     int64(last.ID),
+			PublicKey: last.PublicKey,
+			Signature: last.Signature,
+			CreatedAt: now,
+		}
+	}
+	keys := make([]domain.OneTimeKEMPrekey, 0, len(oneTime))
+	for _, k := range oneTime {
+		if k.PublicKey == "" || k.Signature == "" {
+			return nil, nil, fmt.Errorf("%w: one-time KEM prekey missing publicKey or signature", ErrInvalidRequest)
+		}
+		keys = append(keys, domain.OneTimeKEMPrekey{
+			ID:        uuid.New(),
+			DeviceID:  deviceID,
+			KeyID:     int64(k.ID),
+			PublicKey: k.PublicKey,
+			Signature: k.Signature,
+		})
+	}
+	return lastResort, keys, nil
+}
+
+func kemPreKeyDTO(keyID int64, publicKey, signature string) *dto.KEMPreKey {
+	return &dto.KEMPreKey{ID: uint32(keyID), PublicKey: publicKey, Signature: signature}
+}
@@ -8,6 +8,7 @@ import (
 
 	"keys/internal/domain"
 	"keys/internal/dto"
+	"keys/internal/events"
 	"keys/internal/store"
 
 	"github.com/google/uuid"
@@ -56,8 +57,19 @@ func (s *Service) RegisterDevice(ctx context.Context, req dto.RegisterDeviceRequ
 			PublicKey: k.PublicKey,
 		})
 	}
+	kemLast, kemOTKs, err := kemPreKeys(deviceID, req.KEMPreKey, req.OneTimeKEMPreKeys, createdAt)
+	if err != nil {
+		return dto.RegisterDeviceResponse{}, err
+	}
 
 	err = s.store.WithTx(ctx, func(tx *store.Store) error {
+		existing, err := tx.Devices().Get(ctx, deviceID)
+		if err != nil && !errors.Is(err, store.ErrRecordNotFound) {
+			return err
+		}
+		if existing != nil && existing.RevokedAt != nil {
+			return ErrDeviceRevoked
+		}
 		if err := tx.Users().Ensure(ctx, userID); err != nil {
 			return err
 		}
@@ -70,16 +82,34 @@ func (s *Service) RegisterDevice(ctx context.Context, req dto.RegisterDeviceRequ
 		if err := tx.SignedPreKeys().Upsert(ctx, domain.SignedPreKey{DeviceID: deviceID, PublicKey: req.SignedPreKey.PublicKey, Signature: req.SignedPreKey.Signature, CreatedAt: createdAt}); err != nil {
 			return err
 		}
-		return tx.OneTimePreKeys().AddBatch(ctx, otks)
+		if err := tx.OneTimePreKeys().AddBatch(ctx, otks); err != nil {
+			return err
+		}
+		if kemLast != nil {
+			if err := tx.KEMPreKeys().Upsert(ctx, *kemLast); err != nil {
+				return err
+			}
+		}
+		if err := tx.OneTimeKEMPreKeys().AddBatch(ctx, kemOTKs); err != nil {
+			return err
+		}
+		return tx.Outbox().Append(ctx, events.DeviceKeysRegistered{
+			DeviceID:          deviceID.String(),
+			UserID:            userID.String(),
+			OneTimePreKeys:    len(otks),
+			OneTimeKEMPreKeys: len(kemOTKs),
+			At:                time.Now().UTC(),
+		})
 	})
 	if err != nil {
 		return dto.RegisterDeviceResponse{}, err
 	}
 
 	return dto.RegisterDeviceResponse{
-		UserID:         userID.String(),
-		DeviceID:       deviceID.String(),
-		OneTimePreKeys: len(otks),
+		UserID:            userID.String(),
+		DeviceID:          deviceID.String(),
+		OneTimePreKeys:    len(otks),
+		OneTimeKEMPreKeys: len(kemOTKs),
 	}, nil
 }
 
@@ -88,10 +118,23 @@ func (s *Service) GetPreKeyBundle(ctx context.Context, deviceID uuid.UUID) (dto.
 		identity *domain.IdentityKey
 		signed   *domain.SignedPreKey
 		otk      *domain.OneTimePrekey
+		kem      *domain.KEMPreKey
+		kemOTK   *domain.OneTimeKEMPrekey
 	)
 
+	var revokedAt *time.Time
 	err := s.store.WithTx(ctx, func(tx *store.Store) error {
-		var err error
+		device, err := tx.Devices().Get(ctx, deviceID)
+		if err != nil {
+			if errors.Is(err, store.ErrRecordNotFound) {
+				return ErrDeviceNotFound
+			}
+			return err
+		}
+		if device.RevokedAt != nil {
+			revokedAt = device.RevokedAt
+			return ErrDeviceRevoked
+		}
 		identity, err = tx.IdentityKeys().GetByDevice(ctx, deviceID)
 		if err != nil {
 			if errors.Is(err, store.ErrRecordNotFound) {
@@ -107,11 +150,23 @@ func (s *Service) GetPreKeyBundle(ctx context.Context, deviceID uuid.UUID) (dto.
 			return err
 		}
 		otk, err = tx.OneTimePreKeys().ConsumeNext(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+		kem, err = tx.KEMPreKeys().GetByDevice(ctx, deviceID)
+		if err != nil || kem == nil {
+			return err
+		}
+		kemOTK, err = tx.OneTimeKEMPreKeys().ConsumeNext(ctx, deviceID)
 		return err
 	})
 	if err != nil {
-		if errors.Is(err, ErrDeviceNotFound) {
+		switch {
+		case errors.Is(err, ErrDeviceNotFound):
 			return dto.PreKeyBundleResponse{}, ErrDeviceNotFound
+		case errors.Is(err, ErrDeviceRevoked):
+			// Callers still get the tombstone so they can tell senders why.
+			return dto.PreKeyBundleResponse{DeviceID: deviceID.String(), Revoked: true, RevokedAt: revokedAt}, ErrDeviceRevoked
 		}
 		return dto.PreKeyBundleResponse{}, err
 	}
@@ -120,7 +175,7 @@ func (s *Service) GetPreKeyBundle(ctx context.Context, deviceID uuid.UUID) (dto.
 		DeviceID:             deviceID.String(),
 		IdentityKey:          identity.PublicKey,
 		IdentitySignatureKey: identity.SignatureKey,
-		SignedPreKey: dto.SignedPreKey{
+		SignedPreKey: &dto.SignedPreKey{
 			PublicKey: signed.PublicKey,
 			Signature: signed.Signature,
 			CreatedAt: signed.CreatedAt,
@@ -132,6 +187,12 @@ func (s *Service) GetPreKeyBundle(ctx context.Context, deviceID uuid.UUID) (dto.
 			PublicKey: otk.PublicKey,
 		}
 	}
+	if kem != nil {
+		resp.KEMPreKey = kemPreKeyDTO(kem.KeyID, kem.PublicKey, kem.Signature)
+	}
+	if kemOTK != nil {
+		resp.OneTimeKEMPreKey = kemPreKeyDTO(kemOTK.KeyID, kemOTK.PublicKey, kemOTK.Signature)
+	}
 	return resp, nil
 }
 
@@ -160,18 +221,42 @@ func (s *Service) RotateSignedPreKey(ctx context.Context, req dto.RotateSignedPr
 		}
 		otks = append(otks, domain.OneTimePrekey{ID: id, DeviceID: deviceID, PublicKey: k.PublicKey})
 	}
+	kemLast, kemOTKs, err := kemPreKeys(deviceID, req.KEMPreKey, req.OneTimeKEMPreKeys, createdAt)
+	if err != nil {
+		return dto.RotateSignedPreKeyResponse{}, err
+	}
 
 	err = s.store.WithTx(ctx, func(tx *store.Store) error {
-		if _, err := tx.Devices().Get(ctx, deviceID); err != nil {
+		device, err := tx.Devices().Get(ctx, deviceID)
+		if err != nil {
 			if errors.Is(err, store.ErrRecordNotFound) {
 				return ErrDeviceNotFound
 			}
 			return err
 		}
+		if device.RevokedAt != nil {
+			return ErrDeviceRevoked
+		}
 		if err := tx.SignedPreKeys().Upsert(ctx, domain.SignedPreKey{DeviceID: deviceID, PublicKey: req.SignedPreKey.PublicKey, Signature: req.SignedPreKey.Signature, CreatedAt: createdAt}); err != nil {
 			return err
 		}
-		return tx.OneTimePreKeys().AddBatch(ctx, otks)
+		if err := tx.OneTimePreKeys().AddBatch(ctx, otks); err != nil {
+			return err
+		}
+		if kemLast != nil {
+			if err := tx.KEMPreKeys().Upsert(ctx, *kemLast); err != nil {
+				return err
+			}
+		}
+		if err := tx.OneTimeKEMPreKeys().AddBatch(ctx, kemOTKs); err != nil {
+			return err
+		}
+		return tx.Outbox().Append(ctx, events.SignedPreKeyRotated{
+			DeviceID:            deviceID.String(),
+			AddedOneTimeKeys:    len(otks),
+			AddedOneTimeKEMKeys: len(kemOTKs),
+			At:                  time.Now().UTC(),
+		})
 	})
 	if err != nil {
 		if errors.Is(err, ErrDeviceNotFound) {
@@ -187,7 +272,8 @@ func (s *Service) RotateSignedPreKey(ctx context.Context, req dto.RotateSignedPr
 			Signature: req.SignedPreKey.Signature,
 			CreatedAt: createdAt,
 		},
-		AddedOneTimeKeys: len(otks),
+		AddedOneTimeKeys:    len(otks),
+		AddedOneTimeKEMKeys: len(kemOTKs),
 	}, nil
 }
 
@@ -231,6 +317,12 @@ func (s *Service) DeleteUserData(ctx context.Context, userID uuid.UUID) (map[str
 		if err := count("oneTimePrekeys", db.Table("one_time_prekeys").Joins("JOIN devices ON devices.id = one_time_prekeys.device_id").Where("devices.user_id = ?", userID)); err != nil {
 			return err
 		}
+		if err := count("kemPreKeys", db.Table("kem_pre_keys").Joins("JOIN devices ON devices.id = kem_pre_keys.device_id").Where("devices.user_id = ?", userID)); err != nil {
+			return err
+		}
+		if err := count("oneTimeKemPrekeys", db.Table("one_time_kem_prekeys").Joins("JOIN devices ON devices.id = one_time_kem_prekeys.device_id").Where("devices.user_id = ?", userID)); err != nil {
+			return err
+		}
 
 		return db.Where("id = ?", userID).Delete(&domain.User{}).Error
 	})
@@ -2,17 +2,22 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
 	"keys/internal/domain"
 	"keys/internal/dto"
+	"keys/internal/events"
 	"keys/internal/service"
 	"keys/internal/store"
 
 	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"eventbus"
 )
 
 func setupService(t *testing.T) (*service.Service, *gorm.DB) {
@@ -23,7 +28,7 @@ func setupService(t *testing.T) (*service.Service, *gorm.DB) {
 		t.Fatalf("open sqlite: %v", err)
 	}
 
-	if err := db.AutoMigrate(&domain.User{}, &domain.Device{}, &domain.IdentityKey{}, &domain.SignedPreKey{}, &domain.OneTimePrekey{}); err != nil {
+	if err := db.AutoMigrate(&domain.User{}, &domain.Device{}, &domain.IdentityKey{}, &domain.SignedPreKey{}, &domain.OneTimePrekey{}, &domain.KEMPreKey{}, &domain.OneTimeKEMPrekey{}, &eventbus.OutboxEvent{}); err != nil {
 		t.Fatalf("automigrate: %v", err)
 	}
 
@@ -169,3 +174,271 @@ func TestRotateSignedPreKey(t *testing.T) {
 		t.Fatalf("expected a single active signed prekey, got %d", signedCount)
 	}
 }
+
+func TestKEMPreKeysAreServedOneTimeFirst(t *testing.T) {
+	svc, _ := setupService(t)
+	ctx := context.Background()
+
+	deviceID := uuid.New()
+	resp, err := svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		UserID:               uuid.New().String(),
+		DeviceID:             deviceID.String(),
+		IdentityKey:          "identity-pq",
+		IdentitySignatureKey: "identity-sig-pq",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-pq", Signature: "sig-pq"},
+		KEMPreKey:            &dto.KEMPreKey{ID: 1, PublicKey: "kem-last", Signature: "kem-last-sig"},
+		OneTimeKEMPreKeys: []dto.KEMPreKey{
+			{ID: 2, PublicKey: "kem-otk-2", Signature: "kem-otk-2-sig"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if resp.OneTimeKEMPreKeys != 1 {
+		t.Fatalf("expected 1 one-time KEM prekey recorded, got %d", resp.OneTimeKEMPreKeys)
+	}
+
+	first, err := svc.GetPreKeyBundle(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("bundle1: %v", err)
+	}
+	if first.OneTimeKEMPreKey == nil || first.OneTimeKEMPreKey.ID != 2 || first.OneTimeKEMPreKey.Signature != "kem-otk-2-sig" {
+		t.Fatalf("expected one-time KEM prekey 2, got %+v", first.OneTimeKEMPreKey)
+	}
+	if first.KEMPreKey == nil || first.KEMPreKey.ID != 1 {
+		t.Fatalf("expected last-resort KEM prekey 1, got %+v", first.KEMPreKey)
+	}
+
+	second, err := svc.GetPreKeyBundle(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("bundle2: %v", err)
+	}
+	if second.OneTimeKEMPreKey != nil {
+		t.Fatalf("expected one-time KEM prekeys to be exhausted, got %+v", second.OneTimeKEMPreKey)
+	}
+	if second.KEMPreKey == nil || second.KEMPreKey.PublicKey != "kem-last" {
+		t.Fatalf("expected last-resort KEM prekey to keep being served, got %+v", second.KEMPreKey)
+	}
+
+	rot, err := svc.RotateSignedPreKey(ctx, dto.RotateSignedPreKeyRequest{
+		DeviceID:          deviceID.String(),
+		SignedPreKey:      dto.SignedPreKey{PublicKey: "signed-pq-2", Signature: "sig-pq-2"},
+		OneTimeKEMPreKeys: []dto.KEMPreKey{{ID: 3, PublicKey: "kem-otk-3", Signature: "kem-otk-3-sig"}},
+	})
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if rot.AddedOneTimeKEMKeys != 1 {
+		t.Fatalf("expected 1 added one-time KEM prekey, got %d", rot.AddedOneTimeKEMKeys)
+	}
+	third, err := svc.GetPreKeyBundle(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("bundle3: %v", err)
+	}
+	if third.KEMPreKey == nil || third.KEMPreKey.ID != 1 || third.OneTimeKEMPreKey == nil || third.OneTimeKEMPreKey.ID != 3 {
+		t.Fatalf("rotation without a KEM prekey must keep the last-resort key, got %+v / %+v", third.KEMPreKey, third.OneTimeKEMPreKey)
+	}
+
+	_, err = svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		DeviceID:             uuid.New().String(),
+		IdentityKey:          "identity-bad",
+		IdentitySignatureKey: "identity-sig-bad",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-bad", Signature: "sig-bad"},
+		KEMPreKey:            &dto.KEMPreKey{ID: 1, PublicKey: "kem-unsigned"},
+	})
+	if !errors.Is(err, service.ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest for unsigned KEM prekey, got %v", err)
+	}
+}
+
+func TestDeviceRevokedEventDropsUnconsumedPrekeys(t *testing.T) {
+	svc, db := setupService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	deviceID := uuid.New()
+	_, err := svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		UserID:               userID.String(),
+		DeviceID:             deviceID.String(),
+		IdentityKey:          "identity-revoked",
+		IdentitySignatureKey: "identity-sig-revoked",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-revoked", Signature: "sig-revoked"},
+		OneTimePreKeys: []dto.OneTimePreKey{
+			{ID: uuid.New().String(), PublicKey: "otk-a"},
+			{ID: uuid.New().String(), PublicKey: "otk-b"},
+			{ID: uuid.New().String(), PublicKey: "otk-c"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := svc.GetPreKeyBundle(ctx, deviceID); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+
+	bus := eventbus.NewInProcess()
+	if err := svc.Subscribe(bus); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	env, err := eventbus.NewEnvelope("auth", authDeviceRevoked{DeviceID: deviceID.String(), UserID: userID.String(), At: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("envelope: %v", err)
+	}
+	// The relay can publish an event twice, so the handler must tolerate duplicates.
+	for i := 0; i < 2; i++ {
+		if err := bus.Publish(ctx, env); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	var unconsumed, consumed int64
+	db.Model(&domain.OneTimePrekey{}).Where("device_id = ? AND consumed_at IS NULL", deviceID).Count(&unconsumed)
+	db.Model(&domain.OneTimePrekey{}).Where("device_id = ? AND consumed_at IS NOT NULL", deviceID).Count(&consumed)
+	if unconsumed != 0 || consumed != 1 {
+		t.Fatalf("expected only the consumed prekey to remain, got unconsumed=%d consumed=%d", unconsumed, consumed)
+	}
+
+	var dropped []eventbus.OutboxEvent
+	if err := db.Where("type = ? AND payload LIKE ?", events.TypePreKeysDropped, "%"+deviceID.String()+"%").Find(&dropped).Error; err != nil {
+		t.Fatalf("load outbox: %v", err)
+	}
+	if len(dropped) != 1 {
+		t.Fatalf("expected one prekeys dropped event, got %d", len(dropped))
+	}
+
+	bundle, err := svc.GetPreKeyBundle(ctx, deviceID)
+	if !errors.Is(err, service.ErrDeviceRevoked) {
+		t.Fatalf("expected ErrDeviceRevoked for revoked bundle, got %v", err)
+	}
+	if !bundle.Revoked || bundle.RevokedAt == nil || bundle.IdentityKey != "" || bundle.SignedPreKey != nil {
+		t.Fatalf("expected a tombstone without key material, got %+v", bundle)
+	}
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("marshal tombstone: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatalf("decode tombstone: %v", err)
+	}
+	if _, ok := fields["signedPreKey"]; ok {
+		t.Fatalf("expected no signedPreKey in the tombstone body, got %s", body)
+	}
+	_, err = svc.RotateSignedPreKey(ctx, dto.RotateSignedPreKeyRequest{
+		DeviceID:     deviceID.String(),
+		SignedPreKey: dto.SignedPreKey{PublicKey: "signed-late", Signature: "sig-late"},
+	})
+	if !errors.Is(err, service.ErrDeviceRevoked) {
+		t.Fatalf("expected ErrDeviceRevoked on rotate, got %v", err)
+	}
+}
+
+func TestExportUserDataListsPublicKeysAndCounts(t *testing.T) {
+	svc, _ := setupService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	deviceID := uuid.New()
+	_, err := svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		UserID:               userID.String(),
+		DeviceID:             deviceID.String(),
+		IdentityKey:          "identity-export",
+		IdentitySignatureKey: "identity-sig-export",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-export", Signature: "sig-export"},
+		OneTimePreKeys: []dto.OneTimePreKey{
+			{ID: uuid.New().String(), PublicKey: "otk-x"},
+			{ID: uuid.New().String(), PublicKey: "otk-y"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := svc.GetPreKeyBundle(ctx, deviceID); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+
+	export, err := svc.ExportUserData(ctx, userID)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(export.Devices) != 1 {
+		t.Fatalf("expected one device in export, got %d", len(export.Devices))
+	}
+	dev := export.Devices[0]
+	if dev.DeviceID != deviceID.String() || dev.IdentityKey != "identity-export" || dev.SignedPreKey == nil || dev.SignedPreKey.PublicKey != "signed-export" {
+		t.Fatalf("unexpected device export: %+v", dev)
+	}
+	if dev.OneTimePreKeys.Available != 1 || dev.OneTimePreKeys.Consumed != 1 {
+		t.Fatalf("expected one available and one consumed prekey, got %+v", dev.OneTimePreKeys)
+	}
+}
+
+func TestRevokeUnknownDeviceBlocksRegistration(t *testing.T) {
+	svc, _ := setupService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	deviceID := uuid.New()
+	if _, err := svc.RevokeDevice(ctx, deviceID, userID, time.Now().UTC(), "device_revoked"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	_, err := svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		UserID:               userID.String(),
+		DeviceID:             deviceID.String(),
+		IdentityKey:          "identity-late",
+		IdentitySignatureKey: "identity-sig-late",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-late", Signature: "sig-late"},
+	})
+	if !errors.Is(err, service.ErrDeviceRevoked) {
+		t.Fatalf("expected ErrDeviceRevoked on register, got %v", err)
+	}
+}
+
+func TestReconcileRevocationRepairsMissedEvent(t *testing.T) {
+	svc, _ := setupService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	deviceID := uuid.New()
+	_, err := svc.RegisterDevice(ctx, dto.RegisterDeviceRequest{
+		UserID:               userID.String(),
+		DeviceID:             deviceID.String(),
+		IdentityKey:          "identity-missed",
+		IdentitySignatureKey: "identity-sig-missed",
+		SignedPreKey:         dto.SignedPreKey{PublicKey: "signed-missed", Signature: "sig-missed"},
+		OneTimePreKeys:       []dto.OneTimePreKey{{ID: uuid.New().String(), PublicKey: "otk-missed"}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	// auth revoked the device but the event never arrived.
+	repaired, err := svc.ReconcileRevocation(ctx, deviceID, userID, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if !repaired {
+		t.Fatalf("expected the missed revocation to be repaired")
+	}
+	if _, err := svc.GetPreKeyBundle(ctx, deviceID); !errors.Is(err, service.ErrDeviceRevoked) {
+		t.Fatalf("expected ErrDeviceRevoked after reconcile, got %v", err)
+	}
+
+	repaired, err = svc.ReconcileRevocation(ctx, deviceID, userID, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("reconcile again: %v", err)
+	}
+	if repaired {
+		t.Fatalf("expected an already revoked device to be skipped")
+	}
+
+	unknown := uuid.New()
+	if repaired, err := svc.ReconcileRevocation(ctx, unknown, userID, time.Now().UTC()); err != nil || !repaired {
+		t.Fatalf("expected an unknown device to be tombstoned, repaired=%v err=%v", repaired, err)
+	}
+}
+
+type authDeviceRevoked events.AuthDeviceRevoked
+
+func (authDeviceRevoked) EventType() string { return events.TypeAuthDeviceRevoked }
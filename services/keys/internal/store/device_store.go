@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"keys/internal/domain"
 
@@ -33,3 +34,13 @@ func (d *DeviceStore) Get(ctx context.Context, id uuid.UUID) (*domain.Device, er
 	}
 	return &device, nil
 }
+
+// Revoke tombstones the device. It reports false when the device was already
+// revoked (or does not exist) so repeated revocations keep the first timestamp.
+func (d *DeviceStore) Revoke(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	res := d.db.WithContext(ctx).
+		Model(&domain.Device{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"keys/internal/domain"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KEMPreKeyStore struct{ db *gorm.DB }
+
+func (s *Store) KEMPreKeys() *KEMPreKeyStore { return &KEMPreKeyStore{db: s.DB} }
+
+func (k *KEMPreKeyStore) Upsert(ctx context.Context, key domain.KEMPreKey) error {
+	return k.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "device_id"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"key_id":     key.KeyID,
+				"public_key": key.PublicKey,
+				"signature":  key.Signature,
+				"created_at": key.CreatedAt,
+			}),
+		}).
+		Create(&key).Error
+}
+
+// GetByDevice returns nil without an error for classic-only devices.
+func (k *KEMPreKeyStore) GetByDevice(ctx context.Context, deviceID uuid.UUID) (*domain.KEMPreKey, error) {
+	var key domain.KEMPreKey
+	if err := k.db.WithContext(ctx).First(&key, "device_id = ?", deviceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+type OneTimeKEMPreKeyStore struct{ db *gorm.DB }
+
+func (s *Store) OneTimeKEMPreKeys() *OneTimeKEMPreKeyStore {
+	return &OneTimeKEMPreKeyStore{db: s.DB}
+}
+
+func (o *OneTimeKEMPreKeyStore) AddBatch(ctx context.Context, keys []domain.OneTimeKEMPrekey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return o.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&keys).Error
+}
+
+func (o *OneTimeKEMPreKeyStore) ConsumeNext(ctx context.Context, deviceID uuid.UUID) (*domain.OneTimeKEMPrekey, error) {
+	var key domain.OneTimeKEMPrekey
+	tx := o.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("device_id = ? AND consumed_at IS NULL", deviceID).
+		Order("created_at ASC, key_id ASC")
+	if err := tx.First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := o.db.WithContext(ctx).Model(&domain.OneTimeKEMPrekey{}).
+		Where("id = ?", key.ID).
+		Update("consumed_at", now).Error; err != nil {
+		return nil, err
+	}
+	key.ConsumedAt = &now
+	return &key, nil
+}
+
+// DeleteUnconsumed removes every one-time KEM prekey of the device that has
+// not been handed out yet.
+func (o *OneTimeKEMPreKeyStore) DeleteUnconsumed(ctx context.Context, deviceID uuid.UUID) (int64, error) {
+	res := o.db.WithContext(ctx).
+		Where("device_id = ? AND consumed_at IS NULL", deviceID).
+		Delete(&domain.OneTimeKEMPrekey{})
+	return res.RowsAffected, res.Error
+}
@@ -45,3 +45,12 @@ func (o *OneTimePreKeyStore) ConsumeNext(ctx context.Context, deviceID uuid.UUID
 	key.ConsumedAt = &now
 	return &key, nil
 }
+
+// DeleteUnconsumed removes every one-time prekey of the device that has not
+// been handed out yet.
+func (o *OneTimePreKeyStore) DeleteUnconsumed(ctx context.Context, deviceID uuid.UUID) (int64, error) {
+	res := o.db.WithContext(ctx).
+		Where("device_id = ? AND consumed_at IS NULL", deviceID).
+		Delete(&domain.OneTimePrekey{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"eventbus"
+)
+
+// eventSource names keys in every envelope it emits.
+const eventSource = "keys"
+
+type OutboxStore struct{ db *gorm.DB }
+
+func (s *Store) Outbox() *OutboxStore { return &OutboxStore{db: s.DB} }
+
+// Append records evt for the relay as part of the current transaction.
+func (o *OutboxStore) Append(ctx context.Context, evt eventbus.Event) error {
+	return eventbus.Append(ctx, o.db, eventSource, evt)
+}
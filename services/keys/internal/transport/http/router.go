@@ -8,14 +8,15 @@ import (
 	"strings"
 	"time"
 
-	"keys/internal/auth"
 	"keys/internal/dto"
 	"keys/internal/observability/metrics"
-	"keys/internal/observability/middleware"
 	"keys/internal/service"
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"identity/verifier"
+	"observability/middleware"
 )
 
 func extractToken(r *http.Request) string {
@@ -29,32 +30,36 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
+func NewRouter(svc *service.Service, authClient *verifier.Client) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	requireAuth := func(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID) (auth.Claims, bool) {
+	requireAuth := func(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID) (verifier.Claims, bool) {
 		if authClient == nil {
 			http.Error(w, "authorization not configured", http.StatusInternalServerError)
-			return auth.Claims{}, false
+			return verifier.Claims{}, false
 		}
-		token := extractToken(r)
-		if token == "" {
+		claims, err := authClient.Authenticate(r, extractToken(r), deviceID)
+		if errors.Is(err, verifier.ErrMissingToken) {
 			http.Error(w, "missing bearer token", http.StatusUnauthorized)
-			return auth.Claims{}, false
+			return verifier.Claims{}, false
+		}
+		if errors.Is(err, verifier.ErrUnavailable) {
+			w.Header().Set("Retry-After", "10")
+			http.Error(w, "authorization unavailable", http.StatusServiceUnavailable)
+			return verifier.Claims{}, false
 		}
-		claims, err := authClient.Verify(r.Context(), token, deviceID)
 		if err != nil {
 			slog.Warn("auth verification failed", "error", err)
 			http.Error(w, "authorization failed", http.StatusUnauthorized)
-			return auth.Claims{}, false
+			return verifier.Claims{}, false
 		}
 		if !claims.Valid {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
-			return auth.Claims{}, false
+			return verifier.Claims{}, false
 		}
 		if deviceID != uuid.Nil && !claims.DeviceAuthorized {
 			http.Error(w, "device not authorized for user", http.StatusForbidden)
-			return auth.Claims{}, false
+			return verifier.Claims{}, false
 		}
 		return claims, true
 	}
@@ -103,8 +108,11 @@ func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
 		res, err := svc.RegisterDevice(r.Context(), req)
 		if err != nil {
 			status := http.StatusInternalServerError
-			if errors.Is(err, service.ErrInvalidRequest) {
+			switch {
+			case errors.Is(err, service.ErrInvalidRequest):
 				status = http.StatusBadRequest
+			case errors.Is(err, service.ErrDeviceRevoked):
+				status = http.StatusConflict
 			}
 			http.Error(w, err.Error(), status)
 			metrics.DeviceRegistrationsTotal.WithLabelValues("failure").Inc()
@@ -141,6 +149,12 @@ func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
 			return
 		}
 		res, err := svc.GetPreKeyBundle(r.Context(), deviceID)
+		if errors.Is(err, service.ErrDeviceRevoked) {
+			metrics.PreKeyBundlesFetchedTotal.WithLabelValues("revoked").Inc()
+			slog.Info("prekey bundle requested for revoked device", "device_id", deviceID, "request_id", reqID, "trace_id", traceID)
+			writeJSON(w, http.StatusGone, res)
+			return
+		}
 		if err != nil {
 			status := http.StatusInternalServerError
 			if errors.Is(err, service.ErrDeviceNotFound) {
@@ -152,7 +166,7 @@ func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
 			return
 		}
 		metrics.PreKeyBundlesFetchedTotal.WithLabelValues("success").Inc()
-		slog.Info("prekey bundle fetched", "device_id", res.DeviceID, "has_one_time", res.OneTimePreKey != nil, "request_id", reqID, "trace_id", traceID)
+		slog.Info("prekey bundle fetched", "device_id", res.DeviceID, "has_one_time", res.OneTimePreKey != nil, "has_kem", res.KEMPreKey != nil, "request_id", reqID, "trace_id", traceID)
 		writeJSON(w, http.StatusOK, res)
 	})
 
@@ -188,6 +202,8 @@ func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
 				status = http.StatusBadRequest
 			case errors.Is(err, service.ErrDeviceNotFound):
 				status = http.StatusNotFound
+			case errors.Is(err, service.ErrDeviceRevoked):
+				status = http.StatusConflict
 			}
 			http.Error(w, err.Error(), status)
 			metrics.SignedPreKeysRotatedTotal.WithLabelValues("failure").Inc()
@@ -225,6 +241,27 @@ func NewRouter(svc *service.Service, authClient *auth.Client) *http.ServeMux {
 		writeJSON(w, http.StatusOK, resp)
 	})
 
+	mux.HandleFunc("/keys/me/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		reqID := middleware.RequestIDFromContext(r.Context())
+		traceID := middleware.TraceIDFromContext(r.Context())
+		claims, ok := requireAuth(w, r, uuid.Nil)
+		if !ok {
+			return
+		}
+		res, err := svc.ExportUserData(r.Context(), claims.UserID)
+		if err != nil {
+			slog.Error("key export failed", "error", err, "user_id", claims.UserID, "request_id", reqID, "trace_id", traceID)
+			http.Error(w, "export failed", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("key material exported", "user_id", claims.UserID, "devices", len(res.Devices), "request_id", reqID, "trace_id", traceID)
+		writeJSON(w, http.StatusOK, res)
+	})
+
 	return mux
 }
 
@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS revoked_at timestamptz;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS one_time_kem_prekeys;
+DROP TABLE IF EXISTS kem_pre_keys;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS kem_pre_keys (
+  device_id uuid PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+  key_id bigint NOT NULL,
+  public_key text NOT NULL,
+  signature text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS one_time_kem_prekeys (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  device_id uuid NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  key_id bigint NOT NULL,
+  public_key text NOT NULL,
+  signature text NOT NULL,
+  consumed_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (device_id, key_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_one_time_kem_prekeys_device_consumed
+  ON one_time_kem_prekeys (device_id)
+  WHERE consumed_at IS NULL;
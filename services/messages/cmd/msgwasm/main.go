@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"syscall/js"
+	"time"
 
 	"github.com/google/uuid"
 
+	cryptocore "cryptocore"
 	"messages/pkg/msgclient"
 )
 
@@ -17,6 +19,8 @@ func main() {
 	js.Global().Set("msgClientInit", js.FuncOf(initDevice))
 	js.Global().Set("msgClientPrepareSend", js.FuncOf(prepareSend))
 	js.Global().Set("msgClientHandleEnvelope", js.FuncOf(handleEnvelope))
+	js.Global().Set("msgClientPrepareReadReceipt", js.FuncOf(prepareReadReceipt))
+	js.Global().Set("msgClientConfigure", js.FuncOf(configure))
 	js.Global().Set("msgClientStateInfo", js.FuncOf(stateInfo))
 	select {}
 }
@@ -34,6 +38,9 @@ func initDevice(this js.Value, args []js.Value) any {
 			UserID:          opts.Get("userID").String(),
 			DeviceID:        opts.Get("deviceID").String(),
 		}
+		if padding := opts.Get("padding"); padding.Type() == js.TypeString {
+			cfg.Padding = padding.String()
+		}
 		state, resp, err := msgclient.RegisterDevice(context.Background(), cfg)
 		if err != nil {
 			reject.Invoke(err.Error())
@@ -50,6 +57,7 @@ func initDevice(this js.Value, args []js.Value) any {
 			"deviceId":       resp.DeviceID,
 			"keysUrl":        state.KeysBaseURL(),
 			"messagesUrl":    state.MessagesBaseURL(),
+			"padding":        state.Padding().String(),
 			"oneTimePrekeys": resp.OneTimePreKeys,
 		}
 		resolve.Invoke(js.ValueOf(out))
@@ -66,7 +74,20 @@ func prepareSend(this js.Value, args []js.Value) any {
 		stateStr := input.Get("state").String()
 		convIDStr := input.Get("convId").String()
 		toIDStr := input.Get("toDeviceId").String()
-		plaintext := input.Get("plaintext").String()
+		payload := msgclient.Payload{
+			Type: msgclient.ContentText,
+			ID:   uuid.NewString(),
+			Body: input.Get("plaintext").String(),
+		}
+		if t := input.Get("type"); t.Type() == js.TypeString && t.String() != "" {
+			payload.Type = t.String()
+		}
+		if reply := input.Get("replyTo"); reply.Type() == js.TypeObject {
+			payload.ReplyTo = &msgclient.Quote{ID: reply.Get("id").String()}
+			if body := reply.Get("body"); body.Type() == js.TypeString {
+				payload.ReplyTo.Body = body.String()
+			}
+		}
 
 		state, err := msgclient.LoadStateFromJSON([]byte(stateStr))
 		if err != nil {
@@ -83,7 +104,16 @@ func prepareSend(this js.Value, args []js.Value) any {
 			reject.Invoke(fmt.Sprintf("invalid recipient id: %v", err))
 			return
 		}
-		req, err := state.PrepareSend(convID, toID, plaintext)
+		// A padding scheme given here becomes the state's setting.
+		if padding := input.Get("padding"); padding.Type() == js.TypeString && padding.String() != "" {
+			scheme, err := cryptocore.ParsePaddingScheme(padding.String())
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			state.SetPadding(scheme)
+		}
+		req, err := state.PreparePayload(convID, toID, payload)
 		if err != nil {
 			reject.Invoke(err.Error())
 			return
@@ -93,19 +123,15 @@ func prepareSend(this js.Value, args []js.Value) any {
 			reject.Invoke(err.Error())
 			return
 		}
-		body, err := json.Marshal(req)
+		request, err := toJSValue(req)
 		if err != nil {
 			reject.Invoke(err.Error())
 			return
 		}
-		var payload map[string]any
-		if err := json.Unmarshal(body, &payload); err != nil {
-			reject.Invoke(err.Error())
-			return
-		}
 		out := map[string]any{
-			"state":   string(stateJSON),
-			"request": payload,
+			"state":     string(stateJSON),
+			"request":   request,
+			"messageId": payload.ID,
 		}
 		resolve.Invoke(js.ValueOf(out))
 	})
@@ -131,9 +157,9 @@ func handleEnvelope(this js.Value, args []js.Value) any {
 			reject.Invoke(err.Error())
 			return
 		}
-		plaintext, err := state.HandleEnvelope(&env)
-		if err != nil {
-			reject.Invoke(err.Error())
+		in, handleErr := state.HandleEnvelope(&env)
+		if handleErr != nil && in == nil && !msgclient.IsSessionFailure(handleErr) {
+			reject.Invoke(handleErr.Error())
 			return
 		}
 		stateJSON, err := state.Marshal()
@@ -141,14 +167,152 @@ func handleEnvelope(this js.Value, args []js.Value) any {
 			reject.Invoke(err.Error())
 			return
 		}
+		// Session failures resolve so the caller stores the failure count;
+		// requests carries reset and resend messages to post.
 		out := map[string]any{
 			"state":     string(stateJSON),
-			"plaintext": plaintext,
+			"plaintext": "",
+			"notice":    "",
+			"requests":  []any{},
+		}
+		if in != nil {
+			requests, err := toJSValues(in.Outgoing)
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			out["plaintext"], out["notice"], out["requests"] = in.Plaintext, in.Notice, requests
+			if in.Payload != nil {
+				message, err := toJSValue(in.Payload)
+				if err != nil {
+					reject.Invoke(err.Error())
+					return
+				}
+				out["message"] = message
+			}
+			if in.Receipt != nil {
+				receipt, err := toJSValue(in.Receipt)
+				if err != nil {
+					reject.Invoke(err.Error())
+					return
+				}
+				out["receipt"] = receipt
+			}
+			if in.ExpiresAt != nil {
+				out["expiresAt"] = in.ExpiresAt.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		if handleErr != nil {
+			out["error"] = handleErr.Error()
+		}
+		resolve.Invoke(js.ValueOf(out))
+	})
+}
+
+// prepareReadReceipt resolves with a null request when the state has read
+// receipts turned off.
+func prepareReadReceipt(this js.Value, args []js.Value) any {
+	return async(func(resolve, reject js.Value) {
+		if len(args) < 1 {
+			reject.Invoke("missing arguments")
+			return
+		}
+		input := args[0]
+		state, err := msgclient.LoadStateFromJSON([]byte(input.Get("state").String()))
+		if err != nil {
+			reject.Invoke(err.Error())
+			return
+		}
+		convID, err := uuid.Parse(input.Get("convId").String())
+		if err != nil {
+			reject.Invoke(fmt.Sprintf("invalid conversation id: %v", err))
+			return
+		}
+		toID, err := uuid.Parse(input.Get("toDeviceId").String())
+		if err != nil {
+			reject.Invoke(fmt.Sprintf("invalid recipient id: %v", err))
+			return
+		}
+		var ids []string
+		if list := input.Get("ids"); list.Type() == js.TypeObject {
+			for i := 0; i < list.Length(); i++ {
+				ids = append(ids, list.Index(i).String())
+			}
+		}
+		req, err := state.PrepareReadReceipt(convID, toID, ids)
+		if err != nil {
+			reject.Invoke(err.Error())
+			return
+		}
+		stateJSON, err := state.Marshal()
+		if err != nil {
+			reject.Invoke(err.Error())
+			return
+		}
+		out := map[string]any{"state": string(stateJSON), "request": nil}
+		if req != nil {
+			request, err := toJSValue(req)
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			out["request"] = request
 		}
 		resolve.Invoke(js.ValueOf(out))
 	})
 }
 
+// configure changes the state's privacy settings; options left out keep
+// their value.
+func configure(this js.Value, args []js.Value) any {
+	return async(func(resolve, reject js.Value) {
+		if len(args) < 1 {
+			reject.Invoke("missing arguments")
+			return
+		}
+		input := args[0]
+		state, err := msgclient.LoadStateFromJSON([]byte(input.Get("state").String()))
+		if err != nil {
+			reject.Invoke(err.Error())
+			return
+		}
+		if on := input.Get("readReceipts"); on.Type() == js.TypeBoolean {
+			state.SetReadReceipts(on.Bool())
+		}
+		if padding := input.Get("padding"); padding.Type() == js.TypeString && padding.String() != "" {
+			scheme, err := cryptocore.ParsePaddingScheme(padding.String())
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			state.SetPadding(scheme)
+		}
+		// timerSeconds sets the disappearing-message timer of convId.
+		if secs := input.Get("timerSeconds"); secs.Type() == js.TypeNumber {
+			convID, err := uuid.Parse(input.Get("convId").String())
+			if err != nil {
+				reject.Invoke(fmt.Sprintf("invalid conversation id: %v", err))
+				return
+			}
+			n := secs.Float()
+			if n < 0 || n > msgclient.MaxTimer.Seconds() {
+				reject.Invoke("timerSeconds out of range")
+				return
+			}
+			if err := state.SetTimer(convID, time.Duration(n)*time.Second); err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+		}
+		stateJSON, err := state.Marshal()
+		if err != nil {
+			reject.Invoke(err.Error())
+			return
+		}
+		resolve.Invoke(js.ValueOf(map[string]any{"state": string(stateJSON)}))
+	})
+}
+
 func stateInfo(this js.Value, args []js.Value) any {
 	if len(args) == 0 {
 		return nil
@@ -159,14 +323,46 @@ func stateInfo(this js.Value, args []js.Value) any {
 		return js.Null()
 	}
 	info := map[string]any{
-		"userId":      state.UserID(),
-		"deviceId":    state.DeviceID(),
-		"keysUrl":     state.KeysBaseURL(),
-		"messagesUrl": state.MessagesBaseURL(),
+		"userId":       state.UserID(),
+		"deviceId":     state.DeviceID(),
+		"keysUrl":      state.KeysBaseURL(),
+		"messagesUrl":  state.MessagesBaseURL(),
+		"padding":      state.Padding().String(),
+		"readReceipts": state.ReadReceipts(),
 	}
+	timers := map[string]any{}
+	for id, d := range state.Timers() {
+		timers[id] = int(d / time.Second)
+	}
+	info["timers"] = timers
 	return js.ValueOf(info)
 }
 
+// toJSValue round-trips v through JSON into the plain maps js.ValueOf accepts.
+func toJSValue(v any) (any, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func toJSValues[T any](items []T) ([]any, error) {
+	out := make([]any, 0, len(items))
+	for _, item := range items {
+		v, err := toJSValue(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
 func async(fn func(resolve, reject js.Value)) js.Value {
 	promise := js.Global().Get("Promise")
 	handler := js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"eventbus"
 )
 
 type Config struct {
@@ -13,6 +15,37 @@ type Config struct {
 	WSPollInterval   time.Duration
 	DeliveryBatchMax int
 	AuthBaseURL      string
+	// IdentityKey verifies identity headers signed by the gateway. When
+	// empty every request is verified with auth.
+	IdentityKey string
+	// RevocationSyncInterval is how often auth's revoked-device list is
+	// checked for revocations the event bus did not deliver. It needs
+	// IdentityKey.
+	RevocationSyncInterval time.Duration
+
+	EventBus           eventbus.Config
+	OutboxPollInterval time.Duration
+
+	// PendingMetricsInterval is how often the pending-message gauges are
+	// refreshed from the database.
+	PendingMetricsInterval time.Duration
+	// ReapInterval is how often expired disappearing messages are deleted.
+	ReapInterval time.Duration
+
+	// EphemeralPerSecond and EphemeralBurst bound how many ephemeral frames,
+	// such as typing indicators, one device may relay.
+	EphemeralPerSecond int
+	EphemeralBurst     int
+	// EphemeralFanOut carries ephemeral frames between instances. It uses
+	// the event bus servers without a queue group, on its own channel, so
+	// every replica sees every frame and other services see none.
+	EphemeralFanOut eventbus.Config
+
+	// ShutdownDelay is how long /readyz fails before the listener closes;
+	// ShutdownTimeout bounds the wait for in-flight requests and WebSockets
+	// after that.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
 }
 
 func Load() Config {
@@ -32,6 +65,33 @@ func Load() Config {
 		// Default to service DNS name for containerized deploys; override to
 		// http://localhost:8081 when running locally without Docker.
 		AuthBaseURL: envOr("AUTH_BASE_URL", "http://auth:8081"),
+		IdentityKey: os.Getenv("INTERNAL_IDENTITY_KEY"),
+
+		RevocationSyncInterval: envDuration("MESSAGES_REVOCATION_SYNC_MS", 60000),
+
+		EventBus: eventbus.Config{
+			Transport:   envOr("EVENTBUS_TRANSPORT", ""),
+			PostgresURL: envOr("EVENTBUS_POSTGRES_URL", ""),
+			Channel:     envOr("EVENTBUS_CHANNEL", eventbus.DefaultChannel),
+			NATSURL:     envOr("EVENTBUS_NATS_URL", ""),
+			Group:       "messages",
+		},
+		OutboxPollInterval: envDuration("OUTBOX_POLL_MS", 1000),
+
+		PendingMetricsInterval: envDuration("MESSAGES_PENDING_METRICS_MS", 30000),
+		ReapInterval:           envDuration("MESSAGES_REAP_INTERVAL_MS", 60000),
+
+		EphemeralPerSecond: envInt("MESSAGES_EPHEMERAL_PER_SEC", 5),
+		EphemeralBurst:     envInt("MESSAGES_EPHEMERAL_BURST", 10),
+		EphemeralFanOut: eventbus.Config{
+			Transport:   envOr("EVENTBUS_TRANSPORT", ""),
+			PostgresURL: envOr("EVENTBUS_POSTGRES_URL", ""),
+			Channel:     envOr("EVENTBUS_CHANNEL", eventbus.DefaultChannel) + "_ephemeral",
+			NATSURL:     envOr("EVENTBUS_NATS_URL", ""),
+		},
+
+		ShutdownDelay:   envDuration("MESSAGES_SHUTDOWN_DELAY_MS", 5000),
+		ShutdownTimeout: envDuration("MESSAGES_SHUTDOWN_TIMEOUT_MS", 20000),
 	}
 }
 
@@ -0,0 +1,40 @@
+// Package events holds the domain events messages emits through its outbox and
+// the shapes of the events it consumes from other services.
+package events
+
+import "time"
+
+const (
+	TypeMessageDelivered = "messages.message.delivered"
+
+	// Published by auth.
+	TypeAuthDeviceRevoked    = "auth.device.revoked"
+	TypeAuthDeviceRegistered = "auth.device.registered"
+	TypeAuthSessionRevoked   = "auth.session.revoked"
+)
+
+// MessageDelivered is emitted once the recipient device acknowledges a message.
+type MessageDelivered struct {
+	MessageID    string    `json:"messageId"`
+	ConvID       string    `json:"convId"`
+	FromDeviceID string    `json:"fromDeviceId"`
+	ToDeviceID   string    `json:"toDeviceId"`
+	At           time.Time `json:"at"`
+}
+
+// AuthDeviceRevoked mirrors auth's DeviceRevoked payload.
+type AuthDeviceRevoked struct {
+	DeviceID string    `json:"deviceId"`
+	UserID   string    `json:"userId"`
+	At       time.Time `json:"at"`
+}
+
+// AuthSessionRevoked mirrors auth's SessionRevoked payload.
+type AuthSessionRevoked struct {
+	SessionID string    `json:"sessionId"`
+	UserID    string    `json:"userId"`
+	Reason    string    `json:"reason,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func (MessageDelivered) EventType() string { return TypeMessageDelivered }
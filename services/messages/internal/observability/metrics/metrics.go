@@ -1,31 +1,18 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
 
-var (
-	HTTPRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests.",
-		},
-		[]string{"service", "method", "path", "status"},
-	)
-
-	HTTPRequestDurationSeconds = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests.",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"service", "method", "path"},
-	)
+	obsmetrics "observability/metrics"
+)
 
+var (
 	MessagesStoredTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "messages_stored_total",
 			Help: "Total number of stored messages.",
 		},
-		[]string{"service", "chat_type"},
+		[]string{"chat_type"},
 	)
 
 	MessagesCiphertextBytes = prometheus.NewHistogramVec(
@@ -34,7 +21,7 @@ var (
 			Help:    "Ciphertext sizes for stored messages.",
 			Buckets: prometheus.ExponentialBuckets(64, 2, 10),
 		},
-		[]string{"service", "chat_type"},
+		[]string{"chat_type"},
 	)
 
 	MessageHistoryFetchedTotal = prometheus.NewCounterVec(
@@ -42,22 +29,133 @@ var (
 			Name: "messages_history_fetched_total",
 			Help: "Total number of history fetch operations.",
 		},
-		[]string{"service", "scope"},
+		[]string{"scope"},
+	)
+
+	// Buckets run from sub-second pushes over an open socket to devices that
+	// stay offline for days.
+	MessageDeliveryLatencySeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "messages_delivery_latency_seconds",
+			Help:    "Time from a message being stored to it being delivered to its device.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+		},
+	)
+
+	MessagesAcknowledgedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "messages_acknowledged_total",
+			Help: "Total messages acknowledged by their recipient device.",
+		},
+	)
+
+	MessagesExpiredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_expired_total",
+			Help: "Total disappearing messages hard-deleted after expiry, by whether they had been delivered.",
+		},
+		[]string{"state"},
+	)
+
+	// How long expired rows outlived their expiry before the reaper removed
+	// them; bounded by the reaper interval while it keeps up.
+	MessagesExpiryLagSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "messages_expiry_lag_seconds",
+			Help:    "Time from a message expiring to it being deleted.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 900, 3600},
+		},
+	)
+
+	// The pending gauges come from a periodic query over the whole table, so
+	// every replica reports the same values; aggregate them with max.
+	MessagesPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "messages_pending",
+			Help: "Messages stored but not yet delivered.",
+		},
+	)
+
+	MessagesPendingDevices = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "messages_pending_devices",
+			Help: "Devices with at least one undelivered message.",
+		},
 	)
-)
 
-func MustRegister(serviceName string) {
-	HTTPRequestsTotal = HTTPRequestsTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	HTTPRequestDurationSeconds = HTTPRequestDurationSeconds.MustCurryWith(prometheus.Labels{"service": serviceName}).(*prometheus.HistogramVec)
-	MessagesStoredTotal = MessagesStoredTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
-	MessagesCiphertextBytes = MessagesCiphertextBytes.MustCurryWith(prometheus.Labels{"service": serviceName}).(*prometheus.HistogramVec)
-	MessageHistoryFetchedTotal = MessageHistoryFetchedTotal.MustCurryWith(prometheus.Labels{"service": serviceName})
+	MessagesPendingMaxPerDevice = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "messages_pending_max_per_device",
+			Help: "Undelivered messages queued for the device with the most.",
+		},
+	)
+
+	MessagesPendingOldestAgeSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "messages_pending_oldest_age_seconds",
+			Help: "Age of the oldest undelivered message, 0 when none are pending.",
+		},
+	)
+
+	WebSocketConnectionsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "messages_websocket_connections_active",
+			Help: "WebSocket connections currently open on this instance.",
+		},
+	)
+
+	WebSocketFramesSentTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_websocket_frames_sent_total",
+			Help: "Total WebSocket frames written by type.",
+		},
+		[]string{"type"},
+	)
+
+	WebSocketWriteErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_websocket_write_errors_total",
+			Help: "Total failed WebSocket frame writes by type.",
+		},
+		[]string{"type"},
+	)
+
+	WebSocketFramesReceivedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_websocket_frames_received_total",
+			Help: "Total WebSocket messages received from clients by type.",
+		},
+		[]string{"type"},
+	)
+
+	EphemeralFramesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_ephemeral_frames_total",
+			Help: "Total ephemeral frames from clients by outcome: relayed, forwarded, offline, rate_limited or invalid.",
+		},
+		[]string{"outcome"},
+	)
+)
 
-	prometheus.MustRegister(
-		HTTPRequestsTotal,
-		HTTPRequestDurationSeconds,
+// MustRegister registers the shared HTTP metrics and the messages metrics
+// under the given service and environment labels.
+func MustRegister(serviceName, environment string) {
+	obsmetrics.MustRegister(serviceName, environment,
 		MessagesStoredTotal,
 		MessagesCiphertextBytes,
 		MessageHistoryFetchedTotal,
+		MessageDeliveryLatencySeconds,
+		MessagesAcknowledgedTotal,
+		MessagesExpiredTotal,
+		MessagesExpiryLagSeconds,
+		MessagesPending,
+		MessagesPendingDevices,
+		MessagesPendingMaxPerDevice,
+		MessagesPendingOldestAgeSeconds,
+		WebSocketConnectionsActive,
+		WebSocketFramesSentTotal,
+		WebSocketWriteErrorsTotal,
+		WebSocketFramesReceivedTotal,
+		EphemeralFramesTotal,
 	)
 }
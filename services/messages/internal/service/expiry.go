@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"messages/internal/observability/metrics"
+	"time"
+)
+
+// reapBatch bounds how many expired messages one delete removes, so a large
+// backlog is worked off without long-held locks.
+const reapBatch = 500
+
+// ReapExpired hard-deletes expired messages every interval until ctx ends.
+// Every replica may run it; each batch skips rows another one is deleting.
+func (s *Service) ReapExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.reapExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) reapExpired(ctx context.Context) {
+	total := 0
+	for {
+		now := s.now().UTC()
+		reaped, err := s.store.DeleteExpired(ctx, now, reapBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("reap expired messages", "error", err)
+			}
+			return
+		}
+		for _, m := range reaped {
+			state := "undelivered"
+			if m.Delivered {
+				state = "delivered"
+			}
+			metrics.MessagesExpiredTotal.WithLabelValues(state).Inc()
+			metrics.MessagesExpiryLagSeconds.Observe(now.Sub(m.ExpiresAt).Seconds())
+		}
+		total += len(reaped)
+		if len(reaped) < reapBatch {
+			break
+		}
+	}
+	if total > 0 {
+		slog.Info("reaped expired messages", "count", total)
+	}
+}
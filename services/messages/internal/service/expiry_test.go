@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"messages/internal/observability/metrics"
+	"messages/internal/store"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEnqueueExpiry(t *testing.T) {
+	tests := []struct {
+		name        string
+		expireAfter time.Duration
+		wantErr     bool
+	}{
+		{name: "kept", expireAfter: 0},
+		{name: "disappearing", expireAfter: time.Hour},
+		{name: "longest timer", expireAfter: MaxExpireAfter},
+		{name: "negative", expireAfter: -time.Second, wantErr: true},
+		{name: "too long", expireAfter: MaxExpireAfter + time.Second, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			svc, _ := setupService(t, &now)
+			msg, err := svc.Enqueue(context.Background(), SendInput{
+				ConvID:       uuid.New(),
+				FromDeviceID: uuid.New(),
+				ToDeviceID:   uuid.New(),
+				Ciphertext:   []byte("ciphertext"),
+				Header:       []byte(`{"v":1}`),
+				ExpireAfter:  tc.expireAfter,
+			})
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Fatalf("expected ErrInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("enqueue: %v", err)
+			}
+			if tc.expireAfter == 0 {
+				if msg.ExpiresAt != nil {
+					t.Fatalf("expected no expiry, got %v", msg.ExpiresAt)
+				}
+				return
+			}
+			if msg.ExpiresAt == nil || !msg.ExpiresAt.Equal(now.Add(tc.expireAfter)) {
+				t.Fatalf("expected expiry at %v, got %v", now.Add(tc.expireAfter), msg.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestReapExpired(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, db := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+
+	expiredDelivered := send(t, svc, alice, bob, time.Minute)
+	send(t, svc, alice, bob, time.Minute) // expires undelivered
+	expiredDeleted := send(t, svc, alice, bob, time.Minute)
+	future := send(t, svc, alice, bob, time.Hour)
+	kept := send(t, svc, alice, bob, 0)
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{expiredDelivered.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if err := db.Delete(&store.Message{}, "id = ?", expiredDeleted.ID).Error; err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+
+	delivered := metrics.MessagesExpiredTotal.WithLabelValues("delivered")
+	undelivered := metrics.MessagesExpiredTotal.WithLabelValues("undelivered")
+	beforeDelivered, beforeUndelivered := testutil.ToFloat64(delivered), testutil.ToFloat64(undelivered)
+
+	now = now.Add(2 * time.Minute)
+	svc.reapExpired(ctx)
+
+	if got := testutil.ToFloat64(delivered) - beforeDelivered; got != 1 {
+		t.Fatalf("expected 1 delivered message reaped, got %v", got)
+	}
+	if got := testutil.ToFloat64(undelivered) - beforeUndelivered; got != 2 {
+		t.Fatalf("expected 2 undelivered messages reaped, got %v", got)
+	}
+	var left []store.Message
+	if err := db.Unscoped().Find(&left).Error; err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	remaining := map[uuid.UUID]bool{}
+	for _, m := range left {
+		remaining[m.ID] = true
+	}
+	if len(remaining) != 2 || !remaining[future.ID] || !remaining[kept.ID] {
+		t.Fatalf("expected only the unexpired messages to remain, got %d", len(left))
+	}
+
+	// A second pass has nothing left to do.
+	now = now.Add(time.Minute)
+	svc.reapExpired(ctx)
+	if got := testutil.ToFloat64(undelivered) - beforeUndelivered; got != 2 {
+		t.Fatalf("expected nothing more reaped, got %v", got)
+	}
+}
+
+func TestDeleteExpiredHonoursLimit(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+
+	var expiries []time.Time
+	for i := 0; i < 3; i++ {
+		msg := send(t, svc, alice, bob, time.Duration(i+1)*time.Minute)
+		expiries = append(expiries, *msg.ExpiresAt)
+	}
+
+	reaped, err := svc.store.DeleteExpired(ctx, now.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if len(reaped) != 2 {
+		t.Fatalf("expected the limit of 2, got %d", len(reaped))
+	}
+	for i, m := range reaped {
+		if !m.ExpiresAt.Equal(expiries[i]) || m.Delivered {
+			t.Fatalf("expected the earliest expiries first, got %+v", reaped)
+		}
+	}
+	reaped, err = svc.store.DeleteExpired(ctx, now.Add(time.Hour), 2)
+	if err != nil || len(reaped) != 1 || !reaped[0].ExpiresAt.Equal(expiries[2]) {
+		t.Fatalf("expected the last expired message, got %+v (%v)", reaped, err)
+	}
+}
+
+func TestPendingLeavesOutExpired(t *testing.T) {
+	// The store compares expiry with the database clock, so the messages
+	// are sent relative to the real time.
+	now := time.Now().UTC().Add(-2 * time.Hour)
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+
+	send(t, svc, alice, bob, time.Hour)
+	visible := send(t, svc, alice, bob, 3*time.Hour)
+	kept := send(t, svc, alice, bob, 0)
+
+	pending, err := svc.Pending(ctx, bob, 10)
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	got := map[uuid.UUID]bool{}
+	for _, m := range pending {
+		got[m.ID] = true
+	}
+	if len(got) != 2 || !got[visible.ID] || !got[kept.ID] {
+		t.Fatalf("expected the expired message left out, got %d pending", len(pending))
+	}
+}
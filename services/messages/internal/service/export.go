@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"messages/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// DeviceExport is the messages service's part of a data export for one device.
+type DeviceExport struct {
+	DeviceID      uuid.UUID
+	RevokedAt     *time.Time
+	Messages      []store.MessageMetadata
+	Conversations []ConversationSummary
+}
+
+// ConversationSummary aggregates a device's messages in one conversation.
+type ConversationSummary struct {
+	ConvID   uuid.UUID
+	Sent     int
+	Received int
+	FirstAt  time.Time
+	LastAt   time.Time
+}
+
+func (s *Service) ExportForDevice(ctx context.Context, deviceID uuid.UUID) (DeviceExport, error) {
+	if deviceID == uuid.Nil {
+		return DeviceExport{}, ErrInvalidRequest
+	}
+	out := DeviceExport{DeviceID: deviceID}
+	revoked, err := s.store.RevokedDevice(ctx, deviceID)
+	if err != nil {
+		return DeviceExport{}, err
+	}
+	if revoked != nil {
+		out.RevokedAt = &revoked.RevokedAt
+	}
+	out.Messages, err = s.store.MetadataForDevice(ctx, deviceID)
+	if err != nil {
+		return DeviceExport{}, err
+	}
+
+	index := map[uuid.UUID]int{}
+	for _, m := range out.Messages {
+		i, ok := index[m.ConvID]
+		if !ok {
+			i = len(out.Conversations)
+			index[m.ConvID] = i
+			out.Conversations = append(out.Conversations, ConversationSummary{ConvID: m.ConvID, FirstAt: m.SentAt})
+		}
+		conv := &out.Conversations[i]
+		if m.FromDeviceID == deviceID {
+			conv.Sent++
+		} else {
+			conv.Received++
+		}
+		conv.LastAt = m.SentAt
+	}
+	return out, nil
+}
+
+// RevokedDeviceOwner returns the user a revoked device belonged to, or
+// uuid.Nil when the device has not been revoked.
+func (s *Service) RevokedDeviceOwner(ctx context.Context, deviceID uuid.UUID) (uuid.UUID, error) {
+	rd, err := s.store.RevokedDevice(ctx, deviceID)
+	if err != nil || rd == nil {
+		return uuid.Nil, err
+	}
+	return rd.UserID, nil
+}
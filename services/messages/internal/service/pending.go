@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"messages/internal/observability/metrics"
+	"time"
+)
+
+// ReportPending refreshes the pending-message gauges every interval until ctx
+// ends. The query aggregates the whole table, so it runs on a timer rather
+// than on every scrape.
+func (s *Service) ReportPending(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.reportPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) reportPending(ctx context.Context) {
+	stats, err := s.store.PendingStats(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("pending message stats", "error", err)
+		}
+		return
+	}
+	metrics.MessagesPending.Set(float64(stats.Messages))
+	metrics.MessagesPendingDevices.Set(float64(stats.Devices))
+	metrics.MessagesPendingMaxPerDevice.Set(float64(stats.MaxPerDevice))
+	age := 0.0
+	if !stats.Oldest.IsZero() {
+		age = s.now().Sub(stats.Oldest).Seconds()
+	}
+	metrics.MessagesPendingOldestAgeSeconds.Set(age)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"messages/internal/observability/metrics"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// latencySamples returns the delivery-latency histogram's count and sum.
+func latencySamples(t *testing.T) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.MessageDeliveryLatencySeconds.Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestDeliveryMetrics(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	gauges := func() [4]float64 {
+		svc.reportPending(ctx)
+		return [4]float64{
+			testutil.ToFloat64(metrics.MessagesPending),
+			testutil.ToFloat64(metrics.MessagesPendingDevices),
+			testutil.ToFloat64(metrics.MessagesPendingMaxPerDevice),
+			testutil.ToFloat64(metrics.MessagesPendingOldestAgeSeconds),
+		}
+	}
+
+	if got := gauges(); got != [4]float64{} {
+		t.Fatalf("expected empty pending gauges, got %v", got)
+	}
+
+	first := send(t, svc, alice, bob, 0)
+	now = now.Add(10 * time.Second)
+	second := send(t, svc, alice, bob, 0)
+	toCarol := send(t, svc, alice, carol, 0)
+	now = now.Add(20 * time.Second)
+	if got, want := gauges(), [4]float64{3, 2, 2, 30}; got != want {
+		t.Fatalf("after enqueue expected pending %v, got %v", want, got)
+	}
+
+	count, sum := latencySamples(t)
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{first.ID, second.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	gotCount, gotSum := latencySamples(t)
+	if gotCount-count != 2 || gotSum-sum != 50 {
+		t.Fatalf("expected latencies of 30s and 20s observed, got %d samples summing %vs", gotCount-count, gotSum-sum)
+	}
+	if got, want := gauges(), [4]float64{1, 1, 1, 20}; got != want {
+		t.Fatalf("after delivery expected pending %v, got %v", want, got)
+	}
+
+	// Delivering again observes nothing.
+	count, sum = latencySamples(t)
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{first.ID, toCarol.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	gotCount, gotSum = latencySamples(t)
+	if gotCount-count != 1 || gotSum-sum != 20 {
+		t.Fatalf("expected only the new delivery observed, got %d samples summing %vs", gotCount-count, gotSum-sum)
+	}
+	if got := gauges(); got != [4]float64{} {
+		t.Fatalf("expected empty pending gauges, got %v", got)
+	}
+}
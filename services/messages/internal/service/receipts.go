@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"messages/internal/observability/metrics"
+	"messages/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Acknowledge records that deviceID received the given messages. IDs of
+// messages addressed to other devices are ignored, so a device can only
+// acknowledge its own mail.
+func (s *Service) Acknowledge(ctx context.Context, deviceID uuid.UUID, ids []uuid.UUID) error {
+	if deviceID == uuid.Nil {
+		return ErrInvalidRequest
+	}
+	n, err := s.store.Acknowledge(ctx, deviceID, ids, s.now().UTC())
+	if err != nil {
+		return err
+	}
+	metrics.MessagesAcknowledgedTotal.Add(float64(n))
+	return nil
+}
+
+// UnreportedAcks lists acknowledgements of messages deviceID sent that it has
+// not been told about yet.
+func (s *Service) UnreportedAcks(ctx context.Context, deviceID uuid.UUID, limit int) ([]store.Message, error) {
+	if deviceID == uuid.Nil {
+		return nil, ErrInvalidRequest
+	}
+	return s.store.UnreportedAcks(ctx, deviceID, limit)
+}
+
+// MarkAcksReported records that the senders of the given messages were told
+// about their acknowledgement.
+func (s *Service) MarkAcksReported(ctx context.Context, ids []uuid.UUID) error {
+	return s.store.MarkAcksReported(ctx, ids, s.now().UTC())
+}
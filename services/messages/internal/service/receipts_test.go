@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"messages/internal/observability/metrics"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAcknowledge(t *testing.T) {
+	tests := []struct {
+		name    string
+		ackBy   string // "recipient", "sender" or "stranger"
+		twice   bool
+		wantAck bool
+	}{
+		{name: "recipient acknowledges", ackBy: "recipient", wantAck: true},
+		{name: "second acknowledgement is not counted", ackBy: "recipient", twice: true, wantAck: true},
+		{name: "sender cannot acknowledge", ackBy: "sender"},
+		{name: "stranger cannot acknowledge", ackBy: "stranger"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			svc, _ := setupService(t, &now)
+			ctx := context.Background()
+			alice, bob := uuid.New(), uuid.New()
+			msg := send(t, svc, alice, bob, 0)
+
+			by := map[string]uuid.UUID{"recipient": bob, "sender": alice, "stranger": uuid.New()}[tc.ackBy]
+			before := testutil.ToFloat64(metrics.MessagesAcknowledgedTotal)
+			now = now.Add(time.Minute)
+			if err := svc.Acknowledge(ctx, by, []uuid.UUID{msg.ID}); err != nil {
+				t.Fatalf("acknowledge: %v", err)
+			}
+			if tc.twice {
+				now = now.Add(time.Minute)
+				if err := svc.Acknowledge(ctx, by, []uuid.UUID{msg.ID}); err != nil {
+					t.Fatalf("acknowledge again: %v", err)
+				}
+			}
+
+			wantCount := 0.0
+			if tc.wantAck {
+				wantCount = 1
+			}
+			if got := testutil.ToFloat64(metrics.MessagesAcknowledgedTotal) - before; got != wantCount {
+				t.Fatalf("expected %v acknowledgements counted, got %v", wantCount, got)
+			}
+			acks, err := svc.UnreportedAcks(ctx, alice, 10)
+			if err != nil {
+				t.Fatalf("unreported acks: %v", err)
+			}
+			if !tc.wantAck {
+				if len(acks) != 0 {
+					t.Fatalf("expected no acknowledgements, got %d", len(acks))
+				}
+				return
+			}
+			if len(acks) != 1 || acks[0].ID != msg.ID || acks[0].ToDeviceID != bob {
+				t.Fatalf("expected the acknowledged message, got %+v", acks)
+			}
+			if acks[0].AckedAt == nil || !acks[0].AckedAt.Equal(msg.SentAt.Add(time.Minute)) {
+				t.Fatalf("expected the first acknowledgement time, got %v", acks[0].AckedAt)
+			}
+			pending, err := svc.Pending(ctx, bob, 10)
+			if err != nil {
+				t.Fatalf("pending: %v", err)
+			}
+			if len(pending) != 0 {
+				t.Fatalf("expected an acknowledged message to count as delivered")
+			}
+		})
+	}
+}
+
+func TestUnreportedAcksUntilReported(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	first := send(t, svc, alice, bob, 0)
+	second := send(t, svc, alice, carol, 0)
+	unacked := send(t, svc, alice, bob, 0)
+	fromBob := send(t, svc, bob, alice, 0)
+
+	now = now.Add(time.Minute)
+	if err := svc.Acknowledge(ctx, carol, []uuid.UUID{second.ID}); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := svc.Acknowledge(ctx, bob, []uuid.UUID{first.ID}); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	if err := svc.Acknowledge(ctx, alice, []uuid.UUID{fromBob.ID}); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+
+	acks, err := svc.UnreportedAcks(ctx, alice, 10)
+	if err != nil {
+		t.Fatalf("unreported acks: %v", err)
+	}
+	if len(acks) != 2 || acks[0].ID != second.ID || acks[1].ID != first.ID {
+		t.Fatalf("expected alice's acknowledged messages oldest first, got %+v", acks)
+	}
+	for _, m := range acks {
+		if m.ID == unacked.ID {
+			t.Fatalf("unacknowledged message %s reported", m.ID)
+		}
+	}
+	if limited, err := svc.UnreportedAcks(ctx, alice, 1); err != nil || len(limited) != 1 {
+		t.Fatalf("expected the limit to apply, got %d (%v)", len(limited), err)
+	}
+
+	if err := svc.MarkAcksReported(ctx, []uuid.UUID{second.ID}); err != nil {
+		t.Fatalf("mark reported: %v", err)
+	}
+	acks, err = svc.UnreportedAcks(ctx, alice, 10)
+	if err != nil {
+		t.Fatalf("unreported acks: %v", err)
+	}
+	if len(acks) != 1 || acks[0].ID != first.ID {
+		t.Fatalf("expected only the unreported acknowledgement, got %+v", acks)
+	}
+	if acks, _ := svc.UnreportedAcks(ctx, bob, 10); len(acks) != 1 || acks[0].ID != fromBob.ID {
+		t.Fatalf("expected bob to be told about his own message only, got %+v", acks)
+	}
+}
+
+func TestReceiptsRejectNilDevice(t *testing.T) {
+	now := time.Now()
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	if err := svc.Acknowledge(ctx, uuid.Nil, []uuid.UUID{uuid.New()}); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+	if _, err := svc.UnreportedAcks(ctx, uuid.Nil, 10); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"messages/internal/events"
+	"messages/internal/store"
+	"time"
+
+	"github.com/google/uuid"
+
+	"eventbus"
+)
+
+// Subscribe registers the service's handlers for events published by other services.
+func (s *Service) Subscribe(bus eventbus.Transport) error {
+	return bus.Subscribe(events.TypeAuthDeviceRevoked, s.handleDeviceRevoked)
+}
+
+// OnDeviceRevoked registers fn to run after a device revocation has been
+// recorded, e.g. to close its open WebSocket connections.
+func (s *Service) OnDeviceRevoked(fn func(deviceID uuid.UUID)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRevoked = append(s.onRevoked, fn)
+}
+
+func (s *Service) handleDeviceRevoked(ctx context.Context, env eventbus.Envelope) error {
+	var evt events.AuthDeviceRevoked
+	if err := env.Decode(&evt); err != nil {
+		return fmt.Errorf("decode %s: %w", env.Type, err)
+	}
+	deviceID, err := uuid.Parse(evt.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid deviceId in %s", ErrInvalidRequest, env.Type)
+	}
+	userID, err := uuid.Parse(evt.UserID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid userId in %s", ErrInvalidRequest, env.Type)
+	}
+	at := evt.At
+	if at.IsZero() {
+		at = env.OccurredAt
+	}
+	discarded, err := s.RevokeDevice(ctx, deviceID, userID, at)
+	if err != nil {
+		return err
+	}
+	slog.Info("revoked device", "device_id", deviceID, "discarded_pending", discarded, "event_id", env.ID)
+	return nil
+}
+
+// ReconcileRevocation applies a revocation listed by auth that the event bus
+// may not have delivered. It reports whether the device still needed
+// revoking here; devices that already carry a tombstone are left alone.
+func (s *Service) ReconcileRevocation(ctx context.Context, deviceID, userID uuid.UUID, at time.Time) (bool, error) {
+	revoked, err := s.IsRevoked(ctx, deviceID)
+	if err != nil || revoked {
+		return false, err
+	}
+	discarded, err := s.RevokeDevice(ctx, deviceID, userID, at)
+	if err != nil {
+		return false, err
+	}
+	slog.Warn("repaired missed device revocation", "device_id", deviceID, "discarded_pending", discarded)
+	return true, nil
+}
+
+// RevokeDevice tombstones the device so nothing more is queued to or from it
+// and discards messages it will never pick up. Running it twice is harmless.
+func (s *Service) RevokeDevice(ctx context.Context, deviceID, userID uuid.UUID, at time.Time) (int64, error) {
+	if deviceID == uuid.Nil {
+		return 0, ErrInvalidRequest
+	}
+	if at.IsZero() {
+		at = s.now()
+	}
+	var discarded int64
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		if _, err := tx.MarkDeviceRevoked(ctx, deviceID, userID, at.UTC()); err != nil {
+			return err
+		}
+		var err error
+		discarded, err = tx.DiscardPendingForDevice(ctx, deviceID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	listeners := append([]func(uuid.UUID){}, s.onRevoked...)
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn(deviceID)
+	}
+	return discarded, nil
+}
+
+// IsRevoked reports whether deviceID has been revoked.
+func (s *Service) IsRevoked(ctx context.Context, deviceID uuid.UUID) (bool, error) {
+	rd, err := s.store.RevokedDevice(ctx, deviceID)
+	if err != nil {
+		return false, err
+	}
+	return rd != nil, nil
+}
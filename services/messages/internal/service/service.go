@@ -4,19 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"messages/internal/events"
 	"messages/internal/msgjson"
 	"messages/internal/observability/metrics"
-	"messages/internal/observability/middleware"
 	"messages/internal/store"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+
+	"observability/middleware"
 )
 
 type Service struct {
 	store *store.Store
 	now   func() time.Time
+
+	mu        sync.Mutex
+	onRevoked []func(deviceID uuid.UUID)
 }
 
 type SendInput struct {
@@ -25,9 +32,18 @@ type SendInput struct {
 	ToDeviceID   uuid.UUID
 	Ciphertext   []byte
 	Header       json.RawMessage
+	// ExpireAfter makes the message disappear that long after it was sent;
+	// zero keeps it.
+	ExpireAfter time.Duration
 }
 
-var ErrInvalidRequest = errors.New("service: invalid request")
+// MaxExpireAfter is the longest disappearing-message timer accepted.
+const MaxExpireAfter = 365 * 24 * time.Hour
+
+var (
+	ErrInvalidRequest = errors.New("service: invalid request")
+	ErrDeviceRevoked  = errors.New("service: device revoked")
+)
 
 func New(st *store.Store) *Service {
 	return &Service{store: st, now: time.Now}
@@ -40,6 +56,22 @@ func (s *Service) Enqueue(ctx context.Context, in SendInput) (store.Message, err
 	if len(in.Ciphertext) == 0 || len(in.Header) == 0 {
 		return store.Message{}, ErrInvalidRequest
 	}
+	if in.ExpireAfter < 0 || in.ExpireAfter > MaxExpireAfter {
+		return store.Message{}, fmt.Errorf("%w: expiry must be between 0 and %s", ErrInvalidRequest, MaxExpireAfter)
+	}
+	for _, id := range []uuid.UUID{in.ToDeviceID, in.FromDeviceID} {
+		revoked, err := s.store.RevokedDevice(ctx, id)
+		if err != nil {
+			return store.Message{}, err
+		}
+		if revoked != nil {
+			role := "recipient"
+			if id != in.ToDeviceID {
+				role = "sender"
+			}
+			return store.Message{}, fmt.Errorf("%w: %s device %s was revoked at %s", ErrDeviceRevoked, role, id, revoked.RevokedAt.UTC().Format(time.RFC3339))
+		}
+	}
 	msg := store.Message{
 		ConvID:       in.ConvID,
 		FromDeviceID: in.FromDeviceID,
@@ -48,6 +80,10 @@ func (s *Service) Enqueue(ctx context.Context, in SendInput) (store.Message, err
 		Header:       msgjson.JSON(append([]byte(nil), in.Header...)),
 		SentAt:       s.now().UTC(),
 	}
+	if in.ExpireAfter > 0 {
+		expiresAt := msg.SentAt.Add(in.ExpireAfter)
+		msg.ExpiresAt = &expiresAt
+	}
 	if err := s.store.Create(ctx, &msg); err != nil {
 		return store.Message{}, err
 	}
@@ -71,7 +107,34 @@ func (s *Service) MarkDelivered(ctx context.Context, ids []uuid.UUID) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	return s.store.MarkDelivered(ctx, ids, s.now().UTC())
+	at := s.now().UTC()
+	var delivered []store.Message
+	err := s.store.WithTx(ctx, func(tx *store.Store) error {
+		var err error
+		delivered, err = tx.MarkDelivered(ctx, ids, at)
+		if err != nil {
+			return err
+		}
+		for _, m := range delivered {
+			if err := tx.AppendEvent(ctx, events.MessageDelivered{
+				MessageID:    m.ID.String(),
+				ConvID:       m.ConvID.String(),
+				FromDeviceID: m.FromDeviceID.String(),
+				ToDeviceID:   m.ToDeviceID.String(),
+				At:           at,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range delivered {
+		metrics.MessageDeliveryLatencySeconds.Observe(at.Sub(m.SentAt).Seconds())
+	}
+	return nil
 }
 
 func (s *Service) History(ctx context.Context, deviceID uuid.UUID, since time.Time, convID uuid.UUID, limit int) ([]store.Message, error) {
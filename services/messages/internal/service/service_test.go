@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"messages/internal/events"
+	"messages/internal/observability/metrics"
+	"messages/internal/store"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"eventbus"
+)
+
+// sqliteDriver is sqlite with the Postgres functions the store calls.
+const sqliteDriver = "sqlite3_messages"
+
+// messagesTable mirrors the migrations in SQLite's dialect; the Postgres
+// column types and defaults in the model tags do not parse there.
+const messagesTable = `CREATE TABLE messages (
+	id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+	conv_id TEXT NOT NULL,
+	from_device_id TEXT NOT NULL,
+	to_device_id TEXT NOT NULL,
+	ciphertext BLOB NOT NULL,
+	header TEXT NOT NULL,
+	sent_at DATETIME NOT NULL DEFAULT (now()),
+	received_at DATETIME,
+	delivered_at DATETIME,
+	acked_at DATETIME,
+	ack_reported_at DATETIME,
+	expires_at DATETIME,
+	deleted_at DATETIME
+)`
+
+func TestMain(m *testing.M) {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("now", func() string {
+				return time.Now().UTC().Format(sqlite3.SQLiteTimestampFormats[0])
+			}, false); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("gen_random_uuid", func() string {
+				return uuid.NewString()
+			}, false)
+		},
+	})
+	metrics.MustRegister("messages-test", "test")
+	os.Exit(m.Run())
+}
+
+// setupService returns a service over a fresh in-memory store whose clock
+// reads *now.
+func setupService(t *testing.T, now *time.Time) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.New(sqlite.Config{
+		DriverName: sqliteDriver,
+		DSN:        "file:" + t.Name() + "?mode=memory&cache=shared",
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.Exec(messagesTable).Error; err != nil {
+		t.Fatalf("create messages: %v", err)
+	}
+	if err := db.AutoMigrate(&store.RevokedDevice{}, &eventbus.OutboxEvent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	svc := New(store.New(db))
+	svc.now = func() time.Time { return *now }
+	return svc, db
+}
+
+// send enqueues a message from one device to another.
+func send(t *testing.T, svc *Service, from, to uuid.UUID, expireAfter time.Duration) store.Message {
+	t.Helper()
+	msg, err := svc.Enqueue(context.Background(), SendInput{
+		ConvID:       uuid.New(),
+		FromDeviceID: from,
+		ToDeviceID:   to,
+		Ciphertext:   []byte("ciphertext"),
+		Header:       json.RawMessage(`{"v":1}`),
+		ExpireAfter:  expireAfter,
+	})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return msg
+}
+
+func TestMarkDeliveredPublishesOnce(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, db := setupService(t, &now)
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	first := send(t, svc, alice, bob, 0)
+	second := send(t, svc, alice, bob, 0)
+
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{first.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{first.ID, second.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if err := svc.MarkDelivered(ctx, []uuid.UUID{first.ID, second.ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+
+	var rows []eventbus.OutboxEvent
+	if err := db.Where("type = ?", events.TypeMessageDelivered).Order("occurred_at").Find(&rows).Error; err != nil {
+		t.Fatalf("load outbox: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected one MessageDelivered per message, got %d", len(rows))
+	}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		var evt events.MessageDelivered
+		if err := json.Unmarshal(row.Payload, &evt); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		seen[evt.MessageID] = true
+	}
+	if !seen[first.ID.String()] || !seen[second.ID.String()] {
+		t.Fatalf("expected events for both messages, got %v", seen)
+	}
+}
+
+func TestRevokedDeviceOwner(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, _ := setupService(t, &now)
+	ctx := context.Background()
+	user, device := uuid.New(), uuid.New()
+
+	if owner, err := svc.RevokedDeviceOwner(ctx, device); err != nil || owner != uuid.Nil {
+		t.Fatalf("expected no owner for an active device, got %v (%v)", owner, err)
+	}
+	if _, err := svc.RevokeDevice(ctx, device, user, now); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if owner, err := svc.RevokedDeviceOwner(ctx, device); err != nil || owner != user {
+		t.Fatalf("expected %s to own the revoked device, got %v (%v)", user, owner, err)
+	}
+}
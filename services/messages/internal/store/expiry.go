@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// unexpired leaves out disappearing messages past their expiry.
+func unexpired(tx *gorm.DB) *gorm.DB {
+	return tx.Where("expires_at IS NULL OR expires_at > now()")
+}
+
+// ReapedMessage describes a message removed by DeleteExpired.
+type ReapedMessage struct {
+	ExpiresAt time.Time
+	Delivered bool
+}
+
+// DeleteExpired hard-deletes up to limit messages whose expiry is at or
+// before now, including soft-deleted ones. Rows locked by another instance's
+// reaper are skipped rather than waited for.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]ReapedMessage, error) {
+	due := s.db.Unscoped().
+		Model(&Message{}).
+		Select("id").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Order("expires_at").
+		Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	var deleted []Message
+	err := s.db.WithContext(ctx).
+		Unscoped().
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "expires_at"}, {Name: "delivered_at"}}}).
+		Where("id IN (?)", due).
+		Delete(&deleted).Error
+	if err != nil {
+		return nil, err
+	}
+	reaped := make([]ReapedMessage, 0, len(deleted))
+	for _, m := range deleted {
+		reaped = append(reaped, ReapedMessage{ExpiresAt: *m.ExpiresAt, Delivered: m.DeliveredAt != nil})
+	}
+	return reaped, nil
+}
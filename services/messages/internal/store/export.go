@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageMetadata is a message without its ciphertext or header, for data
+// exports: who talked to whom and when, never what was said.
+type MessageMetadata struct {
+	ID              uuid.UUID
+	ConvID          uuid.UUID
+	FromDeviceID    uuid.UUID
+	ToDeviceID      uuid.UUID
+	SentAt          time.Time
+	DeliveredAt     *time.Time
+	AckedAt         *time.Time
+	ExpiresAt       *time.Time
+	CiphertextBytes int64
+}
+
+// MetadataForDevice lists metadata for every message deviceID sent or received.
+func (s *Store) MetadataForDevice(ctx context.Context, deviceID uuid.UUID) ([]MessageMetadata, error) {
+	var rows []MessageMetadata
+	if err := s.db.WithContext(ctx).
+		Model(&Message{}).
+		Select("id, conv_id, from_device_id, to_device_id, sent_at, delivered_at, acked_at, expires_at, octet_length(ciphertext) AS ciphertext_bytes").
+		Where("to_device_id = ? OR from_device_id = ?", deviceID, deviceID).
+		Order("sent_at asc").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
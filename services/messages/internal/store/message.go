@@ -7,19 +7,29 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"eventbus"
 )
 
 type Message struct {
-	ID           uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	ConvID       uuid.UUID      `gorm:"type:uuid;not null"`
-	FromDeviceID uuid.UUID      `gorm:"type:uuid;not null"`
-	ToDeviceID   uuid.UUID      `gorm:"type:uuid;not null;index:idx_messages_to_device_sent,priority:1"`
-	Ciphertext   []byte         `gorm:"type:bytea;not null"`
-	Header       msgjson.JSON   `gorm:"type:jsonb;not null"`
-	SentAt       time.Time      `gorm:"not null;default:now();index:idx_messages_to_device_sent,priority:2"`
-	ReceivedAt   *time.Time     `gorm:"type:timestamptz"`
-	DeliveredAt  *time.Time     `gorm:"type:timestamptz"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	ID           uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	ConvID       uuid.UUID    `gorm:"type:uuid;not null"`
+	FromDeviceID uuid.UUID    `gorm:"type:uuid;not null;index:idx_messages_unreported_acks,where:acked_at IS NOT NULL AND ack_reported_at IS NULL"`
+	ToDeviceID   uuid.UUID    `gorm:"type:uuid;not null;index:idx_messages_to_device_sent,priority:1;index:idx_messages_pending,priority:1,where:delivered_at IS NULL AND deleted_at IS NULL"`
+	Ciphertext   []byte       `gorm:"type:bytea;not null"`
+	Header       msgjson.JSON `gorm:"type:jsonb;not null"`
+	SentAt       time.Time    `gorm:"not null;default:now();index:idx_messages_to_device_sent,priority:2;index:idx_messages_pending,priority:2"`
+	ReceivedAt   *time.Time   `gorm:"type:timestamptz"`
+	DeliveredAt  *time.Time   `gorm:"type:timestamptz"`
+	// AckedAt is set when the recipient device confirms it received the
+	// message, AckReportedAt once the sending device has been told.
+	AckedAt       *time.Time `gorm:"type:timestamptz"`
+	AckReportedAt *time.Time `gorm:"type:timestamptz"`
+	// ExpiresAt is when a disappearing message is removed, delivered or
+	// not. Messages without one stay until their device is deleted.
+	ExpiresAt *time.Time     `gorm:"type:timestamptz;index:idx_messages_expires_at,where:expires_at IS NOT NULL"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Store struct {
@@ -31,17 +41,20 @@ func New(db *gorm.DB) *Store {
 }
 
 func (s *Store) AutoMigrate(ctx context.Context) error {
-	return s.db.WithContext(ctx).AutoMigrate(&Message{})
+	return s.db.WithContext(ctx).AutoMigrate(&Message{}, &RevokedDevice{}, &eventbus.OutboxEvent{})
 }
 
 func (s *Store) Create(ctx context.Context, msg *Message) error {
 	return s.db.WithContext(ctx).Create(msg).Error
 }
 
+// PendingForDevice lists undelivered messages for deviceID, oldest first.
+// Expired messages the reaper has not removed yet are left out.
 func (s *Store) PendingForDevice(ctx context.Context, deviceID uuid.UUID, limit int) ([]Message, error) {
 	var msgs []Message
 	tx := s.db.WithContext(ctx).
 		Where("to_device_id = ? AND delivered_at IS NULL", deviceID).
+		Scopes(unexpired).
 		Order("sent_at asc")
 	if limit > 0 {
 		tx = tx.Limit(limit)
@@ -76,7 +89,8 @@ type HistoryFilter struct {
 func (s *Store) History(ctx context.Context, f HistoryFilter) ([]Message, error) {
 	var msgs []Message
 	tx := s.db.WithContext(ctx).
-		Where("to_device_id = ?", f.DeviceID)
+		Where("to_device_id = ?", f.DeviceID).
+		Scopes(unexpired)
 	if f.ConvID != uuid.Nil {
 		tx = tx.Where("conv_id = ?", f.ConvID)
 	}
@@ -93,15 +107,29 @@ func (s *Store) History(ctx context.Context, f HistoryFilter) ([]Message, error)
 	return msgs, nil
 }
 
-func (s *Store) MarkDelivered(ctx context.Context, ids []uuid.UUID, at time.Time) error {
+// MarkDelivered stamps delivered_at on the given messages and returns the ones
+// that were still undelivered, so callers can react only to new deliveries.
+func (s *Store) MarkDelivered(ctx context.Context, ids []uuid.UUID, at time.Time) ([]Message, error) {
 	if len(ids) == 0 {
-		return nil
+		return nil, nil
 	}
-	return s.db.WithContext(ctx).
-		Model(&Message{}).
-		Where("id IN ?", ids).
-		Update("delivered_at", at).
-		Error
+	// The delivered_at check is part of the UPDATE, so when two calls race
+	// for the same message only the one that stamps it gets the row back.
+	var msgs []Message
+	res := s.db.WithContext(ctx).
+		Model(&msgs).
+		Clauses(clause.Returning{Columns: []clause.Column{
+			{Name: "id"}, {Name: "conv_id"}, {Name: "from_device_id"}, {Name: "to_device_id"}, {Name: "sent_at"},
+		}}).
+		Where("id IN ? AND delivered_at IS NULL", ids).
+		Update("delivered_at", at)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return msgs, nil
 }
 
 func (s *Store) DeleteForDevice(ctx context.Context, deviceID uuid.UUID) (int64, error) {
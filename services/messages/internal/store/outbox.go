@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"eventbus"
+)
+
+// eventSource names messages in every envelope it emits.
+const eventSource = "messages"
+
+// WithTx runs fn inside a transaction; fn receives a Store bound to it.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Store{db: tx})
+	})
+}
+
+// AppendEvent records evt for the relay. Call it on a Store returned by
+// WithTx so the event commits together with the change it describes.
+func (s *Store) AppendEvent(ctx context.Context, evt eventbus.Event) error {
+	return eventbus.Append(ctx, s.db, eventSource, evt)
+}
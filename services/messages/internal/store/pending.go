@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// PendingStats summarises the messages still waiting for delivery.
+type PendingStats struct {
+	Messages     int64
+	Devices      int64
+	MaxPerDevice int64
+	// Oldest is the zero time when nothing is pending.
+	Oldest time.Time
+}
+
+// PendingStats aggregates undelivered messages per device. Both queries can
+// be answered from the partial idx_messages_pending index alone.
+func (s *Store) PendingStats(ctx context.Context) (PendingStats, error) {
+	var row struct {
+		Messages     int64
+		Devices      int64
+		MaxPerDevice int64
+	}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT COALESCE(SUM(n), 0) AS messages,
+		       COUNT(*) AS devices,
+		       COALESCE(MAX(n), 0) AS max_per_device
+		FROM (
+			SELECT to_device_id, COUNT(*) AS n
+			FROM messages
+			WHERE delivered_at IS NULL AND deleted_at IS NULL
+			GROUP BY to_device_id
+		) AS pending`).Scan(&row).Error
+	if err != nil {
+		return PendingStats{}, err
+	}
+	stats := PendingStats{Messages: row.Messages, Devices: row.Devices, MaxPerDevice: row.MaxPerDevice}
+	if stats.Messages == 0 {
+		return stats, nil
+	}
+	// The oldest is read as a column rather than an aggregate so the driver
+	// hands back a typed timestamp.
+	var oldest []time.Time
+	err = s.db.WithContext(ctx).
+		Model(&Message{}).
+		Where("delivered_at IS NULL").
+		Order("sent_at asc").
+		Limit(1).
+		Pluck("sent_at", &oldest).Error
+	if err != nil {
+		return PendingStats{}, err
+	}
+	if len(oldest) > 0 {
+		stats.Oldest = oldest[0]
+	}
+	return stats, nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Acknowledge stamps acked_at on the given messages addressed to deviceID
+// that were not acknowledged yet and returns how many it stamped. IDs of
+// messages for other devices are ignored. A message acknowledged before its
+// write was recorded, e.g. one read through history, counts as delivered too.
+func (s *Store) Acknowledge(ctx context.Context, deviceID uuid.UUID, ids []uuid.UUID, at time.Time) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := s.db.WithContext(ctx).
+		Model(&Message{}).
+		Where("id IN ? AND to_device_id = ? AND acked_at IS NULL", ids, deviceID).
+		Updates(map[string]any{
+			"acked_at":     at,
+			"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", at),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// UnreportedAcks lists acknowledged messages sent by deviceID whose sender
+// has not been told yet, oldest acknowledgement first.
+func (s *Store) UnreportedAcks(ctx context.Context, deviceID uuid.UUID, limit int) ([]Message, error) {
+	var msgs []Message
+	tx := s.db.WithContext(ctx).
+		Select("id", "conv_id", "from_device_id", "to_device_id", "acked_at").
+		Where("from_device_id = ? AND acked_at IS NOT NULL AND ack_reported_at IS NULL", deviceID).
+		Order("acked_at asc")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	if err := tx.Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// MarkAcksReported records that the senders of the given messages have been
+// told about their acknowledgement.
+func (s *Store) MarkAcksReported(ctx context.Context, ids []uuid.UUID, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Model(&Message{}).
+		Where("id IN ?", ids).
+		Update("ack_reported_at", at).
+		Error
+}
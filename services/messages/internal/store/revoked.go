@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevokedDevice is the local tombstone for a device auth has revoked.
+type RevokedDevice struct {
+	DeviceID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	RevokedAt time.Time `gorm:"not null"`
+}
+
+// MarkDeviceRevoked records the tombstone. It reports false when the device
+// was already marked, keeping the first revocation time.
+func (s *Store) MarkDeviceRevoked(ctx context.Context, deviceID, userID uuid.UUID, at time.Time) (bool, error) {
+	res := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RevokedDevice{DeviceID: deviceID, UserID: userID, RevokedAt: at})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RevokedDevice returns the tombstone for deviceID, or nil if it is active.
+func (s *Store) RevokedDevice(ctx context.Context, deviceID uuid.UUID) (*RevokedDevice, error) {
+	var rd RevokedDevice
+	err := s.db.WithContext(ctx).First(&rd, "device_id = ?", deviceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rd, nil
+}
+
+// DiscardPendingForDevice soft-deletes messages still waiting for deviceID.
+func (s *Store) DiscardPendingForDevice(ctx context.Context, deviceID uuid.UUID) (int64, error) {
+	res := s.db.WithContext(ctx).
+		Where("to_device_id = ? AND delivered_at IS NULL", deviceID).
+		Delete(&Message{})
+	return res.RowsAffected, res.Error
+}
@@ -12,6 +12,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	cryptocore "cryptocore"
 	"messages/pkg/msgclient"
 )
 
@@ -20,6 +23,7 @@ type clientInitRequest struct {
 	MessagesURL string `json:"messagesUrl"`
 	UserID      string `json:"userId"`
 	DeviceID    string `json:"deviceId"`
+	Padding     string `json:"padding,omitempty"`
 }
 
 type clientInitResponse struct {
@@ -28,18 +32,26 @@ type clientInitResponse struct {
 	DeviceID       string `json:"deviceId"`
 	KeysURL        string `json:"keysUrl"`
 	MessagesURL    string `json:"messagesUrl"`
+	Padding        string `json:"padding"`
 	OneTimePrekeys int    `json:"oneTimePrekeys"`
 }
 
 type clientSendRequest struct {
-	State      string `json:"state"`
-	ConvID     string `json:"convId"`
-	ToDeviceID string `json:"toDeviceId"`
-	Plaintext  string `json:"plaintext"`
+	State      string           `json:"state"`
+	ConvID     string           `json:"convId"`
+	ToDeviceID string           `json:"toDeviceId"`
+	Plaintext  string           `json:"plaintext"`
+	Type       string           `json:"type,omitempty"`
+	ReplyTo    *msgclient.Quote `json:"replyTo,omitempty"`
+	Padding    string           `json:"padding,omitempty"`
+	// TimerSeconds, when set, becomes the conversation's disappearing-message
+	// timer; 0 turns it off.
+	TimerSeconds *int64 `json:"timerSeconds,omitempty"`
 }
 
 type clientSendResponse struct {
-	State string `json:"state"`
+	State     string `json:"state"`
+	MessageID string `json:"messageId"`
 }
 
 type clientEnvelopeRequest struct {
@@ -48,8 +60,15 @@ type clientEnvelopeRequest struct {
 }
 
 type clientEnvelopeResponse struct {
-	State     string `json:"state"`
-	Plaintext string `json:"plaintext"`
+	State     string             `json:"state"`
+	Plaintext string             `json:"plaintext"`
+	Notice    string             `json:"notice,omitempty"`
+	Message   *msgclient.Payload `json:"message,omitempty"`
+	Receipt   *msgclient.Receipt `json:"receipt,omitempty"`
+	ExpiresAt *time.Time         `json:"expiresAt,omitempty"`
+	// Error is set when the envelope could not be decrypted; the state still
+	// has to be stored, as it counts failures towards a session reset.
+	Error string `json:"error,omitempty"`
 }
 
 const clientHTTPTimeout = 10 * time.Second
@@ -97,11 +116,18 @@ func (h *Handler) handleClientInit(w http.ResponseWriter, r *http.Request) {
 		UserID:          userID,
 		DeviceID:        deviceIDParam,
 		AccessToken:     extractToken(r),
+		Padding:         req.Padding,
 	}
 	if opts.KeysBaseURL == "" || opts.MessagesBaseURL == "" {
 		http.Error(w, "keysUrl and messagesUrl are required", http.StatusBadRequest)
 		return
 	}
+	if p := strings.TrimSpace(req.Padding); p != "" {
+		if _, err := cryptocore.ParsePaddingScheme(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	state, reg, err := msgclient.RegisterDevice(r.Context(), opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
@@ -118,6 +144,7 @@ func (h *Handler) handleClientInit(w http.ResponseWriter, r *http.Request) {
 		DeviceID:       reg.DeviceID,
 		KeysURL:        state.KeysBaseURL(),
 		MessagesURL:    state.MessagesBaseURL(),
+		Padding:        state.Padding().String(),
 		OneTimePrekeys: reg.OneTimePreKeys,
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -160,7 +187,35 @@ func (h *Handler) handleClientSend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	prepared, err := state.PrepareSend(convID, toID, req.Plaintext)
+	payload := msgclient.Payload{
+		Type:    msgclient.ContentText,
+		ID:      uuid.NewString(),
+		ReplyTo: req.ReplyTo,
+		Body:    req.Plaintext,
+	}
+	if t := strings.TrimSpace(req.Type); t != "" {
+		payload.Type = t
+	}
+	if p := strings.TrimSpace(req.Padding); p != "" {
+		scheme, err := cryptocore.ParsePaddingScheme(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.SetPadding(scheme)
+	}
+	if req.TimerSeconds != nil {
+		secs := *req.TimerSeconds
+		if secs < 0 || secs > int64(msgclient.MaxTimer/time.Second) {
+			http.Error(w, "invalid timerSeconds", http.StatusBadRequest)
+			return
+		}
+		if err := state.SetTimer(convID, time.Duration(secs)*time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	prepared, err := state.PreparePayload(convID, toID, payload)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -174,7 +229,7 @@ func (h *Handler) handleClientSend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, http.StatusOK, clientSendResponse{State: string(data)})
+	writeJSON(w, http.StatusOK, clientSendResponse{State: string(data), MessageID: payload.ID})
 }
 
 func (h *Handler) handleClientEnvelope(w http.ResponseWriter, r *http.Request) {
@@ -209,17 +264,31 @@ func (h *Handler) handleClientEnvelope(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	plaintext, err := state.HandleEnvelope(&env)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	in, handleErr := state.HandleEnvelope(&env)
+	if handleErr != nil && in == nil && !msgclient.IsSessionFailure(handleErr) {
+		http.Error(w, handleErr.Error(), http.StatusBadRequest)
 		return
 	}
+	resp := clientEnvelopeResponse{}
+	if in != nil {
+		for _, out := range in.Outgoing {
+			if err := postEncryptedMessage(r.Context(), extractToken(r), state.MessagesBaseURL(), out); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+		resp.Plaintext, resp.Notice, resp.Message, resp.Receipt = in.Plaintext, in.Notice, in.Payload, in.Receipt
+		resp.ExpiresAt = in.ExpiresAt
+	}
+	if handleErr != nil {
+		resp.Error = handleErr.Error()
+	}
 	data, err := state.Marshal()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	resp := clientEnvelopeResponse{State: string(data), Plaintext: plaintext}
+	resp.State = string(data)
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -241,7 +310,7 @@ func postEncryptedMessage(ctx context.Context, token string, base string, payloa
 	if token = strings.TrimSpace(token); token != "" {
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
-	client := &http.Client{Timeout: clientHTTPTimeout}
+	client := &http.Client{Timeout: clientHTTPTimeout, Transport: otelhttp.NewTransport(nil)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -2,15 +2,17 @@ package transport
 
 import (
 	"bufio"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"messages/internal/auth"
-	"messages/internal/observability/middleware"
+	"math/rand/v2"
+	"messages/internal/observability/metrics"
 	"messages/internal/service"
 	"net"
 	"net/http"
@@ -21,15 +23,29 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"eventbus"
+	"identity/verifier"
+	"observability/middleware"
 )
 
 type Handler struct {
 	svc   *service.Service
-	auth  *auth.Client
+	auth  *verifier.Client
 	poll  time.Duration
 	batch int
+	conns *wsRegistry
+
+	// fanOut carries ephemeral frames to the other instances; nil keeps
+	// them on this one. instance tells this process's own frames apart.
+	fanOut   eventbus.Transport
+	instance string
 }
 
+// revocationRecheckInterval bounds how long a socket can outlive its device
+// when the revocation event was handled by another instance.
+const revocationRecheckInterval = 30 * time.Second
+
 func extractToken(r *http.Request) string {
 	authz := strings.TrimSpace(r.Header.Get("Authorization"))
 	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
@@ -41,46 +57,76 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-func (h *Handler) requireAuth(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID) (auth.Claims, bool) {
+func (h *Handler) requireAuth(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID) (verifier.Claims, bool) {
 	if h.auth == nil {
 		http.Error(w, "authorization not configured", http.StatusInternalServerError)
-		return auth.Claims{}, false
+		return verifier.Claims{}, false
 	}
-	token := extractToken(r)
-	if token == "" {
+	claims, err := h.auth.Authenticate(r, extractToken(r), deviceID)
+	if errors.Is(err, verifier.ErrMissingToken) {
 		http.Error(w, "missing bearer token", http.StatusUnauthorized)
-		return auth.Claims{}, false
+		return verifier.Claims{}, false
+	}
+	if errors.Is(err, verifier.ErrUnavailable) {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "authorization unavailable", http.StatusServiceUnavailable)
+		return verifier.Claims{}, false
 	}
-	claims, err := h.auth.Verify(r.Context(), token, deviceID)
 	if err != nil {
 		slog.Warn("auth verification failed", "error", err)
 		http.Error(w, "authorization failed", http.StatusUnauthorized)
-		return auth.Claims{}, false
+		return verifier.Claims{}, false
 	}
 	if !claims.Valid {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
-		return auth.Claims{}, false
+		return verifier.Claims{}, false
 	}
 	if deviceID != uuid.Nil && !claims.DeviceAuthorized {
 		http.Error(w, "device not authorized for user", http.StatusForbidden)
-		return auth.Claims{}, false
+		return verifier.Claims{}, false
 	}
 	return claims, true
 }
 
+// requireExportAuth is requireAuth for the export, which also admits devices
+// the user has since revoked: auth no longer vouches for them, but the
+// messages they sent are still the user's data.
+func (h *Handler) requireExportAuth(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID) (verifier.Claims, bool) {
+	if deviceID == uuid.Nil {
+		return h.requireAuth(w, r, deviceID)
+	}
+	claims, ok := h.requireAuth(w, r, uuid.Nil)
+	if !ok {
+		return verifier.Claims{}, false
+	}
+	owner, err := h.svc.RevokedDeviceOwner(r.Context(), deviceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return verifier.Claims{}, false
+	}
+	if owner != uuid.Nil && owner == claims.UserID {
+		return claims, true
+	}
+	return h.requireAuth(w, r, deviceID)
+}
+
 type sendRequest struct {
 	ConvID       string          `json:"conv_id"`
 	FromDeviceID string          `json:"from_device_id"`
 	ToDeviceID   string          `json:"to_device_id"`
 	Ciphertext   string          `json:"ciphertext"`
 	Header       json.RawMessage `json:"header"`
+	// ExpireAfterSeconds is the conversation's disappearing-message timer;
+	// zero keeps the message until its device is deleted.
+	ExpireAfterSeconds int64 `json:"expire_after_seconds,omitempty"`
 }
 
 type sendResponse struct {
-	ID         string    `json:"id"`
-	ConvID     string    `json:"conv_id"`
-	ToDeviceID string    `json:"to_device_id"`
-	SentAt     time.Time `json:"sent_at"`
+	ID         string     `json:"id"`
+	ConvID     string     `json:"conv_id"`
+	ToDeviceID string     `json:"to_device_id"`
+	SentAt     time.Time  `json:"sent_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 }
 
 type outboundEnvelope struct {
@@ -91,16 +137,49 @@ type outboundEnvelope struct {
 	Ciphertext   string          `json:"ciphertext"`
 	Header       json.RawMessage `json:"header"`
 	SentAt       time.Time       `json:"sent_at"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+}
+
+// Router serves the messages API and owns the WebSocket connections opened
+// through it.
+type Router struct {
+	*http.ServeMux
+	h *Handler
 }
 
-func NewRouter(svc *service.Service, poll time.Duration, batch int, authClient *auth.Client) http.Handler {
+// CloseWebSockets asks every open socket to reconnect, to another instance
+// once this one stops, and waits until they are closed or ctx ends.
+func (rt *Router) CloseWebSockets(ctx context.Context) error {
+	return rt.h.conns.shutdown(ctx)
+}
+
+// FanOutEphemeral forwards ephemeral frames through bus so recipients
+// connected to another instance get them too, and relays the frames other
+// instances forward. bus must hand every event to every replica; call it
+// before serving.
+func (rt *Router) FanOutEphemeral(bus eventbus.Transport) error {
+	if err := bus.Subscribe(typeEphemeralFanOut, rt.h.receiveEphemeral); err != nil {
+		return err
+	}
+	rt.h.fanOut = bus
+	return nil
+}
+
+func NewRouter(svc *service.Service, poll time.Duration, batch int, ephemeral EphemeralLimit, authClient *verifier.Client) *Router {
 	if poll <= 0 {
 		poll = 500 * time.Millisecond
 	}
 	if batch <= 0 {
 		batch = 50
 	}
-	h := &Handler{svc: svc, poll: poll, batch: batch, auth: authClient}
+	if ephemeral.PerSecond <= 0 {
+		ephemeral.PerSecond = 5
+	}
+	if ephemeral.Burst <= 0 {
+		ephemeral.Burst = 10
+	}
+	h := &Handler{svc: svc, poll: poll, batch: batch, auth: authClient, conns: newWSRegistry(ephemeral), instance: uuid.NewString()}
+	svc.OnDeviceRevoked(h.conns.revoke)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -115,11 +194,12 @@ func NewRouter(svc *service.Service, poll time.Duration, batch int, authClient *
 	mux.HandleFunc("/messages/conversations", h.handleConversations)
 	mux.HandleFunc("/messages/history", h.handleHistory)
 	mux.HandleFunc("/messages/me", h.handleDeleteMe)
+	mux.HandleFunc("/messages/me/export", h.handleExportMe)
 	mux.HandleFunc("/ws", h.handleWS)
 	mux.HandleFunc("/client/init", h.handleClientInit)
 	mux.HandleFunc("/client/send", h.handleClientSend)
 	mux.HandleFunc("/client/envelope", h.handleClientEnvelope)
-	return mux
+	return &Router{ServeMux: mux, h: h}
 }
 
 func (h *Handler) handleSend(w http.ResponseWriter, r *http.Request) {
@@ -159,17 +239,25 @@ func (h *Handler) handleSend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid ciphertext", http.StatusBadRequest)
 		return
 	}
+	if req.ExpireAfterSeconds < 0 || req.ExpireAfterSeconds > int64(service.MaxExpireAfter/time.Second) {
+		http.Error(w, "invalid expire_after_seconds", http.StatusBadRequest)
+		return
+	}
 	msg, err := h.svc.Enqueue(r.Context(), service.SendInput{
 		ConvID:       convID,
 		FromDeviceID: fromID,
 		ToDeviceID:   toID,
 		Ciphertext:   ciphertext,
 		Header:       req.Header,
+		ExpireAfter:  time.Duration(req.ExpireAfterSeconds) * time.Second,
 	})
 	if err != nil {
 		status := http.StatusInternalServerError
-		if errors.Is(err, service.ErrInvalidRequest) {
+		switch {
+		case errors.Is(err, service.ErrInvalidRequest):
 			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrDeviceRevoked):
+			status = http.StatusGone
 		}
 		http.Error(w, err.Error(), status)
 		return
@@ -179,6 +267,7 @@ func (h *Handler) handleSend(w http.ResponseWriter, r *http.Request) {
 		ConvID:     msg.ConvID.String(),
 		ToDeviceID: msg.ToDeviceID.String(),
 		SentAt:     msg.SentAt,
+		ExpiresAt:  msg.ExpiresAt,
 	}
 	writeJSON(w, http.StatusCreated, resp)
 }
@@ -252,6 +341,7 @@ func (h *Handler) handleHistory(w http.ResponseWriter, r *http.Request) {
 			Ciphertext:   base64.StdEncoding.EncodeToString(m.Ciphertext),
 			Header:       append(json.RawMessage(nil), m.Header...),
 			SentAt:       m.SentAt,
+			ExpiresAt:    m.ExpiresAt,
 		})
 	}
 
@@ -327,10 +417,24 @@ func (h *Handler) handleWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer ws.close()
 
+	conn, unregister := h.conns.register(deviceID)
+	defer unregister()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	frames := make(chan []byte)
+	readDone := make(chan error, 1)
+	go func() { readDone <- ws.readMessages(frames, stop) }()
+
 	ctx := r.Context()
 	reqID := middleware.RequestIDFromContext(ctx)
 	traceID := middleware.TraceIDFromContext(ctx)
 
+	closeRevoked := func() {
+		slog.Info("closing websocket for revoked device", "device_id", deviceID, "request_id", reqID, "trace_id", traceID)
+		_ = ws.writeClose(closePolicyViolation, "device revoked")
+	}
+
 	sendPending := func() error {
 		msgs, err := h.svc.Pending(ctx, deviceID, h.batch)
 		if err != nil {
@@ -349,6 +453,7 @@ func (h *Handler) handleWS(w http.ResponseWriter, r *http.Request) {
 				Ciphertext:   base64.StdEncoding.EncodeToString(m.Ciphertext),
 				Header:       append(json.RawMessage(nil), m.Header...),
 				SentAt:       m.SentAt,
+				ExpiresAt:    m.ExpiresAt,
 			}
 			data, err := json.Marshal(env)
 			if err != nil {
@@ -362,23 +467,96 @@ func (h *Handler) handleWS(w http.ResponseWriter, r *http.Request) {
 		return h.svc.MarkDelivered(ctx, ids)
 	}
 
+	// sendAcks tells this device which of its messages were acknowledged,
+	// on whichever instance the recipient is connected to.
+	sendAcks := func() error {
+		acks, err := h.svc.UnreportedAcks(ctx, deviceID, h.batch)
+		if err != nil {
+			return err
+		}
+		if len(acks) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, 0, len(acks))
+		for _, m := range acks {
+			data, err := json.Marshal(deliveryNotice{
+				Type:       frameDelivered,
+				ID:         m.ID.String(),
+				ConvID:     m.ConvID.String(),
+				ToDeviceID: m.ToDeviceID.String(),
+				At:         *m.AckedAt,
+			})
+			if err != nil {
+				return err
+			}
+			if err := ws.writeFrame(opText, data); err != nil {
+				return err
+			}
+			ids = append(ids, m.ID)
+		}
+		return h.svc.MarkAcksReported(ctx, ids)
+	}
+
 	if err := sendPending(); err != nil {
 		slog.Error("ws initial send", "error", err, "request_id", reqID, "trace_id", traceID)
 		return
 	}
+	if err := sendAcks(); err != nil {
+		slog.Error("ws initial acks", "error", err, "request_id", reqID, "trace_id", traceID)
+		return
+	}
 
 	ticker := time.NewTicker(h.poll)
 	defer ticker.Stop()
+	recheck := time.NewTicker(revocationRecheckInterval)
+	defer recheck.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case err := <-readDone:
+			if err != nil && !errors.Is(err, io.EOF) {
+				slog.Info("ws read", "error", err, "request_id", reqID, "trace_id", traceID)
+			}
+			return
+		case data := <-frames:
+			if err := h.handleClientFrame(ctx, deviceID, data); err != nil {
+				slog.Warn("ws client frame", "error", err, "device_id", deviceID, "request_id", reqID, "trace_id", traceID)
+			}
+		case data := <-conn.ephemeral:
+			if err := ws.writeFrame(opText, data); err != nil {
+				slog.Error("ws ephemeral", "error", err, "request_id", reqID, "trace_id", traceID)
+				return
+			}
+		case <-conn.revoked:
+			closeRevoked()
+			return
+		case <-h.conns.shutdownSignal():
+			// Spread reconnects so clients do not all land on the remaining
+			// instances at once.
+			after := rand.N(reconnectSpread)
+			_ = ws.writeClose(closeServiceRestart, fmt.Sprintf("reconnect_after_ms=%d", after.Milliseconds()))
+			return
+		case <-recheck.C:
+			isRevoked, err := h.svc.IsRevoked(ctx, deviceID)
+			if err != nil {
+				slog.Warn("ws revocation check", "error", err, "request_id", reqID, "trace_id", traceID)
+				continue
+			}
+			if isRevoked {
+				closeRevoked()
+				return
+			}
 		case <-ticker.C:
 			if err := sendPending(); err != nil {
 				slog.Error("ws send", "error", err, "request_id", reqID, "trace_id", traceID)
 				return
 			}
+			if err := sendAcks(); err != nil {
+				slog.Error("ws acks", "error", err, "request_id", reqID, "trace_id", traceID)
+				return
+			}
 			if err := ws.writeFrame(opPing, nil); err != nil {
 				slog.Error("ws ping", "error", err, "request_id", reqID, "trace_id", traceID)
 				return
@@ -404,7 +582,7 @@ func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
 		deviceID = parsed
 	}
 
-	claims, ok := h.requireAuth(w, r, deviceID)
+	claims, ok := h.requireExportAuth(w, r, deviceID)
 	if !ok {
 		return
 	}
@@ -441,6 +619,118 @@ func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+type exportedMessage struct {
+	ID              string     `json:"id"`
+	ConvID          string     `json:"conv_id"`
+	Direction       string     `json:"direction"`
+	FromDeviceID    string     `json:"from_device_id"`
+	ToDeviceID      string     `json:"to_device_id"`
+	SentAt          time.Time  `json:"sent_at"`
+	DeliveredAt     *time.Time `json:"delivered_at,omitempty"`
+	AckedAt         *time.Time `json:"acked_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CiphertextBytes int64      `json:"ciphertext_bytes"`
+}
+
+type exportedConversation struct {
+	ConvID   string    `json:"conv_id"`
+	Sent     int       `json:"sent"`
+	Received int       `json:"received"`
+	FirstAt  time.Time `json:"first_at"`
+	LastAt   time.Time `json:"last_at"`
+}
+
+// handleExportMe returns message metadata for one of the caller's devices,
+// the token's device unless device_id names another. Ciphertext and headers
+// are left out: the server cannot read them and the user's plaintext only
+// exists on their devices.
+func (h *Handler) handleExportMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceParam := strings.TrimSpace(r.URL.Query().Get("device_id"))
+	deviceID := uuid.Nil
+	if deviceParam != "" {
+		parsed, err := uuid.Parse(deviceParam)
+		if err != nil {
+			http.Error(w, "invalid device_id", http.StatusBadRequest)
+			return
+		}
+		deviceID = parsed
+	}
+
+	claims, ok := h.requireExportAuth(w, r, deviceID)
+	if !ok {
+		return
+	}
+
+	if deviceID == uuid.Nil {
+		if claims.TokenDeviceID == nil {
+			http.Error(w, "device_id is required", http.StatusBadRequest)
+			return
+		}
+		deviceID = *claims.TokenDeviceID
+	}
+
+	export, err := h.svc.ExportForDevice(r.Context(), deviceID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidRequest) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	resp := struct {
+		Service       string                 `json:"service"`
+		GeneratedAt   time.Time              `json:"generated_at"`
+		DeviceID      string                 `json:"device_id"`
+		RevokedAt     *time.Time             `json:"revoked_at,omitempty"`
+		Conversations []exportedConversation `json:"conversations"`
+		Messages      []exportedMessage      `json:"messages"`
+	}{
+		Service:       "messages",
+		GeneratedAt:   time.Now().UTC(),
+		DeviceID:      deviceID.String(),
+		RevokedAt:     export.RevokedAt,
+		Conversations: make([]exportedConversation, 0, len(export.Conversations)),
+		Messages:      make([]exportedMessage, 0, len(export.Messages)),
+	}
+	for _, c := range export.Conversations {
+		resp.Conversations = append(resp.Conversations, exportedConversation{
+			ConvID:   c.ConvID.String(),
+			Sent:     c.Sent,
+			Received: c.Received,
+			FirstAt:  c.FirstAt,
+			LastAt:   c.LastAt,
+		})
+	}
+	for _, m := range export.Messages {
+		direction := "received"
+		if m.FromDeviceID == deviceID {
+			direction = "sent"
+		}
+		resp.Messages = append(resp.Messages, exportedMessage{
+			ID:              m.ID.String(),
+			ConvID:          m.ConvID.String(),
+			Direction:       direction,
+			FromDeviceID:    m.FromDeviceID.String(),
+			ToDeviceID:      m.ToDeviceID.String(),
+			SentAt:          m.SentAt,
+			DeliveredAt:     m.DeliveredAt,
+			AckedAt:         m.AckedAt,
+			ExpiresAt:       m.ExpiresAt,
+			CiphertextBytes: m.CiphertextBytes,
+		})
+	}
+	slog.Info("message metadata exported", "device_id", deviceID, "messages", len(resp.Messages),
+		"request_id", middleware.RequestIDFromContext(r.Context()), "trace_id", middleware.TraceIDFromContext(r.Context()))
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -448,12 +738,32 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 }
 
 const (
-	opText = 0x1
-	opPing = 0x9
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+
+	closeNormal          = 1000
+	closeProtocolError   = 1002
+	closeUnsupportedData = 1003
+	closePolicyViolation = 1008
+	closeServiceRestart  = 1012
+
+	// reconnectSpread is the window reconnect hints are drawn from on shutdown.
+	reconnectSpread = 5 * time.Second
 )
 
+// frameTypes labels the frames this server sends in metrics.
+var frameTypes = map[byte]string{
+	opText:  "message",
+	opClose: "close",
+	opPing:  "ping",
+	opPong:  "pong",
+}
+
 type wsServerConn struct {
 	conn net.Conn
+	r    *bufio.Reader
 	w    *bufio.Writer
 	mu   sync.Mutex
 }
@@ -491,10 +801,21 @@ func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsServerConn, err
 		_ = conn.Close()
 		return nil, err
 	}
-	return &wsServerConn{conn: conn, w: bufio.NewWriter(conn)}, nil
+	return &wsServerConn{conn: conn, r: rw.Reader, w: bufio.NewWriter(conn)}, nil
 }
 
+// writeFrame sends one unfragmented frame and counts it by type.
 func (c *wsServerConn) writeFrame(opcode byte, payload []byte) error {
+	frameType := frameTypes[opcode]
+	if err := c.write(opcode, payload); err != nil {
+		metrics.WebSocketWriteErrorsTotal.WithLabelValues(frameType).Inc()
+		return err
+	}
+	metrics.WebSocketFramesSentTotal.WithLabelValues(frameType).Inc()
+	return nil
+}
+
+func (c *wsServerConn) write(opcode byte, payload []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
@@ -530,6 +851,13 @@ func (c *wsServerConn) writeFrame(opcode byte, payload []byte) error {
 	return c.w.Flush()
 }
 
+// writeClose sends a close frame carrying code and reason.
+func (c *wsServerConn) writeClose(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	return c.writeFrame(opClose, append(payload, reason...))
+}
+
 func (c *wsServerConn) close() {
 	_ = c.conn.Close()
 }
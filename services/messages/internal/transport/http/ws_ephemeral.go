@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"messages/internal/observability/metrics"
+	"time"
+
+	"github.com/google/uuid"
+
+	"eventbus"
+)
+
+// frameEphemeral carries a short-lived encrypted blob, such as a typing or
+// presence signal, between two connected devices. The server relays it to
+// the recipient's sockets on this instance, forwards it to the other
+// instances when fan-out is configured, and never stores it; a recipient
+// with no socket anywhere misses it.
+const frameEphemeral = "ephemeral"
+
+// typeEphemeralFanOut routes forwarded frames on the fan-out transport.
+const typeEphemeralFanOut = "messages.ephemeral"
+
+// fanOutTimeout bounds publishing one frame to the other instances.
+const fanOutTimeout = 2 * time.Second
+
+// maxEphemeralBlob bounds the decoded size of an ephemeral blob.
+const maxEphemeralBlob = 4 << 10
+
+// EphemeralLimit is the token bucket applied to each sending device's
+// ephemeral frames.
+type EphemeralLimit struct {
+	PerSecond int
+	Burst     int
+}
+
+type ephemeralFrame struct {
+	Type         string    `json:"type"`
+	ConvID       string    `json:"conv_id"`
+	FromDeviceID string    `json:"from_device_id"`
+	Blob         string    `json:"blob"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+// ephemeralFanOut is a relayed frame on its way to the other instances.
+// Origin lets the sending instance skip its own copy.
+type ephemeralFanOut struct {
+	Origin     string          `json:"origin"`
+	ToDeviceID string          `json:"toDeviceId"`
+	Frame      json.RawMessage `json:"frame"`
+}
+
+func (ephemeralFanOut) EventType() string { return typeEphemeralFanOut }
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit EphemeralLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: float64(limit.Burst), last: now}
+}
+
+func (b *tokenBucket) allow(limit EphemeralLimit, now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * float64(limit.PerSecond)
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// relayEphemeral passes an ephemeral frame from deviceID on to its
+// recipient. Frames over the sender's rate limit, or for a recipient that is
+// not connected here while fan-out is off, are dropped without telling the
+// sender.
+func (h *Handler) relayEphemeral(deviceID uuid.UUID, frame clientFrame) error {
+	convID, err := uuid.Parse(frame.ConvID)
+	if err != nil {
+		metrics.EphemeralFramesTotal.WithLabelValues("invalid").Inc()
+		return fmt.Errorf("invalid conv_id %q", frame.ConvID)
+	}
+	toID, err := uuid.Parse(frame.ToDeviceID)
+	if err != nil {
+		metrics.EphemeralFramesTotal.WithLabelValues("invalid").Inc()
+		return fmt.Errorf("invalid to_device_id %q", frame.ToDeviceID)
+	}
+	blob, err := base64.StdEncoding.DecodeString(frame.Blob)
+	if err != nil || len(blob) == 0 || len(blob) > maxEphemeralBlob {
+		metrics.EphemeralFramesTotal.WithLabelValues("invalid").Inc()
+		return errors.New("invalid ephemeral blob")
+	}
+	if !h.conns.allowEphemeral(deviceID) {
+		metrics.EphemeralFramesTotal.WithLabelValues("rate_limited").Inc()
+		return nil
+	}
+	data, err := json.Marshal(ephemeralFrame{
+		Type:         frameEphemeral,
+		ConvID:       convID.String(),
+		FromDeviceID: deviceID.String(),
+		Blob:         frame.Blob,
+		SentAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	local := h.conns.relay(toID, data)
+	forwarded := h.forwardEphemeral(toID, data)
+	switch {
+	case local > 0:
+		metrics.EphemeralFramesTotal.WithLabelValues("relayed").Inc()
+	case forwarded:
+		metrics.EphemeralFramesTotal.WithLabelValues("forwarded").Inc()
+	default:
+		metrics.EphemeralFramesTotal.WithLabelValues("offline").Inc()
+	}
+	return nil
+}
+
+// forwardEphemeral publishes frame for the recipient's sockets on other
+// instances. The recipient may hold sockets here and elsewhere, so it is
+// sent even after a local relay. It reports whether the frame left.
+func (h *Handler) forwardEphemeral(toID uuid.UUID, frame []byte) bool {
+	if h.fanOut == nil {
+		return false
+	}
+	env, err := eventbus.NewEnvelope("messages", ephemeralFanOut{Origin: h.instance, ToDeviceID: toID.String(), Frame: frame})
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	if err := h.fanOut.Publish(ctx, env); err != nil {
+		slog.Warn("ephemeral fan-out failed", "error", err)
+		return false
+	}
+	return true
+}
+
+// receiveEphemeral relays a frame forwarded by another instance to the
+// recipient's sockets here.
+func (h *Handler) receiveEphemeral(_ context.Context, env eventbus.Envelope) error {
+	var fwd ephemeralFanOut
+	if err := env.Decode(&fwd); err != nil {
+		return err
+	}
+	if fwd.Origin == h.instance {
+		return nil
+	}
+	toID, err := uuid.Parse(fwd.ToDeviceID)
+	if err != nil {
+		return fmt.Errorf("invalid to_device_id %q", fwd.ToDeviceID)
+	}
+	h.conns.relay(toID, fwd.Frame)
+	return nil
+}
@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"messages/internal/observability/metrics"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"eventbus"
+)
+
+func ephemeralJSON(convID, toID, blob string) []byte {
+	data, _ := json.Marshal(clientFrame{Type: frameEphemeral, ConvID: convID, ToDeviceID: toID, Blob: blob})
+	return data
+}
+
+func TestRelayEphemeral(t *testing.T) {
+	blob := base64.StdEncoding.EncodeToString([]byte("typing"))
+	tests := []struct {
+		name        string
+		frame       func(conv, to uuid.UUID) []byte
+		connected   bool
+		wantErr     bool
+		wantOutcome string
+	}{
+		{
+			name:        "relayed to the recipient",
+			frame:       func(conv, to uuid.UUID) []byte { return ephemeralJSON(conv.String(), to.String(), blob) },
+			connected:   true,
+			wantOutcome: "relayed",
+		},
+		{
+			name:        "recipient offline",
+			frame:       func(conv, to uuid.UUID) []byte { return ephemeralJSON(conv.String(), to.String(), blob) },
+			wantOutcome: "offline",
+		},
+		{
+			name:        "invalid conversation",
+			frame:       func(_, to uuid.UUID) []byte { return ephemeralJSON("conv", to.String(), blob) },
+			connected:   true,
+			wantErr:     true,
+			wantOutcome: "invalid",
+		},
+		{
+			name:        "invalid recipient",
+			frame:       func(conv, _ uuid.UUID) []byte { return ephemeralJSON(conv.String(), "", blob) },
+			wantErr:     true,
+			wantOutcome: "invalid",
+		},
+		{
+			name:        "blob not base64",
+			frame:       func(conv, to uuid.UUID) []byte { return ephemeralJSON(conv.String(), to.String(), "!!") },
+			connected:   true,
+			wantErr:     true,
+			wantOutcome: "invalid",
+		},
+		{
+			name:        "empty blob",
+			frame:       func(conv, to uuid.UUID) []byte { return ephemeralJSON(conv.String(), to.String(), "") },
+			connected:   true,
+			wantErr:     true,
+			wantOutcome: "invalid",
+		},
+		{
+			name: "blob too large",
+			frame: func(conv, to uuid.UUID) []byte {
+				big := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", maxEphemeralBlob+1)))
+				return ephemeralJSON(conv.String(), to.String(), big)
+			},
+			connected:   true,
+			wantErr:     true,
+			wantOutcome: "invalid",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{conns: newWSRegistry(EphemeralLimit{PerSecond: 5, Burst: 10})}
+			from, to, conv := uuid.New(), uuid.New(), uuid.New()
+			var recipient *wsConn
+			if tc.connected {
+				c, unregister := h.conns.register(to)
+				defer unregister()
+				recipient = c
+			}
+
+			outcome := metrics.EphemeralFramesTotal.WithLabelValues(tc.wantOutcome)
+			before := testutil.ToFloat64(outcome)
+			err := h.handleClientFrame(context.Background(), from, tc.frame(conv, to))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%v, got %v", tc.wantErr, err)
+			}
+			if got := testutil.ToFloat64(outcome) - before; got != 1 {
+				t.Fatalf("expected one %s frame counted, got %v", tc.wantOutcome, got)
+			}
+			if recipient == nil {
+				return
+			}
+
+			select {
+			case data := <-recipient.ephemeral:
+				if tc.wantOutcome != "relayed" {
+					t.Fatalf("expected nothing relayed, got %s", data)
+				}
+				var got ephemeralFrame
+				if err := json.Unmarshal(data, &got); err != nil {
+					t.Fatalf("decode relayed frame: %v", err)
+				}
+				if got.Type != frameEphemeral || got.ConvID != conv.String() || got.FromDeviceID != from.String() || got.Blob != blob || got.SentAt.IsZero() {
+					t.Fatalf("unexpected relayed frame %+v", got)
+				}
+			default:
+				if tc.wantOutcome == "relayed" {
+					t.Fatalf("expected the frame to be relayed")
+				}
+			}
+		})
+	}
+}
+
+func TestRelayEphemeralRateLimit(t *testing.T) {
+	h := &Handler{conns: newWSRegistry(EphemeralLimit{PerSecond: 1, Burst: 3})}
+	from, to, conv := uuid.New(), uuid.New(), uuid.New()
+	recipient, unregister := h.conns.register(to)
+	defer unregister()
+	frame := ephemeralJSON(conv.String(), to.String(), base64.StdEncoding.EncodeToString([]byte("typing")))
+
+	limited := metrics.EphemeralFramesTotal.WithLabelValues("rate_limited")
+	before := testutil.ToFloat64(limited)
+	for i := 0; i < 5; i++ {
+		if err := h.handleClientFrame(context.Background(), from, frame); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if got := len(recipient.ephemeral); got != 3 {
+		t.Fatalf("expected the burst of 3 relayed, got %d", got)
+	}
+	if got := testutil.ToFloat64(limited) - before; got != 2 {
+		t.Fatalf("expected 2 frames rate limited, got %v", got)
+	}
+
+	// The limit is the sender's: another device still gets through.
+	if err := h.handleClientFrame(context.Background(), uuid.New(), frame); err != nil {
+		t.Fatalf("other sender: %v", err)
+	}
+	if got := len(recipient.ephemeral); got != 4 {
+		t.Fatalf("expected another sender's frame relayed, got %d queued", got)
+	}
+}
+
+func TestRelayEphemeralFullQueue(t *testing.T) {
+	h := &Handler{conns: newWSRegistry(EphemeralLimit{PerSecond: 1, Burst: ephemeralQueue * 2})}
+	from, to, conv := uuid.New(), uuid.New(), uuid.New()
+	recipient, unregister := h.conns.register(to)
+	defer unregister()
+	frame := ephemeralJSON(conv.String(), to.String(), base64.StdEncoding.EncodeToString([]byte("typing")))
+
+	for i := 0; i < ephemeralQueue+2; i++ {
+		if err := h.handleClientFrame(context.Background(), from, frame); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if got := len(recipient.ephemeral); got != ephemeralQueue {
+		t.Fatalf("expected the queue to cap at %d, got %d", ephemeralQueue, got)
+	}
+}
+
+func TestRelayEphemeralFanOut(t *testing.T) {
+	bus := eventbus.NewInProcess()
+	limit := EphemeralLimit{PerSecond: 5, Burst: 10}
+	sender := &Router{h: &Handler{conns: newWSRegistry(limit), instance: "a"}}
+	other := &Router{h: &Handler{conns: newWSRegistry(limit), instance: "b"}}
+	for _, rt := range []*Router{sender, other} {
+		if err := rt.FanOutEphemeral(bus); err != nil {
+			t.Fatalf("fan-out: %v", err)
+		}
+	}
+	from, to, conv := uuid.New(), uuid.New(), uuid.New()
+	local, unregisterLocal := sender.h.conns.register(to)
+	defer unregisterLocal()
+	remote, unregisterRemote := other.h.conns.register(to)
+	defer unregisterRemote()
+
+	frame := ephemeralJSON(conv.String(), to.String(), base64.StdEncoding.EncodeToString([]byte("typing")))
+	if err := sender.h.handleClientFrame(context.Background(), from, frame); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := len(local.ephemeral); got != 1 {
+		t.Fatalf("expected one frame on the sender's instance, got %d", got)
+	}
+	if got := len(remote.ephemeral); got != 1 {
+		t.Fatalf("expected one frame on the other instance, got %d", got)
+	}
+	var got ephemeralFrame
+	if err := json.Unmarshal(<-remote.ephemeral, &got); err != nil {
+		t.Fatalf("decode forwarded frame: %v", err)
+	}
+	if got.FromDeviceID != from.String() || got.ConvID != conv.String() {
+		t.Fatalf("unexpected forwarded frame %+v", got)
+	}
+
+	// With no socket on the sender's instance the frame still counts as sent.
+	unregisterLocal()
+	forwarded := metrics.EphemeralFramesTotal.WithLabelValues("forwarded")
+	before := testutil.ToFloat64(forwarded)
+	if err := sender.h.handleClientFrame(context.Background(), from, frame); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := testutil.ToFloat64(forwarded) - before; got != 1 {
+		t.Fatalf("expected one forwarded frame counted, got %v", got)
+	}
+	if got := len(remote.ephemeral); got != 1 {
+		t.Fatalf("expected the other instance to get the frame, got %d", got)
+	}
+}
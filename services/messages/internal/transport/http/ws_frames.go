@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"messages/internal/observability/metrics"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Messages are pushed to clients as bare envelopes. Every other JSON text
+// frame, in either direction, names its kind in a "type" field.
+const (
+	// frameAck is sent by a client once it has processed envelopes.
+	frameAck = "ack"
+	// frameDelivered tells a sending device that a recipient acknowledged
+	// one of its messages.
+	frameDelivered = "delivered"
+)
+
+// maxClientFrame bounds the payload of a frame a client may send.
+const maxClientFrame = 64 << 10
+
+var errProtocol = errors.New("websocket protocol error")
+
+type clientFrame struct {
+	Type string   `json:"type"`
+	IDs  []string `json:"ids,omitempty"`
+
+	// Ephemeral frames only.
+	ConvID     string `json:"conv_id,omitempty"`
+	ToDeviceID string `json:"to_device_id,omitempty"`
+	Blob       string `json:"blob,omitempty"`
+}
+
+type deliveryNotice struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	ConvID     string    `json:"conv_id"`
+	ToDeviceID string    `json:"to_device_id"`
+	At         time.Time `json:"at"`
+}
+
+// handleClientFrame acts on one text frame from deviceID's connection.
+func (h *Handler) handleClientFrame(ctx context.Context, deviceID uuid.UUID, data []byte) error {
+	var frame clientFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		metrics.WebSocketFramesReceivedTotal.WithLabelValues("invalid").Inc()
+		return fmt.Errorf("decode client frame: %w", err)
+	}
+	switch frame.Type {
+	case frameAck:
+		metrics.WebSocketFramesReceivedTotal.WithLabelValues(frameAck).Inc()
+		ids := make([]uuid.UUID, 0, len(frame.IDs))
+		for _, raw := range frame.IDs {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return fmt.Errorf("invalid message id %q", raw)
+			}
+			ids = append(ids, id)
+		}
+		return h.svc.Acknowledge(ctx, deviceID, ids)
+	case frameEphemeral:
+		metrics.WebSocketFramesReceivedTotal.WithLabelValues(frameEphemeral).Inc()
+		return h.relayEphemeral(deviceID, frame)
+	default:
+		metrics.WebSocketFramesReceivedTotal.WithLabelValues("unknown").Inc()
+		return fmt.Errorf("unknown client frame type %q", frame.Type)
+	}
+}
+
+// readMessages reads frames until the client closes the connection or it
+// fails, handing text payloads to out. Control frames are answered here. It
+// returns io.EOF after a close frame.
+func (c *wsServerConn) readMessages(out chan<- []byte, stop <-chan struct{}) error {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				_ = c.writeClose(closeProtocolError, err.Error())
+			}
+			return err
+		}
+		switch opcode {
+		case opText:
+			select {
+			case out <- payload:
+			case <-stop:
+				return nil
+			}
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return err
+			}
+		case opPong:
+		case opClose:
+			_ = c.writeClose(closeNormal, "")
+			return io.EOF
+		default:
+			_ = c.writeClose(closeUnsupportedData, "unsupported frame")
+			return fmt.Errorf("%w: opcode %#x", errProtocol, opcode)
+		}
+	}
+}
+
+// readFrame reads one client frame. Clients must mask their frames and this
+// server does not reassemble fragmented ones.
+func (c *wsServerConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	if !fin {
+		return 0, nil, fmt.Errorf("%w: fragmented frame", errProtocol)
+	}
+	if head[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("%w: unmasked client frame", errProtocol)
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxClientFrame {
+		return 0, nil, fmt.Errorf("%w: frame of %d bytes", errProtocol, length)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
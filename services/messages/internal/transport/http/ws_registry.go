@@ -0,0 +1,194 @@
+package transport
+
+import (
+	"context"
+	"math"
+	"messages/internal/observability/metrics"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// wsRegistry tracks the WebSocket connections open on this instance so they
+// can be closed when their device is revoked or the instance shuts down, and
+// so ephemeral frames can be relayed to them.
+type wsRegistry struct {
+	mu     sync.Mutex
+	conns  map[uuid.UUID]map[*wsConn]struct{}
+	limits map[uuid.UUID]*tokenBucket
+	limit  EphemeralLimit
+	swept  time.Time // last sweep of idle buckets
+	open   int
+
+	closing      chan struct{} // closed when shutdown starts
+	shuttingDown bool
+	idle         chan struct{} // closed once shutting down with no connections left
+}
+
+// wsConn is one registered connection.
+type wsConn struct {
+	revoked   chan struct{} // closed when the device is revoked
+	ephemeral chan []byte   // frames relayed from other devices
+}
+
+// ephemeralQueue is how many relayed frames a connection may have waiting
+// before further ones are dropped.
+const ephemeralQueue = 16
+
+// bucketIdleTTL is how long a device's ephemeral bucket is kept after its
+// last frame, or longer if the limit takes longer to refill. Buckets outlive
+// the device's connections, so reconnecting does not hand out a fresh burst;
+// one idle until it refilled is full anyway and can be dropped.
+const bucketIdleTTL = 10 * time.Minute
+
+func newWSRegistry(limit EphemeralLimit) *wsRegistry {
+	return &wsRegistry{
+		conns:   make(map[uuid.UUID]map[*wsConn]struct{}),
+		limits:  make(map[uuid.UUID]*tokenBucket),
+		limit:   limit,
+		swept:   time.Now(),
+		closing: make(chan struct{}),
+		idle:    make(chan struct{}),
+	}
+}
+
+// register adds a connection for deviceID and returns it with a func the
+// caller must run once the connection ends.
+func (r *wsRegistry) register(deviceID uuid.UUID) (*wsConn, func()) {
+	c := &wsConn{revoked: make(chan struct{}), ephemeral: make(chan []byte, ephemeralQueue)}
+	r.mu.Lock()
+	set, ok := r.conns[deviceID]
+	if !ok {
+		set = make(map[*wsConn]struct{})
+		r.conns[deviceID] = set
+	}
+	set[c] = struct{}{}
+	r.open++
+	r.mu.Unlock()
+	metrics.WebSocketConnectionsActive.Inc()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(r.done)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		set, ok := r.conns[deviceID]
+		if !ok {
+			return
+		}
+		if _, ok := set[c]; !ok {
+			return
+		}
+		delete(set, c)
+		if len(set) == 0 {
+			delete(r.conns, deviceID)
+		}
+	}
+}
+
+// revoke signals every connection registered for deviceID.
+func (r *wsRegistry) revoke(deviceID uuid.UUID) {
+	r.mu.Lock()
+	set := r.conns[deviceID]
+	delete(r.conns, deviceID)
+	r.mu.Unlock()
+	for c := range set {
+		close(c.revoked)
+	}
+}
+
+// allowEphemeral takes a token from deviceID's ephemeral rate limit. The
+// bucket is shared by all of the device's connections on this instance and
+// kept for bucketIdleTTL after its last use, whether or not they stay open.
+func (r *wsRegistry) allowEphemeral(deviceID uuid.UUID) bool {
+	return r.allowEphemeralAt(deviceID, time.Now())
+}
+
+func (r *wsRegistry) allowEphemeralAt(deviceID uuid.UUID, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.swept) >= r.bucketTTL() {
+		r.sweepBuckets(now)
+	}
+	b, ok := r.limits[deviceID]
+	if !ok {
+		b = newTokenBucket(r.limit, now)
+		r.limits[deviceID] = b
+	}
+	return b.allow(r.limit, now)
+}
+
+// bucketTTL is how long an idle bucket is kept: bucketIdleTTL, or the time
+// the limit takes to refill from empty if that is longer.
+func (r *wsRegistry) bucketTTL() time.Duration {
+	if r.limit.PerSecond <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	refill := time.Duration(r.limit.Burst) * time.Second / time.Duration(r.limit.PerSecond)
+	return max(bucketIdleTTL, refill)
+}
+
+// sweepBuckets drops the buckets idle for bucketTTL. r.mu must be held.
+func (r *wsRegistry) sweepBuckets(now time.Time) {
+	ttl := r.bucketTTL()
+	for id, b := range r.limits {
+		if now.Sub(b.last) >= ttl {
+			delete(r.limits, id)
+		}
+	}
+	r.swept = now
+}
+
+// relay queues frame on every connection deviceID has open on this instance
+// without waiting; a connection whose queue is full misses it. It returns
+// how many connections took the frame.
+func (r *wsRegistry) relay(deviceID uuid.UUID, frame []byte) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for c := range r.conns[deviceID] {
+		select {
+		case c.ephemeral <- frame:
+			n++
+		default:
+		}
+	}
+	return n
+}
+
+func (r *wsRegistry) done() {
+	metrics.WebSocketConnectionsActive.Dec()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open--
+	if r.shuttingDown && r.open == 0 {
+		close(r.idle)
+	}
+}
+
+// shutdownSignal is closed when the instance starts shutting down.
+func (r *wsRegistry) shutdownSignal() <-chan struct{} {
+	return r.closing
+}
+
+// shutdown signals every connection to close and waits until they have, or
+// until ctx ends.
+func (r *wsRegistry) shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.shuttingDown {
+		r.shuttingDown = true
+		close(r.closing)
+		if r.open == 0 {
+			close(r.idle)
+		}
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
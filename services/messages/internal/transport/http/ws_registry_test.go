@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEphemeralBucketOutlivesConnections(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(r *wsRegistry, device uuid.UUID, unregister func())
+	}{
+		{name: "reconnect", end: func(_ *wsRegistry, _ uuid.UUID, unregister func()) { unregister() }},
+		{name: "revoke", end: func(r *wsRegistry, device uuid.UUID, _ func()) { r.revoke(device) }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newWSRegistry(EphemeralLimit{PerSecond: 1, Burst: 2})
+			device := uuid.New()
+			now := time.Now()
+
+			_, unregister := r.register(device)
+			for i := 0; i < 2; i++ {
+				if !r.allowEphemeralAt(device, now) {
+					t.Fatalf("frame %d: expected the burst to be allowed", i)
+				}
+			}
+			if r.allowEphemeralAt(device, now) {
+				t.Fatalf("expected the bucket to be empty")
+			}
+
+			tc.end(r, device, unregister)
+			_, unregister = r.register(device)
+			defer unregister()
+			if r.allowEphemeralAt(device, now) {
+				t.Fatalf("expected a new connection to inherit the empty bucket")
+			}
+			if !r.allowEphemeralAt(device, now.Add(time.Second)) {
+				t.Fatalf("expected the bucket to refill")
+			}
+		})
+	}
+}
+
+func TestEphemeralBucketsSweptWhenIdle(t *testing.T) {
+	r := newWSRegistry(EphemeralLimit{PerSecond: 1, Burst: 2})
+	idle, active := uuid.New(), uuid.New()
+	start := r.swept
+
+	r.allowEphemeralAt(idle, start)
+	r.allowEphemeralAt(active, start.Add(bucketIdleTTL/2))
+	r.allowEphemeralAt(active, start.Add(bucketIdleTTL))
+
+	if _, ok := r.limits[idle]; ok {
+		t.Fatalf("expected the idle bucket to be swept")
+	}
+	if _, ok := r.limits[active]; !ok {
+		t.Fatalf("expected the active bucket to be kept")
+	}
+}
+
+func TestEphemeralBucketTTLCoversRefill(t *testing.T) {
+	r := newWSRegistry(EphemeralLimit{PerSecond: 1, Burst: 3600})
+	if got := r.bucketTTL(); got != time.Hour {
+		t.Fatalf("expected the TTL to cover a full refill, got %v", got)
+	}
+}
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS revoked_devices (
+    device_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL
+);
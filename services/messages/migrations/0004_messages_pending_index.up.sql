@@ -0,0 +1,5 @@
+-- Undelivered messages per device, for the WebSocket push and the pending
+-- gauges.
+CREATE INDEX IF NOT EXISTS idx_messages_pending
+    ON messages (to_device_id, sent_at)
+    WHERE delivered_at IS NULL AND deleted_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_unreported_acks;
+ALTER TABLE messages DROP COLUMN IF EXISTS ack_reported_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS acked_at;
@@ -0,0 +1,7 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS acked_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS ack_reported_at TIMESTAMPTZ;
+
+-- Delivery notices still owed to a sending device.
+CREATE INDEX IF NOT EXISTS idx_messages_unreported_acks
+    ON messages (from_device_id)
+    WHERE acked_at IS NOT NULL AND ack_reported_at IS NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- The reaper walks disappearing messages in expiry order.
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at
+    ON messages (expires_at)
+    WHERE expires_at IS NOT NULL;
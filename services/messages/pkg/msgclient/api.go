@@ -23,15 +23,28 @@ type InitOptions struct {
 	UserID          string
 	DeviceID        string
 	AccessToken     string
+	// Padding names the cryptocore padding scheme for outgoing messages.
+	// Empty selects DefaultPadding.
+	Padding string
 }
 
+// oneTimeKEMPrekeys is how many one-time ML-KEM prekeys a new device uploads.
+// Once they are used up peers fall back to the last-resort KEM prekey.
+const oneTimeKEMPrekeys = 10
+
 // RegisterDevice provisions a new device with the key service and builds a runtime state.
 func RegisterDevice(ctx context.Context, opts InitOptions) (*State, registerDeviceResponse, error) {
+	padding := strings.TrimSpace(opts.Padding)
+	if padding != "" {
+		if _, err := cryptocore.ParsePaddingScheme(padding); err != nil {
+			return nil, registerDeviceResponse{}, err
+		}
+	}
 	dev, err := cryptocore.GenerateIdentityKeypair()
 	if err != nil {
 		return nil, registerDeviceResponse{}, fmt.Errorf("generate identity: %w", err)
 	}
-	bundle, err := dev.PublishPrekeyBundle(0)
+	bundle, err := dev.PublishPQPrekeyBundle(0, oneTimeKEMPrekeys)
 	if err != nil {
 		return nil, registerDeviceResponse{}, fmt.Errorf("publish bundle: %w", err)
 	}
@@ -44,6 +57,13 @@ func RegisterDevice(ctx context.Context, opts InitOptions) (*State, registerDevi
 	req.SignedPreKey.PublicKey = base64.StdEncoding.EncodeToString(bundle.SignedPrekey[:])
 	req.SignedPreKey.Signature = base64.StdEncoding.EncodeToString(bundle.SignedPrekeySig)
 	req.SignedPreKey.CreatedAt = time.Now().UTC()
+	if bundle.KEMPrekey != nil {
+		kem := kemPreKeyToPayload(*bundle.KEMPrekey)
+		req.KEMPreKey = &kem
+	}
+	for _, k := range bundle.OneTimeKEMPrekeys {
+		req.OneTimeKEMPreKeys = append(req.OneTimeKEMPreKeys, kemPreKeyToPayload(k))
+	}
 
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -81,9 +101,10 @@ func RegisterDevice(ctx context.Context, opts InitOptions) (*State, registerDevi
 			DeviceID:        regResp.DeviceID,
 			KeysBaseURL:     normalizeBaseURL(opts.KeysBaseURL),
 			MessagesBaseURL: normalizeBaseURL(opts.MessagesBaseURL),
+			Padding:         padding,
 		},
 		device:   dev,
-		sessions: make(map[string]*cryptocore.SessionState),
+		sessions: make(map[string]*cryptocore.SessionRecord),
 	}
 	return state, regResp, nil
 }
@@ -101,14 +122,35 @@ func LoadStateFromJSON(data []byte) (*State, error) {
 	if err != nil {
 		return nil, err
 	}
-	sessions := make(map[string]*cryptocore.SessionState)
+	if file.Padding != "" {
+		if _, err := cryptocore.ParsePaddingScheme(file.Padding); err != nil {
+			return nil, err
+		}
+	}
+	if err := validTimers(file.Timers); err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]*cryptocore.SessionRecord)
+	for id, snap := range file.Records {
+		record, err := cryptocore.ImportRecord(snap)
+		if err != nil {
+			return nil, fmt.Errorf("import session record %s: %w", id, err)
+		}
+		sessions[id] = record
+	}
 	for id, snap := range file.Sessions {
+		if _, ok := sessions[id]; ok {
+			continue
+		}
 		sess, err := cryptocore.ImportSession(snap)
 		if err != nil {
 			return nil, fmt.Errorf("import session %s: %w", id, err)
 		}
-		sessions[id] = sess
+		record := cryptocore.NewSessionRecord()
+		record.SetCurrent(sess)
+		sessions[id] = record
 	}
+	file.Sessions = nil
 	return &State{file: file, device: dev, sessions: sessions}, nil
 }
 
@@ -120,17 +162,17 @@ func (s *State) Marshal() ([]byte, error) {
 	}
 	s.file.Device = devState
 	if len(s.sessions) == 0 {
-		s.file.Sessions = nil
+		s.file.Records = nil
 	} else {
-		sessions := make(map[string]*cryptocore.SessionStateSnapshot, len(s.sessions))
-		for id, sess := range s.sessions {
-			snap, err := cryptocore.ExportSession(sess)
+		records := make(map[string]*cryptocore.SessionRecordSnapshot, len(s.sessions))
+		for id, record := range s.sessions {
+			snap, err := cryptocore.ExportRecord(record)
 			if err != nil {
-				return nil, fmt.Errorf("export session %s: %w", id, err)
+				return nil, fmt.Errorf("export session record %s: %w", id, err)
 			}
-			sessions[id] = snap
+			records[id] = snap
 		}
-		s.file.Sessions = sessions
+		s.file.Records = records
 	}
 	return json.MarshalIndent(s.file, "", "  ")
 }
@@ -151,16 +193,42 @@ func (s *State) Clone() (*State, error) {
 
 // PrepareSend encrypts plaintext for the given conversation and recipient.
 func (s *State) PrepareSend(convID, toID uuid.UUID, plaintext string) (*sendRequest, error) {
-	opts := &sendOptions{convID: convID, toID: toID, plaintext: plaintext}
-	sess, handshake, err := ensureSession(s, convID, toID)
+	return s.PreparePayload(convID, toID, Payload{Type: ContentText, Body: plaintext})
+}
+
+// PreparePayload encrypts a structured message for the given conversation
+// and recipient. ID and SentAt are filled in when empty. Control content
+// types are reserved for the client itself.
+func (s *State) PreparePayload(convID, toID uuid.UUID, payload Payload) (*sendRequest, error) {
+	if payload.Type == "" {
+		return nil, errors.New("payload type is required")
+	}
+	if payload.IsControl() {
+		return nil, fmt.Errorf("content type %q is reserved", payload.Type)
+	}
+	if payload.ID == "" {
+		payload.ID = uuid.NewString()
+	}
+	if payload.SentAt.IsZero() {
+		payload.SentAt = time.Now().UTC()
+	}
+	req, err := s.sealPayload(convID, toID, payload)
 	if err != nil {
 		return nil, err
 	}
-	return buildSendRequest(s.file.DeviceID, opts, sess, handshake)
+	entry := outboxEntry{ConvID: convID.String(), ToDeviceID: toID.String(), Payload: payload}
+	if timer := s.Timer(convID); timer > 0 {
+		expiresAt := payload.SentAt.Add(timer)
+		entry.ExpiresAt = &expiresAt
+	}
+	s.remember(entry)
+	return req, nil
 }
 
-// HandleEnvelope decrypts an inbound envelope and updates session state.
-func (s *State) HandleEnvelope(env *InboundEnvelope) (string, error) {
+// HandleEnvelope decrypts an inbound envelope and updates session state. On
+// a decryption error the state still has to be saved, and the returned
+// Inbound, if any, carries session reset messages to post.
+func (s *State) HandleEnvelope(env *InboundEnvelope) (*Inbound, error) {
 	return handleInbound(env, s)
 }
 
@@ -176,5 +244,17 @@ func (s *State) KeysBaseURL() string { return s.file.KeysBaseURL }
 // MessagesBaseURL returns the configured message service base URL.
 func (s *State) MessagesBaseURL() string { return s.file.MessagesBaseURL }
 
+// Padding returns the scheme outgoing messages are padded with.
+func (s *State) Padding() cryptocore.PaddingScheme {
+	scheme, err := cryptocore.ParsePaddingScheme(s.file.Padding)
+	if err != nil {
+		return DefaultPadding
+	}
+	return scheme
+}
+
+// SetPadding selects the padding scheme for outgoing messages.
+func (s *State) SetPadding(scheme cryptocore.PaddingScheme) { s.file.Padding = scheme.String() }
+
 // SetPath assigns the persistence path used by Save.
 func (s *State) SetPath(path string) { s.path = path }
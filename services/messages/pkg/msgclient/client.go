@@ -43,19 +43,35 @@ type sendOptions struct {
 }
 
 type stateFile struct {
-	UserID          string                                      `json:"user_id"`
-	DeviceID        string                                      `json:"device_id"`
-	KeysBaseURL     string                                      `json:"keys_base_url"`
-	MessagesBaseURL string                                      `json:"messages_base_url"`
-	Device          *cryptocore.DeviceState                     `json:"device"`
-	Sessions        map[string]*cryptocore.SessionStateSnapshot `json:"sessions,omitempty"`
+	UserID          string                                       `json:"user_id"`
+	DeviceID        string                                       `json:"device_id"`
+	KeysBaseURL     string                                       `json:"keys_base_url"`
+	MessagesBaseURL string                                       `json:"messages_base_url"`
+	Device          *cryptocore.DeviceState                      `json:"device"`
+	Records         map[string]*cryptocore.SessionRecordSnapshot `json:"records,omitempty"`
+	// Sessions is the single-session layout written before records existed.
+	// It is read on load and folded into Records.
+	Sessions map[string]*cryptocore.SessionStateSnapshot `json:"sessions,omitempty"`
+	// Failures counts undecryptable messages per conversation; Outbox keeps
+	// recently sent messages so they can be resent on request.
+	Failures map[string]*failureState `json:"failures,omitempty"`
+	Outbox   []outboxEntry            `json:"outbox,omitempty"`
+	// Padding names the cryptocore padding scheme for outgoing messages;
+	// empty means DefaultPadding.
+	Padding string `json:"padding,omitempty"`
+	// DisableReadReceipts stops this device from telling peers that their
+	// messages were read.
+	DisableReadReceipts bool `json:"disableReadReceipts,omitempty"`
+	// Timers holds the disappearing-message timer in seconds by
+	// conversation, for conversations that have one.
+	Timers map[string]int64 `json:"timers,omitempty"`
 }
 
 type State struct {
 	path     string
 	file     stateFile
 	device   *cryptocore.Device
-	sessions map[string]*cryptocore.SessionState
+	sessions map[string]*cryptocore.SessionRecord
 }
 
 type registerDeviceRequest struct {
@@ -72,6 +88,14 @@ type registerDeviceRequest struct {
 		ID        string `json:"id"`
 		PublicKey string `json:"publicKey"`
 	} `json:"oneTimePreKeys"`
+	KEMPreKey         *kemPreKeyPayload  `json:"kemPreKey,omitempty"`
+	OneTimeKEMPreKeys []kemPreKeyPayload `json:"oneTimeKemPreKeys,omitempty"`
+}
+
+type kemPreKeyPayload struct {
+	ID        uint32 `json:"id"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
 }
 
 type registerDeviceResponse struct {
@@ -93,6 +117,9 @@ type preKeyBundleResponse struct {
 		ID        string `json:"id"`
 		PublicKey string `json:"publicKey"`
 	} `json:"oneTimePreKey"`
+	KEMPreKey        *kemPreKeyPayload `json:"kemPreKey"`
+	OneTimeKEMPreKey *kemPreKeyPayload `json:"oneTimeKemPreKey"`
+	Revoked          bool              `json:"revoked"`
 }
 
 type sendRequest struct {
@@ -101,9 +128,15 @@ type sendRequest struct {
 	ToDeviceID   string          `json:"to_device_id"`
 	Ciphertext   string          `json:"ciphertext"`
 	Header       json.RawMessage `json:"header"`
+	// ExpireAfterSeconds carries the conversation's disappearing-message
+	// timer to the messages service.
+	ExpireAfterSeconds int64 `json:"expire_after_seconds,omitempty"`
 }
 
 type headerPayload struct {
+	// MessageID is readable without decrypting, so a recipient can ask for
+	// a message it could not open.
+	MessageID string            `json:"messageId,omitempty"`
 	Handshake *handshakePayload `json:"handshake,omitempty"`
 	Ratchet   ratchetPayload    `json:"ratchet"`
 }
@@ -113,6 +146,10 @@ type handshakePayload struct {
 	IdentitySignatureKey string  `json:"identitySignatureKey"`
 	EphemeralKey         string  `json:"ephemeralKey"`
 	OneTimePrekeyID      *uint32 `json:"oneTimePrekeyId,omitempty"`
+	// Only set for PQXDH handshakes; classic peers never see them.
+	Protocol      cryptocore.ProtocolVersion `json:"protocol,omitempty"`
+	KEMPrekeyID   uint32                     `json:"kemPrekeyId,omitempty"`
+	KEMCiphertext string                     `json:"kemCiphertext,omitempty"`
 }
 
 type ratchetPayload struct {
@@ -130,6 +167,7 @@ type InboundEnvelope struct {
 	Ciphertext   string          `json:"ciphertext"`
 	Header       json.RawMessage `json:"header"`
 	SentAt       time.Time       `json:"sent_at"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
 }
 
 func RunCLI(prog string, args []string, stderr io.Writer) error {
@@ -146,6 +184,10 @@ func RunCLI(prog string, args []string, stderr io.Writer) error {
 		err = runSend(rest)
 	case "listen":
 		err = runListen(rest)
+	case "reset":
+		err = runReset(rest)
+	case "settings":
+		err = runSettings(rest)
 	default:
 		return UsageError{Program: prog}
 	}
@@ -175,6 +217,8 @@ func (UsageError) UsageLines() []string {
 		"  init      Initialize a device and register with the key service",
 		"  send      Encrypt and send a message",
 		"  listen    Connect to the message service and receive messages",
+		"  reset     End the session with a device and start a new one",
+		"  settings  Show or change privacy settings",
 	}
 }
 
@@ -187,6 +231,7 @@ func runInit(args []string) error {
 	userID := fs.String("user", "", "existing user ID (optional)")
 	deviceID := fs.String("device", "", "existing device ID (optional)")
 	token := fs.String("token", getenv("MSGCTL_ACCESS_TOKEN", ""), "access token for protected endpoints")
+	padding := fs.String("padding", DefaultPadding.String(), "message padding: none, buckets or padme")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -202,6 +247,7 @@ func runInit(args []string) error {
 		UserID:          *userID,
 		DeviceID:        *deviceID,
 		AccessToken:     strings.TrimSpace(*token),
+		Padding:         *padding,
 	})
 	if err != nil {
 		return err
@@ -223,21 +269,114 @@ func runSend(args []string) error {
 	if err != nil {
 		return err
 	}
-	sess, handshake, err := ensureSession(state, opts.convID, opts.toID)
+	req, err := state.PrepareSend(opts.convID, opts.toID, opts.plaintext)
 	if err != nil {
 		return err
 	}
-	req, err := buildSendRequest(state.file.DeviceID, opts, sess, handshake)
+	if err := postMessage(state.file.MessagesBaseURL, req); err != nil {
+		return err
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+	fmt.Println("message queued")
+	return nil
+}
+
+func runReset(args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	statePath := fs.String("state", getenv("MSGCTL_STATE_PATH", defaultStatePath), "state file path")
+	convIDStr := fs.String("conv", "", "conversation UUID")
+	toDevice := fs.String("to", "", "peer device UUID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	convID, err := uuid.Parse(*convIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid conversation id: %w", err)
+	}
+	toID, err := uuid.Parse(*toDevice)
+	if err != nil {
+		return fmt.Errorf("invalid peer device id: %w", err)
+	}
+	state, err := loadState(*statePath)
 	if err != nil {
 		return err
 	}
-	if err := postMessage(state.file.MessagesBaseURL, req); err != nil {
+	in, err := state.ResetSession(convID, toID)
+	if err != nil {
 		return err
 	}
+	for _, req := range in.Outgoing {
+		if err := postMessage(state.file.MessagesBaseURL, req); err != nil {
+			return err
+		}
+	}
 	if err := state.save(); err != nil {
 		return err
 	}
-	fmt.Println("message queued")
+	fmt.Println(in.Notice)
+	return nil
+}
+
+func runSettings(args []string) error {
+	fs := flag.NewFlagSet("settings", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	statePath := fs.String("state", getenv("MSGCTL_STATE_PATH", defaultStatePath), "state file path")
+	readReceipts := fs.String("read-receipts", "", "send read receipts: on or off")
+	padding := fs.String("padding", "", "message padding: none, buckets or padme")
+	conv := fs.String("conv", "", "conversation UUID for --timer")
+	timer := fs.String("timer", "", "disappearing-message timer for --conv, e.g. 1h; 0 turns it off")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	state, err := loadState(*statePath)
+	if err != nil {
+		return err
+	}
+	var convID uuid.UUID
+	if *conv != "" {
+		if convID, err = uuid.Parse(*conv); err != nil {
+			return fmt.Errorf("invalid conversation id: %w", err)
+		}
+	}
+	if *timer != "" {
+		if convID == uuid.Nil {
+			return fmt.Errorf("--timer needs --conv")
+		}
+		d, err := time.ParseDuration(*timer)
+		if *timer == "0" {
+			d, err = 0, nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid timer: %w", err)
+		}
+		if err := state.SetTimer(convID, d); err != nil {
+			return err
+		}
+	}
+	switch *readReceipts {
+	case "":
+	case "on", "off":
+		state.SetReadReceipts(*readReceipts == "on")
+	default:
+		return fmt.Errorf("read-receipts must be on or off")
+	}
+	if *padding != "" {
+		scheme, err := cryptocore.ParsePaddingScheme(*padding)
+		if err != nil {
+			return err
+		}
+		state.SetPadding(scheme)
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+	fmt.Printf("read receipts: %t\npadding: %s\n", state.ReadReceipts(), state.Padding())
+	if convID != uuid.Nil {
+		fmt.Printf("timer: %s\n", state.Timer(convID))
+	}
 	return nil
 }
 
@@ -292,8 +431,9 @@ func resolvePlaintext(arg string) (string, error) {
 }
 
 func ensureSession(state *State, convID, toID uuid.UUID) (*cryptocore.SessionState, *cryptocore.HandshakeMessage, error) {
-	if sess, ok := state.sessions[convID.String()]; ok {
-		return sess, nil, nil
+	record, ok := state.sessions[convID.String()]
+	if ok && record.Current() != nil {
+		return record.Current(), nil, nil
 	}
 	bundle, err := fetchBundle(state.file.KeysBaseURL, toID)
 	if err != nil {
@@ -303,25 +443,58 @@ func ensureSession(state *State, convID, toID uuid.UUID) (*cryptocore.SessionSta
 	if err != nil {
 		return nil, nil, fmt.Errorf("init session: %w", err)
 	}
-	state.sessions[convID.String()] = sess
+	if record == nil {
+		record = cryptocore.NewSessionRecord()
+		state.sessions[convID.String()] = record
+	}
+	record.SetCurrent(sess)
 	return sess, handshake, nil
 }
 
-func buildSendRequest(fromDeviceID string, opts *sendOptions, sess *cryptocore.SessionState, handshake *cryptocore.HandshakeMessage) (*sendRequest, error) {
-	ciphertext, header, err := cryptocore.Encrypt(sess, []byte(opts.plaintext))
+// sealPayload encrypts payload on the conversation's current session,
+// starting one if needed.
+func (s *State) sealPayload(convID, toID uuid.UUID, payload Payload) (*sendRequest, error) {
+	sess, handshake, err := ensureSession(s, convID, toID)
+	if err != nil {
+		return nil, err
+	}
+	return s.seal(convID, toID, payload, sess, handshake)
+}
+
+// seal encrypts payload on sess, giving it an ID and timestamp if it has
+// none yet.
+func (s *State) seal(convID, toID uuid.UUID, payload Payload, sess *cryptocore.SessionState, handshake *cryptocore.HandshakeMessage) (*sendRequest, error) {
+	if payload.ID == "" {
+		payload.ID = uuid.NewString()
+	}
+	if payload.SentAt.IsZero() {
+		payload.SentAt = time.Now().UTC()
+	}
+	plaintext, err := encodePayload(payload, s.Padding())
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, header, err := cryptocore.Encrypt(sess, plaintext)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt: %w", err)
 	}
-	headerJSON, err := buildHeaderJSON(header, handshake)
+	headerJSON, err := buildHeaderJSON(payload.ID, header, handshake)
 	if err != nil {
 		return nil, err
 	}
+	// Session control messages must reach the peer however late, or the
+	// two sides' sessions stay out of step.
+	expireAfter := s.file.Timers[convID.String()]
+	if strings.HasPrefix(payload.Type, "session.") {
+		expireAfter = 0
+	}
 	return &sendRequest{
-		ConvID:       opts.convID.String(),
-		FromDeviceID: fromDeviceID,
-		ToDeviceID:   opts.toID.String(),
-		Ciphertext:   base64.StdEncoding.EncodeToString(ciphertext),
-		Header:       headerJSON,
+		ConvID:             convID.String(),
+		FromDeviceID:       s.file.DeviceID,
+		ToDeviceID:         toID.String(),
+		Ciphertext:         base64.StdEncoding.EncodeToString(ciphertext),
+		Header:             headerJSON,
+		ExpireAfterSeconds: expireAfter,
 	}, nil
 }
 
@@ -389,62 +562,236 @@ func runListen(args []string) error {
 		if err != nil {
 			return err
 		}
+		var frame struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(payload, &frame); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid frame: %v\n", err)
+			continue
+		}
+		switch frame.Type {
+		case "":
+		case frameDelivered:
+			var notice deliveryNotice
+			if err := json.Unmarshal(payload, &notice); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid delivery notice: %v\n", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "[%s] delivered %s to %s\n", notice.At.Format(time.RFC3339), notice.ID, notice.ToDeviceID); err != nil {
+				return err
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
 		var env InboundEnvelope
 		if err := json.Unmarshal(payload, &env); err != nil {
 			fmt.Fprintf(os.Stderr, "invalid envelope: %v\n", err)
 			continue
 		}
-		plaintext, err := handleInbound(&env, state)
+		in, err := handleInbound(&env, state)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "decrypt failed: %v\n", err)
-			continue
 		}
-		if _, err := fmt.Fprintf(writer, "[%s] %s -> %s: %s\n", env.SentAt.Format(time.RFC3339), env.FromDeviceID, env.ToDeviceID, plaintext); err != nil {
+		if in != nil {
+			if err := printInbound(writer, &env, in); err != nil {
+				return err
+			}
+			// Printed messages count as read.
+			if in.Payload != nil && in.Payload.ID != "" {
+				convID, fromID, err := envelopePeer(&env)
+				if err != nil {
+					return err
+				}
+				receipt, err := state.PrepareReadReceipt(convID, fromID, []string{in.Payload.ID})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "read receipt: %v\n", err)
+				} else if receipt != nil {
+					in.Outgoing = append(in.Outgoing, receipt)
+				}
+			}
+			for _, req := range in.Outgoing {
+				if err := postMessage(state.file.MessagesBaseURL, req); err != nil {
+					fmt.Fprintf(os.Stderr, "send control message: %v\n", err)
+				}
+			}
+		}
+		if err := state.save(); err != nil {
 			return err
 		}
-		if err := writer.Flush(); err != nil {
+		ack, err := encodeAck(env.ID)
+		if err != nil {
 			return err
 		}
-		if err := state.save(); err != nil {
+		if err := conn.writeFrame(wsOpText, ack); err != nil {
+			return err
+		}
+	}
+}
+
+func printInbound(w *bufio.Writer, env *InboundEnvelope, in *Inbound) error {
+	stamp := env.SentAt.Format(time.RFC3339)
+	if in.Notice != "" {
+		if _, err := fmt.Fprintf(w, "[%s] %s <-> %s: -- %s --\n", stamp, env.FromDeviceID, env.ToDeviceID, in.Notice); err != nil {
+			return err
+		}
+	}
+	if in.Plaintext != "" {
+		text := in.Plaintext
+		if in.ExpiresAt != nil {
+			text += fmt.Sprintf(" (disappears %s)", in.ExpiresAt.Local().Format(time.RFC3339))
+		}
+		if _, err := fmt.Fprintf(w, "[%s] %s -> %s: %s\n", stamp, env.FromDeviceID, env.ToDeviceID, text); err != nil {
+			return err
+		}
+	}
+	if in.Receipt != nil {
+		if _, err := fmt.Fprintf(w, "[%s] %s %s %s\n", stamp, env.FromDeviceID, in.Receipt.Status, strings.Join(in.Receipt.MessageIDs, ", ")); err != nil {
 			return err
 		}
 	}
+	return w.Flush()
 }
 
-func handleInbound(env *InboundEnvelope, state *State) (string, error) {
+// handleInbound decrypts env and acts on control messages. When the session
+// is out of step it returns the decryption error together with any reset
+// messages that have to be posted.
+func handleInbound(env *InboundEnvelope, state *State) (*Inbound, error) {
 	var header headerPayload
 	if err := json.Unmarshal(env.Header, &header); err != nil {
-		return "", fmt.Errorf("decode header: %w", err)
+		return nil, fmt.Errorf("decode header: %w", err)
 	}
 	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
 	if err != nil {
-		return "", fmt.Errorf("decode ciphertext: %w", err)
+		return nil, fmt.Errorf("decode ciphertext: %w", err)
+	}
+	plaintext, err := openEnvelope(env, state, &header, ciphertext)
+	if err != nil {
+		if !IsSessionFailure(err) {
+			return nil, err
+		}
+		in, resetErr := state.recordFailure(env, header.MessageID)
+		if resetErr != nil {
+			return nil, fmt.Errorf("%w (session reset failed: %v)", err, resetErr)
+		}
+		return in, err
+	}
+	delete(state.file.Failures, env.ConvID)
+	payload, ok, err := decodePayload(plaintext)
+	if err != nil {
+		return nil, err
 	}
-	convID := env.ConvID
-	sess, ok := state.sessions[convID]
 	if !ok {
+		return &Inbound{Notice: NoticeNewerPayload}, nil
+	}
+	switch payload.Type {
+	case ContentText:
+		return state.received(env, &payload)
+	case ContentSessionEnd:
+		// The peer dropped its earlier sessions and sends this as the first
+		// message of the new one, so the handshake names the session to keep.
 		if header.Handshake == nil {
-			return "", fmt.Errorf("missing handshake for new session")
+			return nil, fmt.Errorf("session end without handshake")
 		}
 		hs, err := payloadToHandshake(header.Handshake)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		if err := state.sessions[env.ConvID].EndOtherSessions(hs.EphemeralKey); err != nil {
+			return nil, err
+		}
+		return &Inbound{Notice: NoticeSessionReset}, nil
+	case ContentResendRequest:
+		convID, fromID, err := envelopePeer(env)
+		if err != nil {
+			return nil, err
+		}
+		outgoing, err := state.resend(convID, fromID, payload.Resend)
+		if err != nil {
+			return nil, err
+		}
+		return &Inbound{Outgoing: outgoing}, nil
+	case ContentDeliveryReceipt, ContentReadReceipt:
+		return &Inbound{Receipt: receiptFor(&payload)}, nil
+	default:
+		// Unknown control messages are dropped; other unknown types fall
+		// back to their body so newer clients stay readable.
+		if payload.IsControl() {
+			return &Inbound{}, nil
+		}
+		return state.received(env, &payload)
+	}
+}
+
+// received returns a message to show, with a delivery receipt for the sender
+// unless the message predates payload IDs. A disappearing message read after
+// its expiry is dropped.
+func (s *State) received(env *InboundEnvelope, payload *Payload) (*Inbound, error) {
+	if expired(env.ExpiresAt, time.Now()) {
+		return &Inbound{}, nil
+	}
+	in := &Inbound{Plaintext: payload.Body, Payload: payload, ExpiresAt: env.ExpiresAt}
+	if payload.ID == "" {
+		return in, nil
+	}
+	convID, fromID, err := envelopePeer(env)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := s.sealPayload(convID, fromID, Payload{Type: ContentDeliveryReceipt, Receipts: []string{payload.ID}})
+	if err != nil {
+		return nil, err
+	}
+	in.Outgoing = append(in.Outgoing, receipt)
+	return in, nil
+}
+
+// envelopePeer parses the conversation and sender of env.
+func envelopePeer(env *InboundEnvelope) (convID, fromID uuid.UUID, err error) {
+	convID, err = uuid.Parse(env.ConvID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid conversation id: %w", err)
+	}
+	fromID, err = uuid.Parse(env.FromDeviceID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid sender device id: %w", err)
+	}
+	return convID, fromID, nil
+}
+
+func openEnvelope(env *InboundEnvelope, state *State, header *headerPayload, ciphertext []byte) ([]byte, error) {
+	convID := env.ConvID
+	record, ok := state.sessions[convID]
+	if !ok {
+		if header.Handshake == nil {
+			return nil, fmt.Errorf("missing handshake for new session: %w", cryptocore.ErrNoSession)
 		}
-		sess, err = state.device.AcceptSession(hs)
+		record = cryptocore.NewSessionRecord()
+	}
+	// A handshake on a known conversation means the peer reset or both sides
+	// started a session at once; the record sorts out which one is live.
+	if header.Handshake != nil {
+		hs, err := payloadToHandshake(header.Handshake)
 		if err != nil {
-			return "", fmt.Errorf("accept session: %w", err)
+			return nil, err
+		}
+		if err := record.Accept(state.device, hs); err != nil {
+			return nil, fmt.Errorf("accept session: %w", err)
 		}
-		state.sessions[convID] = sess
+		state.sessions[convID] = record
 	}
 	msgHeader, err := payloadToMessageHeader(&header.Ratchet)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	plaintext, err := cryptocore.Decrypt(sess, ciphertext, msgHeader)
+	plaintext, err := record.Decrypt(ciphertext, msgHeader)
 	if err != nil {
-		return "", fmt.Errorf("decrypt: %w", err)
+		return nil, fmt.Errorf("decrypt: %w", err)
 	}
-	return string(plaintext), nil
+	return plaintext, nil
 }
 
 func fetchBundle(base string, deviceID uuid.UUID) (*cryptocore.PrekeyBundle, error) {
@@ -457,6 +804,9 @@ func fetchBundle(base string, deviceID uuid.UUID) (*cryptocore.PrekeyBundle, err
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	if resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("device %s has been revoked", deviceID)
+	}
 	if resp.StatusCode >= 400 {
 		data, _ := io.ReadAll(resp.Body)
 		if len(data) == 0 {
@@ -468,6 +818,9 @@ func fetchBundle(base string, deviceID uuid.UUID) (*cryptocore.PrekeyBundle, err
 	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
 		return nil, err
 	}
+	if bundle.Revoked {
+		return nil, fmt.Errorf("device %s has been revoked", deviceID)
+	}
 	return convertBundle(&bundle)
 }
 
@@ -505,14 +858,49 @@ func convertBundle(resp *preKeyBundleResponse) (*cryptocore.PrekeyBundle, error)
 			out.OneTimePrekeys = []cryptocore.OneTimePrekey{{ID: id, Public: pk}}
 		}
 	}
+	if resp.KEMPreKey != nil {
+		kem, err := convertKEMPreKey(resp.KEMPreKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode KEM prekey: %w", err)
+		}
+		out.KEMPrekey = &kem
+	}
+	if resp.OneTimeKEMPreKey != nil {
+		kem, err := convertKEMPreKey(resp.OneTimeKEMPreKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode one-time KEM prekey: %w", err)
+		}
+		out.OneTimeKEMPrekeys = []cryptocore.KEMPrekey{kem}
+	}
 	return &out, nil
 }
 
-func buildHeaderJSON(header *cryptocore.MessageHeader, handshake *cryptocore.HandshakeMessage) (json.RawMessage, error) {
+func convertKEMPreKey(p *kemPreKeyPayload) (cryptocore.KEMPrekey, error) {
+	pub, err := base64.StdEncoding.DecodeString(p.PublicKey)
+	if err != nil {
+		return cryptocore.KEMPrekey{}, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(p.Signature)
+	if err != nil {
+		return cryptocore.KEMPrekey{}, err
+	}
+	return cryptocore.KEMPrekey{ID: p.ID, Public: pub, Signature: sig}, nil
+}
+
+func kemPreKeyToPayload(k cryptocore.KEMPrekey) kemPreKeyPayload {
+	return kemPreKeyPayload{
+		ID:        k.ID,
+		PublicKey: base64.StdEncoding.EncodeToString(k.Public),
+		Signature: base64.StdEncoding.EncodeToString(k.Signature),
+	}
+}
+
+func buildHeaderJSON(messageID string, header *cryptocore.MessageHeader, handshake *cryptocore.HandshakeMessage) (json.RawMessage, error) {
 	if header == nil {
 		return nil, fmt.Errorf("nil message header")
 	}
 	hp := headerPayload{
+		MessageID: messageID,
 		Ratchet: ratchetPayload{
 			DHPublic: base64.StdEncoding.EncodeToString(header.DHPublic[:]),
 			PN:       header.PN,
@@ -526,6 +914,11 @@ func buildHeaderJSON(header *cryptocore.MessageHeader, handshake *cryptocore.Han
 			IdentitySignatureKey: base64.StdEncoding.EncodeToString(handshake.IdentitySignatureKey),
 			EphemeralKey:         base64.StdEncoding.EncodeToString(handshake.EphemeralKey[:]),
 			OneTimePrekeyID:      handshake.OneTimePrekeyID,
+			Protocol:             handshake.Protocol,
+			KEMPrekeyID:          handshake.KEMPrekeyID,
+		}
+		if len(handshake.KEMCiphertext) > 0 {
+			hp.Handshake.KEMCiphertext = base64.StdEncoding.EncodeToString(handshake.KEMCiphertext)
 		}
 	}
 	data, err := json.Marshal(hp)
@@ -582,6 +975,15 @@ func payloadToHandshake(p *handshakePayload) (*cryptocore.HandshakeMessage, erro
 		IdentitySignatureKey: sigKey,
 		EphemeralKey:         eph,
 		OneTimePrekeyID:      p.OneTimePrekeyID,
+		Protocol:             p.Protocol,
+		KEMPrekeyID:          p.KEMPrekeyID,
+	}
+	if p.KEMCiphertext != "" {
+		ct, err := base64.StdEncoding.DecodeString(p.KEMCiphertext)
+		if err != nil {
+			return nil, fmt.Errorf("decode handshake KEM ciphertext: %w", err)
+		}
+		msg.KEMCiphertext = ct
 	}
 	return msg, nil
 }
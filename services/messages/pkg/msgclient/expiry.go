@@ -0,0 +1,73 @@
+package msgclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxTimer is the longest disappearing-message timer the messages service
+// accepts.
+const MaxTimer = 365 * 24 * time.Hour
+
+// Timer returns the disappearing-message timer of a conversation, zero when
+// its messages are kept.
+func (s *State) Timer(convID uuid.UUID) time.Duration {
+	return time.Duration(s.file.Timers[convID.String()]) * time.Second
+}
+
+// SetTimer sets the disappearing-message timer for messages this device
+// sends in a conversation. The messages service deletes each message that
+// long after it was sent, and the outbox forgets it at the same time. Zero
+// turns the timer off.
+func (s *State) SetTimer(convID uuid.UUID, d time.Duration) error {
+	if d < 0 || d > MaxTimer || d%time.Second != 0 {
+		return fmt.Errorf("timer must be whole seconds between 0 and %s", MaxTimer)
+	}
+	if d == 0 {
+		delete(s.file.Timers, convID.String())
+		return nil
+	}
+	if s.file.Timers == nil {
+		s.file.Timers = make(map[string]int64)
+	}
+	s.file.Timers[convID.String()] = int64(d / time.Second)
+	return nil
+}
+
+// Timers lists the conversations that have a disappearing-message timer,
+// keyed by conversation ID.
+func (s *State) Timers() map[string]time.Duration {
+	out := make(map[string]time.Duration, len(s.file.Timers))
+	for id, secs := range s.file.Timers {
+		out[id] = time.Duration(secs) * time.Second
+	}
+	return out
+}
+
+func validTimers(timers map[string]int64) error {
+	for id, secs := range timers {
+		if secs <= 0 || time.Duration(secs) > MaxTimer/time.Second {
+			return fmt.Errorf("invalid timer for conversation %s", id)
+		}
+	}
+	return nil
+}
+
+// expired reports whether a message expiring at expiresAt is gone by now.
+func expired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+// pruneOutbox drops sent messages whose expiry has passed, so they are never
+// resent.
+func (s *State) pruneOutbox(now time.Time) {
+	kept := s.file.Outbox[:0]
+	for _, entry := range s.file.Outbox {
+		if !expired(entry.ExpiresAt, now) {
+			kept = append(kept, entry)
+		}
+	}
+	s.file.Outbox = kept
+}
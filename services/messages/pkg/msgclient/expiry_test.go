@@ -0,0 +1,168 @@
+package msgclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSetTimer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timer   time.Duration
+		wantErr bool
+	}{
+		{name: "thirty seconds", timer: 30 * time.Second},
+		{name: "longest", timer: MaxTimer},
+		{name: "off", timer: 0},
+		{name: "negative", timer: -time.Second, wantErr: true},
+		{name: "too long", timer: MaxTimer + time.Second, wantErr: true},
+		{name: "fraction of a second", timer: 1500 * time.Millisecond, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &State{}
+			conv := uuid.New()
+			if err := s.SetTimer(conv, time.Minute); err != nil {
+				t.Fatalf("set timer: %v", err)
+			}
+			err := s.SetTimer(conv, tc.timer)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%v, got %v", tc.wantErr, err)
+			}
+			want := tc.timer
+			if tc.wantErr {
+				want = time.Minute
+			}
+			if got := s.Timer(conv); got != want {
+				t.Fatalf("expected timer %v, got %v", want, got)
+			}
+			if _, listed := s.Timers()[conv.String()]; listed != (want != 0) {
+				t.Fatalf("expected the conversation listed=%v", want != 0)
+			}
+			if err := validTimers(s.file.Timers); err != nil {
+				t.Fatalf("stored timers rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidTimers(t *testing.T) {
+	tests := []struct {
+		name    string
+		timers  map[string]int64
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "valid", timers: map[string]int64{"c1": 30, "c2": int64(MaxTimer / time.Second)}},
+		{name: "zero", timers: map[string]int64{"c1": 0}, wantErr: true},
+		{name: "negative", timers: map[string]int64{"c1": -5}, wantErr: true},
+		{name: "too long", timers: map[string]int64{"c1": int64(MaxTimer/time.Second) + 1}, wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := validTimers(tc.timers); (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error=%v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestPruneOutbox(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Second)
+	s := &State{file: stateFile{Outbox: []outboxEntry{
+		{Payload: Payload{ID: "kept"}},
+		{Payload: Payload{ID: "expired"}, ExpiresAt: &past},
+		{Payload: Payload{ID: "due now"}, ExpiresAt: &now},
+		{Payload: Payload{ID: "later"}, ExpiresAt: &future},
+	}}}
+	s.pruneOutbox(now)
+	var ids []string
+	for _, e := range s.file.Outbox {
+		ids = append(ids, e.Payload.ID)
+	}
+	if len(ids) != 2 || ids[0] != "kept" || ids[1] != "later" {
+		t.Fatalf("expected kept and later to remain, got %v", ids)
+	}
+}
+
+func TestTimerAppliesToSends(t *testing.T) {
+	p := newPeers(t)
+	bobID := deviceUUID(t, p.bob)
+	if err := p.alice.SetTimer(p.conv, 30*time.Second); err != nil {
+		t.Fatalf("set timer: %v", err)
+	}
+
+	req := p.send(t, p.alice, p.bob, "secret")
+	if req.ExpireAfterSeconds != 30 {
+		t.Fatalf("expected the timer on the send, got %d", req.ExpireAfterSeconds)
+	}
+	entry := p.alice.file.Outbox[len(p.alice.file.Outbox)-1]
+	if entry.ExpiresAt == nil || !entry.ExpiresAt.Equal(entry.Payload.SentAt.Add(30*time.Second)) {
+		t.Fatalf("expected the outbox entry to expire with the message, got %v", entry.ExpiresAt)
+	}
+
+	resent, err := p.alice.resend(p.conv, bobID, []string{entry.Payload.ID})
+	if err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	if len(resent) != 1 || resent[0].ExpireAfterSeconds <= 0 || resent[0].ExpireAfterSeconds > 30 {
+		t.Fatalf("expected the resend to keep the remaining time, got %+v", resent)
+	}
+
+	reset, err := p.alice.ResetSession(p.conv, bobID)
+	if err != nil {
+		t.Fatalf("reset session: %v", err)
+	}
+	for _, req := range reset.Outgoing {
+		if req.ExpireAfterSeconds != 0 {
+			t.Fatalf("expected session control messages never to expire, got %d", req.ExpireAfterSeconds)
+		}
+	}
+
+	past := time.Now().Add(-time.Second)
+	p.alice.file.Outbox[len(p.alice.file.Outbox)-1].ExpiresAt = &past
+	if resent, err := p.alice.resend(p.conv, bobID, []string{entry.Payload.ID}); err != nil || len(resent) != 0 {
+		t.Fatalf("expected an expired message not to be resent, got %d (%v)", len(resent), err)
+	}
+}
+
+func TestReceivedExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		wantShown bool
+	}{
+		{name: "kept", wantShown: true},
+		{name: "still live", expiresIn: time.Minute, wantShown: true},
+		{name: "expired before it was read", expiresIn: -time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newPeers(t)
+			req := p.send(t, p.alice, p.bob, "secret")
+			env := &InboundEnvelope{
+				ID:           uuid.NewString(),
+				ConvID:       req.ConvID,
+				FromDeviceID: req.FromDeviceID,
+				ToDeviceID:   req.ToDeviceID,
+				Ciphertext:   req.Ciphertext,
+				Header:       req.Header,
+			}
+			if tc.expiresIn != 0 {
+				at := time.Now().Add(tc.expiresIn)
+				env.ExpiresAt = &at
+			}
+			in, err := p.bob.HandleEnvelope(env)
+			if err != nil {
+				t.Fatalf("handle envelope: %v", err)
+			}
+			if shown := in.Plaintext == "secret"; shown != tc.wantShown {
+				t.Fatalf("expected shown=%v, got %+v", tc.wantShown, in)
+			}
+			if tc.wantShown && in.ExpiresAt != env.ExpiresAt {
+				t.Fatalf("expected the expiry passed on, got %v", in.ExpiresAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package msgclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	cryptocore "cryptocore"
+)
+
+// payloadVersion is the first byte of every plaintext this client encrypts.
+// A JSON Payload follows, padded with cryptocore.Pad over the whole
+// plaintext. Adding optional fields keeps the version; readers ignore fields
+// they do not know. Version 1 carried unpadded JSON, and older clients
+// encrypted the raw text, which is still read as a text message.
+const (
+	payloadVersionJSON   byte = 0x01
+	payloadVersionPadded byte = 0x02
+	payloadVersion            = payloadVersionPadded
+)
+
+// maxPayloadVersion ends the byte range reserved for payload versions.
+// Typed text never starts with these control characters, so a plaintext
+// from an older client cannot be mistaken for a payload.
+const maxPayloadVersion byte = 0x08
+
+// Content types carried inside the ciphertext. The session.* and receipt.*
+// types are control messages handled by the client and never shown as
+// messages.
+const (
+	ContentText            = "text"
+	ContentSessionEnd      = "session.end"
+	ContentResendRequest   = "session.resend"
+	ContentDeliveryReceipt = "receipt.delivered"
+	ContentReadReceipt     = "receipt.read"
+)
+
+// controlPrefixes mark content types that are never shown to the user, even
+// when this client does not know them.
+var controlPrefixes = []string{"session.", "receipt."}
+
+// NoticeNewerPayload is reported for messages written in a payload version
+// this client cannot read.
+const NoticeNewerPayload = "message needs a newer client"
+
+// Payload is the content encrypted inside every message. A client that does
+// not know Type shows Body as text, so new content types should carry a
+// readable fallback there.
+type Payload struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id,omitempty"`
+	SentAt  time.Time `json:"ts,omitempty"`
+	ReplyTo *Quote    `json:"replyTo,omitempty"`
+	Body    string    `json:"body,omitempty"`
+	// Resend lists the message IDs a resend request asks for again.
+	Resend []string `json:"resend,omitempty"`
+	// Receipts lists the message IDs a receipt confirms.
+	Receipts []string `json:"receipts,omitempty"`
+}
+
+// Quote references the message a reply answers, with an excerpt of it.
+type Quote struct {
+	ID   string `json:"id"`
+	Body string `json:"body,omitempty"`
+}
+
+// IsControl reports whether the payload is a control message.
+func (p *Payload) IsControl() bool {
+	for _, prefix := range controlPrefixes {
+		if strings.HasPrefix(p.Type, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPadding is the padding scheme of states that have not chosen one.
+const DefaultPadding = cryptocore.PaddingBuckets
+
+func encodePayload(p Payload, scheme cryptocore.PaddingScheme) ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return cryptocore.Pad(append([]byte{payloadVersion}, data...), scheme)
+}
+
+// decodePayload parses a decrypted plaintext. It returns ok=false for a
+// payload version newer than this client understands.
+func decodePayload(plaintext []byte) (p Payload, ok bool, err error) {
+	switch {
+	case len(plaintext) > 0 && plaintext[0] == payloadVersionPadded:
+		unpadded, err := cryptocore.Unpad(plaintext)
+		if err != nil {
+			return Payload{}, false, fmt.Errorf("decode payload: %w", err)
+		}
+		plaintext = unpadded
+	case len(plaintext) > 0 && plaintext[0] == payloadVersionJSON:
+	case len(plaintext) > 0 && plaintext[0] > payloadVersion && plaintext[0] <= maxPayloadVersion:
+		return Payload{}, false, nil
+	default:
+		return Payload{Type: ContentText, Body: string(plaintext)}, true, nil
+	}
+	if err := json.Unmarshal(plaintext[1:], &p); err != nil {
+		return Payload{}, false, fmt.Errorf("decode payload: %w", err)
+	}
+	if p.Type == "" {
+		return Payload{}, false, fmt.Errorf("payload without content type")
+	}
+	return p, true, nil
+}
@@ -0,0 +1,126 @@
+package msgclient
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	cryptocore "cryptocore"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	sent := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	payloads := []Payload{
+		{Type: ContentText, ID: "m1", SentAt: sent, Body: "hello"},
+		{Type: ContentText, ID: "m2", SentAt: sent, Body: "sure", ReplyTo: &Quote{ID: "m1", Body: "hello"}},
+		{Type: ContentResendRequest, Resend: []string{"m1", "m2"}},
+		{Type: ContentReadReceipt, Receipts: []string{"m1"}},
+		{Type: "image", Body: "[image]"},
+	}
+	for _, scheme := range []cryptocore.PaddingScheme{cryptocore.PaddingNone, cryptocore.PaddingBuckets, cryptocore.PaddingPadme} {
+		for _, want := range payloads {
+			plaintext, err := encodePayload(want, scheme)
+			if err != nil {
+				t.Fatalf("%v %s: encode: %v", scheme, want.Type, err)
+			}
+			if plaintext[0] != payloadVersion {
+				t.Fatalf("%v %s: expected version %d, got %d", scheme, want.Type, payloadVersion, plaintext[0])
+			}
+			got, ok, err := decodePayload(plaintext)
+			if err != nil || !ok {
+				t.Fatalf("%v %s: decode: ok=%v err=%v", scheme, want.Type, ok, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%v: expected %+v, got %+v", scheme, want, got)
+			}
+		}
+	}
+}
+
+func TestDecodePayloadVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext []byte
+		want      Payload
+		ok        bool
+		wantErr   bool
+	}{
+		{
+			name:      "raw text from older clients",
+			plaintext: []byte("hi there"),
+			want:      Payload{Type: ContentText, Body: "hi there"},
+			ok:        true,
+		},
+		{
+			name:      "unpadded version 1",
+			plaintext: append([]byte{payloadVersionJSON}, `{"type":"text","body":"v1"}`...),
+			want:      Payload{Type: ContentText, Body: "v1"},
+			ok:        true,
+		},
+		{
+			name:      "unknown fields are ignored",
+			plaintext: append([]byte{payloadVersionJSON}, `{"type":"text","body":"x","future":1}`...),
+			want:      Payload{Type: ContentText, Body: "x"},
+			ok:        true,
+		},
+		{
+			name:      "newer version",
+			plaintext: append([]byte{payloadVersion + 1}, `{"type":"text"}`...),
+		},
+		{
+			name:      "last reserved version",
+			plaintext: []byte{maxPayloadVersion},
+		},
+		{
+			name:      "missing content type",
+			plaintext: append([]byte{payloadVersionJSON}, `{"body":"x"}`...),
+			wantErr:   true,
+		},
+		{
+			name:      "malformed json",
+			plaintext: append([]byte{payloadVersionJSON}, `{"type":`...),
+			wantErr:   true,
+		},
+		{
+			name:      "padded without end marker",
+			plaintext: []byte{payloadVersionPadded, 0, 0, 0},
+			wantErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := decodePayload(tc.plaintext)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%v, got %v", tc.wantErr, err)
+			}
+			if ok != tc.ok {
+				t.Fatalf("expected ok=%v, got %v", tc.ok, ok)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPayloadIsControl(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{ContentText, false},
+		{"image", false},
+		{ContentSessionEnd, true},
+		{ContentResendRequest, true},
+		{ContentDeliveryReceipt, true},
+		{ContentReadReceipt, true},
+		{"session.future", true},
+		{"receipt.future", true},
+	}
+	for _, tc := range tests {
+		p := Payload{Type: tc.contentType}
+		if got := p.IsControl(); got != tc.want {
+			t.Errorf("%s: expected control=%v, got %v", tc.contentType, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package msgclient
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Receipt statuses reported in Inbound.Receipt.
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// Receipt reports that the peer device received or read messages this device
+// sent. MessageIDs are payload IDs, not the messages service's IDs.
+type Receipt struct {
+	Status     string   `json:"status"`
+	MessageIDs []string `json:"messageIds"`
+}
+
+// WebSocket frames other than envelopes name their kind in a type field.
+const (
+	frameAck       = "ack"
+	frameDelivered = "delivered"
+)
+
+// ackFrame tells the messages service that envelopes were processed.
+type ackFrame struct {
+	Type string   `json:"type"`
+	IDs  []string `json:"ids"`
+}
+
+// deliveryNotice is the messages service's word that the recipient device
+// acknowledged a message. ID is the service's message ID.
+type deliveryNotice struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	ConvID     string    `json:"conv_id"`
+	ToDeviceID string    `json:"to_device_id"`
+	At         time.Time `json:"at"`
+}
+
+// ReadReceipts reports whether this device tells peers that their messages
+// were read.
+func (s *State) ReadReceipts() bool { return !s.file.DisableReadReceipts }
+
+// SetReadReceipts turns read receipts on or off. Delivery receipts are always
+// sent; they reveal nothing the messages service does not already see.
+func (s *State) SetReadReceipts(on bool) { s.file.DisableReadReceipts = !on }
+
+// PrepareReadReceipt encrypts a read receipt for the given messages from
+// toID. It returns nil when read receipts are turned off.
+func (s *State) PrepareReadReceipt(convID, toID uuid.UUID, ids []string) (*sendRequest, error) {
+	if !s.ReadReceipts() || len(ids) == 0 {
+		return nil, nil
+	}
+	return s.sealPayload(convID, toID, Payload{Type: ContentReadReceipt, Receipts: ids})
+}
+
+// receiptFor returns the receipt carried by a receipt payload.
+func receiptFor(p *Payload) *Receipt {
+	status := ReceiptDelivered
+	if p.Type == ContentReadReceipt {
+		status = ReceiptRead
+	}
+	return &Receipt{Status: status, MessageIDs: p.Receipts}
+}
+
+func encodeAck(ids ...string) ([]byte, error) {
+	return json.Marshal(ackFrame{Type: frameAck, IDs: ids})
+}
@@ -0,0 +1,72 @@
+package msgclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReceiptFor(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{ContentDeliveryReceipt, ReceiptDelivered},
+		{ContentReadReceipt, ReceiptRead},
+	}
+	for _, tc := range tests {
+		got := receiptFor(&Payload{Type: tc.contentType, Receipts: []string{"m1", "m2"}})
+		want := &Receipt{Status: tc.want, MessageIDs: []string{"m1", "m2"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %+v, got %+v", tc.contentType, want, got)
+		}
+	}
+}
+
+func TestPrepareReadReceiptSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		on   bool
+		ids  []string
+	}{
+		{name: "read receipts off", ids: []string{"m1"}},
+		{name: "nothing read", on: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &State{}
+			s.SetReadReceipts(tc.on)
+			if s.ReadReceipts() != tc.on {
+				t.Fatalf("expected read receipts %v", tc.on)
+			}
+			req, err := s.PrepareReadReceipt(uuid.New(), uuid.New(), tc.ids)
+			if err != nil || req != nil {
+				t.Fatalf("expected no receipt, got %+v (%v)", req, err)
+			}
+		})
+	}
+}
+
+func TestDeliveryFrames(t *testing.T) {
+	ack, err := encodeAck("a", "b")
+	if err != nil {
+		t.Fatalf("encode ack: %v", err)
+	}
+	if string(ack) != `{"type":"ack","ids":["a","b"]}` {
+		t.Fatalf("unexpected ack frame %s", ack)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var notice deliveryNotice
+	frame := `{"type":"delivered","id":"m1","conv_id":"c1","to_device_id":"d1","at":"2026-03-01T12:00:00Z"}`
+	if err := json.Unmarshal([]byte(frame), &notice); err != nil {
+		t.Fatalf("decode notice: %v", err)
+	}
+	want := deliveryNotice{Type: frameDelivered, ID: "m1", ConvID: "c1", ToDeviceID: "d1", At: at}
+	if notice != want {
+		t.Fatalf("expected %+v, got %+v", want, notice)
+	}
+}
@@ -0,0 +1,179 @@
+package msgclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	cryptocore "cryptocore"
+)
+
+const (
+	// resetAfterFailures is how many undecryptable messages in a row make a
+	// conversation reset its session.
+	resetAfterFailures = 3
+	// resetCooldown stops two broken ends from resetting each other in a loop.
+	resetCooldown = time.Minute
+	// maxOutbox bounds how many sent messages are kept for resend requests.
+	maxOutbox = 100
+)
+
+// NoticeSessionReset is reported to the user on both ends when a
+// conversation's session has been replaced.
+const NoticeSessionReset = "session reset"
+
+// Inbound is the outcome of handling one envelope.
+type Inbound struct {
+	// Plaintext is the message text. It is empty for control messages.
+	Plaintext string
+	// Payload is the decrypted message; nil for control messages.
+	Payload *Payload
+	// Notice is a status line for the user, such as NoticeSessionReset.
+	Notice string
+	// Receipt is set when the peer confirms messages this device sent.
+	Receipt *Receipt
+	// ExpiresAt is when a disappearing message must be removed from view.
+	ExpiresAt *time.Time
+	// Outgoing holds control messages, such as the delivery receipt for a
+	// received message, and resent messages the caller must post to the
+	// messages service.
+	Outgoing []*sendRequest
+}
+
+type failureState struct {
+	Count      int       `json:"count"`
+	MessageIDs []string  `json:"messageIds,omitempty"`
+	LastReset  time.Time `json:"lastReset,omitempty"`
+}
+
+type outboxEntry struct {
+	ConvID     string     `json:"convId"`
+	ToDeviceID string     `json:"toDeviceId"`
+	Payload    Payload    `json:"payload"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// IsSessionFailure reports whether err means the session with the peer is
+// out of step, as opposed to a malformed or replayed envelope. Such errors
+// are counted in the state, which must be saved even though handling failed.
+func IsSessionFailure(err error) bool {
+	return errors.Is(err, cryptocore.ErrDecryptionFailed) ||
+		errors.Is(err, cryptocore.ErrInvalidRemoteKey) ||
+		errors.Is(err, cryptocore.ErrNoSession) ||
+		errors.Is(err, cryptocore.ErrMissingOneTimeKey)
+}
+
+// recordFailure counts an undecryptable envelope and resets the session once
+// resetAfterFailures is reached. It returns nil until then.
+func (s *State) recordFailure(env *InboundEnvelope, messageID string) (*Inbound, error) {
+	if s.file.Failures == nil {
+		s.file.Failures = make(map[string]*failureState)
+	}
+	f := s.file.Failures[env.ConvID]
+	if f == nil {
+		f = &failureState{}
+		s.file.Failures[env.ConvID] = f
+	}
+	f.Count++
+	if messageID != "" && len(f.MessageIDs) < maxOutbox {
+		f.MessageIDs = append(f.MessageIDs, messageID)
+	}
+	if f.Count < resetAfterFailures || time.Since(f.LastReset) < resetCooldown {
+		return nil, nil
+	}
+	convID, peerID, err := envelopePeer(env)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.resetSession(convID, peerID, f.MessageIDs)
+	if err != nil {
+		return nil, err
+	}
+	f.Count, f.MessageIDs, f.LastReset = 0, nil, time.Now().UTC()
+	return out, nil
+}
+
+// ResetSession ends the conversation's session and starts a new one from a
+// fresh prekey bundle. The returned Outgoing messages tell the peer.
+func (s *State) ResetSession(convID, toID uuid.UUID) (*Inbound, error) {
+	return s.resetSession(convID, toID, nil)
+}
+
+// resetSession handshakes again with the peer and sends an end-session
+// message on the new session, followed by a resend request for resendIDs.
+func (s *State) resetSession(convID, toID uuid.UUID, resendIDs []string) (*Inbound, error) {
+	bundle, err := fetchBundle(s.file.KeysBaseURL, toID)
+	if err != nil {
+		return nil, err
+	}
+	sess, handshake, err := s.device.InitSession(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("init session: %w", err)
+	}
+	record, ok := s.sessions[convID.String()]
+	if !ok {
+		record = cryptocore.NewSessionRecord()
+		s.sessions[convID.String()] = record
+	}
+	record.SetCurrent(sess)
+	if err := record.EndOtherSessions(sess.BaseKey); err != nil {
+		return nil, err
+	}
+
+	end, err := s.seal(convID, toID, Payload{Type: ContentSessionEnd}, sess, handshake)
+	if err != nil {
+		return nil, err
+	}
+	out := &Inbound{Notice: NoticeSessionReset, Outgoing: []*sendRequest{end}}
+	if len(resendIDs) > 0 {
+		req, err := s.seal(convID, toID, Payload{Type: ContentResendRequest, Resend: resendIDs}, sess, nil)
+		if err != nil {
+			return nil, err
+		}
+		out.Outgoing = append(out.Outgoing, req)
+	}
+	return out, nil
+}
+
+// resend re-encrypts the requested messages that this device sent to the
+// requesting device in the conversation. Unknown and expired IDs are
+// skipped, and a disappearing message keeps its original expiry.
+func (s *State) resend(convID, toID uuid.UUID, ids []string) ([]*sendRequest, error) {
+	now := time.Now()
+	s.pruneOutbox(now)
+	var out []*sendRequest
+	for _, id := range ids {
+		entry := s.findOutbox(id)
+		if entry == nil || entry.ConvID != convID.String() || entry.ToDeviceID != toID.String() {
+			continue
+		}
+		req, err := s.sealPayload(convID, toID, entry.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if entry.ExpiresAt != nil {
+			req.ExpireAfterSeconds = int64((entry.ExpiresAt.Sub(now) + time.Second - 1) / time.Second)
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+func (s *State) remember(entry outboxEntry) {
+	s.pruneOutbox(time.Now())
+	s.file.Outbox = append(s.file.Outbox, entry)
+	if len(s.file.Outbox) > maxOutbox {
+		s.file.Outbox = s.file.Outbox[len(s.file.Outbox)-maxOutbox:]
+	}
+}
+
+func (s *State) findOutbox(id string) *outboxEntry {
+	for i := range s.file.Outbox {
+		if s.file.Outbox[i].Payload.ID == id {
+			return &s.file.Outbox[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package msgclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	cryptocore "cryptocore"
+)
+
+// peers is two devices sharing a conversation, with a keys service that
+// serves fresh prekey bundles for both.
+type peers struct {
+	alice, bob *State
+	conv       uuid.UUID
+}
+
+func newPeers(t *testing.T) *peers {
+	t.Helper()
+	devices := map[string]*State{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := devices[r.URL.Query().Get("device_id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		bundle, err := st.device.PublishPQPrekeyBundle(1, 1)
+		if err != nil {
+			t.Errorf("publish bundle: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var resp preKeyBundleResponse
+		resp.DeviceID = st.file.DeviceID
+		resp.IdentityKey = base64.StdEncoding.EncodeToString(bundle.IdentityKey[:])
+		resp.IdentitySignatureKey = base64.StdEncoding.EncodeToString(bundle.IdentitySignatureKey)
+		resp.SignedPreKey.PublicKey = base64.StdEncoding.EncodeToString(bundle.SignedPrekey[:])
+		resp.SignedPreKey.Signature = base64.StdEncoding.EncodeToString(bundle.SignedPrekeySig)
+		kem := kemPreKeyToPayload(*bundle.KEMPrekey)
+		resp.KEMPreKey = &kem
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	newState := func() *State {
+		dev, err := cryptocore.GenerateIdentityKeypair()
+		if err != nil {
+			t.Fatalf("generate device: %v", err)
+		}
+		st := &State{
+			file:     stateFile{DeviceID: uuid.NewString(), KeysBaseURL: srv.URL},
+			device:   dev,
+			sessions: make(map[string]*cryptocore.SessionRecord),
+		}
+		devices[st.file.DeviceID] = st
+		return st
+	}
+	return &peers{alice: newState(), bob: newState(), conv: uuid.New()}
+}
+
+func deviceUUID(t *testing.T, s *State) uuid.UUID {
+	t.Helper()
+	id, err := uuid.Parse(s.DeviceID())
+	if err != nil {
+		t.Fatalf("device id: %v", err)
+	}
+	return id
+}
+
+// send encrypts text from one peer to the other.
+func (p *peers) send(t *testing.T, from, to *State, text string) *sendRequest {
+	t.Helper()
+	req, err := from.PrepareSend(p.conv, deviceUUID(t, to), text)
+	if err != nil {
+		t.Fatalf("prepare send: %v", err)
+	}
+	return req
+}
+
+// deliver hands req to its recipient the way the messages service would.
+func deliver(to *State, req *sendRequest) (*Inbound, error) {
+	return to.HandleEnvelope(&InboundEnvelope{
+		ID:           uuid.NewString(),
+		ConvID:       req.ConvID,
+		FromDeviceID: req.FromDeviceID,
+		ToDeviceID:   req.ToDeviceID,
+		Ciphertext:   req.Ciphertext,
+		Header:       req.Header,
+	})
+}
+
+func TestSessionResetRecoversLostSession(t *testing.T) {
+	p := newPeers(t)
+	if in, err := deliver(p.bob, p.send(t, p.alice, p.bob, "hello")); err != nil || in.Plaintext != "hello" {
+		t.Fatalf("expected the first message to arrive, got %+v (%v)", in, err)
+	}
+
+	// Bob loses his session, e.g. by restoring an old state file.
+	p.bob.sessions = make(map[string]*cryptocore.SessionRecord)
+
+	lost := []string{"one", "two", "three"}
+	var reset *Inbound
+	for i, text := range lost {
+		in, err := deliver(p.bob, p.send(t, p.alice, p.bob, text))
+		if !IsSessionFailure(err) {
+			t.Fatalf("message %d: expected a session failure, got %v", i, err)
+		}
+		if i < resetAfterFailures-1 {
+			if in != nil {
+				t.Fatalf("message %d: expected no reset before %d failures", i, resetAfterFailures)
+			}
+			continue
+		}
+		reset = in
+	}
+	if reset == nil || reset.Notice != NoticeSessionReset || len(reset.Outgoing) != 2 {
+		t.Fatalf("expected a reset with end-session and resend request, got %+v", reset)
+	}
+	if f := p.bob.file.Failures[p.conv.String()]; f != nil && f.Count != 0 {
+		t.Fatalf("expected the failure count to restart after the reset")
+	}
+
+	// Alice accepts the new session and resends what bob missed.
+	in, err := deliver(p.alice, reset.Outgoing[0])
+	if err != nil || in.Notice != NoticeSessionReset {
+		t.Fatalf("expected alice to see the reset, got %+v (%v)", in, err)
+	}
+	in, err = deliver(p.alice, reset.Outgoing[1])
+	if err != nil {
+		t.Fatalf("resend request: %v", err)
+	}
+	if len(in.Outgoing) != len(lost) {
+		t.Fatalf("expected %d resent messages, got %d", len(lost), len(in.Outgoing))
+	}
+	for i, req := range in.Outgoing {
+		got, err := deliver(p.bob, req)
+		if err != nil {
+			t.Fatalf("resent message %d: %v", i, err)
+		}
+		if got.Plaintext != lost[i] {
+			t.Fatalf("resent message %d: expected %q, got %q", i, lost[i], got.Plaintext)
+		}
+	}
+
+	// Messaging works both ways on the new session.
+	if in, err := deliver(p.bob, p.send(t, p.alice, p.bob, "after")); err != nil || in.Plaintext != "after" {
+		t.Fatalf("expected alice's next message to arrive, got %+v (%v)", in, err)
+	}
+	if in, err := deliver(p.alice, p.send(t, p.bob, p.alice, "reply")); err != nil || in.Plaintext != "reply" {
+		t.Fatalf("expected bob's reply to arrive, got %+v (%v)", in, err)
+	}
+
+	for _, st := range []*State{p.alice, p.bob} {
+		data, err := st.Marshal()
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if _, err := LoadStateFromJSON(data); err != nil {
+			t.Fatalf("reload state: %v", err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package health serves the readiness probe. /healthz only says the process
+// is up; /readyz also checks the service's dependencies and fails as soon as
+// shutdown begins, so load balancers stop routing here before the listener
+// closes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Check reports whether one dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Readiness struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func New() *Readiness {
+	return &Readiness{timeout: 2 * time.Second}
+}
+
+// Add registers a dependency check. Call it before serving.
+func (r *Readiness) Add(name string, check Check) {
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes every later probe fail.
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.draining.Load() {
+		writeReport(w, http.StatusServiceUnavailable, report{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	defer cancel()
+	results := make([]error, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	rep := report{Status: "ready", Checks: make(map[string]string, len(r.checks))}
+	status := http.StatusOK
+	for i, c := range r.checks {
+		if results[i] != nil {
+			rep.Checks[c.name] = results[i].Error()
+			rep.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		rep.Checks[c.name] = "ok"
+	}
+	writeReport(w, status, rep)
+}
+
+func writeReport(w http.ResponseWriter, status int, rep report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
+// DB pings the database behind db.
+func DB(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// HTTP expects url to answer without a server error.
+func HTTP(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func probe(t *testing.T, r *Readiness) (int, report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var rep report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return rec.Code, rep
+}
+
+func TestReadinessReportsFailedChecksAndDrain(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	dbErr := errors.New("connection refused")
+	var dbDown bool
+	r := New()
+	r.Add("db", func(context.Context) error {
+		if dbDown {
+			return dbErr
+		}
+		return nil
+	})
+	r.Add("auth", HTTP(upstream.URL+"/healthz"))
+
+	code, rep := probe(t, r)
+	if code != http.StatusOK || rep.Status != "ready" || rep.Checks["db"] != "ok" || rep.Checks["auth"] != "ok" {
+		t.Fatalf("healthy probe = %d %+v", code, rep)
+	}
+
+	dbDown = true
+	code, rep = probe(t, r)
+	if code != http.StatusServiceUnavailable || rep.Status != "unavailable" || rep.Checks["db"] != dbErr.Error() || rep.Checks["auth"] != "ok" {
+		t.Fatalf("db down probe = %d %+v", code, rep)
+	}
+
+	dbDown = false
+	r.Drain()
+	code, rep = probe(t, r)
+	if code != http.StatusServiceUnavailable || rep.Status != "draining" {
+		t.Fatalf("draining probe = %d %+v", code, rep)
+	}
+}
+
+func TestHTTPCheckFailsOnServerError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	if err := HTTP(upstream.URL)(context.Background()); err == nil {
+		t.Fatal("expected an error for a 502")
+	}
+	upstream.Close()
+	if err := HTTP(upstream.URL)(context.Background()); err == nil {
+		t.Fatal("expected an error for an unreachable upstream")
+	}
+}
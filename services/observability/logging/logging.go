@@ -0,0 +1,97 @@
+// Package logging builds the JSON slog logger every service uses. It
+// redacts credentials before they reach the log stream: attributes named
+// like tokens, passwords, secrets or keys, and bearer tokens, JWTs or token
+// fields embedded in any other string.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+type Config struct {
+	ServiceName string
+	Environment string
+	Level       string
+	// Output defaults to stdout.
+	Output io.Writer
+}
+
+func NewLogger(cfg Config) *slog.Logger {
+	level := new(slog.LevelVar)
+
+	switch cfg.Level {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	default:
+		level.Set(slog.LevelInfo)
+	}
+
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+
+	return slog.New(handler).With(
+		slog.String("service", cfg.ServiceName),
+		slog.String("env", cfg.Environment),
+	)
+}
+
+var (
+	// sensitiveKeys are attribute names, or suffixes after "_", whose string
+	// values are always dropped.
+	sensitiveKeys = []string{"token", "password", "secret", "authorization", "cookie", "private_key", "signing_key", "identity_key"}
+
+	bearerRE  = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	jwtRE     = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	jsonKeyRE = regexp.MustCompile(`(?i)("(?:[a-z_]*token|password|secret)"\s*:\s*)"[^"]*"`)
+)
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if sensitiveKey(a.Key) {
+			return slog.String(a.Key, Redacted)
+		}
+		if s := scrub(a.Value.String()); s != a.Value.String() {
+			return slog.String(a.Key, s)
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			if s := scrub(err.Error()); s != err.Error() {
+				return slog.String(a.Key, s)
+			}
+		}
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+func scrub(s string) string {
+	s = bearerRE.ReplaceAllString(s, "Bearer "+Redacted)
+	s = jwtRE.ReplaceAllString(s, Redacted)
+	return jsonKeyRE.ReplaceAllString(s, `$1"`+Redacted+`"`)
+}
@@ -0,0 +1,37 @@
+// Package metrics holds the HTTP metrics every service exposes and the one
+// registration hook services call at startup.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests.",
+		},
+		[]string{"method", "route", "status"},
+	)
+
+	HTTPRequestDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "route"},
+	)
+)
+
+// MustRegister registers the HTTP metrics and the service's own collectors
+// with the default registry. Every series gets constant service and
+// environment labels, so collectors must not declare those themselves.
+func MustRegister(service, environment string, collectors ...prometheus.Collector) {
+	MustRegisterWith(prometheus.DefaultRegisterer, service, environment, collectors...)
+}
+
+// MustRegisterWith is MustRegister for another registry, e.g. in tests.
+func MustRegisterWith(reg prometheus.Registerer, service, environment string, collectors ...prometheus.Collector) {
+	reg = prometheus.WrapRegistererWith(prometheus.Labels{"service": service, "environment": environment}, reg)
+	reg.MustRegister(append([]prometheus.Collector{HTTPRequestsTotal, HTTPRequestDurationSeconds}, collectors...)...)
+}
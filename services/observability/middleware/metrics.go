@@ -8,7 +8,7 @@ import (
 	"strconv"
 	"time"
 
-	"gateway/internal/observability/metrics"
+	"observability/metrics"
 )
 
 type statusRecorder struct {
@@ -21,7 +21,7 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
-// Preserve hijacking support (needed for websocket proxying).
+// Preserve hijacking support (needed for websockets).
 func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := r.ResponseWriter.(http.Hijacker); ok {
 		return hj.Hijack()
@@ -29,6 +29,7 @@ func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, http.ErrNotSupported
 }
 
+// WithMetrics counts and times requests by route template, not raw path.
 func WithMetrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/metrics" {
@@ -38,20 +39,21 @@ func WithMetrics(next http.Handler) http.Handler {
 
 		start := time.Now()
 		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r, holder := withRoute(r)
 
 		next.ServeHTTP(sr, r)
 
 		duration := time.Since(start).Seconds()
-		path := r.URL.Path
+		rt := route(r, holder)
 		method := r.Method
 		statusStr := strconv.Itoa(sr.status)
 
-		metrics.HTTPRequestsTotal.WithLabelValues(method, path, statusStr).Inc()
-		metrics.HTTPRequestDurationSeconds.WithLabelValues(method, path).Observe(duration)
+		metrics.HTTPRequestsTotal.WithLabelValues(method, rt, statusStr).Inc()
+		metrics.HTTPRequestDurationSeconds.WithLabelValues(method, rt).Observe(duration)
 
 		slog.Default().Debug("request metrics updated",
 			"method", method,
-			"path", path,
+			"route", rt,
 			"status", sr.status,
 			"duration_seconds", duration,
 		)
@@ -0,0 +1,46 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"observability/metrics"
+	obsmw "observability/middleware"
+)
+
+func TestMetricsAreLabelledByRouteTemplate(t *testing.T) {
+	metrics.MustRegisterWith(prometheus.NewRegistry(), "test", "test")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/messages/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	// A router that does not set Request.Pattern reports its own template.
+	mux.Handle("/chi/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		obsmw.SetRoute(r, "/chi/{id}")
+	}))
+	h := obsmw.WithRequestAndTrace(obsmw.WithMetrics(mux))
+
+	for _, path := range []string{"/v1/messages/a", "/v1/messages/b", "/chi/x", "/nope/1", "/nope/2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	for _, c := range []struct {
+		route, status string
+		want          float64
+	}{
+		{"/v1/messages/{id}", "200", 2},
+		{"/chi/{id}", "200", 1},
+		{obsmw.Unmatched, "404", 2},
+	} {
+		got := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(http.MethodGet, c.route, c.status))
+		if got != c.want {
+			t.Errorf("requests for route %q = %v, want %v", c.route, got, c.want)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequestsTotal); n != 3 {
+		t.Errorf("series = %d, want 3: raw paths must not become labels", n)
+	}
+}
@@ -8,13 +8,15 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ctxKey string
 
 const (
 	CtxKeyRequestID ctxKey = "request_id"
-	CtxKeyTraceID   ctxKey = "trace_id"
 )
 
 func generateID() string {
@@ -26,20 +28,18 @@ func generateID() string {
 	return strconv.FormatInt(time.Now().UnixNano(), 36)
 }
 
+// WithRequestAndTrace starts a server span, continuing the trace from an
+// incoming traceparent header, and assigns the request an X-Request-ID.
 func WithRequestAndTrace(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	withIDs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reqID := r.Header.Get("X-Request-ID")
 		if reqID == "" {
 			reqID = generateID()
 		}
 
-		traceID := r.Header.Get("X-Trace-ID")
-		if traceID == "" {
-			traceID = generateID()
-		}
-
+		r, holder := withRoute(r)
 		ctx := context.WithValue(r.Context(), CtxKeyRequestID, reqID)
-		ctx = context.WithValue(ctx, CtxKeyTraceID, traceID)
+		traceID := TraceIDFromContext(ctx)
 
 		r = r.WithContext(ctx)
 
@@ -52,6 +52,10 @@ func WithRequestAndTrace(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 
+		if rt := route(r, holder); rt != Unmatched {
+			trace.SpanFromContext(ctx).SetName(r.Method + " " + rt)
+		}
+
 		slog.Default().Info("finished request",
 			"request_id", reqID,
 			"trace_id", traceID,
@@ -59,6 +63,16 @@ func WithRequestAndTrace(next http.Handler) http.Handler {
 			"path", r.URL.Path,
 		)
 	})
+	return otelhttp.NewHandler(withIDs, "http.server", otelhttp.WithFilter(traced))
+}
+
+// traced leaves probes and scrapes out of traces.
+func traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
 }
 
 func RequestIDFromContext(ctx context.Context) string {
@@ -68,9 +82,11 @@ func RequestIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// TraceIDFromContext returns the ID of the trace ctx belongs to, or "" when
+// it carries no span.
 func TraceIDFromContext(ctx context.Context) string {
-	if v, ok := ctx.Value(CtxKeyTraceID).(string); ok {
-		return v
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
 	}
 	return ""
 }
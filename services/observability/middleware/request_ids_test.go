@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	obsmw "observability/middleware"
+)
+
+func TestTraceparentIsContinuedUpstream(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer func() { _ = tp.Shutdown(t.Context()) }()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var upstreamParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	var seen string
+	h := obsmw.WithRequestAndTrace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = obsmw.TraceIDFromContext(r.Context())
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL+"/v1/thing", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/thing", nil)
+	req.Header.Set("traceparent", incoming)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if seen != traceID {
+		t.Fatalf("trace id in handler = %q, want %q", seen, traceID)
+	}
+	parts := strings.Split(upstreamParent, "-")
+	if len(parts) != 4 || parts[1] != traceID {
+		t.Fatalf("upstream traceparent = %q, want trace %s", upstreamParent, traceID)
+	}
+	if parts[2] == "00f067aa0ba902b7" {
+		t.Fatal("upstream should see the service's span as parent, not the caller's")
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Unmatched is the route label for requests no route matched, e.g. 404s.
+// Raw paths are never used as labels since they are unbounded.
+const Unmatched = "unmatched"
+
+type routeKey struct{}
+
+type routeHolder struct {
+	pattern string
+}
+
+// withRoute makes sure r carries a holder SetRoute can fill in.
+func withRoute(r *http.Request) (*http.Request, *routeHolder) {
+	if h, ok := r.Context().Value(routeKey{}).(*routeHolder); ok {
+		return r, h
+	}
+	h := &routeHolder{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, h)), h
+}
+
+// SetRoute records the route template that matched r, for routers that do
+// not set http.Request.Pattern (chi, for one). Call it from inside the router
+// once routing is done.
+func SetRoute(r *http.Request, pattern string) {
+	if h, ok := r.Context().Value(routeKey{}).(*routeHolder); ok && pattern != "" {
+		h.pattern = pattern
+	}
+}
+
+// route returns the template of the route that handled r. ServeMux records
+// the matched pattern on the request it was given, which only the innermost
+// wrapper holds, so that wrapper copies it into the shared holder. The
+// method is dropped from "GET /path" patterns since it is a label of its own.
+func route(r *http.Request, h *routeHolder) string {
+	if h.pattern == "" {
+		_, path, found := strings.Cut(r.Pattern, " ")
+		if !found {
+			path = r.Pattern
+		}
+		h.pattern = path
+	}
+	if h.pattern == "" {
+		return Unmatched
+	}
+	return h.pattern
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "otel:span"
+
+type gormSpan struct {
+	span   trace.Span
+	parent context.Context
+}
+
+// InstrumentGORM records a span for every statement db runs, as a child of
+// the span in the statement's context (set with db.WithContext). Only the
+// parameterised SQL is recorded, never the bound values.
+func InstrumentGORM(db *gorm.DB) error {
+	tracer := otel.Tracer("gorm.io/gorm")
+	before := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			parent := tx.Statement.Context
+			if parent == nil {
+				parent = context.Background()
+			}
+			ctx, span := tracer.Start(parent, "gorm."+op,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(op)),
+			)
+			tx.Statement.Context = ctx
+			tx.InstanceSet(gormSpanKey, gormSpan{span: span, parent: parent})
+		}
+	}
+	after := func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(gormSpanKey)
+		if !ok {
+			return
+		}
+		s := v.(gormSpan)
+		tx.Statement.Context = s.parent
+		if tx.Statement.Table != "" {
+			s.span.SetAttributes(semconv.DBCollectionName(tx.Statement.Table))
+		}
+		if sql := tx.Statement.SQL.String(); sql != "" {
+			s.span.SetAttributes(semconv.DBQueryText(sql))
+		}
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			s.span.RecordError(tx.Error)
+			s.span.SetStatus(codes.Error, tx.Error.Error())
+		}
+		s.span.End()
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("otel:before_create", before("create")),
+		cb.Create().After("gorm:create").Register("otel:after_create", after),
+		cb.Query().Before("gorm:query").Register("otel:before_query", before("query")),
+		cb.Query().After("gorm:query").Register("otel:after_query", after),
+		cb.Update().Before("gorm:update").Register("otel:before_update", before("update")),
+		cb.Update().After("gorm:update").Register("otel:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("otel:before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("otel:after_delete", after),
+		cb.Row().Before("gorm:row").Register("otel:before_row", before("row")),
+		cb.Row().After("gorm:row").Register("otel:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("otel:before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("otel:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
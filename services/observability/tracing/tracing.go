@@ -0,0 +1,70 @@
+// Package tracing sets up OpenTelemetry tracing with W3C traceparent
+// propagation.
+//
+// The exporter is picked with OTEL_TRACES_EXPORTER: "otlp" (OTLP over HTTP,
+// configured with the standard OTEL_EXPORTER_OTLP_* variables), "stdout" or
+// "none". When unset, OTLP is used if an OTLP endpoint is configured and
+// nothing is exported otherwise. Spans are still created without an
+// exporter, so trace IDs reach logs and downstream services either way.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// Setup installs the global tracer provider and propagator. The returned
+// func flushes pending spans and must run before exit.
+func Setup(ctx context.Context, service, environment string) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.DeploymentEnvironmentNameKey.String(environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")))
+	if kind == "" {
+		kind = "none"
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+			kind = "otlp"
+		}
+	}
+	switch kind {
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	case "stdout", "console":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("tracing: unknown OTEL_TRACES_EXPORTER %q", kind)
+	}
+}